@@ -31,6 +31,8 @@ export function decrypt(encryptedStr: string): string {
   return decipher.update(data).toString('utf8') + decipher.final('utf8');
 }
 
+const ROTATION_MODES = ['none', 'sticky', 'per_request'];
+
 function stripPassword(row: any) {
   const { auth_pass_enc, ...rest } = row;
   return { ...rest, has_password: !!auth_pass_enc };
@@ -39,13 +41,20 @@ function stripPassword(row: any) {
 // POST /api/v1/proxies
 proxiesRouter.post('/', async (req: Request, res: Response, next: NextFunction) => {
   try {
-    const { provider_id, label, host, port, protocol, auth_user, auth_pass, expected_country, expected_city, is_dedicated } = req.body;
+    const { provider_id, label, host, port, protocol, auth_user, auth_pass, expected_country, expected_city, is_dedicated, rotation_mode, sticky_minutes, session_format } = req.body;
 
     if (!provider_id || !label || !host || !port) {
       logger.warn({ module: 'routes.proxies', validation_errors: ['provider_id, label, host, port are required'] }, 'Validation error');
       return res.status(400).json({ error: { message: 'provider_id, label, host, port are required' } });
     }
 
+    if (rotation_mode !== undefined && !ROTATION_MODES.includes(rotation_mode)) {
+      return res.status(400).json({ error: { message: 'rotation_mode must be none, sticky or per_request' } });
+    }
+    if (rotation_mode === 'sticky' && !auth_user) {
+      return res.status(400).json({ error: { message: 'sticky rotation needs auth_user to carry the session' } });
+    }
+
     const portNum = parseInt(port, 10);
     if (isNaN(portNum) || portNum < 1 || portNum > 65535) {
       return res.status(400).json({ error: { message: 'port must be between 1 and 65535' } });
@@ -63,10 +72,10 @@ proxiesRouter.post('/', async (req: Request, res: Response, next: NextFunction)
     }
 
     const result = await pool.query(
-      `INSERT INTO proxy_endpoint (provider_id, label, host, port, protocol, auth_user, auth_pass_enc, expected_country, expected_city, is_dedicated)
-       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+      `INSERT INTO proxy_endpoint (provider_id, label, host, port, protocol, auth_user, auth_pass_enc, expected_country, expected_city, is_dedicated, rotation_mode, sticky_minutes, session_format)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
        RETURNING *`,
-      [provider_id, label, host, portNum, protocol || 'http', auth_user || null, authPassEnc, expected_country || null, expected_city || null, is_dedicated || false],
+      [provider_id, label, host, portNum, protocol || 'http', auth_user || null, authPassEnc, expected_country || null, expected_city || null, is_dedicated || false, rotation_mode || 'none', sticky_minutes || null, session_format || null],
     );
 
     res.status(201).json({ data: stripPassword(result.rows[0]) });
@@ -139,7 +148,11 @@ proxiesRouter.get('/:id', async (req: Request, res: Response, next: NextFunction
 // PUT /api/v1/proxies/:id
 proxiesRouter.put('/:id', async (req: Request, res: Response, next: NextFunction) => {
   try {
-    const { label, host, port, protocol, auth_user, auth_pass, expected_country, expected_city, is_dedicated } = req.body;
+    const { label, host, port, protocol, auth_user, auth_pass, expected_country, expected_city, is_dedicated, rotation_mode, sticky_minutes, session_format } = req.body;
+
+    if (rotation_mode !== undefined && !ROTATION_MODES.includes(rotation_mode)) {
+      return res.status(400).json({ error: { message: 'rotation_mode must be none, sticky or per_request' } });
+    }
     const fields: string[] = [];
     const values: any[] = [];
     let idx = 1;
@@ -157,6 +170,9 @@ proxiesRouter.put('/:id', async (req: Request, res: Response, next: NextFunction
     if (expected_country !== undefined) { fields.push(`expected_country = $${idx++}`); values.push(expected_country); }
     if (expected_city !== undefined) { fields.push(`expected_city = $${idx++}`); values.push(expected_city); }
     if (is_dedicated !== undefined) { fields.push(`is_dedicated = $${idx++}`); values.push(is_dedicated); }
+    if (rotation_mode !== undefined) { fields.push(`rotation_mode = $${idx++}`); values.push(rotation_mode); }
+    if (sticky_minutes !== undefined) { fields.push(`sticky_minutes = $${idx++}`); values.push(sticky_minutes); }
+    if (session_format !== undefined) { fields.push(`session_format = $${idx++}`); values.push(session_format); }
 
     if (fields.length === 0) {
       return res.status(400).json({ error: { message: 'No fields to update' } });
@@ -18,6 +18,10 @@ runsRouter.post('/', async (req: Request, res: Response, next: NextFunction) =>
       request_timeout_ms = 10000,
       warmup_requests = 5,
       summary_interval_sec = 30,
+      ip_family = 'auto',
+      duration_sec = null,
+      target_samples = null,
+      load_profile = null,
     } = req.body;
 
     if (!proxy_id) {
@@ -25,19 +29,50 @@ runsRouter.post('/', async (req: Request, res: Response, next: NextFunction) =>
       return res.status(400).json({ error: { message: 'proxy_id is required' } });
     }
 
+    if (!['auto', 'ipv4', 'ipv6'].includes(ip_family)) {
+      logger.warn({ module: 'routes.runs', validation_errors: ['ip_family must be auto, ipv4 or ipv6'] }, 'Validation error');
+      return res.status(400).json({ error: { message: 'ip_family must be auto, ipv4 or ipv6' } });
+    }
+
+    if (!['continuous', 'fixed'].includes(run_mode)) {
+      logger.warn({ module: 'routes.runs', validation_errors: ['run_mode must be continuous or fixed'] }, 'Validation error');
+      return res.status(400).json({ error: { message: 'run_mode must be continuous or fixed' } });
+    }
+
+    const isPositiveInt = (v: unknown) => v === null || (Number.isInteger(v) && (v as number) > 0);
+    if (!isPositiveInt(duration_sec) || !isPositiveInt(target_samples)
+      || (run_mode === 'fixed' && duration_sec === null && target_samples === null)
+      || (run_mode === 'continuous' && (duration_sec !== null || target_samples !== null))) {
+      const message = 'fixed runs need a positive duration_sec or target_samples; continuous runs take neither';
+      logger.warn({ module: 'routes.runs', validation_errors: [message] }, 'Validation error');
+      return res.status(400).json({ error: { message } });
+    }
+
+    if (load_profile !== null) {
+      const isNonNegative = (v: unknown) => v === undefined || (typeof v === 'number' && v >= 0);
+      const valid = typeof load_profile === 'object'
+        && ['ramp', 'step', 'spike', 'sine'].includes(load_profile.type)
+        && ['base_pct', 'peak_pct', 'duration_sec', 'steps', 'period_sec'].every((k) => isNonNegative(load_profile[k]));
+      if (!valid) {
+        const message = 'load_profile type must be ramp, step, spike or sine, with no negative values';
+        logger.warn({ module: 'routes.runs', validation_errors: [message] }, 'Validation error');
+        return res.status(400).json({ error: { message } });
+      }
+    }
+
     // Verify proxy exists
     const proxyResult = await pool.query('SELECT id FROM proxy_endpoint WHERE id = $1', [proxy_id]);
     if (proxyResult.rows.length === 0) {
       return res.status(400).json({ error: { message: 'Proxy not found' } });
     }
 
-    const configSnapshot = { http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec };
+    const configSnapshot = { http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec, ip_family, duration_sec, target_samples, load_profile };
 
     const result = await pool.query(
-      `INSERT INTO test_run (proxy_id, run_mode, http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec, config_snapshot)
-       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+      `INSERT INTO test_run (proxy_id, run_mode, http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec, ip_family, duration_sec, target_samples, load_profile, config_snapshot)
+       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
        RETURNING *`,
-      [proxy_id, run_mode, http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec, JSON.stringify(configSnapshot)],
+      [proxy_id, run_mode, http_rpm, https_rpm, ws_messages_per_minute, request_timeout_ms, warmup_requests, summary_interval_sec, ip_family, duration_sec, target_samples, load_profile && JSON.stringify(load_profile), JSON.stringify(configSnapshot)],
     );
 
     const run = result.rows[0];
@@ -58,13 +93,13 @@ runsRouter.post('/', async (req: Request, res: Response, next: NextFunction) =>
 // POST /api/v1/runs/start — Trigger runner for pending runs
 runsRouter.post('/start', async (req: Request, res: Response, next: NextFunction) => {
   try {
-    const { run_ids, scoring_config } = req.body;
+    const { run_ids, scoring_config, incident_config } = req.body;
 
     if (!run_ids || !Array.isArray(run_ids) || run_ids.length === 0) {
       return res.status(400).json({ error: { message: 'run_ids array is required' } });
     }
 
-    const result = await triggerRunner(run_ids, scoring_config);
+    const result = await triggerRunner(run_ids, scoring_config, incident_config);
     res.json({ data: result });
   } catch (err) {
     next(err);
@@ -237,18 +272,23 @@ runsRouter.post('/:id/http-samples/batch', async (req: Request, res: Response, n
     let idx = 1;
 
     for (const s of samples) {
-      placeholders.push(`($${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++})`);
-      values.push(
+      const row = [
         runId, s.seq, s.is_warmup ?? false, s.target_url, s.method ?? 'GET',
         s.is_https ?? false, s.status_code ?? null, s.error_type ?? null, s.error_message ?? null,
-        s.tcp_connect_ms ?? null, s.tls_handshake_ms ?? null, s.ttfb_ms ?? null, s.total_ms ?? null,
+        s.tcp_connect_ms ?? null, s.socks_handshake_ms ?? null, s.tls_handshake_ms ?? null, s.ttfb_ms ?? null, s.total_ms ?? null,
         s.tls_version ?? null, s.tls_cipher ?? null,
-        s.bytes_sent ?? 0, s.bytes_received ?? 0,
-      );
+        s.proxy_tls_handshake_ms ?? null, s.proxy_tls_version ?? null, s.proxy_tls_cipher ?? null,
+        s.proxy_auth_scheme ?? null, s.proxy_auth_round_trips ?? 0, s.proxy_auth_ms ?? null, s.observed_ip_family ?? null,
+        s.negotiated_protocol ?? null, s.h2_streams || null, s.h2_stream_avg_ms ?? null, s.h2_stream_max_ms ?? null, s.h2_stream_resets ?? 0,
+        s.bytes_sent ?? 0, s.bytes_received ?? 0, s.target_rpm || null,
+        s.hop_timings?.length ? JSON.stringify(s.hop_timings) : null,
+      ];
+      placeholders.push(`(${row.map(() => `$${idx++}`).join(', ')})`);
+      values.push(...row);
     }
 
     await pool.query(
-      `INSERT INTO http_sample (run_id, seq, is_warmup, target_url, method, is_https, status_code, error_type, error_message, tcp_connect_ms, tls_handshake_ms, ttfb_ms, total_ms, tls_version, tls_cipher, bytes_sent, bytes_received)
+      `INSERT INTO http_sample (run_id, seq, is_warmup, target_url, method, is_https, status_code, error_type, error_message, tcp_connect_ms, socks_handshake_ms, tls_handshake_ms, ttfb_ms, total_ms, tls_version, tls_cipher, proxy_tls_handshake_ms, proxy_tls_version, proxy_tls_cipher, proxy_auth_scheme, proxy_auth_round_trips, proxy_auth_ms, observed_ip_family, negotiated_protocol, h2_streams, h2_stream_avg_ms, h2_stream_max_ms, h2_stream_resets, bytes_sent, bytes_received, target_rpm, hop_timings)
        VALUES ${placeholders.join(', ')}`,
       values,
     );
@@ -281,19 +321,23 @@ runsRouter.post('/:id/ws-samples/batch', async (req: Request, res: Response, nex
     let idx = 1;
 
     for (const s of samples) {
-      placeholders.push(`($${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++})`);
-      values.push(
+      const row = [
         runId, s.seq ?? 0, s.is_warmup ?? false, s.target_url ?? '',
         s.connected ?? false, s.error_type ?? null, s.error_message ?? null,
-        s.tcp_connect_ms ?? null, s.tls_handshake_ms ?? null, s.handshake_ms ?? null,
+        s.tcp_connect_ms ?? null, s.socks_handshake_ms ?? null, s.tls_handshake_ms ?? null, s.handshake_ms ?? null,
+        s.proxy_tls_handshake_ms ?? null, s.proxy_tls_version ?? null, s.proxy_tls_cipher ?? null,
+        s.proxy_auth_scheme ?? null, s.proxy_auth_round_trips ?? 0, s.proxy_auth_ms ?? null, s.observed_ip_family ?? null,
         s.message_rtt_ms ?? null, s.connection_held_ms ?? null, s.disconnect_reason ?? null,
         s.messages_sent ?? 0, s.messages_received ?? 0, s.drop_count ?? 0,
+        s.hop_timings?.length ? JSON.stringify(s.hop_timings) : null,
         s.measured_at ?? new Date().toISOString(),
-      );
+      ];
+      placeholders.push(`(${row.map(() => `$${idx++}`).join(', ')})`);
+      values.push(...row);
     }
 
     await pool.query(
-      `INSERT INTO ws_sample (run_id, seq, is_warmup, target_url, connected, error_type, error_message, tcp_connect_ms, tls_handshake_ms, handshake_ms, message_rtt_ms, connection_held_ms, disconnect_reason, messages_sent, messages_received, drop_count, measured_at)
+      `INSERT INTO ws_sample (run_id, seq, is_warmup, target_url, connected, error_type, error_message, tcp_connect_ms, socks_handshake_ms, tls_handshake_ms, handshake_ms, proxy_tls_handshake_ms, proxy_tls_version, proxy_tls_cipher, proxy_auth_scheme, proxy_auth_round_trips, proxy_auth_ms, observed_ip_family, message_rtt_ms, connection_held_ms, disconnect_reason, messages_sent, messages_received, drop_count, hop_timings, measured_at)
        VALUES ${placeholders.join(', ')}`,
       values,
     );
@@ -311,6 +355,57 @@ runsRouter.post('/:id/ws-samples/batch', async (req: Request, res: Response, nex
   }
 });
 
+// POST /api/v1/runs/:id/udp-samples/batch — Batch insert UDP samples
+runsRouter.post('/:id/udp-samples/batch', async (req: Request, res: Response, next: NextFunction) => {
+  try {
+    const { samples } = req.body;
+
+    if (!samples || !Array.isArray(samples) || samples.length === 0) {
+      logger.error({ module: 'routes.runs', run_id: req.params.id, first_error: 'samples array is required' }, 'UDP batch validation fail');
+      return res.status(400).json({ error: { message: 'samples array is required' } });
+    }
+
+    if (samples.length > 100) {
+      return res.status(400).json({ error: { message: 'Maximum 100 samples per batch' } });
+    }
+
+    const runId = req.params.id;
+
+    const values: any[] = [];
+    const placeholders: string[] = [];
+    let idx = 1;
+
+    for (const s of samples) {
+      placeholders.push(`($${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++}, $${idx++})`);
+      values.push(
+        runId, s.seq ?? 0, s.is_warmup ?? false, s.target_addr ?? '',
+        s.associated ?? false, s.error_type ?? null, s.error_message ?? null,
+        s.tcp_connect_ms ?? null, s.socks_handshake_ms ?? null,
+        s.packets_sent ?? 0, s.packets_received ?? 0, s.lost_count ?? 0, s.reordered_count ?? 0, s.duplicate_count ?? 0,
+        s.rtt_avg_ms ?? null, s.rtt_min_ms ?? null, s.rtt_max_ms ?? null, s.jitter_ms ?? null,
+        s.measured_at ?? new Date().toISOString(),
+      );
+    }
+
+    await pool.query(
+      `INSERT INTO udp_sample (run_id, seq, is_warmup, target_addr, associated, error_type, error_message, tcp_connect_ms, socks_handshake_ms, packets_sent, packets_received, lost_count, reordered_count, duplicate_count, rtt_avg_ms, rtt_min_ms, rtt_max_ms, jitter_ms, measured_at)
+       VALUES ${placeholders.join(', ')}`,
+      values,
+    );
+
+    // Update total_udp_samples counter
+    await pool.query(
+      `UPDATE test_run SET total_udp_samples = total_udp_samples + $2 WHERE id = $1`,
+      [runId, samples.length],
+    );
+
+    logger.info({ module: 'routes.runs', run_id: runId, table: 'udp_sample', count: samples.length }, 'UDP batch ingestion');
+    res.status(201).json({ inserted: samples.length });
+  } catch (err) {
+    next(err);
+  }
+});
+
 // POST /api/v1/runs/:id/ip-checks — Insert IP check result
 runsRouter.post('/:id/ip-checks', async (req: Request, res: Response, next: NextFunction) => {
   try {
@@ -349,6 +444,49 @@ runsRouter.post('/:id/ip-checks', async (req: Request, res: Response, next: Next
   }
 });
 
+// POST /api/v1/runs/:id/incidents — Upsert an incident, sent when it opens and when it ends
+runsRouter.post('/:id/incidents', async (req: Request, res: Response, next: NextFunction) => {
+  try {
+    const s = req.body;
+    const runId = req.params.id;
+
+    // Get proxy_id from run
+    const runResult = await pool.query('SELECT proxy_id FROM test_run WHERE id = $1', [runId]);
+    if (runResult.rows.length === 0) {
+      return res.status(404).json({ error: { message: 'Run not found' } });
+    }
+    const proxyId = runResult.rows[0].proxy_id;
+
+    const result = await pool.query(
+      `INSERT INTO incident (
+        run_id, proxy_id, seq, status, trigger, error_type, error_counts, protocols,
+        failed_samples, total_samples, started_at, ended_at, duration_ms
+      ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+      ON CONFLICT (run_id, seq) DO UPDATE SET
+        status = EXCLUDED.status,
+        error_type = EXCLUDED.error_type,
+        error_counts = EXCLUDED.error_counts,
+        protocols = EXCLUDED.protocols,
+        failed_samples = EXCLUDED.failed_samples,
+        total_samples = EXCLUDED.total_samples,
+        ended_at = EXCLUDED.ended_at,
+        duration_ms = EXCLUDED.duration_ms
+      RETURNING *`,
+      [
+        runId, proxyId, s.seq, s.status, s.trigger, s.error_type || '',
+        JSON.stringify(s.error_counts || {}), JSON.stringify(s.protocols || []),
+        s.failed_samples || 0, s.total_samples || 0,
+        s.started_at, s.ended_at ?? null, s.duration_ms || 0,
+      ],
+    );
+
+    logger.info({ module: 'routes.runs', run_id: runId, incident_seq: s.seq, status: s.status, error_type: s.error_type }, 'Incident ingestion');
+    res.status(201).json({ data: result.rows[0] });
+  } catch (err) {
+    next(err);
+  }
+});
+
 // POST /api/v1/runs/:id/summary — Upsert run summary
 runsRouter.post('/:id/summary', async (req: Request, res: Response, next: NextFunction) => {
   try {
@@ -362,6 +500,12 @@ runsRouter.post('/:id/summary', async (req: Request, res: Response, next: NextFu
     }
     const proxyId = runResult.rows[0].proxy_id;
 
+    if (s.window) {
+      const windowResult = await upsertWindowSummary(runId, proxyId, s);
+      logger.info({ module: 'routes.runs', run_id: runId, window: s.window, score_total: s.score_total }, 'Window summary received');
+      return res.json({ data: windowResult });
+    }
+
     const result = await pool.query(
       `INSERT INTO run_summary (
         run_id, proxy_id, http_sample_count, https_sample_count, ws_sample_count,
@@ -375,11 +519,22 @@ runsRouter.post('/:id/summary', async (req: Request, res: Response, next: NextFu
         ip_clean, ip_geo_match, ip_stable,
         score_uptime, score_latency, score_jitter, score_ws, score_security, score_total,
         ip_clean_score, majority_tls_version, tls_version_score,
+        udp_sample_count, udp_loss_rate, udp_rtt_p95_ms, udp_jitter_ms, score_udp,
+        h1_sample_count, h1_error_count, h1_ttfb_p50_ms, h1_ttfb_p95_ms,
+        h2_sample_count, h2_error_count, h2_ttfb_p50_ms, h2_ttfb_p95_ms,
+        h2_stream_avg_ms, h2_stream_p95_ms, h2_stream_reset_count, h2_stream_reset_rate,
+        stop_reason,
+        rotation_mode, ip_pool_size, ip_reuse_rate,
+        session_count, session_lifetime_avg_sec, session_lifetime_min_sec, premature_rotations,
         computed_at
       ) VALUES (
         $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
         $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33,
-        $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, now()
+        $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45,
+        $46, $47, $48, $49, $50,
+        $51, $52, $53, $54, $55, $56, $57, $58, $59, $60, $61, $62,
+        $63,
+        $64, $65, $66, $67, $68, $69, $70, now()
       )
       ON CONFLICT (run_id) DO UPDATE SET
         http_sample_count = EXCLUDED.http_sample_count,
@@ -425,6 +580,31 @@ runsRouter.post('/:id/summary', async (req: Request, res: Response, next: NextFu
         ip_clean_score = EXCLUDED.ip_clean_score,
         majority_tls_version = EXCLUDED.majority_tls_version,
         tls_version_score = EXCLUDED.tls_version_score,
+        udp_sample_count = EXCLUDED.udp_sample_count,
+        udp_loss_rate = EXCLUDED.udp_loss_rate,
+        udp_rtt_p95_ms = EXCLUDED.udp_rtt_p95_ms,
+        udp_jitter_ms = EXCLUDED.udp_jitter_ms,
+        score_udp = EXCLUDED.score_udp,
+        h1_sample_count = EXCLUDED.h1_sample_count,
+        h1_error_count = EXCLUDED.h1_error_count,
+        h1_ttfb_p50_ms = EXCLUDED.h1_ttfb_p50_ms,
+        h1_ttfb_p95_ms = EXCLUDED.h1_ttfb_p95_ms,
+        h2_sample_count = EXCLUDED.h2_sample_count,
+        h2_error_count = EXCLUDED.h2_error_count,
+        h2_ttfb_p50_ms = EXCLUDED.h2_ttfb_p50_ms,
+        h2_ttfb_p95_ms = EXCLUDED.h2_ttfb_p95_ms,
+        h2_stream_avg_ms = EXCLUDED.h2_stream_avg_ms,
+        h2_stream_p95_ms = EXCLUDED.h2_stream_p95_ms,
+        h2_stream_reset_count = EXCLUDED.h2_stream_reset_count,
+        h2_stream_reset_rate = EXCLUDED.h2_stream_reset_rate,
+        stop_reason = COALESCE(EXCLUDED.stop_reason, run_summary.stop_reason),
+        rotation_mode = EXCLUDED.rotation_mode,
+        ip_pool_size = EXCLUDED.ip_pool_size,
+        ip_reuse_rate = EXCLUDED.ip_reuse_rate,
+        session_count = EXCLUDED.session_count,
+        session_lifetime_avg_sec = EXCLUDED.session_lifetime_avg_sec,
+        session_lifetime_min_sec = EXCLUDED.session_lifetime_min_sec,
+        premature_rotations = EXCLUDED.premature_rotations,
         computed_at = now()
       RETURNING *`,
       [
@@ -440,6 +620,13 @@ runsRouter.post('/:id/summary', async (req: Request, res: Response, next: NextFu
         s.ip_clean ?? null, s.ip_geo_match ?? null, s.ip_stable ?? null,
         s.score_uptime ?? null, s.score_latency ?? null, s.score_jitter ?? null, s.score_ws ?? null, s.score_security ?? null, s.score_total ?? null,
         s.ip_clean_score ?? null, s.majority_tls_version ?? null, s.tls_version_score ?? null,
+        s.udp_sample_count || 0, s.udp_loss_rate ?? null, s.udp_rtt_p95_ms ?? null, s.udp_jitter_ms ?? null, s.score_udp ?? null,
+        s.h1_sample_count || 0, s.h1_error_count || 0, s.h1_ttfb_p50_ms ?? null, s.h1_ttfb_p95_ms ?? null,
+        s.h2_sample_count || 0, s.h2_error_count || 0, s.h2_ttfb_p50_ms ?? null, s.h2_ttfb_p95_ms ?? null,
+        s.h2_stream_avg_ms ?? null, s.h2_stream_p95_ms ?? null, s.h2_stream_reset_count || 0, s.h2_stream_reset_rate ?? null,
+        s.stop_reason || null,
+        s.rotation_mode || null, s.ip_pool_size || 0, s.ip_reuse_rate ?? null,
+        s.session_count || 0, s.session_lifetime_avg_sec ?? null, s.session_lifetime_min_sec ?? null, s.premature_rotations || 0,
       ],
     );
 
@@ -541,6 +728,52 @@ runsRouter.get('/:id/ip-checks', async (req: Request, res: Response, next: NextF
   }
 });
 
+// GET /api/v1/runs/:id/incidents — Incidents in order, with MTTR and MTBF over the run so far
+runsRouter.get('/:id/incidents', async (req: Request, res: Response, next: NextFunction) => {
+  try {
+    const runResult = await pool.query('SELECT started_at, finished_at FROM test_run WHERE id = $1', [req.params.id]);
+    if (runResult.rows.length === 0) {
+      return res.status(404).json({ error: { message: 'Run not found' } });
+    }
+    const result = await pool.query(
+      'SELECT * FROM incident WHERE run_id = $1 ORDER BY seq',
+      [req.params.id],
+    );
+    res.json({ data: result.rows, stats: incidentStats(runResult.rows[0], result.rows) });
+  } catch (err) {
+    next(err);
+  }
+});
+
+// incidentStats derives MTTR from resolved incidents and MTBF from the time the proxy
+// was up between them; incidents still open count as down until now
+function incidentStats(run: { started_at: Date | null; finished_at: Date | null }, incidents: any[]) {
+  const now = Date.now();
+  let downtimeMs = 0;
+  let resolvedMs = 0;
+  let resolvedCount = 0;
+  for (const inc of incidents) {
+    const end = inc.ended_at ? new Date(inc.ended_at).getTime() : now;
+    downtimeMs += Math.max(0, end - new Date(inc.started_at).getTime());
+    if (inc.status === 'resolved') {
+      resolvedCount++;
+      resolvedMs += inc.duration_ms;
+    }
+  }
+  let mtbfMs: number | null = null;
+  if (run.started_at && incidents.length > 0) {
+    const observedMs = (run.finished_at ? new Date(run.finished_at).getTime() : now) - new Date(run.started_at).getTime();
+    mtbfMs = Math.max(0, observedMs - downtimeMs) / incidents.length;
+  }
+  return {
+    incident_count: incidents.length,
+    resolved_count: resolvedCount,
+    downtime_ms: downtimeMs,
+    mttr_ms: resolvedCount > 0 ? resolvedMs / resolvedCount : null,
+    mtbf_ms: mtbfMs,
+  };
+}
+
 // GET /api/v1/runs/:id/summary
 runsRouter.get('/:id/summary', async (req: Request, res: Response, next: NextFunction) => {
   try {
@@ -553,3 +786,68 @@ runsRouter.get('/:id/summary', async (req: Request, res: Response, next: NextFun
     next(err);
   }
 });
+
+// GET /api/v1/runs/:id/summary/windows — Latest trailing-window summaries (1m, 5m, 15m)
+runsRouter.get('/:id/summary/windows', async (req: Request, res: Response, next: NextFunction) => {
+  try {
+    const result = await pool.query(
+      'SELECT * FROM run_summary_window WHERE run_id = $1 ORDER BY window_label',
+      [req.params.id],
+    );
+    res.json({ data: result.rows });
+  } catch (err) {
+    next(err);
+  }
+});
+
+// upsertWindowSummary stores one trailing-window summary, keyed by run and window
+async function upsertWindowSummary(runId: string, proxyId: string, s: any) {
+  const result = await pool.query(
+    `INSERT INTO run_summary_window (
+      run_id, proxy_id, window_label,
+      http_sample_count, https_sample_count, ws_sample_count, udp_sample_count,
+      http_success_count, http_error_count, uptime_ratio,
+      ttfb_p50_ms, ttfb_p95_ms, ttfb_p99_ms, total_p95_ms, jitter_ms,
+      ws_drop_rate, udp_loss_rate,
+      score_uptime, score_latency, score_jitter, score_ws, score_udp, score_security, score_total,
+      computed_at
+    ) VALUES (
+      $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+      $18, $19, $20, $21, $22, $23, $24, now()
+    )
+    ON CONFLICT (run_id, window_label) DO UPDATE SET
+      http_sample_count = EXCLUDED.http_sample_count,
+      https_sample_count = EXCLUDED.https_sample_count,
+      ws_sample_count = EXCLUDED.ws_sample_count,
+      udp_sample_count = EXCLUDED.udp_sample_count,
+      http_success_count = EXCLUDED.http_success_count,
+      http_error_count = EXCLUDED.http_error_count,
+      uptime_ratio = EXCLUDED.uptime_ratio,
+      ttfb_p50_ms = EXCLUDED.ttfb_p50_ms,
+      ttfb_p95_ms = EXCLUDED.ttfb_p95_ms,
+      ttfb_p99_ms = EXCLUDED.ttfb_p99_ms,
+      total_p95_ms = EXCLUDED.total_p95_ms,
+      jitter_ms = EXCLUDED.jitter_ms,
+      ws_drop_rate = EXCLUDED.ws_drop_rate,
+      udp_loss_rate = EXCLUDED.udp_loss_rate,
+      score_uptime = EXCLUDED.score_uptime,
+      score_latency = EXCLUDED.score_latency,
+      score_jitter = EXCLUDED.score_jitter,
+      score_ws = EXCLUDED.score_ws,
+      score_udp = EXCLUDED.score_udp,
+      score_security = EXCLUDED.score_security,
+      score_total = EXCLUDED.score_total,
+      computed_at = now()
+    RETURNING *`,
+    [
+      runId, proxyId, s.window,
+      s.http_sample_count || 0, s.https_sample_count || 0, s.ws_sample_count || 0, s.udp_sample_count || 0,
+      s.http_success_count || 0, s.http_error_count || 0, s.uptime_ratio ?? null,
+      s.ttfb_p50_ms ?? null, s.ttfb_p95_ms ?? null, s.ttfb_p99_ms ?? null, s.total_p95_ms ?? null, s.jitter_ms ?? null,
+      s.ws_drop_rate ?? null, s.udp_loss_rate ?? null,
+      s.score_uptime ?? null, s.score_latency ?? null, s.score_jitter ?? null, s.score_ws ?? null,
+      s.score_udp ?? null, s.score_security ?? null, s.score_total ?? null,
+    ],
+  );
+  return result.rows[0];
+}
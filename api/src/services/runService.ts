@@ -5,8 +5,10 @@ import { decrypt } from '../routes/proxies';
 const RUNNER_URL = process.env.RUNNER_URL || 'http://runner:9090';
 const TARGET_HTTP_URL = process.env.TARGET_HTTP_URL || 'http://target:3001';
 const TARGET_HTTPS_URL = process.env.TARGET_HTTPS_URL || 'https://target:3443';
+const TARGET_UDP_ADDR = process.env.TARGET_UDP_ADDR || 'target:3002';
+const TARGET_HTTP3_URL = process.env.TARGET_HTTP3_URL || 'https://h3target:3444';
 
-export async function triggerRunner(runIds: string[], scoringConfig?: Record<string, unknown>): Promise<{ triggered: number; failed: number; errors: string[] }> {
+export async function triggerRunner(runIds: string[], scoringConfig?: Record<string, unknown>, incidentConfig?: Record<string, unknown>): Promise<{ triggered: number; failed: number; errors: string[] }> {
   const runs: any[] = [];
   const errors: string[] = [];
 
@@ -52,6 +54,11 @@ export async function triggerRunner(runIds: string[], scoringConfig?: Record<str
         auth_pass: authPass,
         expected_country: proxy.expected_country || '',
         label: proxy.label,
+        rotation: {
+          mode: proxy.rotation_mode || 'none',
+          sticky_minutes: proxy.sticky_minutes || 0,
+          session_format: proxy.session_format || '',
+        },
       },
       config: {
         http_rpm: run.http_rpm,
@@ -60,11 +67,19 @@ export async function triggerRunner(runIds: string[], scoringConfig?: Record<str
         request_timeout_ms: run.request_timeout_ms,
         warmup_requests: run.warmup_requests,
         summary_interval_sec: run.summary_interval_sec,
+        ip_family: run.ip_family,
+        run_mode: run.run_mode,
+        ...(run.duration_sec ? { duration_sec: run.duration_sec } : {}),
+        ...(run.target_samples ? { target_samples: run.target_samples } : {}),
+        ...(run.load_profile ? { load_profile: run.load_profile } : {}),
         ...(scoringConfig ? { scoring_config: scoringConfig } : {}),
+        ...(incidentConfig ? { incident_config: incidentConfig } : {}),
       },
       target: {
         http_url: TARGET_HTTP_URL,
         https_url: TARGET_HTTPS_URL,
+        udp_addr: TARGET_UDP_ADDR,
+        http3_url: TARGET_HTTP3_URL,
       },
     });
   }
@@ -89,9 +104,25 @@ export async function triggerRunner(runIds: string[], scoringConfig?: Record<str
       body: JSON.stringify({ runs }),
     });
 
+    let rejectedCount = 0;
     if (response.ok) {
+      // The Runner refuses runs a required reporter sink could not record as started
+      const body = (await response.json().catch(() => ({}))) as { rejected?: { run_id: string; error: string }[] };
+      const rejected = new Map((body.rejected || []).map((r) => [r.run_id, r.error]));
+      rejectedCount = rejected.size;
+
       // Update status to running only after successful Runner response
       for (const run of runs) {
+        const reason = rejected.get(run.run_id);
+        if (reason !== undefined) {
+          await pool.query(
+            `UPDATE test_run SET status = 'failed', error_message = $2, finished_at = now() WHERE id = $1`,
+            [run.run_id, reason],
+          );
+          errors.push(`Run ${run.run_id} not started: ${reason}`);
+          logger.warn({ module: 'services.runService', run_id: run.run_id, old_status: 'pending', new_status: 'failed', error_detail: reason }, 'Run status changed');
+          continue;
+        }
         await pool.query(
           `UPDATE test_run SET status = 'running', started_at = now() WHERE id = $1`,
           [run.run_id],
@@ -120,7 +151,7 @@ export async function triggerRunner(runIds: string[], scoringConfig?: Record<str
       return { triggered: 0, failed: runs.length + errors.length, errors: [...errors, `Runner responded ${response.status}`] };
     }
 
-    return { triggered: runs.length, failed: errors.length, errors };
+    return { triggered: runs.length - rejectedCount, failed: errors.length, errors };
   } catch (err: any) {
     logger.error({
       module: 'services.runService',
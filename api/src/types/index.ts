@@ -13,13 +13,16 @@ export interface ProxyEndpoint {
   label: string;
   host: string;
   port: number;
-  protocol: 'http' | 'https' | 'socks5';
+  protocol: 'http' | 'https' | 'socks4' | 'socks4a' | 'socks5' | 'masque';
   auth_user?: string | null;
   auth_pass_enc?: string | null;
   expected_country?: string | null;
   expected_city?: string | null;
   is_dedicated: boolean;
   is_active: boolean;
+  rotation_mode: 'none' | 'sticky' | 'per_request';
+  sticky_minutes?: number | null;
+  session_format?: string | null;
   created_at: string;
   updated_at: string;
 }
@@ -39,6 +42,10 @@ export interface TestRun {
   ws_messages_per_minute: number;
   warmup_requests: number;
   summary_interval_sec: number;
+  ip_family: 'auto' | 'ipv4' | 'ipv6';
+  duration_sec?: number | null;
+  target_samples?: number | null;
+  load_profile?: LoadProfile | null;
   total_http_samples: number;
   total_https_samples: number;
   total_ws_samples: number;
@@ -61,16 +68,42 @@ export interface HttpSample {
   error_type?: string | null;
   error_message?: string | null;
   tcp_connect_ms?: number | null;
+  socks_handshake_ms?: number | null;
   tls_handshake_ms?: number | null;
   ttfb_ms?: number | null;
   total_ms?: number | null;
   tls_version?: string | null;
   tls_cipher?: string | null;
+  proxy_tls_handshake_ms?: number | null;
+  proxy_tls_version?: string | null;
+  proxy_tls_cipher?: string | null;
+  proxy_auth_scheme?: string | null;
+  proxy_auth_round_trips: number;
+  proxy_auth_ms?: number | null;
+  observed_ip_family?: string | null;
+  negotiated_protocol?: string | null;
+  h2_streams?: number | null;
+  h2_stream_avg_ms?: number | null;
+  h2_stream_max_ms?: number | null;
+  h2_stream_resets: number;
   bytes_sent: number;
   bytes_received: number;
+  target_rpm?: number | null;
+  hop_timings?: HopTiming[] | null;
   measured_at: string;
 }
 
+export interface HopTiming {
+  hop: number;
+  label?: string;
+  protocol: string;
+  tcp_connect_ms?: number;
+  tls_handshake_ms?: number;
+  tunnel_ms?: number;
+  auth_scheme?: string;
+  error_type?: string;
+}
+
 export interface RunSummary {
   id: string;
   run_id: string;
@@ -118,6 +151,26 @@ export interface RunSummary {
   ip_clean_score?: number | null;
   majority_tls_version?: string | null;
   tls_version_score?: number | null;
+  h1_sample_count: number;
+  h1_error_count: number;
+  h1_ttfb_p50_ms?: number | null;
+  h1_ttfb_p95_ms?: number | null;
+  h2_sample_count: number;
+  h2_error_count: number;
+  h2_ttfb_p50_ms?: number | null;
+  h2_ttfb_p95_ms?: number | null;
+  h2_stream_avg_ms?: number | null;
+  h2_stream_p95_ms?: number | null;
+  h2_stream_reset_count: number;
+  h2_stream_reset_rate?: number | null;
+  stop_reason?: 'stopped' | 'duration_reached' | 'sample_target_reached' | null;
+  rotation_mode?: 'none' | 'sticky' | 'per_request' | null;
+  ip_pool_size: number;
+  ip_reuse_rate?: number | null;
+  session_count: number;
+  session_lifetime_avg_sec?: number | null;
+  session_lifetime_min_sec?: number | null;
+  premature_rotations: number;
   computed_at: string;
 }
 
@@ -182,3 +235,45 @@ export interface ScoringConfig {
   ws_hold_target_ms: number;
   ip_check_interval_sec: number;
 }
+
+export interface LoadProfile {
+  type: 'ramp' | 'step' | 'spike' | 'sine';
+  base_pct?: number;
+  peak_pct?: number;
+  duration_sec?: number;
+  steps?: number;
+  period_sec?: number;
+}
+
+export interface IncidentConfig {
+  consecutive_failures: number;
+  error_rate_threshold: number;
+  error_rate_window_sec: number;
+  min_window_samples: number;
+  recovery_successes: number;
+}
+
+export interface Incident {
+  id: string;
+  run_id: string;
+  proxy_id: string;
+  seq: number;
+  status: 'open' | 'resolved' | 'unresolved';
+  trigger: 'consecutive_failures' | 'error_rate';
+  error_type: string;
+  error_counts: Record<string, number>;
+  protocols: string[];
+  failed_samples: number;
+  total_samples: number;
+  started_at: string;
+  ended_at?: string | null;
+  duration_ms: number;
+}
+
+export interface IncidentStats {
+  incident_count: number;
+  resolved_count: number;
+  downtime_ms: number;
+  mttr_ms: number | null;
+  mtbf_ms: number | null;
+}
@@ -53,7 +53,7 @@ export function ProxyForm({ isOpen, onClose, onSubmit, proxy, providers, default
     if (!host.trim()) newErrors.host = 'Host is required';
     const portNum = parseInt(port, 10);
     if (!port || isNaN(portNum) || portNum < 1 || portNum > 65535) newErrors.port = 'Port must be 1-65535';
-    if (!['http', 'https', 'socks5'].includes(protocol)) newErrors.protocol = 'Invalid protocol';
+    if (!['http', 'https', 'socks4', 'socks4a', 'socks5', 'masque'].includes(protocol)) newErrors.protocol = 'Invalid protocol';
 
     if (Object.keys(newErrors).length > 0) {
       if (process.env.NODE_ENV === 'development') {
@@ -79,7 +79,7 @@ export function ProxyForm({ isOpen, onClose, onSubmit, proxy, providers, default
           label: label.trim(),
           host: host.trim(),
           port: parseInt(port, 10),
-          protocol: protocol as 'http' | 'https' | 'socks5',
+          protocol: protocol as 'http' | 'https' | 'socks4' | 'socks4a' | 'socks5' | 'masque',
           auth_user: authUser.trim() || undefined,
           expected_country: expectedCountry.trim() || undefined,
           is_dedicated: isDedicated,
@@ -92,7 +92,7 @@ export function ProxyForm({ isOpen, onClose, onSubmit, proxy, providers, default
           label: label.trim(),
           host: host.trim(),
           port: parseInt(port, 10),
-          protocol: protocol as 'http' | 'https' | 'socks5',
+          protocol: protocol as 'http' | 'https' | 'socks4' | 'socks4a' | 'socks5' | 'masque',
           auth_user: authUser.trim() || undefined,
           auth_pass: authPass || undefined,
           expected_country: expectedCountry.trim() || undefined,
@@ -138,7 +138,10 @@ export function ProxyForm({ isOpen, onClose, onSubmit, proxy, providers, default
             options={[
               { value: 'http', label: 'HTTP' },
               { value: 'https', label: 'HTTPS' },
+              { value: 'socks4', label: 'SOCKS4' },
+              { value: 'socks4a', label: 'SOCKS4a' },
               { value: 'socks5', label: 'SOCKS5' },
+              { value: 'masque', label: 'MASQUE (HTTP/3)' },
             ]}
             error={errors.protocol}
           />
@@ -0,0 +1,34 @@
+-- SOCKS5 UDP ASSOCIATE samples and UDP summary columns
+
+CREATE TABLE IF NOT EXISTS udp_sample (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    seq                 INT NOT NULL,
+    is_warmup           BOOLEAN NOT NULL DEFAULT false,
+    target_addr         TEXT NOT NULL,
+    associated          BOOLEAN NOT NULL DEFAULT false,
+    error_type          TEXT,
+    error_message       TEXT,
+    tcp_connect_ms      DOUBLE PRECISION,
+    socks_handshake_ms  DOUBLE PRECISION,
+    packets_sent        INT NOT NULL DEFAULT 0,
+    packets_received    INT NOT NULL DEFAULT 0,
+    lost_count          INT NOT NULL DEFAULT 0,
+    reordered_count     INT NOT NULL DEFAULT 0,
+    duplicate_count     INT NOT NULL DEFAULT 0,
+    rtt_avg_ms          DOUBLE PRECISION,
+    rtt_min_ms          DOUBLE PRECISION,
+    rtt_max_ms          DOUBLE PRECISION,
+    jitter_ms           DOUBLE PRECISION,
+    measured_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_udp_sample_run ON udp_sample(run_id);
+
+ALTER TABLE test_run ADD COLUMN IF NOT EXISTS total_udp_samples INT NOT NULL DEFAULT 0;
+
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS udp_sample_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS udp_loss_rate DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS udp_rtt_p95_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS udp_jitter_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS score_udp DOUBLE PRECISION;
@@ -0,0 +1,5 @@
+-- Allow MASQUE (HTTP/3 CONNECT-UDP) proxy endpoints
+
+ALTER TABLE proxy_endpoint DROP CONSTRAINT IF EXISTS proxy_endpoint_protocol_check;
+ALTER TABLE proxy_endpoint ADD CONSTRAINT proxy_endpoint_protocol_check
+    CHECK (protocol IN ('http', 'https', 'socks4', 'socks4a', 'socks5', 'masque'));
@@ -0,0 +1,4 @@
+-- Per-run address-family preference: auto, or pin the proxy's egress to IPv4 or IPv6
+
+ALTER TABLE test_run ADD COLUMN IF NOT EXISTS ip_family TEXT NOT NULL DEFAULT 'auto'
+    CHECK (ip_family IN ('auto', 'ipv4', 'ipv6'));
@@ -0,0 +1,6 @@
+-- Declared exit IP behaviour for rotating/residential proxies
+
+ALTER TABLE proxy_endpoint ADD COLUMN IF NOT EXISTS rotation_mode TEXT NOT NULL DEFAULT 'none'
+    CHECK (rotation_mode IN ('none', 'sticky', 'per_request'));
+ALTER TABLE proxy_endpoint ADD COLUMN IF NOT EXISTS sticky_minutes INT;
+ALTER TABLE proxy_endpoint ADD COLUMN IF NOT EXISTS session_format TEXT;
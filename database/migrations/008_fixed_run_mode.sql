@@ -0,0 +1,6 @@
+-- Fixed runs stop themselves after a duration and/or a sample count per tester
+
+ALTER TABLE test_run ADD COLUMN IF NOT EXISTS duration_sec INT
+    CHECK (duration_sec IS NULL OR duration_sec > 0);
+ALTER TABLE test_run ADD COLUMN IF NOT EXISTS target_samples INT
+    CHECK (target_samples IS NULL OR target_samples > 0);
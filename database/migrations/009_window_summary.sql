@@ -0,0 +1,32 @@
+-- Rolling summaries over trailing windows (1m, 5m, 15m), one row per run and window,
+-- next to the cumulative run_summary
+
+CREATE TABLE IF NOT EXISTS run_summary_window (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    proxy_id            UUID NOT NULL REFERENCES proxy_endpoint(id) ON DELETE CASCADE,
+    window_label        TEXT NOT NULL,
+    http_sample_count   INT NOT NULL DEFAULT 0,
+    https_sample_count  INT NOT NULL DEFAULT 0,
+    ws_sample_count     INT NOT NULL DEFAULT 0,
+    udp_sample_count    INT NOT NULL DEFAULT 0,
+    http_success_count  INT NOT NULL DEFAULT 0,
+    http_error_count    INT NOT NULL DEFAULT 0,
+    uptime_ratio        DOUBLE PRECISION,
+    ttfb_p50_ms         DOUBLE PRECISION,
+    ttfb_p95_ms         DOUBLE PRECISION,
+    ttfb_p99_ms         DOUBLE PRECISION,
+    total_p95_ms        DOUBLE PRECISION,
+    jitter_ms           DOUBLE PRECISION,
+    ws_drop_rate        DOUBLE PRECISION,
+    udp_loss_rate       DOUBLE PRECISION,
+    score_uptime        DOUBLE PRECISION,
+    score_latency       DOUBLE PRECISION,
+    score_jitter        DOUBLE PRECISION,
+    score_ws            DOUBLE PRECISION,
+    score_udp           DOUBLE PRECISION,
+    score_security      DOUBLE PRECISION,
+    score_total         DOUBLE PRECISION,
+    computed_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (run_id, window_label)
+);
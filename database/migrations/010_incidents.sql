@@ -0,0 +1,23 @@
+-- Outage incidents the Runner detects from the sample stream, for MTBF/MTTR
+
+CREATE TABLE IF NOT EXISTS incident (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    proxy_id            UUID NOT NULL REFERENCES proxy_endpoint(id) ON DELETE CASCADE,
+    seq                 INT NOT NULL,
+    status              TEXT NOT NULL
+                        CHECK (status IN ('open', 'resolved', 'unresolved')),
+    trigger             TEXT NOT NULL
+                        CHECK (trigger IN ('consecutive_failures', 'error_rate')),
+    error_type          TEXT NOT NULL,
+    error_counts        JSONB NOT NULL DEFAULT '{}',
+    protocols           JSONB NOT NULL DEFAULT '[]',
+    failed_samples      INT NOT NULL DEFAULT 0,
+    total_samples       INT NOT NULL DEFAULT 0,
+    started_at          TIMESTAMPTZ NOT NULL,
+    ended_at            TIMESTAMPTZ,
+    duration_ms         DOUBLE PRECISION NOT NULL DEFAULT 0,
+    UNIQUE (run_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_proxy ON incident(proxy_id, started_at);
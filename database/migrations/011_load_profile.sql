@@ -0,0 +1,6 @@
+-- Load profiles that move a run's HTTP(S) request rates over time, and the rate each
+-- HTTP sample was sent at, to plot latency against offered load
+
+ALTER TABLE test_run ADD COLUMN IF NOT EXISTS load_profile JSONB
+    CHECK (load_profile IS NULL OR load_profile->>'type' IN ('ramp', 'step', 'spike', 'sine'));
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS target_rpm DOUBLE PRECISION;
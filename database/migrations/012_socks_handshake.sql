@@ -0,0 +1,4 @@
+-- SOCKS handshake time as its own phase on HTTP(S) and WS samples, next to udp_sample's
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS socks_handshake_ms DOUBLE PRECISION;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS socks_handshake_ms DOUBLE PRECISION;
@@ -0,0 +1,8 @@
+-- Proxy-leg TLS (protocol=https proxies) on HTTP(S) and WS samples, separate from the target's TLS
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_tls_handshake_ms DOUBLE PRECISION;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_tls_version TEXT;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_tls_cipher TEXT;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_tls_handshake_ms DOUBLE PRECISION;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_tls_version TEXT;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_tls_cipher TEXT;
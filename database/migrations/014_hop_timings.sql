@@ -0,0 +1,4 @@
+-- Per-hop dial breakdown of chained proxies on HTTP(S) and WS samples; NULL when unchained
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS hop_timings JSONB;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS hop_timings JSONB;
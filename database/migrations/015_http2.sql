@@ -0,0 +1,21 @@
+-- Negotiated HTTP version and h2 stream stats on http_sample, and the HTTP/1.1 vs HTTP/2
+-- breakdown on run_summary
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS negotiated_protocol TEXT;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS h2_streams INT;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS h2_stream_avg_ms DOUBLE PRECISION;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS h2_stream_max_ms DOUBLE PRECISION;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS h2_stream_resets INT NOT NULL DEFAULT 0;
+
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h1_sample_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h1_error_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h1_ttfb_p50_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h1_ttfb_p95_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_sample_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_error_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_ttfb_p50_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_ttfb_p95_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_stream_avg_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_stream_p95_ms DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_stream_reset_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS h2_stream_reset_rate DOUBLE PRECISION;
@@ -0,0 +1,8 @@
+-- Proxy-Authorization scheme and the 407 round trips it cost on HTTP(S) and WS samples
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_auth_scheme TEXT;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_auth_round_trips INT NOT NULL DEFAULT 0;
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS proxy_auth_ms DOUBLE PRECISION;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_auth_scheme TEXT;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_auth_round_trips INT NOT NULL DEFAULT 0;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS proxy_auth_ms DOUBLE PRECISION;
@@ -0,0 +1,4 @@
+-- Family (ipv4 or ipv6) of the exit address the target saw, per HTTP(S) and WS sample
+
+ALTER TABLE http_sample ADD COLUMN IF NOT EXISTS observed_ip_family TEXT;
+ALTER TABLE ws_sample ADD COLUMN IF NOT EXISTS observed_ip_family TEXT;
@@ -0,0 +1,3 @@
+-- Why a run ended (stopped, duration_reached, sample_target_reached), set by the final summary
+
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS stop_reason TEXT;
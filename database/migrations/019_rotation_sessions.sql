@@ -0,0 +1,10 @@
+-- Exit IP rotation on run_summary: the pool seen on HTTP(S) samples, and sticky sessions
+-- followed by IP re-checks
+
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS rotation_mode TEXT;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS ip_pool_size INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS ip_reuse_rate DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS session_count INT NOT NULL DEFAULT 0;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS session_lifetime_avg_sec DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS session_lifetime_min_sec DOUBLE PRECISION;
+ALTER TABLE run_summary ADD COLUMN IF NOT EXISTS premature_rotations INT NOT NULL DEFAULT 0;
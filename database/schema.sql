@@ -22,13 +22,17 @@ CREATE TABLE IF NOT EXISTS proxy_endpoint (
     host            TEXT NOT NULL,
     port            INT NOT NULL,
     protocol        TEXT NOT NULL DEFAULT 'http'
-                    CHECK (protocol IN ('http', 'https', 'socks5')),
+                    CHECK (protocol IN ('http', 'https', 'socks4', 'socks4a', 'socks5', 'masque')),
     auth_user       TEXT,
     auth_pass_enc   TEXT,
     expected_country TEXT,
     expected_city   TEXT,
     is_dedicated    BOOLEAN NOT NULL DEFAULT false,
     is_active       BOOLEAN NOT NULL DEFAULT true,
+    rotation_mode   TEXT NOT NULL DEFAULT 'none'
+                    CHECK (rotation_mode IN ('none', 'sticky', 'per_request')),
+    sticky_minutes  INT,
+    session_format  TEXT,
     created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
     updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
 );
@@ -53,9 +57,15 @@ CREATE TABLE IF NOT EXISTS test_run (
     ws_messages_per_minute  INT NOT NULL DEFAULT 60,
     warmup_requests         INT NOT NULL DEFAULT 5,
     summary_interval_sec    INT NOT NULL DEFAULT 30,
+    ip_family               TEXT NOT NULL DEFAULT 'auto'
+                            CHECK (ip_family IN ('auto', 'ipv4', 'ipv6')),
+    duration_sec            INT CHECK (duration_sec IS NULL OR duration_sec > 0),
+    target_samples          INT CHECK (target_samples IS NULL OR target_samples > 0),
+    load_profile            JSONB CHECK (load_profile IS NULL OR load_profile->>'type' IN ('ramp', 'step', 'spike', 'sine')),
     total_http_samples      INT NOT NULL DEFAULT 0,
     total_https_samples     INT NOT NULL DEFAULT 0,
     total_ws_samples        INT NOT NULL DEFAULT 0,
+    total_udp_samples       INT NOT NULL DEFAULT 0,
     started_at              TIMESTAMPTZ,
     stopped_at              TIMESTAMPTZ,
     finished_at             TIMESTAMPTZ,
@@ -79,13 +89,28 @@ CREATE TABLE IF NOT EXISTS http_sample (
     error_type      TEXT,
     error_message   TEXT,
     tcp_connect_ms      DOUBLE PRECISION,
+    socks_handshake_ms  DOUBLE PRECISION,
     tls_handshake_ms    DOUBLE PRECISION,
     ttfb_ms             DOUBLE PRECISION,
     total_ms            DOUBLE PRECISION,
     tls_version     TEXT,
     tls_cipher      TEXT,
+    proxy_tls_handshake_ms  DOUBLE PRECISION,
+    proxy_tls_version       TEXT,
+    proxy_tls_cipher        TEXT,
+    proxy_auth_scheme       TEXT,
+    proxy_auth_round_trips  INT NOT NULL DEFAULT 0,
+    proxy_auth_ms           DOUBLE PRECISION,
+    observed_ip_family      TEXT,
+    negotiated_protocol     TEXT,
+    h2_streams              INT,
+    h2_stream_avg_ms        DOUBLE PRECISION,
+    h2_stream_max_ms        DOUBLE PRECISION,
+    h2_stream_resets        INT NOT NULL DEFAULT 0,
     bytes_sent      BIGINT DEFAULT 0,
     bytes_received  BIGINT DEFAULT 0,
+    target_rpm      DOUBLE PRECISION,
+    hop_timings     JSONB,
     measured_at     TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
@@ -102,8 +127,16 @@ CREATE TABLE IF NOT EXISTS ws_sample (
     error_type          TEXT,
     error_message       TEXT,
     tcp_connect_ms      DOUBLE PRECISION,
+    socks_handshake_ms  DOUBLE PRECISION,
     tls_handshake_ms    DOUBLE PRECISION,
     handshake_ms        DOUBLE PRECISION,
+    proxy_tls_handshake_ms  DOUBLE PRECISION,
+    proxy_tls_version       TEXT,
+    proxy_tls_cipher        TEXT,
+    proxy_auth_scheme       TEXT,
+    proxy_auth_round_trips  INT NOT NULL DEFAULT 0,
+    proxy_auth_ms           DOUBLE PRECISION,
+    observed_ip_family      TEXT,
     message_rtt_ms      DOUBLE PRECISION,
     started_at          TIMESTAMPTZ,
     connection_held_ms  DOUBLE PRECISION,
@@ -111,11 +144,38 @@ CREATE TABLE IF NOT EXISTS ws_sample (
     messages_sent       INT NOT NULL DEFAULT 0,
     messages_received   INT NOT NULL DEFAULT 0,
     drop_count          INT NOT NULL DEFAULT 0,
+    hop_timings         JSONB,
     measured_at         TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
 CREATE INDEX IF NOT EXISTS idx_ws_sample_run ON ws_sample(run_id);
 
+-- 5b. udp_sample (SOCKS5 UDP ASSOCIATE sessions)
+CREATE TABLE IF NOT EXISTS udp_sample (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    seq                 INT NOT NULL,
+    is_warmup           BOOLEAN NOT NULL DEFAULT false,
+    target_addr         TEXT NOT NULL,
+    associated          BOOLEAN NOT NULL DEFAULT false,
+    error_type          TEXT,
+    error_message       TEXT,
+    tcp_connect_ms      DOUBLE PRECISION,
+    socks_handshake_ms  DOUBLE PRECISION,
+    packets_sent        INT NOT NULL DEFAULT 0,
+    packets_received    INT NOT NULL DEFAULT 0,
+    lost_count          INT NOT NULL DEFAULT 0,
+    reordered_count     INT NOT NULL DEFAULT 0,
+    duplicate_count     INT NOT NULL DEFAULT 0,
+    rtt_avg_ms          DOUBLE PRECISION,
+    rtt_min_ms          DOUBLE PRECISION,
+    rtt_max_ms          DOUBLE PRECISION,
+    jitter_ms           DOUBLE PRECISION,
+    measured_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_udp_sample_run ON udp_sample(run_id);
+
 -- 6. ip_check_result
 CREATE TABLE IF NOT EXISTS ip_check_result (
     id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -187,8 +247,85 @@ CREATE TABLE IF NOT EXISTS run_summary (
     ip_clean_score          DOUBLE PRECISION,
     majority_tls_version    VARCHAR(20),
     tls_version_score       DOUBLE PRECISION,
+    udp_sample_count        INT NOT NULL DEFAULT 0,
+    udp_loss_rate           DOUBLE PRECISION,
+    udp_rtt_p95_ms          DOUBLE PRECISION,
+    udp_jitter_ms           DOUBLE PRECISION,
+    score_udp               DOUBLE PRECISION,
+    h1_sample_count         INT NOT NULL DEFAULT 0,
+    h1_error_count          INT NOT NULL DEFAULT 0,
+    h1_ttfb_p50_ms          DOUBLE PRECISION,
+    h1_ttfb_p95_ms          DOUBLE PRECISION,
+    h2_sample_count         INT NOT NULL DEFAULT 0,
+    h2_error_count          INT NOT NULL DEFAULT 0,
+    h2_ttfb_p50_ms          DOUBLE PRECISION,
+    h2_ttfb_p95_ms          DOUBLE PRECISION,
+    h2_stream_avg_ms        DOUBLE PRECISION,
+    h2_stream_p95_ms        DOUBLE PRECISION,
+    h2_stream_reset_count   INT NOT NULL DEFAULT 0,
+    h2_stream_reset_rate    DOUBLE PRECISION,
+    stop_reason             TEXT,
+    rotation_mode           TEXT,
+    ip_pool_size            INT NOT NULL DEFAULT 0,
+    ip_reuse_rate           DOUBLE PRECISION,
+    session_count           INT NOT NULL DEFAULT 0,
+    session_lifetime_avg_sec DOUBLE PRECISION,
+    session_lifetime_min_sec DOUBLE PRECISION,
+    premature_rotations     INT NOT NULL DEFAULT 0,
     computed_at         TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
 CREATE INDEX IF NOT EXISTS idx_run_summary_proxy ON run_summary(proxy_id);
 CREATE INDEX IF NOT EXISTS idx_run_summary_score ON run_summary(score_total DESC);
+
+CREATE TABLE IF NOT EXISTS run_summary_window (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    proxy_id            UUID NOT NULL REFERENCES proxy_endpoint(id) ON DELETE CASCADE,
+    window_label        TEXT NOT NULL,
+    http_sample_count   INT NOT NULL DEFAULT 0,
+    https_sample_count  INT NOT NULL DEFAULT 0,
+    ws_sample_count     INT NOT NULL DEFAULT 0,
+    udp_sample_count    INT NOT NULL DEFAULT 0,
+    http_success_count  INT NOT NULL DEFAULT 0,
+    http_error_count    INT NOT NULL DEFAULT 0,
+    uptime_ratio        DOUBLE PRECISION,
+    ttfb_p50_ms         DOUBLE PRECISION,
+    ttfb_p95_ms         DOUBLE PRECISION,
+    ttfb_p99_ms         DOUBLE PRECISION,
+    total_p95_ms        DOUBLE PRECISION,
+    jitter_ms           DOUBLE PRECISION,
+    ws_drop_rate        DOUBLE PRECISION,
+    udp_loss_rate       DOUBLE PRECISION,
+    score_uptime        DOUBLE PRECISION,
+    score_latency       DOUBLE PRECISION,
+    score_jitter        DOUBLE PRECISION,
+    score_ws            DOUBLE PRECISION,
+    score_udp           DOUBLE PRECISION,
+    score_security      DOUBLE PRECISION,
+    score_total         DOUBLE PRECISION,
+    computed_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (run_id, window_label)
+);
+
+CREATE TABLE IF NOT EXISTS incident (
+    id                  UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    run_id              UUID NOT NULL REFERENCES test_run(id) ON DELETE CASCADE,
+    proxy_id            UUID NOT NULL REFERENCES proxy_endpoint(id) ON DELETE CASCADE,
+    seq                 INT NOT NULL,
+    status              TEXT NOT NULL
+                        CHECK (status IN ('open', 'resolved', 'unresolved')),
+    trigger             TEXT NOT NULL
+                        CHECK (trigger IN ('consecutive_failures', 'error_rate')),
+    error_type          TEXT NOT NULL,
+    error_counts        JSONB NOT NULL DEFAULT '{}',
+    protocols           JSONB NOT NULL DEFAULT '[]',
+    failed_samples      INT NOT NULL DEFAULT 0,
+    total_samples       INT NOT NULL DEFAULT 0,
+    started_at          TIMESTAMPTZ NOT NULL,
+    ended_at            TIMESTAMPTZ,
+    duration_ms         DOUBLE PRECISION NOT NULL DEFAULT 0,
+    UNIQUE (run_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_proxy ON incident(proxy_id, started_at);
@@ -0,0 +1,373 @@
+// Command h3target is the HTTP/3 (QUIC) stand-in for the Node target, used by masque runs.
+// It serves /health, /echo, /ip, /large and /slow over HTTP/3 on H3_PORT and, for local
+// testing without a real MASQUE proxy, accepts CONNECT-UDP (RFC 9298) on MASQUE_PORT.
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"proxy-stability-test/runner/internal/proxy"
+)
+
+const (
+	maxLargeSize     = 10 * 1024 * 1024 // 10MB, same cap as the Node target
+	defaultLargeSize = 1024
+	maxSlowDelayMS   = 30000
+	defaultSlowMS    = 1000
+)
+
+var startTime = time.Now()
+
+func main() {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: parseLogLevel(os.Getenv("LOG_LEVEL")),
+	})
+	logger := slog.New(handler).With("service", "h3target")
+	slog.SetDefault(logger)
+
+	port := os.Getenv("H3_PORT")
+	if port == "" {
+		port = "3444"
+	}
+	masquePort := os.Getenv("MASQUE_PORT")
+	if masquePort == "" {
+		masquePort = "3445"
+	}
+
+	tlsConf, err := selfSignedTLSConfig()
+	if err != nil {
+		logger.Error("TLS cert generation failed",
+			"module", "h3target",
+			"error_detail", err.Error(),
+		)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/echo", handleEcho)
+	mux.HandleFunc("/ip", handleIP)
+	mux.HandleFunc("/large", handleLarge)
+	mux.HandleFunc("/slow", handleSlow)
+
+	// Target and proxy listen separately: the proxy's outer packets must be larger
+	// than the target's packets they carry, so they cannot share one QUIC config
+	srv := &http3.Server{
+		Addr:      ":" + port,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConf),
+		Handler:   withObservedIP(mux),
+	}
+	masqueSrv := &http3.Server{
+		Addr:            ":" + masquePort,
+		TLSConfig:       http3.ConfigureTLSConfig(tlsConf),
+		EnableDatagrams: true,
+		QUICConfig: &quic.Config{
+			EnableDatagrams:   true,
+			InitialPacketSize: 1350,
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodConnect || r.Proto != "connect-udp" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			handleConnectUDP(w, r, logger)
+		}),
+	}
+
+	logger.Info("HTTP3 target starting",
+		"module", "h3target",
+		"phase", "startup",
+		"port", port,
+		"masque_port", masquePort,
+		"routes", []string{"/health", "/echo", "/ip", "/large", "/slow"},
+		"go_version", runtime.Version(),
+	)
+
+	for _, s := range []*http3.Server{srv, masqueSrv} {
+		go func(s *http3.Server) {
+			if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("HTTP3 listener failed",
+					"module", "h3target",
+					"addr", s.Addr,
+					"error_detail", err.Error(),
+				)
+				os.Exit(1)
+			}
+		}(s)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-sigChan
+
+	logger.Info("HTTP3 target shutdown",
+		"module", "h3target",
+		"signal", sig.String(),
+	)
+	srv.Close()
+	masqueSrv.Close()
+}
+
+func handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"status":    "ok",
+		"uptime_ms": time.Since(startTime).Milliseconds(),
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func handleEcho(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var body any
+	contentLength := 0
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		raw, _ := io.ReadAll(r.Body)
+		contentLength = len(raw)
+		if len(raw) > 0 {
+			json.Unmarshal(raw, &body)
+		}
+	}
+
+	writeJSON(w, map[string]any{
+		"method": r.Method,
+		"body":   body,
+		"headers": map[string]any{
+			"user-agent": headerOrNil(r, "User-Agent"),
+			"x-run-id":   headerOrNil(r, "X-Run-Id"),
+			"x-seq":      headerOrNil(r, "X-Seq"),
+		},
+		"content_length": contentLength,
+		"timestamp":      time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func handleIP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	writeJSON(w, map[string]any{
+		"ip": clientIP,
+		"headers": map[string]any{
+			"x-forwarded-for": headerOrNil(r, "X-Forwarded-For"),
+			"x-real-ip":       headerOrNil(r, "X-Real-Ip"),
+		},
+		"timestamp": time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func handleLarge(w http.ResponseWriter, r *http.Request) {
+	size := defaultLargeSize
+	if n, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		size = min(max(n, 1), maxLargeSize)
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+
+	chunk := make([]byte, 64*1024)
+	for remaining := size; remaining > 0; {
+		n := min(len(chunk), remaining)
+		rand.Read(chunk[:n])
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		remaining -= n
+	}
+}
+
+func handleSlow(w http.ResponseWriter, r *http.Request) {
+	delay := defaultSlowMS
+	if n, err := strconv.Atoi(r.URL.Query().Get("delay")); err == nil {
+		delay = min(max(n, 0), maxSlowDelayMS)
+	}
+
+	select {
+	case <-time.After(time.Duration(delay) * time.Millisecond):
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, map[string]any{
+		"delayed_ms": delay,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// handleConnectUDP proxies context ID 0 HTTP datagrams to the UDP target named in the path
+// (/.well-known/masque/udp/{host}/{port}/) until either side closes the stream
+func handleConnectUDP(w http.ResponseWriter, r *http.Request, logger *slog.Logger) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, proxy.MASQUEUDPPathPrefix), "/")
+	if !strings.HasPrefix(r.URL.Path, proxy.MASQUEUDPPathPrefix) || len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get(http3.CapsuleProtocolHeader) != "?1" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	targetAddr := net.JoinHostPort(parts[0], parts[1])
+	conn, err := net.Dial("udp", targetAddr)
+	if err != nil {
+		logger.Warn("CONNECT-UDP target dial failed",
+			"module", "h3target.masque",
+			"target_addr", targetAddr,
+			"error_detail", err.Error(),
+		)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer conn.Close()
+
+	w.Header().Set(http3.CapsuleProtocolHeader, "?1")
+	w.WriteHeader(http.StatusOK)
+	str := w.(http3.HTTPStreamer).HTTPStream()
+	defer str.Close()
+
+	logger.Debug("CONNECT-UDP tunnel open",
+		"module", "h3target.masque",
+		"target_addr", targetAddr,
+		"client_addr", r.RemoteAddr,
+	)
+
+	// The client ends the tunnel by closing the stream; capsules are not used
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		io.Copy(io.Discard, str)
+		cancel()
+	}()
+
+	// target → client
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				cancel()
+				return
+			}
+			data := make([]byte, 0, n+1)
+			data = append(data, 0)
+			if err := str.SendDatagram(append(data, buf[:n]...)); err != nil {
+				logger.Debug("CONNECT-UDP datagram dropped",
+					"module", "h3target.masque",
+					"size", n,
+					"error_detail", err.Error(),
+				)
+			}
+		}
+	}()
+
+	// client → target
+	for {
+		data, err := str.ReceiveDatagram(ctx)
+		if err != nil {
+			break
+		}
+		contextID, n, err := quicvarint.Parse(data)
+		if err != nil || contextID != 0 {
+			continue
+		}
+		conn.Write(data[n:])
+	}
+
+	logger.Debug("CONNECT-UDP tunnel closed",
+		"module", "h3target.masque",
+		"target_addr", targetAddr,
+	)
+}
+
+// withObservedIP reports the peer address on every response, as the Node target does,
+// so samples can record the family the proxy egressed on
+func withObservedIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			w.Header().Set(proxy.ObservedIPHeader, host)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func headerOrNil(r *http.Request, name string) any {
+	if v := r.Header.Get(name); v != "" {
+		return v
+	}
+	return nil
+}
+
+// selfSignedTLSConfig generates a throwaway ECDSA certificate; the runner skips verification
+func selfSignedTLSConfig() (*tls.Config, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "h3target"},
+		DNSNames:     []string{"h3target", "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}, nil
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
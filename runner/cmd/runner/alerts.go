@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxy-stability-test/runner/internal/alert"
+)
+
+// alertConfig reads the ALERT_* variables. Each configured webhook becomes a channel;
+// with none configured alerting is off.
+func alertConfig() (alert.Config, error) {
+	cfg := alert.Config{
+		ScoreThreshold:  0.5,
+		UptimeThreshold: 0.9,
+		Cooldown:        15 * time.Minute,
+	}
+
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		cfg.Channels = append(cfg.Channels, alert.Channel{Name: "webhook", URL: url, Format: "json"})
+	}
+	if url := os.Getenv("ALERT_SLACK_WEBHOOK_URL"); url != "" {
+		cfg.Channels = append(cfg.Channels, alert.Channel{Name: "slack", URL: url, Format: "slack"})
+	}
+	if key := os.Getenv("ALERT_PAGERDUTY_ROUTING_KEY"); key != "" {
+		url := os.Getenv("ALERT_PAGERDUTY_URL")
+		if url == "" {
+			url = alert.DefaultPagerDutyURL
+		}
+		cfg.Channels = append(cfg.Channels, alert.Channel{Name: "pagerduty", URL: url, Format: "pagerduty", RoutingKey: key})
+	}
+
+	if v := os.Getenv("ALERT_EVENTS"); v != "" {
+		cfg.Events = make(map[string]bool)
+		for _, event := range sinkNames(v) {
+			if !slices.Contains(alert.AllEvents, event) {
+				return cfg, fmt.Errorf("ALERT_EVENTS: unknown event %q, expected one of %s",
+					event, strings.Join(alert.AllEvents, ", "))
+			}
+			cfg.Events[event] = true
+		}
+	}
+
+	var err error
+	if cfg.ScoreThreshold, err = ratioEnv("ALERT_SCORE_THRESHOLD", cfg.ScoreThreshold); err != nil {
+		return cfg, err
+	}
+	if cfg.UptimeThreshold, err = ratioEnv("ALERT_UPTIME_THRESHOLD", cfg.UptimeThreshold); err != nil {
+		return cfg, err
+	}
+	if v := os.Getenv("ALERT_COOLDOWN_SEC"); v != "" {
+		sec, err := strconv.Atoi(v)
+		if err != nil || sec < 0 {
+			return cfg, fmt.Errorf("ALERT_COOLDOWN_SEC must be a non-negative integer")
+		}
+		cfg.Cooldown = time.Duration(sec) * time.Second
+	}
+	return cfg, nil
+}
+
+// ratioEnv reads a 0-1 threshold; 0 disables the alert it guards
+func ratioEnv(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 || f > 1 {
+		return def, fmt.Errorf("%s must be between 0 and 1", name)
+	}
+	return f, nil
+}
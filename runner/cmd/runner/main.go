@@ -10,7 +10,10 @@ import (
 	"syscall"
 	"time"
 
+	"proxy-stability-test/runner/internal/alert"
+	"proxy-stability-test/runner/internal/reporter"
 	"proxy-stability-test/runner/internal/server"
+	"proxy-stability-test/runner/internal/tracing"
 )
 
 func main() {
@@ -33,16 +36,112 @@ func main() {
 
 	dbURL := os.Getenv("DATABASE_URL")
 
+	// REPORTER lists the sinks every run reports to: api, db (straight to PostgreSQL so
+	// runs survive without the API), file (per-run NDJSON/Parquet for offline analysis),
+	// metrics (the Prometheus series on /metrics), or several comma-separated
+	reporterSinks := os.Getenv("REPORTER")
+	if reporterSinks == "" {
+		reporterSinks = "api,metrics"
+	}
+
+	// Reports a sink cannot take wait under SPOOL_DIR/<sink>, up to SPOOL_MAX_MB and
+	// SPOOL_MAX_AGE_HOURS per sink; SPOOL_DIR=off disables spooling
+	spoolDir := os.Getenv("SPOOL_DIR")
+	if spoolDir == "" {
+		spoolDir = "/var/spool/runner"
+	}
+
+	// Probe spans go to an OTLP/HTTP collector when one is configured
+	otelEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+
 	logger.Info("Runner process starting",
 		"module", "server.handler",
 		"phase", "startup",
 		"port", port,
 		"api_url", apiURL,
+		"reporter", reporterSinks,
+		"spool_dir", spoolDir,
+		"otel_endpoint", otelEndpoint,
 		"go_version", runtime.Version(),
 	)
 
+	names := sinkNames(reporterSinks)
+	if len(names) == 0 {
+		names = []string{"api", "metrics"}
+	}
+	limits, err := spoolLimits()
+	if err != nil {
+		logger.Error("Spool setup failed",
+			"module", "server.handler",
+			"phase", "startup",
+			"spool_dir", spoolDir,
+			"error_detail", err.Error(),
+		)
+		os.Exit(1)
+	}
+	sinks, closeSinks, err := buildSinks(names, apiURL, dbURL, spoolDir, limits, logger)
+	if err != nil {
+		logger.Error("Reporter setup failed",
+			"module", "server.handler",
+			"phase", "startup",
+			"reporter", reporterSinks,
+			"error_detail", err.Error(),
+		)
+		os.Exit(1)
+	}
+	defer closeSinks()
+	fanOut := reporter.NewFanOut(sinks, logger)
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if otelEndpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), logger)
+		if err != nil {
+			// Tracing is diagnostic; runs go ahead without it
+			logger.Warn("Tracing disabled",
+				"module", "server.handler",
+				"phase", "startup",
+				"error_detail", err.Error(),
+			)
+		} else {
+			shutdownTracing = shutdown
+		}
+	}
+
+	alertCfg, err := alertConfig()
+	if err != nil {
+		logger.Error("Alert setup failed",
+			"module", "server.handler",
+			"phase", "startup",
+			"error_detail", err.Error(),
+		)
+		os.Exit(1)
+	}
+	alerts := alert.NewManager(alertCfg, logger)
+	for _, ch := range alertCfg.Channels {
+		logger.Info("Alert channel configured",
+			"module", "server.handler",
+			"phase", "startup",
+			"channel", ch.Name,
+			"score_threshold", alertCfg.ScoreThreshold,
+			"uptime_threshold", alertCfg.UptimeThreshold,
+			"cooldown_sec", alertCfg.Cooldown.Seconds(),
+		)
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	go alerts.Run(bgCtx)
+
+	// Each spool replays into its own sink, never back through the spool
+	for _, sink := range sinks {
+		if sink.Spool != nil {
+			go sink.Spool.Replay(bgCtx, fanOut.ReplayTarget(sink.Name))
+		}
+	}
+
 	// Create handler and register routes
-	h := server.NewHandler(logger, apiURL, dbURL)
+	h := server.NewHandler(logger, fanOut, alerts)
 	mux := http.NewServeMux()
 	h.RegisterRoutes(mux)
 
@@ -86,6 +185,12 @@ func main() {
 			"error_detail", err.Error(),
 		)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Trace flush error",
+			"module", "server.handler",
+			"error_detail", err.Error(),
+		)
+	}
 }
 
 func parseLogLevel(level string) slog.Level {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxy-stability-test/runner/internal/reporter"
+)
+
+const (
+	defaultSinkTimeout = 30 * time.Second
+	defaultSpoolMaxMB  = 1024
+	defaultSpoolMaxAge = 72 * time.Hour
+)
+
+// buildSinks creates the sinks named in REPORTER (e.g. "api,metrics" or "api,file"). Each sink's
+// policy comes from REPORTER_<NAME>_REQUIRED, _TIMEOUT_MS and _BATCH_SIZE; the first
+// sink listed is required unless told otherwise, the rest are best-effort. With a spool
+// directory each sink but metrics spools under its own subdirectory; a sink whose spool
+// cannot be opened runs without one. The returned cleanup closes any database pool.
+func buildSinks(names []string, apiURL, dbURL, spoolDir string, limits reporter.SpoolLimits, logger *slog.Logger) ([]reporter.Sink, func(), error) {
+	var sinks []reporter.Sink
+	var closers []func()
+	cleanup := func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if seen[name] {
+			cleanup()
+			return nil, nil, fmt.Errorf("sink %s listed twice", name)
+		}
+		seen[name] = true
+
+		policy, err := sinkPolicy(name, i == 0)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		var sink reporter.Sink
+		switch name {
+		case "api":
+			sink = reporter.NewAPISink(apiURL, policy, logger)
+		case "db":
+			if dbURL == "" {
+				cleanup()
+				return nil, nil, fmt.Errorf("DATABASE_URL is required for the db sink")
+			}
+			connectCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			db, err := reporter.NewDBReporter(connectCtx, dbURL, logger)
+			cancel()
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			closers = append(closers, db.Close)
+			sink = reporter.NewDBSink(db, policy)
+		case "file":
+			opts, dir, err := fileOptions()
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			file, err := reporter.NewFileReporter(dir, opts, logger)
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			sink = reporter.NewFileSink(file, policy)
+		case "metrics":
+			sink = reporter.NewMetricsSink(policy)
+		default:
+			cleanup()
+			return nil, nil, fmt.Errorf("unknown sink %q, expected api, db, file or metrics", name)
+		}
+
+		if spoolDir != "off" && name != "metrics" {
+			spool, err := reporter.OpenSpool(filepath.Join(spoolDir, name), limits, logger)
+			if err != nil {
+				// Spooling only protects against outages; the sink still works without it
+				logger.Warn("Spool disabled",
+					"module", "server.handler",
+					"phase", "startup",
+					"sink", name,
+					"spool_dir", spoolDir,
+					"error_detail", err.Error(),
+				)
+			} else {
+				sink.Spool = spool
+			}
+		}
+
+		logger.Info("Reporter sink configured",
+			"module", "server.handler",
+			"phase", "startup",
+			"sink", name,
+			"required", policy.Required,
+			"timeout_ms", policy.Timeout.Milliseconds(),
+			"batch_size", policy.BatchSize,
+			"spooled", sink.Spool != nil,
+		)
+		sinks = append(sinks, sink)
+	}
+	return sinks, cleanup, nil
+}
+
+// sinkPolicy reads REPORTER_<NAME>_* for one sink
+func sinkPolicy(name string, first bool) (reporter.SinkPolicy, error) {
+	prefix := "REPORTER_" + strings.ToUpper(name) + "_"
+	policy := reporter.SinkPolicy{Required: first, Timeout: defaultSinkTimeout}
+
+	if v := os.Getenv(prefix + "REQUIRED"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return policy, fmt.Errorf("%sREQUIRED: %w", prefix, err)
+		}
+		policy.Required = required
+	}
+	if v := os.Getenv(prefix + "TIMEOUT_MS"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return policy, fmt.Errorf("%sTIMEOUT_MS must be a positive integer", prefix)
+		}
+		policy.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	if v := os.Getenv(prefix + "BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return policy, fmt.Errorf("%sBATCH_SIZE must be a non-negative integer", prefix)
+		}
+		policy.BatchSize = n
+	}
+	return policy, nil
+}
+
+// fileOptions reads REPORTER_FILE_DIR, _FORMAT and _MAX_MB for the file sink
+func fileOptions() (reporter.FileOptions, string, error) {
+	var opts reporter.FileOptions
+	dir := os.Getenv("REPORTER_FILE_DIR")
+	if dir == "" {
+		dir = "/var/lib/runner/results"
+	}
+	switch format := strings.ToLower(os.Getenv("REPORTER_FILE_FORMAT")); format {
+	case "", "ndjson":
+	case "parquet":
+		opts.Parquet = true
+	default:
+		return opts, "", fmt.Errorf("REPORTER_FILE_FORMAT must be ndjson or parquet, got %q", format)
+	}
+	if v := os.Getenv("REPORTER_FILE_MAX_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb <= 0 {
+			return opts, "", fmt.Errorf("REPORTER_FILE_MAX_MB must be a positive integer")
+		}
+		opts.MaxFileBytes = int64(mb) << 20
+	}
+	return opts, dir, nil
+}
+
+// spoolLimits reads SPOOL_MAX_MB and SPOOL_MAX_AGE_HOURS; 0 leaves a limit off
+func spoolLimits() (reporter.SpoolLimits, error) {
+	limits := reporter.SpoolLimits{MaxBytes: defaultSpoolMaxMB << 20, MaxAge: defaultSpoolMaxAge}
+	if v := os.Getenv("SPOOL_MAX_MB"); v != "" {
+		mb, err := strconv.Atoi(v)
+		if err != nil || mb < 0 {
+			return limits, fmt.Errorf("SPOOL_MAX_MB must be a non-negative integer")
+		}
+		limits.MaxBytes = int64(mb) << 20
+	}
+	if v := os.Getenv("SPOOL_MAX_AGE_HOURS"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours < 0 {
+			return limits, fmt.Errorf("SPOOL_MAX_AGE_HOURS must be a non-negative integer")
+		}
+		limits.MaxAge = time.Duration(hours) * time.Hour
+	}
+	return limits, nil
+}
+
+// sinkNames splits a comma-separated REPORTER value
+func sinkNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,265 @@
+// Package alert notifies people through webhooks when a run needs attention: the proxy
+// is unreachable, its exit IP moved, or its score or uptime collapsed
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/metrics"
+)
+
+// Event types
+const (
+	EventConnectivityFailed = "connectivity_failed"
+	EventIPChanged          = "ip_changed"
+	EventScoreLow           = "score_low"
+	EventUptimeCollapse     = "uptime_collapse"
+	EventGeoMismatch        = "geo_mismatch"
+)
+
+// AllEvents lists every event type, in the order they are documented
+var AllEvents = []string{
+	EventConnectivityFailed,
+	EventIPChanged,
+	EventScoreLow,
+	EventUptimeCollapse,
+	EventGeoMismatch,
+}
+
+// Severities, mapped onto each channel's own levels
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+)
+
+// Event is one alert about one run
+type Event struct {
+	Type       string         `json:"type"`
+	Severity   string         `json:"severity"`
+	RunID      string         `json:"run_id"`
+	ProxyLabel string         `json:"proxy_label"`
+	Summary    string         `json:"summary"`
+	Details    map[string]any `json:"details,omitempty"`
+	Resolved   bool           `json:"resolved"` // the condition that fired this event has cleared
+	At         time.Time      `json:"at"`
+}
+
+// key identifies an alert for dedup: one per run and event type
+func (e Event) key() string {
+	return e.RunID + "/" + e.Type
+}
+
+// Channel is one webhook destination
+type Channel struct {
+	Name   string // "webhook", "slack" or "pagerduty"; also the metrics label
+	URL    string
+	Format string // payload shape: "json", "slack" or "pagerduty"
+	// RoutingKey is the PagerDuty Events API v2 integration key
+	RoutingKey string
+}
+
+// Config selects channels, events and thresholds
+type Config struct {
+	Channels []Channel
+	// Events enabled by type; nil enables all
+	Events map[string]bool
+	// ScoreThreshold fires score_low when the rolling ScoreTotal drops below it
+	ScoreThreshold float64
+	// UptimeThreshold fires uptime_collapse when the rolling UptimeRatio drops below it
+	UptimeThreshold float64
+	// Cooldown suppresses repeats of the same run's event type for this long
+	Cooldown time.Duration
+}
+
+const (
+	queueSize     = 256
+	maxAttempts   = 3
+	sendTimeout   = 10 * time.Second
+	minSampleSize = 20 // samples a rolling summary needs before scores can alert
+)
+
+// Manager dedups events and delivers them to every channel in the background. It is
+// built once per process and shared by all runs; a nil Manager ignores everything.
+type Manager struct {
+	cfg    Config
+	client *http.Client
+	logger *slog.Logger
+	queue  chan Event
+
+	mu     sync.Mutex
+	last   map[string]time.Time // key -> last fired
+	active map[string]Event     // key -> firing condition awaiting resolve
+}
+
+// NewManager returns a Manager for cfg; call Run to start delivery
+func NewManager(cfg Config, logger *slog.Logger) *Manager {
+	return &Manager{
+		cfg:    cfg,
+		client: &http.Client{Timeout: sendTimeout},
+		logger: logger.With("module", "alert.manager"),
+		queue:  make(chan Event, queueSize),
+		last:   make(map[string]time.Time),
+		active: make(map[string]Event),
+	}
+}
+
+// Run delivers queued events until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-m.queue:
+			for _, ch := range m.cfg.Channels {
+				m.deliver(ctx, ch, ev)
+			}
+		}
+	}
+}
+
+// Fire queues ev unless its type is disabled or the same run fired it within the cooldown
+func (m *Manager) Fire(ev Event) {
+	if m == nil || !m.enabled(ev.Type) {
+		return
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+
+	m.mu.Lock()
+	key := ev.key()
+	if last, ok := m.last[key]; ok && ev.At.Sub(last) < m.cfg.Cooldown {
+		m.mu.Unlock()
+		metrics.Alert(ev.Type, "suppressed")
+		m.logger.Debug("Alert suppressed",
+			"run_id", ev.RunID,
+			"event", ev.Type,
+			"cooldown_sec", m.cfg.Cooldown.Seconds(),
+		)
+		return
+	}
+	m.last[key] = ev.At
+	m.active[key] = ev
+	m.mu.Unlock()
+
+	m.enqueue(ev, "fired")
+}
+
+// Resolve sends a resolved event for eventType if it is currently firing for runID
+func (m *Manager) Resolve(runID, eventType string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	key := runID + "/" + eventType
+	ev, ok := m.active[key]
+	if ok {
+		delete(m.active, key)
+		delete(m.last, key) // a relapse alerts straight away
+	}
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	ev.Resolved = true
+	ev.Summary = "Resolved: " + ev.Summary
+	ev.At = time.Now()
+	m.enqueue(ev, "resolved")
+}
+
+// CheckSummary fires or resolves score_low and uptime_collapse from a rolling summary
+func (m *Manager) CheckSummary(runID, proxyLabel string, s domain.RunSummary) {
+	if m == nil || s.HTTPSampleCount+s.HTTPSSampleCount < minSampleSize {
+		return
+	}
+
+	if m.cfg.ScoreThreshold > 0 {
+		if s.ScoreTotal < m.cfg.ScoreThreshold {
+			m.Fire(Event{
+				Type:       EventScoreLow,
+				Severity:   SeverityWarning,
+				RunID:      runID,
+				ProxyLabel: proxyLabel,
+				Summary:    fmt.Sprintf("%s score %.2f is below %.2f", proxyLabel, s.ScoreTotal, m.cfg.ScoreThreshold),
+				Details: map[string]any{
+					"score_total":   s.ScoreTotal,
+					"threshold":     m.cfg.ScoreThreshold,
+					"score_uptime":  s.ScoreUptime,
+					"score_latency": s.ScoreLatency,
+					"score_jitter":  s.ScoreJitter,
+				},
+			})
+		} else {
+			m.Resolve(runID, EventScoreLow)
+		}
+	}
+
+	if m.cfg.UptimeThreshold > 0 {
+		if s.UptimeRatio < m.cfg.UptimeThreshold {
+			m.Fire(Event{
+				Type:       EventUptimeCollapse,
+				Severity:   SeverityCritical,
+				RunID:      runID,
+				ProxyLabel: proxyLabel,
+				Summary:    fmt.Sprintf("%s uptime %.1f%% is below %.1f%%", proxyLabel, s.UptimeRatio*100, m.cfg.UptimeThreshold*100),
+				Details: map[string]any{
+					"uptime_ratio":       s.UptimeRatio,
+					"threshold":          m.cfg.UptimeThreshold,
+					"http_success_count": s.HTTPSuccessCount,
+					"http_error_count":   s.HTTPErrorCount,
+				},
+			})
+		} else {
+			m.Resolve(runID, EventUptimeCollapse)
+		}
+	}
+}
+
+// ForgetRun drops a finished run's dedup state
+func (m *Manager) ForgetRun(runID string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, eventType := range AllEvents {
+		delete(m.last, runID+"/"+eventType)
+		delete(m.active, runID+"/"+eventType)
+	}
+}
+
+func (m *Manager) enabled(eventType string) bool {
+	if len(m.cfg.Channels) == 0 {
+		return false
+	}
+	return m.cfg.Events == nil || m.cfg.Events[eventType]
+}
+
+// enqueue hands ev to the delivery loop without ever blocking a run
+func (m *Manager) enqueue(ev Event, outcome string) {
+	select {
+	case m.queue <- ev:
+		metrics.Alert(ev.Type, outcome)
+		m.logger.Info("Alert queued",
+			"run_id", ev.RunID,
+			"proxy_label", ev.ProxyLabel,
+			"event", ev.Type,
+			"severity", ev.Severity,
+			"resolved", ev.Resolved,
+		)
+	default:
+		metrics.Alert(ev.Type, "dropped")
+		m.logger.Warn("Alert dropped, queue full",
+			"run_id", ev.RunID,
+			"event", ev.Type,
+			"queue_size", queueSize,
+		)
+	}
+}
@@ -0,0 +1,166 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"proxy-stability-test/runner/internal/metrics"
+)
+
+// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// deliver posts ev to one channel, retrying transient failures
+func (m *Manager) deliver(ctx context.Context, ch Channel, ev Event) {
+	body, err := json.Marshal(payload(ch, ev))
+	if err != nil {
+		metrics.AlertDelivery(ch.Name, "failed")
+		return
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(attempt*attempt) * time.Second
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		}
+
+		lastErr = m.post(ctx, ch.URL, body)
+		if lastErr == nil {
+			metrics.AlertDelivery(ch.Name, "ok")
+			return
+		}
+		var permanent permanentError
+		if errors.As(lastErr, &permanent) {
+			break
+		}
+	}
+
+	metrics.AlertDelivery(ch.Name, "failed")
+	m.logger.Error("Alert delivery fail",
+		"run_id", ev.RunID,
+		"event", ev.Type,
+		"channel", ch.Name,
+		"error_detail", lastErr.Error(),
+	)
+}
+
+// permanentError is a failure resending the same payload will not fix: a bad URL or a
+// 4xx answer
+type permanentError struct {
+	reason string
+}
+
+func (e permanentError) Error() string {
+	return e.reason
+}
+
+func (m *Manager) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{reason: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return permanentError{reason: fmt.Sprintf("webhook rejected payload: http %d", resp.StatusCode)}
+	default:
+		return fmt.Errorf("webhook unavailable: http %d", resp.StatusCode)
+	}
+}
+
+// payload shapes ev for the channel's receiver
+func payload(ch Channel, ev Event) any {
+	switch ch.Format {
+	case "slack":
+		return slackPayload(ev)
+	case "pagerduty":
+		return pagerDutyPayload(ch.RoutingKey, ev)
+	default:
+		return ev
+	}
+}
+
+// slackPayload is an incoming-webhook message; Mattermost and Discord's /slack endpoint
+// accept the same shape
+func slackPayload(ev Event) map[string]any {
+	icon := ":warning:"
+	switch {
+	case ev.Resolved:
+		icon = ":white_check_mark:"
+	case ev.Severity == SeverityCritical:
+		icon = ":rotating_light:"
+	}
+
+	fields := []map[string]any{
+		{"title": "Run", "value": ev.RunID, "short": true},
+		{"title": "Proxy", "value": ev.ProxyLabel, "short": true},
+	}
+	keys := make([]string, 0, len(ev.Details))
+	for k := range ev.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, map[string]any{"title": k, "value": fmt.Sprint(ev.Details[k]), "short": true})
+	}
+
+	color := "warning"
+	switch {
+	case ev.Resolved:
+		color = "good"
+	case ev.Severity == SeverityCritical:
+		color = "danger"
+	}
+
+	return map[string]any{
+		"text": fmt.Sprintf("%s *%s* %s", icon, ev.Type, ev.Summary),
+		"attachments": []map[string]any{{
+			"color":  color,
+			"fields": fields,
+			"ts":     ev.At.Unix(),
+		}},
+	}
+}
+
+// pagerDutyPayload is an Events API v2 event. The dedup key is per run and event type,
+// so a resolved event closes the incident its trigger opened.
+func pagerDutyPayload(routingKey string, ev Event) map[string]any {
+	action := "trigger"
+	if ev.Resolved {
+		action = "resolve"
+	}
+	return map[string]any{
+		"routing_key":  routingKey,
+		"event_action": action,
+		"dedup_key":    "proxy-stability/" + ev.key(),
+		"payload": map[string]any{
+			"summary":        ev.Summary,
+			"source":         ev.ProxyLabel,
+			"severity":       ev.Severity,
+			"timestamp":      ev.At.UTC().Format(time.RFC3339),
+			"component":      "runner",
+			"class":          ev.Type,
+			"custom_details": ev.Details,
+		},
+	}
+}
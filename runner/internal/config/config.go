@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+
 	"proxy-stability-test/runner/internal/domain"
 )
 
@@ -9,6 +12,7 @@ const (
 	DefaultHTTPRPM            = 500
 	DefaultHTTPSRPM           = 500
 	DefaultWSMessagesPerMin   = 60
+	DefaultUDPPacketsPerMin   = 600
 	DefaultRequestTimeoutMS   = 10000
 	DefaultWarmupRequests     = 5
 	DefaultSummaryIntervalSec = 30
@@ -25,29 +29,221 @@ func FromTrigger(tr domain.TriggerRun) domain.RunConfig {
 	cfg.HTTPRPM = withDefault(tr.Config.HTTPRPM, DefaultHTTPRPM)
 	cfg.HTTPSRPM = withDefault(tr.Config.HTTPSRPM, DefaultHTTPSRPM)
 	cfg.WSMessagesPerMin = withDefault(tr.Config.WSMessagesPerMin, DefaultWSMessagesPerMin)
+	cfg.UDPPacketsPerMin = withDefault(tr.Config.UDPPacketsPerMin, DefaultUDPPacketsPerMin)
 	cfg.RequestTimeoutMS = withDefault(tr.Config.RequestTimeoutMS, DefaultRequestTimeoutMS)
 	cfg.WarmupRequests = withDefault(tr.Config.WarmupRequests, DefaultWarmupRequests)
 	cfg.SummaryIntervalSec = withDefault(tr.Config.SummaryIntervalSec, DefaultSummaryIntervalSec)
 
+	// IPv6 literal hosts may arrive bracketed ("[2001:db8::1]"); dialers add brackets themselves
+	cfg.Proxy.Host = unbracket(cfg.Proxy.Host)
+	for i := range cfg.Proxy.Chain {
+		cfg.Proxy.Chain[i].Host = unbracket(cfg.Proxy.Chain[i].Host)
+	}
+	cfg.IPFamily = tr.Config.IPFamily
+	if cfg.IPFamily == "" {
+		cfg.IPFamily = domain.IPFamilyAuto
+	}
+	cfg.Proxy.IPFamily = cfg.IPFamily
+	if cfg.Proxy.Rotation.Mode == "" {
+		cfg.Proxy.Rotation.Mode = domain.RotationNone
+	}
+
+	cfg.RunMode = tr.Config.RunMode
+	if cfg.RunMode == "" {
+		cfg.RunMode = domain.RunModeContinuous
+	}
+	cfg.DurationSec = tr.Config.DurationSec
+	cfg.TargetSamples = tr.Config.TargetSamples
+
 	// Parse scoring config, use defaults for zero values
-	sc := domain.DefaultScoringConfig()
-	if tr.Config.ScoringConfig != nil {
-		if tr.Config.ScoringConfig.LatencyThresholdMs > 0 {
-			sc.LatencyThresholdMs = tr.Config.ScoringConfig.LatencyThresholdMs
-		}
-		if tr.Config.ScoringConfig.JitterThresholdMs > 0 {
-			sc.JitterThresholdMs = tr.Config.ScoringConfig.JitterThresholdMs
-		}
-		if tr.Config.ScoringConfig.WSHoldTargetMs > 0 {
-			sc.WSHoldTargetMs = tr.Config.ScoringConfig.WSHoldTargetMs
-		}
-		if tr.Config.ScoringConfig.IPCheckIntervalSec > 0 {
-			sc.IPCheckIntervalSec = tr.Config.ScoringConfig.IPCheckIntervalSec
+	cfg.ScoringCfg = MergeScoring(domain.DefaultScoringConfig(), tr.Config.ScoringConfig)
+	cfg.IncidentCfg = mergeIncident(domain.DefaultIncidentConfig(), tr.Config.IncidentConfig)
+	cfg.LoadProfile = withLoadDefaults(tr.Config.LoadProfile)
+
+	return cfg
+}
+
+// withLoadDefaults fills the zero fields of p from its type's defaults
+func withLoadDefaults(p *domain.LoadProfile) *domain.LoadProfile {
+	if p == nil {
+		return nil
+	}
+	out := domain.DefaultLoadProfile(p.Type)
+	if p.BasePct > 0 {
+		out.BasePct = p.BasePct
+	}
+	if p.PeakPct > 0 {
+		out.PeakPct = p.PeakPct
+	}
+	if p.DurationSec > 0 {
+		out.DurationSec = p.DurationSec
+	}
+	if p.Steps > 0 {
+		out.Steps = p.Steps
+	}
+	if p.PeriodSec > 0 {
+		out.PeriodSec = p.PeriodSec
+	}
+	return &out
+}
+
+// IsSupportedLoadProfile reports whether p is a known profile without negative fields;
+// a spike must also end before the next one starts
+func IsSupportedLoadProfile(p *domain.LoadProfile) bool {
+	if p == nil {
+		return true
+	}
+	if p.BasePct < 0 || p.PeakPct < 0 || p.DurationSec < 0 || p.Steps < 0 || p.PeriodSec < 0 {
+		return false
+	}
+	switch p.Type {
+	case domain.LoadProfileRamp, domain.LoadProfileStep, domain.LoadProfileSine:
+		return true
+	case domain.LoadProfileSpike:
+		full := withLoadDefaults(p)
+		return full.DurationSec < full.PeriodSec
+	default:
+		return false
+	}
+}
+
+// mergeIncident overlays the positive fields of patch onto base
+func mergeIncident(base domain.IncidentConfig, patch *domain.IncidentConfig) domain.IncidentConfig {
+	if patch == nil {
+		return base
+	}
+	if patch.ConsecutiveFailures > 0 {
+		base.ConsecutiveFailures = patch.ConsecutiveFailures
+	}
+	if patch.ErrorRateThreshold > 0 {
+		base.ErrorRateThreshold = patch.ErrorRateThreshold
+	}
+	if patch.ErrorRateWindowSec > 0 {
+		base.ErrorRateWindowSec = patch.ErrorRateWindowSec
+	}
+	if patch.MinWindowSamples > 0 {
+		base.MinWindowSamples = patch.MinWindowSamples
+	}
+	if patch.RecoverySuccesses > 0 {
+		base.RecoverySuccesses = patch.RecoverySuccesses
+	}
+	return base
+}
+
+// IsSupportedIncidentConfig rejects negative thresholds and an error rate above 1
+func IsSupportedIncidentConfig(c *domain.IncidentConfig) bool {
+	if c == nil {
+		return true
+	}
+	return c.ConsecutiveFailures >= 0 && c.ErrorRateWindowSec >= 0 && c.MinWindowSamples >= 0 &&
+		c.RecoverySuccesses >= 0 && c.ErrorRateThreshold >= 0 && c.ErrorRateThreshold <= 1
+}
+
+// MergeScoring overlays the positive fields of patch onto base
+func MergeScoring(base domain.ScoringConfig, patch *domain.ScoringConfig) domain.ScoringConfig {
+	if patch == nil {
+		return base
+	}
+	if patch.LatencyThresholdMs > 0 {
+		base.LatencyThresholdMs = patch.LatencyThresholdMs
+	}
+	if patch.JitterThresholdMs > 0 {
+		base.JitterThresholdMs = patch.JitterThresholdMs
+	}
+	if patch.WSHoldTargetMs > 0 {
+		base.WSHoldTargetMs = patch.WSHoldTargetMs
+	}
+	if patch.IPCheckIntervalSec > 0 {
+		base.IPCheckIntervalSec = patch.IPCheckIntervalSec
+	}
+	return base
+}
+
+// ValidatePatch checks a PATCH /runs/{run_id} body: rates must stay positive and burst
+// and scoring values cannot be negative
+func ValidatePatch(p domain.RunConfigPatch) error {
+	rates := []struct {
+		name string
+		v    *int
+	}{
+		{"http_rpm", p.HTTPRPM},
+		{"https_rpm", p.HTTPSRPM},
+		{"ws_messages_per_minute", p.WSMessagesPerMin},
+	}
+	for _, r := range rates {
+		if r.v != nil && *r.v <= 0 {
+			return fmt.Errorf("%s must be positive", r.name)
 		}
 	}
-	cfg.ScoringCfg = sc
+	if p.Burst != nil && (p.Burst.IntervalSec < 0 || p.Burst.Concurrency < 0) {
+		return fmt.Errorf("burst interval_sec and concurrency cannot be negative")
+	}
+	if sc := p.ScoringConfig; sc != nil && (sc.LatencyThresholdMs < 0 || sc.JitterThresholdMs < 0 ||
+		sc.WSHoldTargetMs < 0 || sc.IPCheckIntervalSec < 0) {
+		return fmt.Errorf("scoring_config values cannot be negative")
+	}
+	if p.HTTPRPM == nil && p.HTTPSRPM == nil && p.WSMessagesPerMin == nil && p.Burst == nil && p.ScoringConfig == nil {
+		return fmt.Errorf("nothing to change")
+	}
+	return nil
+}
 
-	return cfg
+// IsSupportedProtocol reports whether the runner can test a proxy speaking protocol
+func IsSupportedProtocol(protocol string) bool {
+	switch protocol {
+	case "", domain.ProtocolHTTP, domain.ProtocolHTTPS,
+		domain.ProtocolSOCKS4, domain.ProtocolSOCKS4A, domain.ProtocolSOCKS5,
+		domain.ProtocolMASQUE:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsSupportedIPFamily reports whether family is a valid RunConfig.IPFamily
+func IsSupportedIPFamily(family string) bool {
+	switch family {
+	case "", domain.IPFamilyAuto, domain.IPFamilyIPv4, domain.IPFamilyIPv6:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsSupportedRunMode reports whether the run mode settings are valid: a fixed run needs
+// a duration, a sample target or both, and a continuous run takes neither
+func IsSupportedRunMode(cfg domain.TriggerRunConfig) bool {
+	if cfg.DurationSec < 0 || cfg.TargetSamples < 0 {
+		return false
+	}
+	switch cfg.RunMode {
+	case "", domain.RunModeContinuous:
+		return cfg.DurationSec == 0 && cfg.TargetSamples == 0
+	case domain.RunModeFixed:
+		return cfg.DurationSec > 0 || cfg.TargetSamples > 0
+	default:
+		return false
+	}
+}
+
+// IsSupportedRotation reports whether rotation is a valid ProxyConfig.Rotation; sticky
+// sessions are carried in the username, so they need credentials
+func IsSupportedRotation(rotation domain.RotationConfig, authUser string) bool {
+	switch rotation.Mode {
+	case "", domain.RotationNone, domain.RotationPerRequest:
+		return true
+	case domain.RotationSticky:
+		return authUser != "" && rotation.StickyMinutes >= 0
+	default:
+		return false
+	}
+}
+
+func unbracket(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
 }
 
 func withDefault(val, def int) int {
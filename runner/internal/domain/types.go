@@ -5,6 +5,51 @@ import (
 	"time"
 )
 
+// Proxy protocols accepted in ProxyConfig.Protocol (empty means http)
+const (
+	ProtocolHTTP    = "http"
+	ProtocolHTTPS   = "https"
+	ProtocolSOCKS4  = "socks4"
+	ProtocolSOCKS4A = "socks4a"
+	ProtocolSOCKS5  = "socks5"
+	ProtocolMASQUE  = "masque" // HTTP/3 CONNECT-UDP (RFC 9298)
+)
+
+// Address families accepted in RunConfig.IPFamily (empty means auto)
+const (
+	IPFamilyAuto = "auto"
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
+// Exit IP behaviour declared in RotationConfig.Mode (empty means none)
+const (
+	RotationNone       = "none"        // the exit IP should never change
+	RotationSticky     = "sticky"      // one session username holds its IP for StickyMinutes
+	RotationPerRequest = "per_request" // the provider picks a new exit IP for every request
+)
+
+// Run modes accepted in RunConfig.RunMode (empty means continuous)
+const (
+	RunModeContinuous = "continuous" // runs until POST /stop
+	RunModeFixed      = "fixed"      // stops itself after DurationSec or TargetSamples
+)
+
+// Load profiles accepted in LoadProfile.Type
+const (
+	LoadProfileRamp  = "ramp"  // linear from BasePct to PeakPct over DurationSec, then holds PeakPct
+	LoadProfileStep  = "step"  // Steps even levels from BasePct to PeakPct, DurationSec each
+	LoadProfileSpike = "spike" // BasePct, rising to PeakPct for DurationSec every PeriodSec
+	LoadProfileSine  = "sine"  // between BasePct and PeakPct, one cycle per PeriodSec, starting low
+)
+
+// Why a run stopped, reported in the final RunSummary
+const (
+	StopReasonStopped      = "stopped"               // POST /stop or runner shutdown
+	StopReasonDuration     = "duration_reached"      // fixed run reached DurationSec
+	StopReasonSampleTarget = "sample_target_reached" // every tester reached TargetSamples
+)
+
 type ProxyConfig struct {
 	Host            string `json:"host"`
 	Port            int    `json:"port"`
@@ -13,11 +58,53 @@ type ProxyConfig struct {
 	AuthPass        string `json:"auth_pass"`
 	ExpectedCountry string `json:"expected_country"`
 	Label           string `json:"label"`
+	// Chain lists upstream hops traversed in order before reaching Host:Port
+	Chain []ProxyHop `json:"chain,omitempty"`
+	// IPFamily is copied from RunConfig.IPFamily so every dial path can pin target addresses
+	IPFamily string `json:"-"`
+	// Rotation declares how a residential/rotating provider hands out exit IPs
+	Rotation RotationConfig `json:"rotation"`
+}
+
+// RotationConfig describes the exit IP behaviour a proxy promises, so intended rotation
+// is measured rather than scored as instability
+type RotationConfig struct {
+	Mode string `json:"mode"`
+	// StickyMinutes is how long one session should keep its exit IP (sticky mode)
+	StickyMinutes int `json:"sticky_minutes,omitempty"`
+	// SessionFormat builds the sticky username from {user}, {session} and {minutes};
+	// empty means "{user}-session-{session}"
+	SessionFormat string `json:"session_format,omitempty"`
+}
+
+// ProxyHop is one proxy in a multi-hop chain
+type ProxyHop struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+	AuthUser string `json:"auth_user"`
+	AuthPass string `json:"auth_pass"`
+	Label    string `json:"label"`
+}
+
+// HopTiming is the per-hop breakdown of a chained dial.
+// Hop 0 is the first upstream hop; the last hop is the configured proxy itself.
+type HopTiming struct {
+	Hop            int     `json:"hop"`
+	Label          string  `json:"label,omitempty"`
+	Protocol       string  `json:"protocol"`
+	TCPConnectMS   float64 `json:"tcp_connect_ms,omitempty"`   // first hop only
+	TLSHandshakeMS float64 `json:"tls_handshake_ms,omitempty"` // protocol=https hops
+	TunnelMS       float64 `json:"tunnel_ms,omitempty"`        // tunnel request to the next hop (or target)
+	AuthScheme     string  `json:"auth_scheme,omitempty"`      // proxy auth used for that tunnel request
+	ErrorType      string  `json:"error_type,omitempty"`
 }
 
 type TargetConfig struct {
 	HTTPURL  string `json:"http_url"`
 	HTTPSURL string `json:"https_url"`
+	UDPAddr  string `json:"udp_addr,omitempty"`  // host:port of the UDP echo endpoint
+	HTTP3URL string `json:"http3_url,omitempty"` // HTTP/3 (QUIC) endpoint, required for masque proxies
 }
 
 type BurstConfig struct {
@@ -26,17 +113,24 @@ type BurstConfig struct {
 }
 
 type RunConfig struct {
-	RunID              string        `json:"run_id"`
-	Proxy              ProxyConfig   `json:"proxy"`
-	Target             TargetConfig  `json:"target"`
-	HTTPRPM            int           `json:"http_rpm"`
-	HTTPSRPM           int           `json:"https_rpm"`
-	WSMessagesPerMin   int           `json:"ws_messages_per_minute"`
-	RequestTimeoutMS   int           `json:"request_timeout_ms"`
-	WarmupRequests     int           `json:"warmup_requests"`
-	SummaryIntervalSec int           `json:"summary_interval_sec"`
-	Burst              *BurstConfig  `json:"burst,omitempty"`
-	ScoringCfg         ScoringConfig `json:"scoring_config"`
+	RunID              string         `json:"run_id"`
+	Proxy              ProxyConfig    `json:"proxy"`
+	Target             TargetConfig   `json:"target"`
+	HTTPRPM            int            `json:"http_rpm"`
+	HTTPSRPM           int            `json:"https_rpm"`
+	WSMessagesPerMin   int            `json:"ws_messages_per_minute"`
+	UDPPacketsPerMin   int            `json:"udp_packets_per_minute"`
+	RequestTimeoutMS   int            `json:"request_timeout_ms"`
+	WarmupRequests     int            `json:"warmup_requests"`
+	SummaryIntervalSec int            `json:"summary_interval_sec"`
+	Burst              *BurstConfig   `json:"burst,omitempty"`
+	IPFamily           string         `json:"ip_family"` // egress family the proxy must use to reach the target
+	ScoringCfg         ScoringConfig  `json:"scoring_config"`
+	RunMode            string         `json:"run_mode"`
+	DurationSec        int            `json:"duration_sec,omitempty"`   // fixed mode: continuous phase length
+	TargetSamples      int            `json:"target_samples,omitempty"` // fixed mode: samples per tester
+	IncidentCfg        IncidentConfig `json:"incident_config"`
+	LoadProfile        *LoadProfile   `json:"load_profile,omitempty"` // nil runs at the flat configured rates
 }
 
 type TriggerPayload struct {
@@ -51,13 +145,30 @@ type TriggerRun struct {
 }
 
 type TriggerRunConfig struct {
-	HTTPRPM            int            `json:"http_rpm"`
-	HTTPSRPM           int            `json:"https_rpm"`
-	WSMessagesPerMin   int            `json:"ws_messages_per_minute"`
-	RequestTimeoutMS   int            `json:"request_timeout_ms"`
-	WarmupRequests     int            `json:"warmup_requests"`
-	SummaryIntervalSec int            `json:"summary_interval_sec"`
-	ScoringConfig      *ScoringConfig `json:"scoring_config,omitempty"`
+	HTTPRPM            int             `json:"http_rpm"`
+	HTTPSRPM           int             `json:"https_rpm"`
+	WSMessagesPerMin   int             `json:"ws_messages_per_minute"`
+	UDPPacketsPerMin   int             `json:"udp_packets_per_minute"`
+	RequestTimeoutMS   int             `json:"request_timeout_ms"`
+	WarmupRequests     int             `json:"warmup_requests"`
+	SummaryIntervalSec int             `json:"summary_interval_sec"`
+	IPFamily           string          `json:"ip_family,omitempty"`
+	ScoringConfig      *ScoringConfig  `json:"scoring_config,omitempty"`
+	RunMode            string          `json:"run_mode,omitempty"`
+	DurationSec        int             `json:"duration_sec,omitempty"`
+	TargetSamples      int             `json:"target_samples,omitempty"`
+	IncidentConfig     *IncidentConfig `json:"incident_config,omitempty"`
+	LoadProfile        *LoadProfile    `json:"load_profile,omitempty"`
+}
+
+// RunConfigPatch changes a running run's rates, bursts or scoring; nil fields, and zero
+// fields inside Burst and ScoringConfig, are left as they are
+type RunConfigPatch struct {
+	HTTPRPM          *int           `json:"http_rpm,omitempty"`
+	HTTPSRPM         *int           `json:"https_rpm,omitempty"`
+	WSMessagesPerMin *int           `json:"ws_messages_per_minute,omitempty"`
+	Burst            *BurstConfig   `json:"burst,omitempty"`
+	ScoringConfig    *ScoringConfig `json:"scoring_config,omitempty"`
 }
 
 type ScoringConfig struct {
@@ -76,43 +187,138 @@ func DefaultScoringConfig() ScoringConfig {
 	}
 }
 
+// IncidentConfig sets when a run opens and closes incidents
+type IncidentConfig struct {
+	ConsecutiveFailures int     `json:"consecutive_failures"`  // failed samples in a row that open an incident
+	ErrorRateThreshold  float64 `json:"error_rate_threshold"`  // share of failed samples in the window that opens one (0-1)
+	ErrorRateWindowSec  int     `json:"error_rate_window_sec"` // trailing window the error rate is measured over
+	MinWindowSamples    int     `json:"min_window_samples"`    // samples the window needs before its rate counts
+	RecoverySuccesses   int     `json:"recovery_successes"`    // successful samples in a row that close an incident
+}
+
+func DefaultIncidentConfig() IncidentConfig {
+	return IncidentConfig{
+		ConsecutiveFailures: 5,
+		ErrorRateThreshold:  0.5,
+		ErrorRateWindowSec:  60,
+		MinWindowSamples:    10,
+		RecoverySuccesses:   3,
+	}
+}
+
+// LoadProfile moves the HTTP, HTTPS and HTTP/3 request rates over the continuous phase.
+// Levels are percentages of the configured http_rpm and https_rpm, so a PATCH of those
+// rates rescales the whole profile.
+type LoadProfile struct {
+	Type        string  `json:"type"`                   // ramp, step, spike or sine
+	BasePct     float64 `json:"base_pct,omitempty"`     // ramp and step start, spike baseline, sine trough
+	PeakPct     float64 `json:"peak_pct,omitempty"`     // ramp and step end, spike height, sine crest
+	DurationSec int     `json:"duration_sec,omitempty"` // ramp length, time per step, spike length
+	Steps       int     `json:"steps,omitempty"`        // step: number of levels, BasePct and PeakPct included
+	PeriodSec   int     `json:"period_sec,omitempty"`   // spike: time between spike starts; sine: one cycle
+}
+
+// DefaultLoadProfile returns the settings a profile of type t uses for its zero fields
+func DefaultLoadProfile(t string) LoadProfile {
+	switch t {
+	case LoadProfileRamp:
+		return LoadProfile{Type: t, BasePct: 10, PeakPct: 100, DurationSec: 300}
+	case LoadProfileStep:
+		return LoadProfile{Type: t, BasePct: 25, PeakPct: 100, DurationSec: 60, Steps: 4}
+	case LoadProfileSpike:
+		return LoadProfile{Type: t, BasePct: 100, PeakPct: 300, DurationSec: 30, PeriodSec: 300}
+	case LoadProfileSine:
+		return LoadProfile{Type: t, BasePct: 25, PeakPct: 100, PeriodSec: 3600}
+	}
+	return LoadProfile{Type: t}
+}
+
 type HTTPSample struct {
-	Seq            int       `json:"seq"`
-	IsWarmup       bool      `json:"is_warmup"`
-	TargetURL      string    `json:"target_url"`
-	Method         string    `json:"method"`
-	IsHTTPS        bool      `json:"is_https"`
-	StatusCode     int       `json:"status_code,omitempty"`
-	ErrorType      string    `json:"error_type,omitempty"`
-	ErrorMessage   string    `json:"error_message,omitempty"`
-	TCPConnectMS   float64   `json:"tcp_connect_ms"`
-	TLSHandshakeMS float64   `json:"tls_handshake_ms,omitempty"`
-	TTFBMS         float64   `json:"ttfb_ms"`
-	TotalMS        float64   `json:"total_ms"`
-	TLSVersion     string    `json:"tls_version,omitempty"`
-	TLSCipher      string    `json:"tls_cipher,omitempty"`
-	BytesSent      int64     `json:"bytes_sent"`
-	BytesReceived  int64     `json:"bytes_received"`
-	MeasuredAt     time.Time `json:"measured_at"`
+	Seq                 int         `json:"seq"`
+	IsWarmup            bool        `json:"is_warmup"`
+	IsBurst             bool        `json:"is_burst,omitempty"` // concurrency-burst request
+	TargetURL           string      `json:"target_url"`
+	Method              string      `json:"method"`
+	IsHTTPS             bool        `json:"is_https"`
+	StatusCode          int         `json:"status_code,omitempty"`
+	ErrorType           string      `json:"error_type,omitempty"`
+	ErrorMessage        string      `json:"error_message,omitempty"`
+	TCPConnectMS        float64     `json:"tcp_connect_ms"`
+	SOCKSHandshakeMS    float64     `json:"socks_handshake_ms,omitempty"`
+	TLSHandshakeMS      float64     `json:"tls_handshake_ms,omitempty"`
+	ProxyTLSHandshakeMS float64     `json:"proxy_tls_handshake_ms,omitempty"` // proxy leg (protocol=https)
+	ProxyTLSVersion     string      `json:"proxy_tls_version,omitempty"`
+	ProxyTLSCipher      string      `json:"proxy_tls_cipher,omitempty"`
+	ConnectUDPMS        float64     `json:"connect_udp_ms,omitempty"`         // MASQUE CONNECT-UDP tunnel setup
+	ProxyAuthScheme     string      `json:"proxy_auth_scheme,omitempty"`      // basic, digest or ntlm
+	ProxyAuthRoundTrips int         `json:"proxy_auth_round_trips,omitempty"` // extra requests answering 407 challenges
+	ProxyAuthMS         float64     `json:"proxy_auth_ms,omitempty"`          // time spent on those requests
+	ObservedIP          string      `json:"observed_ip,omitempty"`            // exit address the target saw
+	ObservedIPFamily    string      `json:"observed_ip_family,omitempty"`     // family of the address the target saw: ipv4 or ipv6
+	TTFBMS              float64     `json:"ttfb_ms"`
+	TotalMS             float64     `json:"total_ms"`
+	TLSVersion          string      `json:"tls_version,omitempty"`
+	TLSCipher           string      `json:"tls_cipher,omitempty"`
+	NegotiatedProtocol  string      `json:"negotiated_protocol,omitempty"` // ALPN result: "h3", "h2" or "http/1.1"
+	H2Streams           int         `json:"h2_streams,omitempty"`          // concurrent streams on the h2 connection
+	H2StreamAvgMS       float64     `json:"h2_stream_avg_ms,omitempty"`
+	H2StreamMaxMS       float64     `json:"h2_stream_max_ms,omitempty"`
+	H2StreamResets      int         `json:"h2_stream_resets,omitempty"`
+	BytesSent           int64       `json:"bytes_sent"`
+	BytesReceived       int64       `json:"bytes_received"`
+	HopTimings          []HopTiming `json:"hop_timings,omitempty"` // chained proxies only
+	TargetRPM           float64     `json:"target_rpm"`            // request rate the tester was set to when the request was sent
+	MeasuredAt          time.Time   `json:"measured_at"`
 }
 
 type WSSample struct {
+	Seq                 int         `json:"seq"`
+	IsWarmup            bool        `json:"is_warmup"`
+	TargetURL           string      `json:"target_url"`
+	Connected           bool        `json:"connected"`
+	IsWSS               bool        `json:"is_wss"`
+	ErrorType           string      `json:"error_type,omitempty"`
+	ErrorMessage        string      `json:"error_message,omitempty"`
+	TCPConnectMS        float64     `json:"tcp_connect_ms"`
+	SOCKSHandshakeMS    float64     `json:"socks_handshake_ms,omitempty"`
+	TLSHandshakeMS      float64     `json:"tls_handshake_ms,omitempty"`
+	ProxyTLSHandshakeMS float64     `json:"proxy_tls_handshake_ms,omitempty"`
+	ProxyTLSVersion     string      `json:"proxy_tls_version,omitempty"`
+	ProxyTLSCipher      string      `json:"proxy_tls_cipher,omitempty"`
+	ProxyAuthScheme     string      `json:"proxy_auth_scheme,omitempty"`
+	ProxyAuthRoundTrips int         `json:"proxy_auth_round_trips,omitempty"`
+	ProxyAuthMS         float64     `json:"proxy_auth_ms,omitempty"`
+	ObservedIPFamily    string      `json:"observed_ip_family,omitempty"`
+	HandshakeMS         float64     `json:"handshake_ms"`
+	MessageRTTMS        float64     `json:"message_rtt_ms"`
+	ConnectionHeldMS    float64     `json:"connection_held_ms"`
+	DisconnectReason    string      `json:"disconnect_reason,omitempty"`
+	MessagesSent        int         `json:"messages_sent"`
+	MessagesReceived    int         `json:"messages_received"`
+	DropCount           int         `json:"drop_count"`
+	HopTimings          []HopTiming `json:"hop_timings,omitempty"` // chained proxies only
+	MeasuredAt          time.Time   `json:"measured_at"`
+}
+
+// UDPSample covers one SOCKS5 UDP ASSOCIATE session of sequenced datagrams
+type UDPSample struct {
 	Seq              int       `json:"seq"`
 	IsWarmup         bool      `json:"is_warmup"`
-	TargetURL        string    `json:"target_url"`
-	Connected        bool      `json:"connected"`
-	IsWSS            bool      `json:"is_wss"`
+	TargetAddr       string    `json:"target_addr"`
+	Associated       bool      `json:"associated"`
 	ErrorType        string    `json:"error_type,omitempty"`
 	ErrorMessage     string    `json:"error_message,omitempty"`
 	TCPConnectMS     float64   `json:"tcp_connect_ms"`
-	TLSHandshakeMS   float64   `json:"tls_handshake_ms,omitempty"`
-	HandshakeMS      float64   `json:"handshake_ms"`
-	MessageRTTMS     float64   `json:"message_rtt_ms"`
-	ConnectionHeldMS float64   `json:"connection_held_ms"`
-	DisconnectReason string    `json:"disconnect_reason,omitempty"`
-	MessagesSent     int       `json:"messages_sent"`
-	MessagesReceived int       `json:"messages_received"`
-	DropCount        int       `json:"drop_count"`
+	SOCKSHandshakeMS float64   `json:"socks_handshake_ms"`
+	PacketsSent      int       `json:"packets_sent"`
+	PacketsReceived  int       `json:"packets_received"` // unique sequence numbers echoed back
+	LostCount        int       `json:"lost_count"`
+	ReorderedCount   int       `json:"reordered_count"`
+	DuplicateCount   int       `json:"duplicate_count"`
+	RTTAvgMS         float64   `json:"rtt_avg_ms"`
+	RTTMinMS         float64   `json:"rtt_min_ms"`
+	RTTMaxMS         float64   `json:"rtt_max_ms"`
+	JitterMS         float64   `json:"jitter_ms"` // mean |RTT(n) - RTT(n-1)|, RFC 3550 style
 	MeasuredAt       time.Time `json:"measured_at"`
 }
 
@@ -120,6 +326,7 @@ type IPCheckResult struct {
 	RunID            string   `json:"run_id"`
 	ProxyID          string   `json:"proxy_id"`
 	ObservedIP       string   `json:"observed_ip"`
+	ObservedIPFamily string   `json:"observed_ip_family"`
 	ExpectedCountry  string   `json:"expected_country"`
 	ActualCountry    string   `json:"actual_country"`
 	ActualRegion     string   `json:"actual_region"`
@@ -134,30 +341,94 @@ type IPCheckResult struct {
 	IPChanges        int      `json:"ip_changes"`
 }
 
+// Incident states
+const (
+	IncidentOpen       = "open"
+	IncidentResolved   = "resolved"
+	IncidentUnresolved = "unresolved" // the run ended while the incident was still open
+)
+
+// What opened an incident
+const (
+	IncidentTriggerConsecutive = "consecutive_failures"
+	IncidentTriggerErrorRate   = "error_rate"
+)
+
+// Incident is a period the proxy was down: it opens at the first failure of the streak or
+// window that crossed a threshold and ends at the first success of the recovery streak.
+// It is reported when it opens and again when it ends, keyed by Seq.
+type Incident struct {
+	Seq           int            `json:"seq"` // 1-based within the run
+	Status        string         `json:"status"`
+	Trigger       string         `json:"trigger"`
+	ErrorType     string         `json:"error_type"` // dominant error type
+	ErrorCounts   map[string]int `json:"error_counts"`
+	Protocols     []string       `json:"protocols"` // testers that failed: http, https, http3, ws, udp
+	FailedSamples int            `json:"failed_samples"`
+	TotalSamples  int            `json:"total_samples"`
+	StartedAt     time.Time      `json:"started_at"`
+	EndedAt       *time.Time     `json:"ended_at,omitempty"`
+	DurationMS    float64        `json:"duration_ms"` // up to now while open
+}
+
 type RunSummary struct {
-	RunID              string  `json:"run_id"`
-	HTTPSampleCount    int     `json:"http_sample_count"`
-	HTTPSSampleCount   int     `json:"https_sample_count"`
-	WSSampleCount      int     `json:"ws_sample_count"`
-	HTTPSuccessCount   int     `json:"http_success_count"`
-	HTTPErrorCount     int     `json:"http_error_count"`
-	UptimeRatio        float64 `json:"uptime_ratio"`
-	TTFBAvgMS          float64 `json:"ttfb_avg_ms"`
-	TTFBP50MS          float64 `json:"ttfb_p50_ms"`
-	TTFBP95MS          float64 `json:"ttfb_p95_ms"`
-	TTFBP99MS          float64 `json:"ttfb_p99_ms"`
-	TTFBMaxMS          float64 `json:"ttfb_max_ms"`
-	TotalAvgMS         float64 `json:"total_avg_ms"`
-	TotalP50MS         float64 `json:"total_p50_ms"`
-	TotalP95MS         float64 `json:"total_p95_ms"`
-	TotalP99MS         float64 `json:"total_p99_ms"`
-	JitterMS           float64 `json:"jitter_ms"`
-	TLSP50MS           float64 `json:"tls_p50_ms"`
-	TLSP95MS           float64 `json:"tls_p95_ms"`
-	TLSP99MS           float64 `json:"tls_p99_ms"`
-	TCPConnectP50MS    float64 `json:"tcp_connect_p50_ms"`
-	TCPConnectP95MS    float64 `json:"tcp_connect_p95_ms"`
-	TCPConnectP99MS    float64 `json:"tcp_connect_p99_ms"`
+	RunID            string  `json:"run_id"`
+	HTTPSampleCount  int     `json:"http_sample_count"`
+	HTTPSSampleCount int     `json:"https_sample_count"`
+	WSSampleCount    int     `json:"ws_sample_count"`
+	HTTPSuccessCount int     `json:"http_success_count"`
+	HTTPErrorCount   int     `json:"http_error_count"`
+	UptimeRatio      float64 `json:"uptime_ratio"`
+	TTFBAvgMS        float64 `json:"ttfb_avg_ms"`
+	TTFBP50MS        float64 `json:"ttfb_p50_ms"`
+	TTFBP95MS        float64 `json:"ttfb_p95_ms"`
+	TTFBP99MS        float64 `json:"ttfb_p99_ms"`
+	TTFBMaxMS        float64 `json:"ttfb_max_ms"`
+	TotalAvgMS       float64 `json:"total_avg_ms"`
+	TotalP50MS       float64 `json:"total_p50_ms"`
+	TotalP95MS       float64 `json:"total_p95_ms"`
+	TotalP99MS       float64 `json:"total_p99_ms"`
+	JitterMS         float64 `json:"jitter_ms"`
+	TLSP50MS         float64 `json:"tls_p50_ms"`
+	TLSP95MS         float64 `json:"tls_p95_ms"`
+	TLSP99MS         float64 `json:"tls_p99_ms"`
+	TCPConnectP50MS  float64 `json:"tcp_connect_p50_ms"`
+	TCPConnectP95MS  float64 `json:"tcp_connect_p95_ms"`
+	TCPConnectP99MS  float64 `json:"tcp_connect_p99_ms"`
+	// HTTPS broken out by negotiated protocol
+	H1SampleCount      int     `json:"h1_sample_count"`
+	H1ErrorCount       int     `json:"h1_error_count"`
+	H1TTFBP50MS        float64 `json:"h1_ttfb_p50_ms"`
+	H1TTFBP95MS        float64 `json:"h1_ttfb_p95_ms"`
+	H2SampleCount      int     `json:"h2_sample_count"`
+	H2ErrorCount       int     `json:"h2_error_count"`
+	H2TTFBP50MS        float64 `json:"h2_ttfb_p50_ms"`
+	H2TTFBP95MS        float64 `json:"h2_ttfb_p95_ms"`
+	H2StreamAvgMS      float64 `json:"h2_stream_avg_ms"`
+	H2StreamP95MS      float64 `json:"h2_stream_p95_ms"`
+	H2StreamResetCount int     `json:"h2_stream_reset_count"`
+	H2StreamResetRate  float64 `json:"h2_stream_reset_rate"`
+	H3SampleCount      int     `json:"h3_sample_count"` // masque proxies only
+	H3ErrorCount       int     `json:"h3_error_count"`
+	H3TTFBP50MS        float64 `json:"h3_ttfb_p50_ms"`
+	H3TTFBP95MS        float64 `json:"h3_ttfb_p95_ms"`
+	ConnectUDPP50MS    float64 `json:"connect_udp_p50_ms"`
+	ConnectUDPP95MS    float64 `json:"connect_udp_p95_ms"`
+	// Proxy authentication: majority negotiated scheme and its extra round-trip cost
+	ProxyAuthScheme string  `json:"proxy_auth_scheme,omitempty"`
+	ProxyAuthAvgMS  float64 `json:"proxy_auth_avg_ms"`
+	ProxyAuthP95MS  float64 `json:"proxy_auth_p95_ms"`
+	// Address family the target observed on HTTP(S) samples (dual-stack grading)
+	ObservedIPv4Count int `json:"observed_ipv4_count"`
+	ObservedIPv6Count int `json:"observed_ipv6_count"`
+	// Exit IP rotation: pool seen on HTTP(S) samples, and sticky sessions followed by IP re-checks
+	RotationMode          string  `json:"rotation_mode,omitempty"`
+	IPPoolSize            int     `json:"ip_pool_size"`
+	IPReuseRate           float64 `json:"ip_reuse_rate"`
+	SessionCount          int     `json:"session_count"`
+	SessionLifetimeAvgSec float64 `json:"session_lifetime_avg_sec"`
+	SessionLifetimeMinSec float64 `json:"session_lifetime_min_sec"`
+	PrematureRotations    int     `json:"premature_rotations"` // sticky sessions that lost their IP early
 	// WS metrics
 	WSSuccessCount int     `json:"ws_success_count"`
 	WSErrorCount   int     `json:"ws_error_count"`
@@ -165,6 +436,20 @@ type RunSummary struct {
 	WSRTTP95MS     float64 `json:"ws_rtt_p95_ms"`
 	WSDropRate     float64 `json:"ws_drop_rate"`
 	WSAvgHoldMS    float64 `json:"ws_avg_hold_ms"`
+	// UDP metrics
+	UDPSampleCount     int     `json:"udp_sample_count"`
+	UDPSuccessCount    int     `json:"udp_success_count"`
+	UDPErrorCount      int     `json:"udp_error_count"`
+	UDPPacketsSent     int     `json:"udp_packets_sent"`
+	UDPPacketsReceived int     `json:"udp_packets_received"`
+	UDPLossRate        float64 `json:"udp_loss_rate"`
+	UDPReorderRate     float64 `json:"udp_reorder_rate"`
+	UDPDuplicateCount  int     `json:"udp_duplicate_count"`
+	UDPRTTAvgMS        float64 `json:"udp_rtt_avg_ms"`
+	UDPRTTP95MS        float64 `json:"udp_rtt_p95_ms"`
+	UDPJitterMS        float64 `json:"udp_jitter_ms"`
+	// Chained proxies: per-hop latency attribution
+	HopStats []HopSummary `json:"hop_stats,omitempty"`
 	// Bytes
 	TotalBytesSent     int64   `json:"total_bytes_sent"`
 	TotalBytesReceived int64   `json:"total_bytes_received"`
@@ -183,7 +468,28 @@ type RunSummary struct {
 	ScoreJitter   float64 `json:"score_jitter"`
 	ScoreWS       float64 `json:"score_ws"`
 	ScoreSecurity float64 `json:"score_security"`
+	ScoreUDP      float64 `json:"score_udp"`
 	ScoreTotal    float64 `json:"score_total"`
+	// StopReason is set on the final summary only
+	StopReason string `json:"stop_reason,omitempty"`
+	// Window labels a summary over only the trailing window ("1m", "5m", "15m"); empty for
+	// the cumulative summary over the whole run
+	Window string `json:"window,omitempty"`
+}
+
+// HopSummary aggregates HopTiming across samples for one hop of a chain
+type HopSummary struct {
+	Hop             int     `json:"hop"`
+	Label           string  `json:"label,omitempty"`
+	Protocol        string  `json:"protocol"`
+	SampleCount     int     `json:"sample_count"`
+	ErrorCount      int     `json:"error_count"`
+	TCPConnectAvgMS float64 `json:"tcp_connect_avg_ms,omitempty"`
+	TLSAvgMS        float64 `json:"tls_avg_ms,omitempty"`
+	TunnelAvgMS     float64 `json:"tunnel_avg_ms"`
+	TunnelP95MS     float64 `json:"tunnel_p95_ms"`
+	AddedAvgMS      float64 `json:"added_avg_ms"`  // tcp + tls + tunnel
+	LatencyShare    float64 `json:"latency_share"` // AddedAvgMS / sum over all hops
 }
 
 // MethodTarget defines an endpoint + method combination for testing
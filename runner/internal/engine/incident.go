@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// incidentSample is what the detector needs from one non-warmup, non-burst sample
+type incidentSample struct {
+	at        time.Time
+	protocol  string // tester: http, https, http3, ws or udp
+	errorType string // empty on success
+}
+
+func (s incidentSample) failed() bool {
+	return s.errorType != ""
+}
+
+// incidentDetector turns the run's sample stream into incidents. While none is open, an
+// incident opens when ConsecutiveFailures samples in a row fail, or when the trailing
+// error-rate window holds at least MinWindowSamples and ErrorRateThreshold of them
+// failed. It ends after RecoverySuccesses samples in a row succeed, and the window starts
+// over so the outage it just closed cannot reopen it.
+type incidentDetector struct {
+	cfg    domain.IncidentConfig
+	window time.Duration
+
+	mu          sync.Mutex
+	streak      []incidentSample // failures in a row, while no incident is open
+	recent      []incidentSample // the error-rate window, oldest first
+	recentFail  int
+	open        *domain.Incident
+	protocols   map[string]bool // protocols that failed during open
+	successes   int             // successes in a row while open
+	recoveredAt time.Time       // first of those successes
+	seq         int
+}
+
+func newIncidentDetector(cfg domain.IncidentConfig) *incidentDetector {
+	return &incidentDetector{
+		cfg:    cfg,
+		window: time.Duration(cfg.ErrorRateWindowSec) * time.Second,
+	}
+}
+
+// observe feeds one sample and returns the incident if it opened or ended
+func (d *incidentDetector) observe(s incidentSample) (domain.Incident, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.open != nil {
+		return d.observeOpen(s)
+	}
+
+	d.push(s)
+	if s.failed() {
+		d.streak = append(d.streak, s)
+	} else {
+		d.streak = d.streak[:0]
+	}
+
+	switch {
+	case len(d.streak) >= d.cfg.ConsecutiveFailures:
+		return d.start(domain.IncidentTriggerConsecutive, d.streak), true
+	case len(d.recent) >= d.cfg.MinWindowSamples &&
+		float64(d.recentFail)/float64(len(d.recent)) >= d.cfg.ErrorRateThreshold:
+		return d.start(domain.IncidentTriggerErrorRate, d.recent), true
+	}
+	return domain.Incident{}, false
+}
+
+// finish ends an incident still open when the run stops, as unresolved
+func (d *incidentDetector) finish(at time.Time) (domain.Incident, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.open == nil {
+		return domain.Incident{}, false
+	}
+	return d.end(domain.IncidentUnresolved, at), true
+}
+
+// push adds s to the error-rate window and drops what has slid out of it
+func (d *incidentDetector) push(s incidentSample) {
+	d.recent = append(d.recent, s)
+	if s.failed() {
+		d.recentFail++
+	}
+	from := s.at.Add(-d.window)
+	n := 0
+	for n < len(d.recent) && d.recent[n].at.Before(from) {
+		if d.recent[n].failed() {
+			d.recentFail--
+		}
+		n++
+	}
+	if n > 0 {
+		d.recent = append(d.recent[:0], d.recent[n:]...)
+	}
+}
+
+// start opens an incident from the samples that crossed the threshold, beginning at the
+// first failure among them
+func (d *incidentDetector) start(trigger string, samples []incidentSample) domain.Incident {
+	d.seq++
+	d.open = &domain.Incident{
+		Seq:         d.seq,
+		Status:      domain.IncidentOpen,
+		Trigger:     trigger,
+		ErrorCounts: make(map[string]int),
+	}
+	d.protocols = make(map[string]bool)
+	d.successes = 0
+
+	started := false
+	for _, s := range samples {
+		if !started && !s.failed() {
+			continue
+		}
+		if !started {
+			d.open.StartedAt = s.at
+			started = true
+		}
+		d.count(s)
+	}
+	inc := d.snapshot(samples[len(samples)-1].at)
+	d.streak = d.streak[:0]
+	d.recent = d.recent[:0]
+	d.recentFail = 0
+	return inc
+}
+
+func (d *incidentDetector) observeOpen(s incidentSample) (domain.Incident, bool) {
+	d.count(s)
+	if s.failed() {
+		d.successes = 0
+		return domain.Incident{}, false
+	}
+	if d.successes == 0 {
+		d.recoveredAt = s.at
+	}
+	d.successes++
+	if d.successes < d.cfg.RecoverySuccesses {
+		return domain.Incident{}, false
+	}
+	return d.end(domain.IncidentResolved, d.recoveredAt), true
+}
+
+func (d *incidentDetector) count(s incidentSample) {
+	d.open.TotalSamples++
+	if s.failed() {
+		d.open.FailedSamples++
+		d.open.ErrorCounts[s.errorType]++
+		d.protocols[s.protocol] = true
+	}
+}
+
+func (d *incidentDetector) end(status string, at time.Time) domain.Incident {
+	if at.Before(d.open.StartedAt) {
+		at = d.open.StartedAt
+	}
+	d.open.Status = status
+	d.open.EndedAt = &at
+	inc := d.snapshot(at)
+	d.open = nil
+	d.protocols = nil
+	return inc
+}
+
+// snapshot copies the open incident as of at, with its dominant error type
+func (d *incidentDetector) snapshot(at time.Time) domain.Incident {
+	inc := *d.open
+	inc.ErrorType = majority(inc.ErrorCounts)
+	inc.ErrorCounts = make(map[string]int, len(d.open.ErrorCounts))
+	for k, v := range d.open.ErrorCounts {
+		inc.ErrorCounts[k] = v
+	}
+	inc.Protocols = make([]string, 0, len(d.protocols))
+	for p := range d.protocols {
+		inc.Protocols = append(inc.Protocols, p)
+	}
+	sort.Strings(inc.Protocols)
+	inc.DurationMS = float64(at.Sub(inc.StartedAt)) / float64(time.Millisecond)
+	return inc
+}
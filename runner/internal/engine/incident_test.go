@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+func TestIncidentDetector(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	// step is one sample, at seconds after base; errorType "" is a success
+	type step struct {
+		sec       int
+		protocol  string
+		errorType string
+	}
+	// event is what the detector returned, with times as seconds after base (-1 for none)
+	type event struct {
+		status    string
+		trigger   string
+		errorType string
+		protocols []string
+		failed    int
+		total     int
+		started   int
+		ended     int
+	}
+	consecutive := domain.IncidentConfig{ConsecutiveFailures: 3, ErrorRateThreshold: 2, ErrorRateWindowSec: 60, MinWindowSamples: 1, RecoverySuccesses: 2}
+	errorRate := domain.IncidentConfig{ConsecutiveFailures: 100, ErrorRateThreshold: 0.5, ErrorRateWindowSec: 10, MinWindowSamples: 4, RecoverySuccesses: 2}
+
+	tests := []struct {
+		name     string
+		cfg      domain.IncidentConfig
+		steps    []step
+		finishAt int // -1 leaves the run unfinished
+		want     []event
+	}{
+		{
+			name: "opens on consecutive failures",
+			cfg:  consecutive,
+			steps: []step{
+				{0, "http", ""},
+				{1, "http", "timeout"},
+				{2, "https", "connection_refused"},
+				{3, "http", "timeout"},
+			},
+			finishAt: -1,
+			want:     []event{{domain.IncidentOpen, domain.IncidentTriggerConsecutive, "timeout", []string{"http", "https"}, 3, 3, 1, -1}},
+		},
+		{
+			name: "a success breaks the streak",
+			cfg:  consecutive,
+			steps: []step{
+				{0, "http", "timeout"},
+				{1, "http", "timeout"},
+				{2, "http", ""},
+				{3, "http", "timeout"},
+				{4, "http", "timeout"},
+			},
+			finishAt: -1,
+		},
+		{
+			name: "opens on error rate from the first failure",
+			cfg:  errorRate,
+			steps: []step{
+				{0, "ws", ""},
+				{1, "ws", "ws_closed"},
+				{2, "ws", ""},
+				{3, "udp", "udp_timeout"},
+			},
+			finishAt: -1,
+			want:     []event{{domain.IncidentOpen, domain.IncidentTriggerErrorRate, "udp_timeout", []string{"udp", "ws"}, 2, 3, 1, -1}},
+		},
+		{
+			name: "error rate ignores failures that left the window",
+			cfg:  errorRate,
+			steps: []step{
+				{0, "http", "timeout"},
+				{1, "http", "timeout"},
+				{20, "http", ""},
+				{21, "http", ""},
+				{22, "http", ""},
+				{23, "http", "timeout"},
+			},
+			finishAt: -1,
+		},
+		{
+			name: "resolves at the first of the recovery successes",
+			cfg:  consecutive,
+			steps: []step{
+				{0, "http", "timeout"},
+				{1, "http", "timeout"},
+				{2, "http", "timeout"},
+				{3, "http", ""},
+				{4, "http", "timeout"},
+				{5, "https", ""},
+				{6, "http", ""},
+				{7, "http", "timeout"},
+			},
+			finishAt: -1,
+			want: []event{
+				{domain.IncidentOpen, domain.IncidentTriggerConsecutive, "timeout", []string{"http"}, 3, 3, 0, -1},
+				{domain.IncidentResolved, domain.IncidentTriggerConsecutive, "timeout", []string{"http"}, 4, 7, 0, 5},
+			},
+		},
+		{
+			name: "still open at finish is unresolved",
+			cfg:  consecutive,
+			steps: []step{
+				{0, "http", "timeout"},
+				{1, "http", "timeout"},
+				{2, "http", "timeout"},
+				{3, "http", ""},
+			},
+			finishAt: 10,
+			want: []event{
+				{domain.IncidentOpen, domain.IncidentTriggerConsecutive, "timeout", []string{"http"}, 3, 3, 0, -1},
+				{domain.IncidentUnresolved, domain.IncidentTriggerConsecutive, "timeout", []string{"http"}, 3, 4, 0, 10},
+			},
+		},
+		{
+			name:     "finish with nothing open",
+			cfg:      consecutive,
+			steps:    []step{{0, "http", "timeout"}},
+			finishAt: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newIncidentDetector(tt.cfg)
+			var got []event
+			record := func(inc domain.Incident) {
+				ended := -1
+				if inc.EndedAt != nil {
+					ended = int(inc.EndedAt.Sub(base) / time.Second)
+					if want := float64(inc.EndedAt.Sub(inc.StartedAt)) / float64(time.Millisecond); inc.DurationMS != want {
+						t.Errorf("incident %d: duration_ms %v, want %v", inc.Seq, inc.DurationMS, want)
+					}
+				}
+				got = append(got, event{inc.Status, inc.Trigger, inc.ErrorType, inc.Protocols, inc.FailedSamples, inc.TotalSamples, int(inc.StartedAt.Sub(base) / time.Second), ended})
+			}
+			for _, s := range tt.steps {
+				if inc, ok := d.observe(incidentSample{at: at(s.sec), protocol: s.protocol, errorType: s.errorType}); ok {
+					record(inc)
+				}
+			}
+			if tt.finishAt >= 0 {
+				if inc, ok := d.finish(at(tt.finishAt)); ok {
+					record(inc)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
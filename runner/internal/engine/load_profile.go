@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/metrics"
+)
+
+// loadTick is how often a load profile moves the testers' rates
+const loadTick = time.Second
+
+// loadPct returns the level p asks for after elapsed, as a percentage of the configured
+// rates. Every field p's type uses must be set, as config.FromTrigger does.
+func loadPct(p domain.LoadProfile, elapsed time.Duration) float64 {
+	t := elapsed.Seconds()
+	switch p.Type {
+	case domain.LoadProfileRamp:
+		if p.DurationSec <= 0 || t >= float64(p.DurationSec) {
+			return p.PeakPct
+		}
+		return p.BasePct + (p.PeakPct-p.BasePct)*t/float64(p.DurationSec)
+	case domain.LoadProfileStep:
+		if p.Steps <= 1 || p.DurationSec <= 0 {
+			return p.PeakPct
+		}
+		step := math.Min(math.Floor(t/float64(p.DurationSec)), float64(p.Steps-1))
+		return p.BasePct + (p.PeakPct-p.BasePct)*step/float64(p.Steps-1)
+	case domain.LoadProfileSpike:
+		// The first spike comes one period in, after a baseline to compare it against
+		if p.PeriodSec <= 0 || t < float64(p.PeriodSec) {
+			return p.BasePct
+		}
+		if math.Mod(t, float64(p.PeriodSec)) < float64(p.DurationSec) {
+			return p.PeakPct
+		}
+		return p.BasePct
+	case domain.LoadProfileSine:
+		if p.PeriodSec <= 0 {
+			return p.BasePct
+		}
+		phase := 2 * math.Pi * t / float64(p.PeriodSec)
+		return p.BasePct + (p.PeakPct-p.BasePct)*(1-math.Cos(phase))/2
+	}
+	return 100
+}
+
+// runLoadProfile moves the testers' rates along the run's load profile, from the start of
+// the continuous phase until ctx ends
+func (o *Orchestrator) runLoadProfile(ctx context.Context) error {
+	profile := *o.config.LoadProfile
+	o.logger.Info("Load profile start",
+		"phase", "continuous",
+		"load_profile", profile.Type,
+		"base_pct", profile.BasePct,
+		"peak_pct", profile.PeakPct,
+		"duration_sec", profile.DurationSec,
+		"steps", profile.Steps,
+		"period_sec", profile.PeriodSec,
+	)
+
+	start := time.Now()
+	ticker := time.NewTicker(loadTick)
+	defer ticker.Stop()
+	for {
+		o.setLoadPct(loadPct(profile, time.Since(start)))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// setLoadPct moves the testers to pct of their configured rates
+func (o *Orchestrator) setLoadPct(pct float64) {
+	o.cfgMu.Lock()
+	defer o.cfgMu.Unlock()
+	if pct == o.loadPct {
+		return
+	}
+	o.loadPct = pct
+	o.applyLoadLocked()
+	o.logger.Debug("Load level changed",
+		"phase", "continuous",
+		"load_pct", pct,
+	)
+}
+
+// applyLoadLocked sets every rate-limited tester to the current load level of its
+// configured rate; callers hold cfgMu
+func (o *Orchestrator) applyLoadLocked() {
+	scale := o.loadPct / 100
+	rpm := make(map[string]float64, 3)
+	if o.httpTester != nil {
+		o.httpTester.SetTargetRPM(float64(o.config.HTTPRPM) * scale)
+		rpm["http"] = o.httpTester.TargetRPM()
+	}
+	if o.httpsTester != nil {
+		o.httpsTester.SetTargetRPM(float64(o.config.HTTPSRPM) * scale)
+		rpm["https"] = o.httpsTester.TargetRPM()
+	}
+	if o.http3Tester != nil {
+		o.http3Tester.SetTargetRPM(float64(o.config.HTTPSRPM) * scale)
+		rpm["http3"] = o.http3Tester.TargetRPM()
+	}
+	for tester, r := range rpm {
+		metrics.SetTargetRPM(o.config.RunID, o.config.Proxy.Label, tester, r)
+	}
+	o.state.setLoad(o.loadPct, rpm)
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
-	"net/url"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,34 +14,59 @@ import (
 
 	"golang.org/x/sync/errgroup"
 
+	"proxy-stability-test/runner/internal/alert"
+	"proxy-stability-test/runner/internal/config"
 	"proxy-stability-test/runner/internal/domain"
 	"proxy-stability-test/runner/internal/ipcheck"
 	"proxy-stability-test/runner/internal/proxy"
 	"proxy-stability-test/runner/internal/reporter"
 	"proxy-stability-test/runner/internal/scoring"
+	"proxy-stability-test/runner/internal/stream"
+)
+
+// Burst defaults when the run config leaves them unset
+const (
+	defaultBurstIntervalSec = 300
+	defaultBurstConcurrency = 100
 )
 
 // Orchestrator manages the lifecycle of testing a single proxy
 type Orchestrator struct {
-	config       domain.RunConfig
-	httpTester   *proxy.HTTPTester
-	httpsTester  *proxy.HTTPSTester
-	wsTester     *proxy.WSTester
-	collector    *ResultCollector
-	reporter     reporter.Reporter
-	logger       *slog.Logger
-	allSamples   []domain.HTTPSample  // accumulated for summary
-	allWSSamples []domain.WSSample    // accumulated for WS summary
-	sampleMu     sync.RWMutex         // protects allSamples and allWSSamples
-	ipResult     *domain.IPCheckResult // IP check result
-	ipMu         sync.Mutex           // protects ipResult during re-checks
+	config        domain.RunConfig
+	cfgMu         sync.RWMutex  // protects config's rates, Burst and ScoringCfg, loadPct, and tester creation, against Reconfigure
+	loadPct       float64       // load profile level, % of the configured HTTP(S) rates
+	burstChanged  chan struct{} // wakes runBurstLoop to pick up a new interval
+	ipIntervalSet chan struct{} // wakes ipReCheckLoop to pick up a new interval
+	httpTester    *proxy.HTTPTester
+	httpsTester   *proxy.HTTPSTester
+	wsTester      *proxy.WSTester
+	udpTester     *proxy.UDPTester   // nil unless SOCKS5 with a UDP target
+	http3Tester   *proxy.HTTP3Tester // masque only; replaces the HTTP/HTTPS/WS testers
+	collector     *ResultCollector   // streaming aggregates for summaries
+	incidents     *incidentDetector
+	reporter      reporter.Reporter
+	alerts        *alert.Manager
+	live          *stream.Hub
+	state         *runState  // lifecycle snapshot for GET /runs
+	limits        *runLimits // fixed run duration and sample target; set when testers start
+	logger        *slog.Logger
+	ipResult      *domain.IPCheckResult // IP check result
+	ipMu          sync.Mutex            // protects ipResult and sessions during re-checks
+	sessions      *sessionTracker       // exit IP rotation across re-checks
 }
 
 // NewOrchestrator creates a new orchestrator for a proxy test run
-func NewOrchestrator(cfg domain.RunConfig, rep reporter.Reporter, logger *slog.Logger) *Orchestrator {
+func NewOrchestrator(cfg domain.RunConfig, rep reporter.Reporter, alerts *alert.Manager, live *stream.Hub, logger *slog.Logger) *Orchestrator {
 	return &Orchestrator{
-		config:   cfg,
-		reporter: rep,
+		config:        cfg,
+		loadPct:       100,
+		burstChanged:  make(chan struct{}, 1),
+		ipIntervalSet: make(chan struct{}, 1),
+		reporter:      rep,
+		alerts:        alerts,
+		live:          live,
+		state:         newRunState(cfg),
+		sessions:      newSessionTracker(cfg.Proxy.Rotation.Mode),
 		logger: logger.With(
 			"module", "engine.orchestrator",
 			"run_id", cfg.RunID,
@@ -53,11 +77,19 @@ func NewOrchestrator(cfg domain.RunConfig, rep reporter.Reporter, logger *slog.L
 
 // Run executes the full test lifecycle
 func (o *Orchestrator) Run(ctx context.Context) error {
+	o.cfgMu.RLock()
 	o.logger.Info("Orchestrator start",
 		"phase", "startup",
 		"http_rpm", o.config.HTTPRPM,
 		"https_rpm", o.config.HTTPSRPM,
+		"rotation_mode", o.sessions.mode,
+		"run_mode", o.config.RunMode,
+		"duration_sec", o.config.DurationSec,
+		"target_samples", o.config.TargetSamples,
 	)
+	o.cfgMu.RUnlock()
+	proxy.RetainSession(o.config.Proxy)
+	defer proxy.ReleaseSession(o.config.Proxy)
 
 	// Phase 0: Connectivity check
 	o.logger.Info("Connectivity check start",
@@ -67,17 +99,28 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	)
 
 	timeout := time.Duration(o.config.RequestTimeoutMS) * time.Millisecond
-	conn, connectMS, err := proxy.DialThroughProxy(ctx, o.config.Proxy, timeout, o.logger)
+	connectMS, err := o.checkConnectivity(ctx, timeout)
 	if err != nil {
 		o.logger.Error("Connectivity check fail",
 			"phase", "connectivity",
 			"error_detail", err.Error(),
 			"connect_ms", connectMS.Milliseconds(),
 		)
-		o.reporter.UpdateStatus(o.config.RunID, "failed", fmt.Sprintf("connectivity check failed: %s", err.Error()))
+		o.setStatus("failed", fmt.Sprintf("connectivity check failed: %s", err.Error()))
+		o.alerts.Fire(alert.Event{
+			Type:       alert.EventConnectivityFailed,
+			Severity:   alert.SeverityCritical,
+			RunID:      o.config.RunID,
+			ProxyLabel: o.config.Proxy.Label,
+			Summary:    fmt.Sprintf("%s unreachable: %s", o.config.Proxy.Label, err.Error()),
+			Details: map[string]any{
+				"proxy_host": o.config.Proxy.Host,
+				"proxy_port": o.config.Proxy.Port,
+				"protocol":   o.config.Proxy.Protocol,
+			},
+		})
 		return err
 	}
-	conn.Close()
 
 	o.logger.Info("Connectivity check pass",
 		"phase", "connectivity",
@@ -85,19 +128,38 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	)
 
 	// Phase 1: IP check
+	o.state.setPhase(PhaseIPCheck)
 	o.logger.Info("IP check start",
 		"phase", "ip_check",
 	)
+	session := proxy.CurrentSession(o.config.Proxy)
 	ipResult := o.runIPCheck(ctx)
 	if ipResult != nil {
 		o.ipResult = ipResult
-		o.reporter.ReportIPCheck(o.config.RunID, *ipResult)
+		o.sessions.observe(session, ipResult.ObservedIP, time.Now())
+		o.state.setIP(ipResult.ObservedIP, 0)
+		o.report("ip_check", o.reporter.ReportIPCheck(o.config.RunID, *ipResult))
 		o.logger.Info("IP check complete",
 			"phase", "ip_check",
 			"observed_ip", ipResult.ObservedIP,
 			"is_clean", ipResult.IsClean,
 			"geo_match", ipResult.GeoMatch,
 		)
+		if ipResult.ActualCountry != "" && !ipResult.GeoMatch {
+			o.alerts.Fire(alert.Event{
+				Type:       alert.EventGeoMismatch,
+				Severity:   alert.SeverityWarning,
+				RunID:      o.config.RunID,
+				ProxyLabel: o.config.Proxy.Label,
+				Summary: fmt.Sprintf("%s exits in %s, expected %s",
+					o.config.Proxy.Label, ipResult.ActualCountry, ipResult.ExpectedCountry),
+				Details: map[string]any{
+					"observed_ip":      ipResult.ObservedIP,
+					"expected_country": ipResult.ExpectedCountry,
+					"actual_country":   ipResult.ActualCountry,
+				},
+			})
+		}
 	} else {
 		o.logger.Warn("IP check skipped (could not determine IP)",
 			"phase", "ip_check",
@@ -107,26 +169,47 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	// Setup sample channels and collector
 	sampleChan := make(chan domain.HTTPSample, 1000)
 	wsSampleChan := make(chan domain.WSSample, 200)
+	udpSampleChan := make(chan domain.UDPSample, 200)
 	o.collector = NewResultCollector(o.config.RunID, o.logger)
+	o.incidents = newIncidentDetector(o.config.IncidentCfg)
 
-	// Create testers
+	// Create testers; a PATCH arriving meanwhile waits so the testers start at its rates
+	o.cfgMu.Lock()
 	httpBaseURL := o.config.Target.HTTPURL
 	httpsBaseURL := o.config.Target.HTTPSURL
 
-	o.httpTester = proxy.NewHTTPTester(
-		o.config.Proxy, o.config.RunID, o.config.HTTPRPM,
-		o.config.RequestTimeoutMS, httpBaseURL, sampleChan, o.logger,
-	)
-	o.httpsTester = proxy.NewHTTPSTester(
-		o.config.Proxy, o.config.RunID, o.config.HTTPSRPM,
-		o.config.RequestTimeoutMS, httpsBaseURL, sampleChan, o.logger,
-	)
-	o.wsTester = proxy.NewWSTester(
-		o.config.Proxy, o.config.RunID, o.config.WSMessagesPerMin,
-		o.config.RequestTimeoutMS, httpBaseURL, httpsBaseURL, wsSampleChan, o.logger,
-	)
+	if proxy.IsMASQUE(o.config.Proxy) {
+		// A MASQUE proxy only carries UDP, so the target is reached over HTTP/3 alone
+		o.http3Tester = proxy.NewHTTP3Tester(
+			o.config.Proxy, o.config.RunID, o.config.HTTPSRPM,
+			o.config.RequestTimeoutMS, o.config.Target.HTTP3URL, sampleChan, o.logger,
+		)
+	} else {
+		o.httpTester = proxy.NewHTTPTester(
+			o.config.Proxy, o.config.RunID, o.config.HTTPRPM,
+			o.config.RequestTimeoutMS, httpBaseURL, sampleChan, o.logger,
+		)
+		o.httpsTester = proxy.NewHTTPSTester(
+			o.config.Proxy, o.config.RunID, o.config.HTTPSRPM,
+			o.config.RequestTimeoutMS, httpsBaseURL, sampleChan, o.logger,
+		)
+		o.wsTester = proxy.NewWSTester(
+			o.config.Proxy, o.config.RunID, o.config.WSMessagesPerMin,
+			o.config.RequestTimeoutMS, httpBaseURL, httpsBaseURL, wsSampleChan, o.logger,
+		)
+	}
+	// UDP ASSOCIATE only exists in SOCKS5, and the relay is not reachable through a chain
+	if o.config.Proxy.Protocol == domain.ProtocolSOCKS5 && !proxy.IsChained(o.config.Proxy) && o.config.Target.UDPAddr != "" {
+		o.udpTester = proxy.NewUDPTester(
+			o.config.Proxy, o.config.RunID, o.config.UDPPacketsPerMin,
+			o.config.RequestTimeoutMS, o.config.Target.UDPAddr, udpSampleChan, o.logger,
+		)
+	}
+	o.applyLoadLocked()
+	o.cfgMu.Unlock()
 
 	// Phase 2: Warmup
+	o.state.setPhase(PhaseWarmup)
 	o.logger.Info("Warmup start",
 		"phase", "warmup",
 		"warmup_requests", o.config.WarmupRequests,
@@ -135,9 +218,14 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	warmupSuccess, warmupFail := 0, 0
 	var warmupTotalMS float64
 	for i := 0; i < o.config.WarmupRequests; i++ {
-		sample := o.httpTester.DoSingleRequest(ctx, "GET", "/echo", nil, i)
+		var sample domain.HTTPSample
+		if o.http3Tester != nil {
+			sample = o.http3Tester.DoSingleRequest(ctx, "GET", "/echo", nil, i)
+		} else {
+			sample = o.httpTester.DoSingleRequest(ctx, "GET", "/echo", nil, i)
+		}
 		sample.IsWarmup = true
-		o.allSamples = append(o.allSamples, sample)
+		o.observeHTTP(sample)
 
 		if sample.ErrorType == "" {
 			warmupSuccess++
@@ -170,64 +258,123 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	)
 
 	// Phase 3: Start goroutines
+	o.state.setPhase(PhaseContinuous)
 	o.logger.Info("Continuous phase start",
 		"phase", "continuous",
 	)
 
-	g := new(errgroup.Group)
-
-	// Goroutine 1: HTTP tester
-	g.Go(func() error {
-		return o.httpTester.Run(ctx)
-	})
+	// Testers, bursts and re-checks stop on testCtx: POST /stop, or a fixed run's own
+	// duration or sample target, whose reason is the cancel cause
+	testCtx, stopTests := context.WithCancelCause(ctx)
+	defer stopTests(nil)
+	if o.config.RunMode == domain.RunModeFixed && o.config.DurationSec > 0 {
+		var cancel context.CancelFunc
+		testCtx, cancel = context.WithTimeoutCause(testCtx,
+			time.Duration(o.config.DurationSec)*time.Second, stopReason(domain.StopReasonDuration))
+		defer cancel()
+	}
+	o.limits = newRunLimits(o.config, testCtx, stopTests)
 
-	// Goroutine 2: HTTPS tester
-	g.Go(func() error {
-		return o.httpsTester.Run(ctx)
-	})
+	// Collectors stop only once the testers have, so every sample sent is drained
+	collectCtx, stopCollecting := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopCollecting()
 
-	// Goroutine 3: WS tester
-	g.Go(func() error {
-		return o.wsTester.Run(ctx)
-	})
+	g := new(errgroup.Group)
+	collectors := new(errgroup.Group)
+
+	if o.http3Tester != nil {
+		// Goroutine 2h: HTTP/3 tester through the MASQUE tunnel (masque only)
+		http3Ctx := o.limits.bind(testCtx, "http3")
+		g.Go(o.state.track("http3", func() error {
+			return o.http3Tester.Run(http3Ctx)
+		}))
+	} else {
+		httpCtx := o.limits.bind(testCtx, "http")
+		httpsCtx := o.limits.bind(testCtx, "https")
+		wsCtx := o.limits.bind(testCtx, "ws")
+
+		// Goroutine 1: HTTP tester
+		g.Go(o.state.track("http", func() error {
+			return o.httpTester.Run(httpCtx)
+		}))
+
+		// Goroutine 2: HTTPS tester
+		g.Go(o.state.track("https", func() error {
+			return o.httpsTester.Run(httpsCtx)
+		}))
+
+		// Goroutine 3: WS tester
+		g.Go(o.state.track("ws", func() error {
+			return o.wsTester.Run(wsCtx)
+		}))
+	}
 
 	// Goroutine 5b: Collect WS samples from channel → batch report
-	g.Go(func() error {
-		return o.collectAndReportWS(ctx, wsSampleChan)
-	})
+	collectors.Go(o.state.track("ws_collector", func() error {
+		return o.collectAndReportWS(collectCtx, wsSampleChan)
+	}))
+
+	// Goroutine 3b: UDP tester + collector (SOCKS5 only)
+	if o.udpTester != nil {
+		udpCtx := o.limits.bind(testCtx, "udp")
+		g.Go(o.state.track("udp", func() error {
+			return o.udpTester.Run(udpCtx)
+		}))
+		collectors.Go(o.state.track("udp_collector", func() error {
+			return o.collectAndReportUDP(collectCtx, udpSampleChan)
+		}))
+	}
+
+	// Goroutine 3c: Load profile, moving the HTTP(S) rates over time
+	if o.config.LoadProfile != nil {
+		g.Go(o.state.track("load_profile", func() error {
+			return o.runLoadProfile(testCtx)
+		}))
+	}
 
 	// Goroutine 4: Rolling summary
-	g.Go(func() error {
-		return o.rollingSummary(ctx)
-	})
+	g.Go(o.state.track("summary", func() error {
+		return o.rollingSummary(testCtx)
+	}))
 
 	// Goroutine 6: Burst test (every 5 minutes)
-	g.Go(func() error {
-		return o.runBurstLoop(ctx, sampleChan)
-	})
+	g.Go(o.state.track("burst", func() error {
+		return o.runBurstLoop(testCtx, sampleChan)
+	}))
 
 	// Goroutine 8: IP re-check (Sprint 4)
-	if o.ipResult != nil && o.config.ScoringCfg.IPCheckIntervalSec > 0 {
-		g.Go(func() error {
-			return o.ipReCheckLoop(ctx)
-		})
+	if o.ipResult != nil && o.scoringConfig().IPCheckIntervalSec > 0 {
+		g.Go(o.state.track("ip_recheck", func() error {
+			return o.ipReCheckLoop(testCtx)
+		}))
 	}
 
 	// Goroutine 7: Collect samples from channel → batch report
-	g.Go(func() error {
-		return o.collectAndReport(ctx, sampleChan)
-	})
+	collectors.Go(o.state.track("collector", func() error {
+		return o.collectAndReport(collectCtx, sampleChan)
+	}))
 
 	o.logger.Info("All goroutines running",
 		"phase", "continuous",
 	)
 
-	// Wait for all goroutines to finish
+	// Wait for the testers, then let the collectors drain what they sent
 	err = g.Wait()
+	reason := stopReasonOf(testCtx)
+	testersStopped := time.Now()
+	o.state.setPhase(PhaseStopping)
+	stopCollecting()
+	if cerr := collectors.Wait(); err == nil {
+		err = cerr
+	}
+	if inc, ok := o.incidents.finish(testersStopped); ok {
+		o.reportIncident(inc)
+	}
 
 	// Phase 4: Stopping
 	o.logger.Info("All goroutines stopped",
 		"phase", "stopping",
+		"stop_reason", reason,
 	)
 
 	// Phase 5: Final summary
@@ -235,44 +382,32 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 		"phase", "final_summary",
 	)
 
-	o.sampleMu.RLock()
-	finalSamples := make([]domain.HTTPSample, len(o.allSamples))
-	copy(finalSamples, o.allSamples)
-	finalWSSamples := make([]domain.WSSample, len(o.allWSSamples))
-	copy(finalWSSamples, o.allWSSamples)
-	o.sampleMu.RUnlock()
-
-	summary := o.collector.ComputeSummary(finalSamples)
-	o.collector.ComputeWSSummary(&summary, finalWSSamples)
+	summary := o.collector.Summary()
 	o.ipMu.Lock()
-	if o.ipResult != nil {
-		summary.IPClean = &o.ipResult.IsClean
-		summary.IPGeoMatch = &o.ipResult.GeoMatch
-		summary.IPStable = &o.ipResult.IPStable
-		// Sprint 4: gradient IP clean score
-		if o.ipResult.BlacklistQueried > 0 {
-			score := 1.0 - float64(o.ipResult.BlacklistListed)/float64(o.ipResult.BlacklistQueried)
-			summary.IPCleanScore = score
-		} else {
-			summary.IPCleanScore = 1.0
-		}
-	}
+	o.applyIPCheck(&summary)
+	o.sessions.apply(&summary)
 	o.ipMu.Unlock()
-	scoring.ComputeScore(&summary, o.config.ScoringCfg)
+	scoring.ComputeScore(&summary, o.scoringConfig())
+	summary.StopReason = reason
 
 	o.logger.Info("Final summary computed",
 		"phase", "final_summary",
+		"stop_reason", summary.StopReason,
 		"final_score", summary.ScoreTotal,
 		"total_http_samples", summary.HTTPSampleCount,
 		"total_https_samples", summary.HTTPSSampleCount,
 		"ws_sample_count", summary.WSSampleCount,
+		"udp_sample_count", summary.UDPSampleCount,
 		"uptime_ratio", summary.UptimeRatio,
 		"score_ws", summary.ScoreWS,
+		"score_udp", summary.ScoreUDP,
 		"score_security", summary.ScoreSecurity,
 	)
 
-	o.reporter.ReportSummary(o.config.RunID, summary)
-	o.reporter.UpdateStatus(o.config.RunID, "completed", "")
+	o.report("summary", o.reporter.ReportSummary(o.config.RunID, summary))
+	o.live.Publish(o.config.RunID, stream.EventFinalSummary, summary)
+	o.state.setSummary(summary)
+	o.setStatus("completed", "")
 
 	o.logger.Info("Orchestrator complete",
 		"phase", "final_summary",
@@ -281,6 +416,109 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 	return err
 }
 
+// Status is a snapshot of the run's lifecycle state
+func (o *Orchestrator) Status() RunStatus {
+	return o.state.snapshot()
+}
+
+// httpTesterName is the tester an HTTP sample counts towards
+func (o *Orchestrator) httpTesterName(sample domain.HTTPSample) string {
+	switch {
+	case o.http3Tester != nil:
+		return "http3"
+	case sample.IsHTTPS:
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// observeHTTP counts an HTTP(S) sample as it arrives and streams it to live subscribers
+func (o *Orchestrator) observeHTTP(sample domain.HTTPSample) {
+	tester := o.httpTesterName(sample)
+	o.state.countSample(tester, sample.IsWarmup, sample.ErrorType != "", sample.MeasuredAt)
+	o.live.Publish(o.config.RunID, stream.EventHTTPSample, sample)
+	// Bursts overload the proxy on purpose; their failures are not an outage
+	if !sample.IsWarmup && !sample.IsBurst {
+		// Same success rule as the summary's uptime: an HTTP error status fails the sample too
+		errorType := sample.ErrorType
+		if errorType == "" && (sample.StatusCode <= 0 || sample.StatusCode >= 400) {
+			errorType = fmt.Sprintf("http_%d", sample.StatusCode)
+		}
+		o.detectIncident(incidentSample{at: sample.MeasuredAt, protocol: tester, errorType: errorType})
+	}
+}
+
+func (o *Orchestrator) observeWS(sample domain.WSSample) {
+	o.state.countSample("ws", sample.IsWarmup, sample.ErrorType != "", sample.MeasuredAt)
+	o.live.Publish(o.config.RunID, stream.EventWSSample, sample)
+	if !sample.IsWarmup {
+		o.detectIncident(incidentSample{at: sample.MeasuredAt, protocol: "ws", errorType: sample.ErrorType})
+	}
+}
+
+func (o *Orchestrator) observeUDP(sample domain.UDPSample) {
+	o.state.countSample("udp", sample.IsWarmup, sample.ErrorType != "", sample.MeasuredAt)
+	o.live.Publish(o.config.RunID, stream.EventUDPSample, sample)
+	if !sample.IsWarmup {
+		o.detectIncident(incidentSample{at: sample.MeasuredAt, protocol: "udp", errorType: sample.ErrorType})
+	}
+}
+
+func (o *Orchestrator) detectIncident(s incidentSample) {
+	if s.at.IsZero() {
+		s.at = time.Now()
+	}
+	if inc, ok := o.incidents.observe(s); ok {
+		o.reportIncident(inc)
+	}
+}
+
+// reportIncident records an incident that opened or ended
+func (o *Orchestrator) reportIncident(inc domain.Incident) {
+	msg := "Incident opened"
+	if inc.Status != domain.IncidentOpen {
+		msg = "Incident ended"
+	}
+	o.logger.Warn(msg,
+		"phase", "continuous",
+		"incident_seq", inc.Seq,
+		"incident_status", inc.Status,
+		"trigger", inc.Trigger,
+		"error_type", inc.ErrorType,
+		"protocols", inc.Protocols,
+		"failed_samples", inc.FailedSamples,
+		"duration_ms", inc.DurationMS,
+	)
+	o.report("incident", o.reporter.ReportIncident(o.config.RunID, inc))
+	o.live.Publish(o.config.RunID, stream.EventIncident, inc)
+	o.state.setIncident(inc)
+}
+
+// report records a report the required sinks did not take. Sinks spool what they can,
+// so the run goes on; the failure shows in its status and the log.
+func (o *Orchestrator) report(kind string, err error) {
+	if err == nil {
+		return
+	}
+	o.state.reportFailed(err)
+	o.logger.Error("Report fail",
+		"phase", o.state.phase(),
+		"kind", kind,
+		"error_detail", err.Error(),
+	)
+}
+
+// setStatus reports the run's status and tells live subscribers
+func (o *Orchestrator) setStatus(status, errorMessage string) {
+	o.report("status", o.reporter.UpdateStatus(o.config.RunID, status, errorMessage))
+	o.state.finish(status, errorMessage)
+	o.live.Publish(o.config.RunID, stream.EventStatus, map[string]string{
+		"status":        status,
+		"error_message": errorMessage,
+	})
+}
+
 func (o *Orchestrator) rollingSummary(ctx context.Context) error {
 	interval := time.Duration(o.config.SummaryIntervalSec) * time.Second
 	ticker := time.NewTicker(interval)
@@ -291,28 +529,16 @@ func (o *Orchestrator) rollingSummary(ctx context.Context) error {
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
-			o.sampleMu.RLock()
-			samplesCopy := make([]domain.HTTPSample, len(o.allSamples))
-			copy(samplesCopy, o.allSamples)
-			wsSamplesCopy := make([]domain.WSSample, len(o.allWSSamples))
-			copy(wsSamplesCopy, o.allWSSamples)
-			o.sampleMu.RUnlock()
-
-			summary := o.collector.ComputeSummary(samplesCopy)
-			o.collector.ComputeWSSummary(&summary, wsSamplesCopy)
+			summary := o.collector.Summary()
+			windows := o.collector.WindowSummaries()
 			o.ipMu.Lock()
-			if o.ipResult != nil {
-				summary.IPClean = &o.ipResult.IsClean
-				summary.IPGeoMatch = &o.ipResult.GeoMatch
-				summary.IPStable = &o.ipResult.IPStable
-				if o.ipResult.BlacklistQueried > 0 {
-					summary.IPCleanScore = 1.0 - float64(o.ipResult.BlacklistListed)/float64(o.ipResult.BlacklistQueried)
-				} else {
-					summary.IPCleanScore = 1.0
-				}
+			o.applyIPCheck(&summary)
+			o.sessions.apply(&summary)
+			for i := range windows {
+				o.applyIPCheck(&windows[i])
 			}
 			o.ipMu.Unlock()
-			scoring.ComputeScore(&summary, o.config.ScoringCfg)
+			scoring.ComputeScore(&summary, o.scoringConfig())
 
 			o.logger.Info("Rolling summary",
 				"phase", "continuous",
@@ -321,14 +547,89 @@ func (o *Orchestrator) rollingSummary(ctx context.Context) error {
 				"http_count", summary.HTTPSampleCount,
 				"https_count", summary.HTTPSSampleCount,
 				"ws_count", summary.WSSampleCount,
+				"udp_count", summary.UDPSampleCount,
 				"uptime_ratio", summary.UptimeRatio,
 			)
 
-			o.reporter.ReportSummary(o.config.RunID, summary)
+			o.report("summary", o.reporter.ReportSummary(o.config.RunID, summary))
+			o.live.Publish(o.config.RunID, stream.EventSummary, summary)
+			o.state.setSummary(summary)
+			o.alerts.CheckSummary(o.config.RunID, o.config.Proxy.Label, summary)
+			o.reportWindows(windows)
 		}
 	}
 }
 
+// reportWindows scores and reports the trailing-window summaries, so a proxy that has
+// degraded recently shows it even when its lifetime averages still look fine
+func (o *Orchestrator) reportWindows(windows []domain.RunSummary) {
+	cfg := o.scoringConfig()
+	for i := range windows {
+		w := &windows[i]
+		scoring.ComputeScore(w, cfg)
+
+		o.logger.Info("Window summary",
+			"phase", "continuous",
+			"goroutine", "summary",
+			"window", w.Window,
+			"score_total", w.ScoreTotal,
+			"http_count", w.HTTPSampleCount,
+			"https_count", w.HTTPSSampleCount,
+			"ws_count", w.WSSampleCount,
+			"udp_count", w.UDPSampleCount,
+			"uptime_ratio", w.UptimeRatio,
+			"ttfb_p95_ms", w.TTFBP95MS,
+		)
+
+		o.report("window_summary", o.reporter.ReportSummary(o.config.RunID, *w))
+		o.live.Publish(o.config.RunID, stream.EventWindowSummary, *w)
+	}
+	o.state.setWindows(windows)
+}
+
+// applyIPCheck copies the latest IP check onto summary for scoring; callers hold ipMu
+func (o *Orchestrator) applyIPCheck(summary *domain.RunSummary) {
+	if o.ipResult == nil {
+		return
+	}
+	summary.IPClean = &o.ipResult.IsClean
+	summary.IPGeoMatch = &o.ipResult.GeoMatch
+	summary.IPStable = &o.ipResult.IPStable
+	// Sprint 4: gradient IP clean score
+	if o.ipResult.BlacklistQueried > 0 {
+		summary.IPCleanScore = 1.0 - float64(o.ipResult.BlacklistListed)/float64(o.ipResult.BlacklistQueried)
+	} else {
+		summary.IPCleanScore = 1.0
+	}
+}
+
+// checkConnectivity opens one tunnel through the proxy to the target and closes it
+func (o *Orchestrator) checkConnectivity(ctx context.Context, timeout time.Duration) (time.Duration, error) {
+	if proxy.IsMASQUE(o.config.Proxy) {
+		if o.config.Target.HTTP3URL == "" {
+			return 0, fmt.Errorf("masque proxy requires an http3 target url")
+		}
+		return proxy.CheckMASQUE(ctx, o.config.Proxy, o.config.Target.HTTP3URL, timeout, o.logger)
+	}
+
+	conn, connectMS, err := proxy.DialThroughProxy(ctx, o.config.Proxy, timeout, o.logger)
+	if err != nil {
+		return connectMS, err
+	}
+	conn.Close()
+	return connectMS, nil
+}
+
+// probeTarget returns the target base URL and transport for one-off requests (IP checks, bursts).
+// MASQUE proxies only carry UDP, so those go to the HTTP/3 target.
+func (o *Orchestrator) probeTarget(timeout time.Duration) (string, http.RoundTripper) {
+	if proxy.IsMASQUE(o.config.Proxy) {
+		return o.config.Target.HTTP3URL, proxy.NewMASQUETransport(o.config.Proxy, timeout, o.logger)
+	}
+	transport := proxy.NewTransport(o.config.Proxy, timeout, o.logger)
+	return o.config.Target.HTTPURL, proxy.WithForwardProxy(transport, o.config.Proxy)
+}
+
 // runIPCheck performs the Phase 1 IP verification
 func (o *Orchestrator) runIPCheck(ctx context.Context) *domain.IPCheckResult {
 	// Step 1: Get observed IP via proxy
@@ -338,10 +639,19 @@ func (o *Orchestrator) runIPCheck(ctx context.Context) *domain.IPCheckResult {
 	}
 
 	result := &domain.IPCheckResult{
-		RunID:           o.config.RunID,
-		ProxyID:         "", // filled by API
-		ObservedIP:      observedIP,
-		ExpectedCountry: o.config.Proxy.ExpectedCountry,
+		RunID:            o.config.RunID,
+		ProxyID:          "", // filled by API
+		ObservedIP:       observedIP,
+		ObservedIPFamily: ipcheck.Family(observedIP),
+		ExpectedCountry:  o.config.Proxy.ExpectedCountry,
+	}
+	if o.config.IPFamily != domain.IPFamilyAuto && result.ObservedIPFamily != o.config.IPFamily {
+		o.logger.Warn("Egress IP family mismatch",
+			"phase", "ip_check",
+			"ip_family", o.config.IPFamily,
+			"observed_ip", observedIP,
+			"observed_ip_family", result.ObservedIPFamily,
+		)
 	}
 
 	// Step 2: Blacklist check
@@ -380,22 +690,14 @@ func (o *Orchestrator) runIPCheck(ctx context.Context) *domain.IPCheckResult {
 
 // getIPViaProxy sends GET /ip through the proxy to determine the observed IP
 func (o *Orchestrator) getIPViaProxy(ctx context.Context) string {
-	proxyURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s:%d", o.config.Proxy.Host, o.config.Proxy.Port),
-	}
-	if o.config.Proxy.AuthUser != "" {
-		proxyURL.User = url.UserPassword(o.config.Proxy.AuthUser, o.config.Proxy.AuthPass)
-	}
-
+	timeout := time.Duration(o.config.RequestTimeoutMS) * time.Millisecond
+	baseURL, transport := o.probeTarget(timeout)
 	client := &http.Client{
-		Timeout: time.Duration(o.config.RequestTimeoutMS) * time.Millisecond,
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		},
+		Timeout:   timeout,
+		Transport: transport,
 	}
 
-	targetURL := o.config.Target.HTTPURL + "/ip"
+	targetURL := baseURL + "/ip"
 	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
 	if err != nil {
 		o.logger.Error("IP check request build fail",
@@ -429,14 +731,15 @@ func (o *Orchestrator) getIPViaProxy(ctx context.Context) string {
 	}
 	if err := json.Unmarshal(body, &ipResp); err != nil {
 		// Try raw text
-		return strings.TrimSpace(string(body))
+		return ipcheck.NormalizeIP(strings.TrimSpace(string(body)))
 	}
-	return ipResp.IP
+	return ipcheck.NormalizeIP(ipResp.IP)
 }
 
-// ipReCheckLoop periodically re-checks the proxy IP for stability (Sprint 4)
+// ipReCheckLoop periodically re-checks the proxy IP for stability (Sprint 4).
+// Changes the rotation mode promises are logged and tracked but do not mark the IP unstable.
 func (o *Orchestrator) ipReCheckLoop(ctx context.Context) error {
-	interval := time.Duration(o.config.ScoringCfg.IPCheckIntervalSec) * time.Second
+	interval := time.Duration(o.scoringConfig().IPCheckIntervalSec) * time.Second
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -444,7 +747,10 @@ func (o *Orchestrator) ipReCheckLoop(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-o.ipIntervalSet:
+			ticker.Reset(time.Duration(o.scoringConfig().IPCheckIntervalSec) * time.Second)
 		case <-ticker.C:
+			session := proxy.CurrentSession(o.config.Proxy)
 			newIP := o.getIPViaProxy(ctx)
 			if newIP == "" {
 				o.logger.Warn("IP re-check failed",
@@ -454,18 +760,57 @@ func (o *Orchestrator) ipReCheckLoop(ctx context.Context) error {
 				continue
 			}
 			o.ipMu.Lock()
-			if o.ipResult != nil && newIP != o.ipResult.ObservedIP {
-				o.logger.Warn("IP changed",
-					"module", "engine.orchestrator",
-					"phase", "continuous",
-					"old_ip", o.ipResult.ObservedIP,
-					"new_ip", newIP,
-					"proxy_id", o.config.Proxy.Label,
-					"run_id", o.config.RunID,
-				)
-				o.ipResult.IPStable = false
-				o.ipResult.IPChanges++
+			changed, expected := o.sessions.observe(session, newIP, time.Now())
+			if o.ipResult != nil && changed {
+				if expected {
+					o.logger.Info("IP rotated",
+						"phase", "continuous",
+						"goroutine", "ip_recheck",
+						"old_ip", o.ipResult.ObservedIP,
+						"new_ip", newIP,
+						"rotation_mode", o.sessions.mode,
+						"session_id", session.ID,
+					)
+				} else {
+					o.logger.Warn("IP changed",
+						"module", "engine.orchestrator",
+						"phase", "continuous",
+						"old_ip", o.ipResult.ObservedIP,
+						"new_ip", newIP,
+						"rotation_mode", o.sessions.mode,
+						"session_id", session.ID,
+						"proxy_id", o.config.Proxy.Label,
+						"run_id", o.config.RunID,
+					)
+					o.ipResult.IPStable = false
+					o.ipResult.IPChanges++
+					o.alerts.Fire(alert.Event{
+						Type:       alert.EventIPChanged,
+						Severity:   alert.SeverityWarning,
+						RunID:      o.config.RunID,
+						ProxyLabel: o.config.Proxy.Label,
+						Summary: fmt.Sprintf("%s exit IP changed from %s to %s",
+							o.config.Proxy.Label, o.ipResult.ObservedIP, newIP),
+						Details: map[string]any{
+							"old_ip":        o.ipResult.ObservedIP,
+							"new_ip":        newIP,
+							"rotation_mode": o.sessions.mode,
+							"ip_changes":    o.ipResult.IPChanges,
+						},
+					})
+				}
+				o.live.Publish(o.config.RunID, stream.EventIPChange, map[string]any{
+					"old_ip":        o.ipResult.ObservedIP,
+					"new_ip":        newIP,
+					"expected":      expected,
+					"rotation_mode": o.sessions.mode,
+					"session_id":    session.ID,
+					"ip_changes":    o.ipResult.IPChanges,
+					"measured_at":   time.Now(),
+				})
 				o.ipResult.ObservedIP = newIP
+				o.ipResult.ObservedIPFamily = ipcheck.Family(newIP)
+				o.state.setIP(newIP, o.ipResult.IPChanges)
 			}
 			o.ipMu.Unlock()
 		}
@@ -474,27 +819,146 @@ func (o *Orchestrator) ipReCheckLoop(ctx context.Context) error {
 
 // runBurstLoop runs burst tests periodically
 func (o *Orchestrator) runBurstLoop(ctx context.Context, sampleChan chan<- domain.HTTPSample) error {
-	intervalSec := 300 // default 5 minutes
-	concurrency := 100
+	ticker := time.NewTicker(time.Duration(o.burstSettings().IntervalSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-o.burstChanged:
+			ticker.Reset(time.Duration(o.burstSettings().IntervalSec) * time.Second)
+		case <-ticker.C:
+			o.runBurst(ctx, o.burstSettings().Concurrency, sampleChan)
+		}
+	}
+}
+
+// burstSettings is the run's burst interval and concurrency, defaults filled in
+func (o *Orchestrator) burstSettings() domain.BurstConfig {
+	o.cfgMu.RLock()
+	defer o.cfgMu.RUnlock()
+	return o.burstSettingsLocked()
+}
+
+func (o *Orchestrator) burstSettingsLocked() domain.BurstConfig {
+	b := domain.BurstConfig{IntervalSec: defaultBurstIntervalSec, Concurrency: defaultBurstConcurrency}
 	if o.config.Burst != nil {
 		if o.config.Burst.IntervalSec > 0 {
-			intervalSec = o.config.Burst.IntervalSec
+			b.IntervalSec = o.config.Burst.IntervalSec
 		}
 		if o.config.Burst.Concurrency > 0 {
-			concurrency = o.config.Burst.Concurrency
+			b.Concurrency = o.config.Burst.Concurrency
 		}
 	}
+	return b
+}
 
-	ticker := time.NewTicker(time.Duration(intervalSec) * time.Second)
-	defer ticker.Stop()
+// scoringConfig is the run's current scoring thresholds
+func (o *Orchestrator) scoringConfig() domain.ScoringConfig {
+	o.cfgMu.RLock()
+	defer o.cfgMu.RUnlock()
+	return o.config.ScoringCfg
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			o.runBurst(ctx, concurrency, sampleChan)
+// Reconfigure applies patch to the run's config and live testers under one lock, so
+// readers see either none or all of it, and records the changes on the run's timeline.
+// New rates apply from the next request or message, new intervals from the next tick.
+func (o *Orchestrator) Reconfigure(patch domain.RunConfigPatch) []ConfigChange {
+	changes := []ConfigChange{}
+	changed := func(field string, old, new any) {
+		changes = append(changes, ConfigChange{Field: field, Old: old, New: new})
+	}
+
+	o.cfgMu.Lock()
+	if patch.HTTPRPM != nil && *patch.HTTPRPM != o.config.HTTPRPM {
+		changed("http_rpm", o.config.HTTPRPM, *patch.HTTPRPM)
+		o.config.HTTPRPM = *patch.HTTPRPM
+		if o.httpTester != nil {
+			o.httpTester.SetRPM(o.config.HTTPRPM)
+		}
+	}
+	if patch.HTTPSRPM != nil && *patch.HTTPSRPM != o.config.HTTPSRPM {
+		changed("https_rpm", o.config.HTTPSRPM, *patch.HTTPSRPM)
+		o.config.HTTPSRPM = *patch.HTTPSRPM
+		if o.httpsTester != nil {
+			o.httpsTester.SetRPM(o.config.HTTPSRPM)
+		}
+		if o.http3Tester != nil {
+			o.http3Tester.SetRPM(o.config.HTTPSRPM)
+		}
+	}
+	if patch.WSMessagesPerMin != nil && *patch.WSMessagesPerMin != o.config.WSMessagesPerMin {
+		changed("ws_messages_per_minute", o.config.WSMessagesPerMin, *patch.WSMessagesPerMin)
+		o.config.WSMessagesPerMin = *patch.WSMessagesPerMin
+		if o.wsTester != nil {
+			o.wsTester.SetMessagesPerMin(o.config.WSMessagesPerMin)
+		}
+	}
+	if patch.Burst != nil {
+		old := o.burstSettingsLocked()
+		burst := old
+		if patch.Burst.IntervalSec > 0 {
+			burst.IntervalSec = patch.Burst.IntervalSec
+		}
+		if patch.Burst.Concurrency > 0 {
+			burst.Concurrency = patch.Burst.Concurrency
 		}
+		o.config.Burst = &burst
+		if burst.IntervalSec != old.IntervalSec {
+			changed("burst.interval_sec", old.IntervalSec, burst.IntervalSec)
+			notify(o.burstChanged)
+		}
+		if burst.Concurrency != old.Concurrency {
+			changed("burst.concurrency", old.Concurrency, burst.Concurrency)
+		}
+	}
+	if patch.ScoringConfig != nil {
+		old := o.config.ScoringCfg
+		sc := config.MergeScoring(old, patch.ScoringConfig)
+		o.config.ScoringCfg = sc
+		if sc.LatencyThresholdMs != old.LatencyThresholdMs {
+			changed("scoring_config.latency_threshold_ms", old.LatencyThresholdMs, sc.LatencyThresholdMs)
+		}
+		if sc.JitterThresholdMs != old.JitterThresholdMs {
+			changed("scoring_config.jitter_threshold_ms", old.JitterThresholdMs, sc.JitterThresholdMs)
+		}
+		if sc.WSHoldTargetMs != old.WSHoldTargetMs {
+			changed("scoring_config.ws_hold_target_ms", old.WSHoldTargetMs, sc.WSHoldTargetMs)
+		}
+		if sc.IPCheckIntervalSec != old.IPCheckIntervalSec {
+			changed("scoring_config.ip_check_interval_sec", old.IPCheckIntervalSec, sc.IPCheckIntervalSec)
+			notify(o.ipIntervalSet)
+		}
+	}
+	// A load profile scales the new rates from its current level
+	o.applyLoadLocked()
+	o.cfgMu.Unlock()
+
+	if len(changes) == 0 {
+		return changes
+	}
+
+	ev := TimelineEvent{At: time.Now(), Type: TimelineConfigChange, Changes: changes}
+	o.state.addEvent(ev)
+	o.live.Publish(o.config.RunID, stream.EventConfigChange, ev)
+
+	fields := make([]string, len(changes))
+	for i, c := range changes {
+		fields[i] = c.Field
+	}
+	o.logger.Info("Run reconfigured",
+		"phase", o.state.phase(),
+		"changed_fields", strings.Join(fields, ","),
+	)
+	return changes
+}
+
+// notify wakes a loop waiting on ch without blocking if it is already due to wake
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
 	}
 }
 
@@ -506,14 +970,16 @@ func (o *Orchestrator) runBurst(ctx context.Context, count int, sampleChan chan<
 		"concurrent_count", count,
 	)
 
-	targetURL := o.config.Target.HTTPURL + "/echo"
+	baseURL, _ := o.probeTarget(10 * time.Second)
+	targetURL := baseURL + "/echo"
 
-	proxyURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s:%d", o.config.Proxy.Host, o.config.Proxy.Port),
-	}
-	if o.config.Proxy.AuthUser != "" {
-		proxyURL.User = url.UserPassword(o.config.Proxy.AuthUser, o.config.Proxy.AuthPass)
+	// Burst samples carry the rate the tester on the same target runs at, as load offered
+	// underneath the burst
+	var targetRPM float64
+	if o.http3Tester != nil {
+		targetRPM = o.http3Tester.TargetRPM()
+	} else if o.httpTester != nil {
+		targetRPM = o.httpTester.TargetRPM()
 	}
 
 	var successCount, failCount int64
@@ -527,11 +993,10 @@ func (o *Orchestrator) runBurst(ctx context.Context, count int, sampleChan chan<
 		go func(idx int) {
 			defer wg.Done()
 
+			_, transport := o.probeTarget(10 * time.Second)
 			client := &http.Client{
-				Timeout: 10 * time.Second,
-				Transport: &http.Transport{
-					Proxy: http.ProxyURL(proxyURL),
-				},
+				Timeout:   10 * time.Second,
+				Transport: transport,
 			}
 
 			reqStart := time.Now()
@@ -540,11 +1005,13 @@ func (o *Orchestrator) runBurst(ctx context.Context, count int, sampleChan chan<
 				atomic.AddInt64(&failCount, 1)
 				sample := domain.HTTPSample{
 					Seq:          idx,
+					IsBurst:      true,
 					Method:       "GET",
 					TargetURL:    targetURL,
 					ErrorType:    "request_build_error",
 					ErrorMessage: err.Error(),
 					TotalMS:      float64(time.Since(reqStart).Microseconds()) / 1000.0,
+					TargetRPM:    targetRPM,
 					MeasuredAt:   time.Now(),
 				}
 				select {
@@ -560,9 +1027,11 @@ func (o *Orchestrator) runBurst(ctx context.Context, count int, sampleChan chan<
 
 			sample := domain.HTTPSample{
 				Seq:        idx,
+				IsBurst:    true,
 				Method:     "GET",
 				TargetURL:  targetURL,
 				TotalMS:    elapsedMS,
+				TargetRPM:  targetRPM,
 				MeasuredAt: time.Now(),
 			}
 
@@ -607,6 +1076,22 @@ func (o *Orchestrator) runBurst(ctx context.Context, count int, sampleChan chan<
 		"avg_ms", avgMS,
 		"duration_ms", burstDuration.Milliseconds(),
 	)
+	o.state.addBurst(BurstResult{
+		StartedAt:    burstStart,
+		Concurrency:  count,
+		SuccessCount: s,
+		FailCount:    f,
+		AvgMS:        avgMS,
+		DurationMS:   burstDuration.Milliseconds(),
+	})
+	o.live.Publish(o.config.RunID, stream.EventBurst, map[string]any{
+		"concurrent_count": count,
+		"success_count":    s,
+		"fail_count":       f,
+		"avg_ms":           avgMS,
+		"duration_ms":      burstDuration.Milliseconds(),
+		"measured_at":      burstStart,
+	})
 }
 
 // collectAndReportWS collects WS samples from channel and reports them in batches
@@ -620,16 +1105,14 @@ func (o *Orchestrator) collectAndReportWS(ctx context.Context, wsSampleChan <-ch
 			return
 		}
 
-		o.sampleMu.Lock()
-		o.allWSSamples = append(o.allWSSamples, batch...)
-		o.sampleMu.Unlock()
+		o.collector.AddWS(batch...)
 
 		o.logger.Debug("WS batch assembled",
 			"phase", "continuous",
 			"batch_size", len(batch),
 		)
 
-		o.reporter.ReportWSSamples(o.config.RunID, batch)
+		o.report("ws_samples", o.reporter.ReportWSSamples(o.config.RunID, batch))
 		batch = make([]domain.WSSample, 0, 20)
 	}
 
@@ -640,7 +1123,11 @@ func (o *Orchestrator) collectAndReportWS(ctx context.Context, wsSampleChan <-ch
 			for draining {
 				select {
 				case sample := <-wsSampleChan:
+					if !o.limits.accept("ws") {
+						continue
+					}
 					batch = append(batch, sample)
+					o.observeWS(sample)
 				default:
 					draining = false
 				}
@@ -648,7 +1135,11 @@ func (o *Orchestrator) collectAndReportWS(ctx context.Context, wsSampleChan <-ch
 			flush()
 			return nil
 		case sample := <-wsSampleChan:
+			if !o.limits.accept("ws") {
+				continue
+			}
 			batch = append(batch, sample)
+			o.observeWS(sample)
 			if len(batch) >= 20 {
 				flush()
 			}
@@ -658,6 +1149,61 @@ func (o *Orchestrator) collectAndReportWS(ctx context.Context, wsSampleChan <-ch
 	}
 }
 
+// collectAndReportUDP collects UDP session samples from channel and reports them in batches
+func (o *Orchestrator) collectAndReportUDP(ctx context.Context, udpSampleChan <-chan domain.UDPSample) error {
+	batch := make([]domain.UDPSample, 0, 10)
+	batchTimeout := time.NewTicker(5 * time.Second)
+	defer batchTimeout.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		o.collector.AddUDP(batch...)
+
+		o.logger.Debug("UDP batch assembled",
+			"phase", "continuous",
+			"batch_size", len(batch),
+		)
+
+		o.report("udp_samples", o.reporter.ReportUDPSamples(o.config.RunID, batch))
+		batch = make([]domain.UDPSample, 0, 10)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			draining := true
+			for draining {
+				select {
+				case sample := <-udpSampleChan:
+					if !o.limits.accept("udp") {
+						continue
+					}
+					batch = append(batch, sample)
+					o.observeUDP(sample)
+				default:
+					draining = false
+				}
+			}
+			flush()
+			return nil
+		case sample := <-udpSampleChan:
+			if !o.limits.accept("udp") {
+				continue
+			}
+			batch = append(batch, sample)
+			o.observeUDP(sample)
+			if len(batch) >= 10 {
+				flush()
+			}
+		case <-batchTimeout.C:
+			flush()
+		}
+	}
+}
+
 func (o *Orchestrator) collectAndReport(ctx context.Context, sampleChan <-chan domain.HTTPSample) error {
 	batch := make([]domain.HTTPSample, 0, 50)
 	batchTimeout := time.NewTicker(5 * time.Second)
@@ -668,9 +1214,7 @@ func (o *Orchestrator) collectAndReport(ctx context.Context, sampleChan <-chan d
 			return
 		}
 
-		o.sampleMu.Lock()
-		o.allSamples = append(o.allSamples, batch...)
-		o.sampleMu.Unlock()
+		o.collector.AddHTTP(batch...)
 
 		httpCount, httpsCount := 0, 0
 		for _, s := range batch {
@@ -688,7 +1232,7 @@ func (o *Orchestrator) collectAndReport(ctx context.Context, sampleChan <-chan d
 			"https_count", httpsCount,
 		)
 
-		o.reporter.ReportHTTPSamples(o.config.RunID, batch)
+		o.report("http_samples", o.reporter.ReportHTTPSamples(o.config.RunID, batch))
 		batch = make([]domain.HTTPSample, 0, 50)
 	}
 
@@ -700,7 +1244,11 @@ func (o *Orchestrator) collectAndReport(ctx context.Context, sampleChan <-chan d
 			for draining {
 				select {
 				case sample := <-sampleChan:
+					if !o.limits.acceptHTTP(o.httpTesterName(sample), sample) {
+						continue
+					}
 					batch = append(batch, sample)
+					o.observeHTTP(sample)
 				default:
 					draining = false
 				}
@@ -708,7 +1256,11 @@ func (o *Orchestrator) collectAndReport(ctx context.Context, sampleChan <-chan d
 			flush()
 			return nil
 		case sample := <-sampleChan:
+			if !o.limits.acceptHTTP(o.httpTesterName(sample), sample) {
+				continue
+			}
 			batch = append(batch, sample)
+			o.observeHTTP(sample)
 			if len(batch) >= 50 {
 				flush()
 			}
@@ -2,19 +2,45 @@ package engine
 
 import (
 	"log/slog"
-	"math"
-	"sort"
 	"sync"
+	"time"
 
 	"proxy-stability-test/runner/internal/domain"
 )
 
-// ResultCollector aggregates HTTP samples and computes summaries
+// summaryWindow is a trailing window rolling summaries are also computed over
+type summaryWindow struct {
+	label string
+	span  time.Duration
+}
+
+// summaryWindows show a run's current health next to its lifetime averages
+var summaryWindows = []summaryWindow{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// windowBucketWidth is the step windows slide by: samples are bucketed by when they were
+// measured, and a window covers every bucket that overlaps it
+const windowBucketWidth = 10 * time.Second
+
+// ResultCollector folds samples into streaming aggregates as they arrive and computes
+// summaries from them, so memory stays flat however long a run lasts and a summary
+// costs the same after a minute or after days. Percentiles are within sketchAccuracy,
+// and the exit IP pool is estimated as cardinalityPrecision describes.
 type ResultCollector struct {
-	mu          sync.RWMutex
-	httpSamples []domain.HTTPSample
-	logger      *slog.Logger
-	runID       string
+	mu      sync.Mutex
+	stats   sampleStats
+	buckets []*statsBucket // oldest first, spanning the longest summary window
+	logger  *slog.Logger
+	runID   string
+}
+
+// statsBucket aggregates the samples measured in one windowBucketWidth
+type statsBucket struct {
+	start time.Time
+	stats sampleStats
 }
 
 // NewResultCollector creates a new result collector
@@ -25,298 +51,706 @@ func NewResultCollector(runID string, logger *slog.Logger) *ResultCollector {
 	}
 }
 
-// Add adds a sample to the collector
-func (c *ResultCollector) Add(sample domain.HTTPSample) {
+// AddHTTP folds HTTP(S) samples into the run's aggregates
+func (c *ResultCollector) AddHTTP(samples ...domain.HTTPSample) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.httpSamples = append(c.httpSamples, sample)
+	for _, s := range samples {
+		c.stats.addHTTP(s)
+		if b := c.bucket(s.MeasuredAt); b != nil {
+			b.addHTTP(s)
+		}
+	}
 }
 
-// AddBatch adds multiple samples at once
-func (c *ResultCollector) AddBatch(samples []domain.HTTPSample) {
+// AddWS folds WS samples into the run's aggregates
+func (c *ResultCollector) AddWS(samples ...domain.WSSample) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.httpSamples = append(c.httpSamples, samples...)
+	for _, s := range samples {
+		c.stats.addWS(s)
+		if b := c.bucket(s.MeasuredAt); b != nil {
+			b.addWS(s)
+		}
+	}
 }
 
-// GetPendingSamples returns and drains non-warmup samples for reporting
-func (c *ResultCollector) GetPendingSamples(batchSize int) []domain.HTTPSample {
+// AddUDP folds UDP session samples into the run's aggregates
+func (c *ResultCollector) AddUDP(samples ...domain.UDPSample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range samples {
+		c.stats.addUDP(s)
+		if b := c.bucket(s.MeasuredAt); b != nil {
+			b.addUDP(s)
+		}
+	}
+}
+
+// Summary computes a RunSummary from every sample added so far
+func (c *ResultCollector) Summary() domain.RunSummary {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	n := len(c.httpSamples)
-	if n == 0 {
+	summary := c.summarize(&c.stats)
+	c.logSummary(summary)
+	return summary
+}
+
+// WindowSummaries computes one RunSummary per summaryWindows entry from only the samples
+// measured in that trailing window, labelled with RunSummary.Window
+func (c *ResultCollector) WindowSummaries() []domain.RunSummary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.prune(now)
+	out := make([]domain.RunSummary, 0, len(summaryWindows))
+	for _, w := range summaryWindows {
+		from := now.Add(-w.span)
+		var merged sampleStats
+		for _, b := range c.buckets {
+			if b.start.Add(windowBucketWidth).After(from) {
+				merged.merge(&b.stats)
+			}
+		}
+		summary := c.summarize(&merged)
+		summary.Window = w.label
+		out = append(out, summary)
+	}
+	return out
+}
+
+func (c *ResultCollector) summarize(st *sampleStats) domain.RunSummary {
+	summary := domain.RunSummary{RunID: c.runID}
+	st.http.apply(&summary)
+	st.ws.apply(&summary)
+	st.udp.apply(&summary)
+	st.hops.apply(&summary)
+	return summary
+}
+
+// bucket returns the window bucket for a sample measured at, or nil if it is older than
+// the longest window; callers hold mu
+func (c *ResultCollector) bucket(at time.Time) *sampleStats {
+	now := time.Now()
+	if at.IsZero() {
+		at = now
+	}
+	start := at.Truncate(windowBucketWidth)
+	if !start.Add(windowBucketWidth).After(now.Add(-maxSummaryWindow())) {
 		return nil
 	}
+	c.prune(now)
 
-	if batchSize > n {
-		batchSize = n
+	// Samples arrive roughly in order, so search from the newest bucket
+	i := len(c.buckets)
+	for i > 0 && !c.buckets[i-1].start.Before(start) {
+		if c.buckets[i-1].start.Equal(start) {
+			return &c.buckets[i-1].stats
+		}
+		i--
 	}
+	b := &statsBucket{start: start}
+	c.buckets = append(c.buckets, nil)
+	copy(c.buckets[i+1:], c.buckets[i:])
+	c.buckets[i] = b
+	return &b.stats
+}
 
-	batch := make([]domain.HTTPSample, batchSize)
-	copy(batch, c.httpSamples[:batchSize])
-	c.httpSamples = c.httpSamples[batchSize:]
-	return batch
+// prune drops the buckets every window has slid past; callers hold mu
+func (c *ResultCollector) prune(now time.Time) {
+	from := now.Add(-maxSummaryWindow())
+	n := 0
+	for n < len(c.buckets) && !c.buckets[n].start.Add(windowBucketWidth).After(from) {
+		n++
+	}
+	if n > 0 {
+		c.buckets = append(c.buckets[:0], c.buckets[n:]...)
+	}
 }
 
-// TotalSamples returns the total count of all samples collected
-func (c *ResultCollector) TotalSamples() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	return len(c.httpSamples)
+func maxSummaryWindow() time.Duration {
+	return summaryWindows[len(summaryWindows)-1].span
 }
 
-// ComputeSummary computes a RunSummary from all collected non-warmup samples
-func (c *ResultCollector) ComputeSummary(allSamples []domain.HTTPSample) domain.RunSummary {
-	// Filter out warmup samples
-	var valid []domain.HTTPSample
-	var httpCount, httpsCount int
-	var successCount, errorCount int
-	var totalBytesSent, totalBytesReceived int64
+func (c *ResultCollector) logSummary(summary domain.RunSummary) {
+	if summary.HTTPSampleCount+summary.HTTPSSampleCount == 0 {
+		c.logger.Warn("No samples for metric",
+			"phase", "continuous",
+			"run_id", c.runID,
+		)
+	} else {
+		c.logger.Info("Summary computed",
+			"phase", "continuous",
+			"run_id", c.runID,
+			"http_count", summary.HTTPSampleCount,
+			"https_count", summary.HTTPSSampleCount,
+			"success_count", summary.HTTPSuccessCount,
+			"error_count", summary.HTTPErrorCount,
+			"uptime_ratio", summary.UptimeRatio,
+			"ttfb_p50_ms", summary.TTFBP50MS,
+			"ttfb_p95_ms", summary.TTFBP95MS,
+			"jitter_ms", summary.JitterMS,
+			"h1_count", summary.H1SampleCount,
+			"h2_count", summary.H2SampleCount,
+			"h3_count", summary.H3SampleCount,
+		)
+	}
 
-	for _, s := range allSamples {
-		if s.IsWarmup {
-			continue
-		}
-		valid = append(valid, s)
-		if s.IsHTTPS {
-			httpsCount++
-		} else {
-			httpCount++
-		}
-		// Success = no connection error AND valid HTTP status (2xx/3xx)
-		if s.ErrorType == "" && s.StatusCode > 0 && s.StatusCode < 400 {
-			successCount++
-		} else {
-			errorCount++
-		}
-		totalBytesSent += s.BytesSent
-		totalBytesReceived += s.BytesReceived
+	if summary.WSSampleCount > 0 {
+		c.logger.Info("WS summary computed",
+			"phase", "continuous",
+			"run_id", c.runID,
+			"ws_sample_count", summary.WSSampleCount,
+			"ws_success_count", summary.WSSuccessCount,
+			"ws_error_count", summary.WSErrorCount,
+			"ws_rtt_avg_ms", summary.WSRTTAvgMS,
+			"ws_drop_rate", summary.WSDropRate,
+		)
 	}
 
-	summary := domain.RunSummary{
-		RunID:              c.runID,
-		HTTPSampleCount:    httpCount,
-		HTTPSSampleCount:   httpsCount,
-		HTTPSuccessCount:   successCount,
-		HTTPErrorCount:     errorCount,
-		TotalBytesSent:     totalBytesSent,
-		TotalBytesReceived: totalBytesReceived,
+	if summary.UDPSampleCount > 0 {
+		c.logger.Info("UDP summary computed",
+			"phase", "continuous",
+			"run_id", c.runID,
+			"udp_sample_count", summary.UDPSampleCount,
+			"udp_success_count", summary.UDPSuccessCount,
+			"udp_loss_rate", summary.UDPLossRate,
+			"udp_rtt_avg_ms", summary.UDPRTTAvgMS,
+			"udp_jitter_ms", summary.UDPJitterMS,
+		)
 	}
 
-	if len(valid) == 0 {
-		c.logger.Warn("No samples for metric",
+	for _, st := range summary.HopStats {
+		c.logger.Info("Hop summary computed",
 			"phase", "continuous",
 			"run_id", c.runID,
+			"hop", st.Hop,
+			"hop_label", st.Label,
+			"hop_protocol", st.Protocol,
+			"sample_count", st.SampleCount,
+			"error_count", st.ErrorCount,
+			"added_avg_ms", st.AddedAvgMS,
+			"latency_share", st.LatencyShare,
 		)
-		return summary
 	}
+}
 
-	// Uptime ratio
-	summary.UptimeRatio = float64(successCount) / float64(len(valid))
+// sampleStats aggregates every kind of sample one run produces
+type sampleStats struct {
+	http httpStats
+	ws   wsStats
+	udp  udpStats
+	hops hopStats
+}
 
-	// Sprint 4: compute majority TLS version
-	tlsVersionCounts := make(map[string]int)
-	for _, s := range valid {
-		if s.IsHTTPS && s.TLSVersion != "" && s.ErrorType == "" {
-			tlsVersionCounts[s.TLSVersion]++
-		}
+func (s *sampleStats) addHTTP(sample domain.HTTPSample) {
+	if sample.IsWarmup {
+		return
 	}
-	if len(tlsVersionCounts) > 0 {
-		maxCount := 0
-		for ver, count := range tlsVersionCounts {
-			if count > maxCount {
-				maxCount = count
-				summary.MajorityTLSVersion = ver
-			}
+	s.http.add(sample)
+	s.hops.add(sample.HopTimings)
+}
+
+func (s *sampleStats) addWS(sample domain.WSSample) {
+	s.ws.add(sample)
+	s.hops.add(sample.HopTimings)
+}
+
+func (s *sampleStats) addUDP(sample domain.UDPSample) {
+	if sample.IsWarmup {
+		return
+	}
+	s.udp.add(sample)
+}
+
+func (s *sampleStats) merge(o *sampleStats) {
+	s.http.merge(&o.http)
+	s.ws.merge(&o.ws)
+	s.udp.merge(&o.udp)
+	s.hops.merge(o.hops)
+}
+
+// httpStats aggregates non-warmup HTTP(S) samples
+type httpStats struct {
+	httpCount, httpsCount     int
+	successCount, errorCount  int
+	bytesSent, bytesReceived  int64
+	tlsVersions               map[string]int // successful HTTPS samples by TLS version
+	ipv4Count, ipv6Count      int
+	exitIPs                   cardinality // distinct exit IPs, estimated in fixed memory
+	observedIPs               int         // samples that reported an exit IP
+	ttfb, total               distribution
+	tcpConnect, tlsHandshake  distribution
+	h1, h2, h3                protocolStats
+	h2Streams, h2StreamResets int
+	h2StreamMS, connectUDP    distribution
+	authSchemes               map[string]int
+	authMS                    distribution
+}
+
+// protocolStats aggregates the HTTPS samples that negotiated one ALPN protocol
+type protocolStats struct {
+	count, errors int
+	ttfb          distribution
+}
+
+func (h *httpStats) add(s domain.HTTPSample) {
+	if s.IsHTTPS {
+		h.httpsCount++
+	} else {
+		h.httpCount++
+	}
+	// Success = no connection error AND valid HTTP status (2xx/3xx)
+	ok := s.ErrorType == "" && s.StatusCode > 0 && s.StatusCode < 400
+	if ok {
+		h.successCount++
+	} else {
+		h.errorCount++
+	}
+	h.bytesSent += s.BytesSent
+	h.bytesReceived += s.BytesReceived
+
+	// Sprint 4: majority TLS version
+	if s.IsHTTPS && s.TLSVersion != "" && s.ErrorType == "" {
+		h.tlsVersions = increment(h.tlsVersions, s.TLSVersion)
+	}
+
+	// Address family the target observed the proxy egress on
+	switch s.ObservedIPFamily {
+	case domain.IPFamilyIPv4:
+		h.ipv4Count++
+	case domain.IPFamilyIPv6:
+		h.ipv6Count++
+	}
+
+	// Exit IP pool: distinct addresses the target saw, and how often one came back
+	if s.ObservedIP != "" {
+		h.observedIPs++
+		h.exitIPs.add(s.ObservedIP)
+	}
+
+	// Timing fields
+	if s.ErrorType == "" {
+		if s.TTFBMS > 0 {
+			h.ttfb.add(s.TTFBMS)
+		}
+		if s.TotalMS > 0 {
+			h.total.add(s.TotalMS)
+		}
+		if s.TCPConnectMS > 0 {
+			h.tcpConnect.add(s.TCPConnectMS)
+		}
+		if s.TLSHandshakeMS > 0 {
+			h.tlsHandshake.add(s.TLSHandshakeMS)
 		}
 	}
 
-	// Extract timing fields
-	var ttfbs, totals, tcpConnects, tlsHandshakes []float64
-	for _, s := range valid {
-		if s.ErrorType == "" {
-			if s.TTFBMS > 0 {
-				ttfbs = append(ttfbs, s.TTFBMS)
-			}
-			if s.TotalMS > 0 {
-				totals = append(totals, s.TotalMS)
-			}
-			if s.TCPConnectMS > 0 {
-				tcpConnects = append(tcpConnects, s.TCPConnectMS)
-			}
-			if s.TLSHandshakeMS > 0 {
-				tlsHandshakes = append(tlsHandshakes, s.TLSHandshakeMS)
-			}
+	// Protocol breakdown by ALPN (h3 for masque runs). Samples that failed before the
+	// target TLS handshake have no protocol and are skipped.
+	switch s.NegotiatedProtocol {
+	case "http/1.1":
+		h.h1.add(s, ok)
+	case "h2":
+		h.h2.add(s, ok)
+		h.h2Streams += s.H2Streams
+		h.h2StreamResets += s.H2StreamResets
+		if s.H2StreamAvgMS > 0 {
+			h.h2StreamMS.add(s.H2StreamAvgMS)
+		}
+	case "h3":
+		h.h3.add(s, ok)
+		if s.ConnectUDPMS > 0 {
+			h.connectUDP.add(s.ConnectUDPMS)
 		}
 	}
 
+	// Proxy auth: every sample that sent credentials counts, so a reused Digest nonce
+	// lowers the average
+	if s.ProxyAuthScheme != "" {
+		h.authSchemes = increment(h.authSchemes, s.ProxyAuthScheme)
+		h.authMS.add(s.ProxyAuthMS)
+	}
+}
+
+func (p *protocolStats) add(s domain.HTTPSample, ok bool) {
+	p.count++
+	if !ok {
+		p.errors++
+	} else if s.TTFBMS > 0 {
+		p.ttfb.add(s.TTFBMS)
+	}
+}
+
+func (h *httpStats) merge(o *httpStats) {
+	h.httpCount += o.httpCount
+	h.httpsCount += o.httpsCount
+	h.successCount += o.successCount
+	h.errorCount += o.errorCount
+	h.bytesSent += o.bytesSent
+	h.bytesReceived += o.bytesReceived
+	h.tlsVersions = mergeCounts(h.tlsVersions, o.tlsVersions)
+	h.ipv4Count += o.ipv4Count
+	h.ipv6Count += o.ipv6Count
+	h.exitIPs.merge(&o.exitIPs)
+	h.observedIPs += o.observedIPs
+	h.ttfb.merge(&o.ttfb)
+	h.total.merge(&o.total)
+	h.tcpConnect.merge(&o.tcpConnect)
+	h.tlsHandshake.merge(&o.tlsHandshake)
+	h.h1.merge(&o.h1)
+	h.h2.merge(&o.h2)
+	h.h3.merge(&o.h3)
+	h.h2Streams += o.h2Streams
+	h.h2StreamResets += o.h2StreamResets
+	h.h2StreamMS.merge(&o.h2StreamMS)
+	h.connectUDP.merge(&o.connectUDP)
+	h.authSchemes = mergeCounts(h.authSchemes, o.authSchemes)
+	h.authMS.merge(&o.authMS)
+}
+
+func (p *protocolStats) merge(o *protocolStats) {
+	p.count += o.count
+	p.errors += o.errors
+	p.ttfb.merge(&o.ttfb)
+}
+
+func (h *httpStats) apply(summary *domain.RunSummary) {
+	summary.HTTPSampleCount = h.httpCount
+	summary.HTTPSSampleCount = h.httpsCount
+	summary.HTTPSuccessCount = h.successCount
+	summary.HTTPErrorCount = h.errorCount
+	summary.TotalBytesSent = h.bytesSent
+	summary.TotalBytesReceived = h.bytesReceived
+
+	total := h.httpCount + h.httpsCount
+	if total == 0 {
+		return
+	}
+
+	summary.UptimeRatio = float64(h.successCount) / float64(total)
+	summary.MajorityTLSVersion = majority(h.tlsVersions)
+	summary.ObservedIPv4Count = h.ipv4Count
+	summary.ObservedIPv6Count = h.ipv6Count
+	// The pool is an estimate (see cardinalityPrecision) and cannot exceed the samples
+	summary.IPPoolSize = min(h.exitIPs.estimate(), h.observedIPs)
+	if h.observedIPs > 0 {
+		summary.IPReuseRate = float64(h.observedIPs-summary.IPPoolSize) / float64(h.observedIPs)
+	}
+
 	// TTFB percentiles
-	if len(ttfbs) > 0 {
-		summary.TTFBAvgMS = mean(ttfbs)
-		summary.TTFBP50MS = percentile(ttfbs, 50)
-		summary.TTFBP95MS = percentile(ttfbs, 95)
-		summary.TTFBP99MS = percentile(ttfbs, 99)
-		summary.TTFBMaxMS = max(ttfbs)
+	if h.ttfb.count() > 0 {
+		summary.TTFBAvgMS = h.ttfb.mean()
+		summary.TTFBP50MS = h.ttfb.percentile(50)
+		summary.TTFBP95MS = h.ttfb.percentile(95)
+		summary.TTFBP99MS = h.ttfb.percentile(99)
+		summary.TTFBMaxMS = h.ttfb.max()
 	}
 
 	// Total duration percentiles
-	if len(totals) > 0 {
-		summary.TotalAvgMS = mean(totals)
-		summary.TotalP50MS = percentile(totals, 50)
-		summary.TotalP95MS = percentile(totals, 95)
-		summary.TotalP99MS = percentile(totals, 99)
+	if h.total.count() > 0 {
+		summary.TotalAvgMS = h.total.mean()
+		summary.TotalP50MS = h.total.percentile(50)
+		summary.TotalP95MS = h.total.percentile(95)
+		summary.TotalP99MS = h.total.percentile(99)
 	}
 
 	// Jitter (stddev of total_ms)
-	if len(totals) > 1 {
-		summary.JitterMS = stddev(totals)
+	if h.total.count() > 1 {
+		summary.JitterMS = h.total.stddev()
 	}
 
 	// TLS handshake percentiles
-	if len(tlsHandshakes) > 0 {
-		summary.TLSP50MS = percentile(tlsHandshakes, 50)
-		summary.TLSP95MS = percentile(tlsHandshakes, 95)
-		summary.TLSP99MS = percentile(tlsHandshakes, 99)
+	if h.tlsHandshake.count() > 0 {
+		summary.TLSP50MS = h.tlsHandshake.percentile(50)
+		summary.TLSP95MS = h.tlsHandshake.percentile(95)
+		summary.TLSP99MS = h.tlsHandshake.percentile(99)
 	}
 
 	// TCP connect percentiles
-	if len(tcpConnects) > 0 {
-		summary.TCPConnectP50MS = percentile(tcpConnects, 50)
-		summary.TCPConnectP95MS = percentile(tcpConnects, 95)
-		summary.TCPConnectP99MS = percentile(tcpConnects, 99)
-	}
-
-	c.logger.Info("Summary computed",
-		"phase", "continuous",
-		"run_id", c.runID,
-		"http_count", httpCount,
-		"https_count", httpsCount,
-		"success_count", successCount,
-		"error_count", errorCount,
-		"uptime_ratio", summary.UptimeRatio,
-		"ttfb_p50_ms", summary.TTFBP50MS,
-		"ttfb_p95_ms", summary.TTFBP95MS,
-		"jitter_ms", summary.JitterMS,
-	)
+	if h.tcpConnect.count() > 0 {
+		summary.TCPConnectP50MS = h.tcpConnect.percentile(50)
+		summary.TCPConnectP95MS = h.tcpConnect.percentile(95)
+		summary.TCPConnectP99MS = h.tcpConnect.percentile(99)
+	}
 
-	return summary
-}
+	// Protocol breakdown
+	summary.H1SampleCount, summary.H1ErrorCount = h.h1.count, h.h1.errors
+	summary.H1TTFBP50MS, summary.H1TTFBP95MS = h.h1.ttfb.percentile(50), h.h1.ttfb.percentile(95)
+	summary.H2SampleCount, summary.H2ErrorCount = h.h2.count, h.h2.errors
+	summary.H2TTFBP50MS, summary.H2TTFBP95MS = h.h2.ttfb.percentile(50), h.h2.ttfb.percentile(95)
+	summary.H3SampleCount, summary.H3ErrorCount = h.h3.count, h.h3.errors
+	summary.H3TTFBP50MS, summary.H3TTFBP95MS = h.h3.ttfb.percentile(50), h.h3.ttfb.percentile(95)
+	summary.ConnectUDPP50MS = h.connectUDP.percentile(50)
+	summary.ConnectUDPP95MS = h.connectUDP.percentile(95)
+	summary.H2StreamResetCount = h.h2StreamResets
+	if h.h2StreamMS.count() > 0 {
+		summary.H2StreamAvgMS = h.h2StreamMS.mean()
+		summary.H2StreamP95MS = h.h2StreamMS.percentile(95)
+	}
+	if h.h2Streams > 0 {
+		summary.H2StreamResetRate = float64(h.h2StreamResets) / float64(h.h2Streams)
+	}
 
-// ComputeWSSummary fills in WS metrics on an existing RunSummary
-func (c *ResultCollector) ComputeWSSummary(summary *domain.RunSummary, wsSamples []domain.WSSample) {
-	if len(wsSamples) == 0 {
-		return
+	// Proxy auth: majority scheme and what its 407 round trips cost
+	summary.ProxyAuthScheme = majority(h.authSchemes)
+	if h.authMS.count() > 0 {
+		summary.ProxyAuthAvgMS = h.authMS.mean()
+		summary.ProxyAuthP95MS = h.authMS.percentile(95)
 	}
+}
 
-	summary.WSSampleCount = len(wsSamples)
+// wsStats aggregates WS connection samples
+type wsStats struct {
+	count, successCount, errorCount int
+	rtt                             distribution
+	hold                            runningStats
+	drops, sent                     int
+}
 
-	var successCount, errorCount int
-	var rtts []float64
-	var holdTimes []float64
-	var totalDrops, totalSent int
+func (w *wsStats) add(ws domain.WSSample) {
+	w.count++
+	if ws.Connected {
+		w.successCount++
+	} else {
+		w.errorCount++
+	}
+	if ws.MessageRTTMS > 0 {
+		w.rtt.add(ws.MessageRTTMS)
+	}
+	if ws.ConnectionHeldMS > 0 {
+		w.hold.add(ws.ConnectionHeldMS)
+	}
+	w.drops += ws.DropCount
+	w.sent += ws.MessagesSent
+}
 
-	for _, ws := range wsSamples {
-		if ws.Connected {
-			successCount++
-		} else {
-			errorCount++
-		}
-		if ws.MessageRTTMS > 0 {
-			rtts = append(rtts, ws.MessageRTTMS)
-		}
-		if ws.ConnectionHeldMS > 0 {
-			holdTimes = append(holdTimes, ws.ConnectionHeldMS)
-		}
-		totalDrops += ws.DropCount
-		totalSent += ws.MessagesSent
+func (w *wsStats) merge(o *wsStats) {
+	w.count += o.count
+	w.successCount += o.successCount
+	w.errorCount += o.errorCount
+	w.rtt.merge(&o.rtt)
+	w.hold.merge(o.hold)
+	w.drops += o.drops
+	w.sent += o.sent
+}
+
+func (w *wsStats) apply(summary *domain.RunSummary) {
+	if w.count == 0 {
+		return
 	}
 
-	summary.WSSuccessCount = successCount
-	summary.WSErrorCount = errorCount
+	summary.WSSampleCount = w.count
+	summary.WSSuccessCount = w.successCount
+	summary.WSErrorCount = w.errorCount
 
-	if len(rtts) > 0 {
-		summary.WSRTTAvgMS = mean(rtts)
-		summary.WSRTTP95MS = percentile(rtts, 95)
+	if w.rtt.count() > 0 {
+		summary.WSRTTAvgMS = w.rtt.mean()
+		summary.WSRTTP95MS = w.rtt.percentile(95)
 	}
 
-	if totalSent > 0 {
-		summary.WSDropRate = float64(totalDrops) / float64(totalSent)
-	} else if successCount == 0 {
+	if w.sent > 0 {
+		summary.WSDropRate = float64(w.drops) / float64(w.sent)
+	} else if w.successCount == 0 {
 		// All connections failed, no messages sent → treat as 100% drop
 		summary.WSDropRate = 1.0
 	}
 
-	if len(holdTimes) > 0 {
-		summary.WSAvgHoldMS = mean(holdTimes)
+	if w.hold.n > 0 {
+		summary.WSAvgHoldMS = w.hold.mean
 	}
-
-	c.logger.Info("WS summary computed",
-		"phase", "continuous",
-		"run_id", c.runID,
-		"ws_sample_count", len(wsSamples),
-		"ws_success_count", successCount,
-		"ws_error_count", errorCount,
-		"ws_rtt_avg_ms", summary.WSRTTAvgMS,
-		"ws_drop_rate", summary.WSDropRate,
-	)
 }
 
-// --- Math helpers ---
+// udpStats aggregates non-warmup UDP ASSOCIATE session samples
+type udpStats struct {
+	count                    int
+	successCount, errorCount int
+	sent, received           int
+	reordered, duplicates    int
+	rtt                      distribution
+	jitter                   runningStats
+}
 
-func mean(data []float64) float64 {
-	if len(data) == 0 {
-		return 0
+func (u *udpStats) add(s domain.UDPSample) {
+	u.count++
+	if s.ErrorType == "" {
+		u.successCount++
+	} else {
+		u.errorCount++
 	}
-	sum := 0.0
-	for _, v := range data {
-		sum += v
+	u.sent += s.PacketsSent
+	u.received += s.PacketsReceived
+	u.reordered += s.ReorderedCount
+	u.duplicates += s.DuplicateCount
+	if s.PacketsReceived > 0 {
+		u.rtt.add(s.RTTAvgMS)
+		if s.PacketsReceived > 1 {
+			u.jitter.add(s.JitterMS)
+		}
 	}
-	return sum / float64(len(data))
 }
 
-func percentile(data []float64, p float64) float64 {
-	if len(data) == 0 {
-		return 0
+func (u *udpStats) merge(o *udpStats) {
+	u.count += o.count
+	u.successCount += o.successCount
+	u.errorCount += o.errorCount
+	u.sent += o.sent
+	u.received += o.received
+	u.reordered += o.reordered
+	u.duplicates += o.duplicates
+	u.rtt.merge(&o.rtt)
+	u.jitter.merge(o.jitter)
+}
+
+func (u *udpStats) apply(summary *domain.RunSummary) {
+	if u.count == 0 {
+		return
+	}
+
+	summary.UDPSampleCount = u.count
+	summary.UDPSuccessCount = u.successCount
+	summary.UDPErrorCount = u.errorCount
+	summary.UDPPacketsSent = u.sent
+	summary.UDPPacketsReceived = u.received
+	summary.UDPDuplicateCount = u.duplicates
+
+	if u.sent > 0 {
+		summary.UDPLossRate = float64(u.sent-u.received) / float64(u.sent)
+	} else if u.successCount == 0 {
+		// No session ever got a relay → treat as 100% loss
+		summary.UDPLossRate = 1.0
 	}
-	sorted := make([]float64, len(data))
-	copy(sorted, data)
-	sort.Float64s(sorted)
+	if u.received > 0 {
+		summary.UDPReorderRate = float64(u.reordered) / float64(u.received)
+	}
+
+	if u.rtt.count() > 0 {
+		summary.UDPRTTAvgMS = u.rtt.mean()
+		summary.UDPRTTP95MS = u.rtt.percentile(95)
+	}
+	if u.jitter.n > 0 {
+		summary.UDPJitterMS = u.jitter.mean
+	}
+}
 
-	rank := (p / 100.0) * float64(len(sorted)-1)
-	lower := int(math.Floor(rank))
-	upper := int(math.Ceil(rank))
+// hopStats attributes proxy-leg latency to each hop of a chained proxy, indexed by hop.
+// Only samples that dialed a fresh connection carry hop timings; reused keep-alive
+// connections add nothing.
+type hopStats []*hopAcc
 
-	if lower == upper || upper >= len(sorted) {
-		return sorted[lower]
+type hopAcc struct {
+	label, protocol       string
+	sampleCount, errCount int
+	tcp, tls              runningStats
+	tunnel                distribution
+}
+
+func (hs *hopStats) add(timings []domain.HopTiming) {
+	for _, h := range timings {
+		for len(*hs) <= h.Hop {
+			*hs = append(*hs, &hopAcc{})
+		}
+		acc := (*hs)[h.Hop]
+		acc.label = h.Label
+		acc.protocol = h.Protocol
+		acc.sampleCount++
+		if h.ErrorType != "" {
+			acc.errCount++
+			continue
+		}
+		if h.TCPConnectMS > 0 {
+			acc.tcp.add(h.TCPConnectMS)
+		}
+		if h.TLSHandshakeMS > 0 {
+			acc.tls.add(h.TLSHandshakeMS)
+		}
+		if h.TunnelMS > 0 {
+			acc.tunnel.add(h.TunnelMS)
+		}
 	}
+}
 
-	frac := rank - float64(lower)
-	return sorted[lower]*(1-frac) + sorted[upper]*frac
+// merge folds o in; hops are labelled as o last saw them, so merge oldest first
+func (hs *hopStats) merge(o hopStats) {
+	for i, src := range o {
+		for len(*hs) <= i {
+			*hs = append(*hs, &hopAcc{})
+		}
+		if src.sampleCount == 0 {
+			continue // o never saw this hop, only a later one
+		}
+		acc := (*hs)[i]
+		acc.label = src.label
+		acc.protocol = src.protocol
+		acc.sampleCount += src.sampleCount
+		acc.errCount += src.errCount
+		acc.tcp.merge(src.tcp)
+		acc.tls.merge(src.tls)
+		acc.tunnel.merge(&src.tunnel)
+	}
 }
 
-func stddev(data []float64) float64 {
-	if len(data) <= 1 {
-		return 0
+func (hs hopStats) apply(summary *domain.RunSummary) {
+	if len(hs) == 0 {
+		return
+	}
+
+	var totalAdded float64
+	out := make([]domain.HopSummary, 0, len(hs))
+	for i, acc := range hs {
+		st := domain.HopSummary{
+			Hop:             i,
+			Label:           acc.label,
+			Protocol:        acc.protocol,
+			SampleCount:     acc.sampleCount,
+			ErrorCount:      acc.errCount,
+			TCPConnectAvgMS: acc.tcp.mean,
+			TLSAvgMS:        acc.tls.mean,
+		}
+		if acc.tunnel.count() > 0 {
+			st.TunnelAvgMS = acc.tunnel.mean()
+			st.TunnelP95MS = acc.tunnel.percentile(95)
+		}
+		st.AddedAvgMS = st.TCPConnectAvgMS + st.TLSAvgMS + st.TunnelAvgMS
+		totalAdded += st.AddedAvgMS
+		out = append(out, st)
 	}
-	avg := mean(data)
-	sumSquares := 0.0
-	for _, v := range data {
-		diff := v - avg
-		sumSquares += diff * diff
+	if totalAdded > 0 {
+		for i := range out {
+			out[i].LatencyShare = out[i].AddedAvgMS / totalAdded
+		}
+	}
+	summary.HopStats = out
+}
+
+// --- Helpers ---
+
+func increment(counts map[string]int, key string) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int)
 	}
-	return math.Sqrt(sumSquares / float64(len(data)))
+	counts[key]++
+	return counts
 }
 
-func max(data []float64) float64 {
-	if len(data) == 0 {
-		return 0
+func mergeCounts(dst, src map[string]int) map[string]int {
+	for key, count := range src {
+		if dst == nil {
+			dst = make(map[string]int)
+		}
+		dst[key] += count
 	}
-	m := data[0]
-	for _, v := range data[1:] {
-		if v > m {
-			m = v
+	return dst
+}
+
+// majority returns the most common key; ties go to the smallest so summaries are stable
+func majority(counts map[string]int) string {
+	best, bestCount := "", 0
+	for key, count := range counts {
+		if count > bestCount || (count == bestCount && key < best) {
+			best, bestCount = key, count
 		}
 	}
-	return m
+	return best
 }
@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// stopReason is the cancel cause when a fixed run stops its own testers
+type stopReason string
+
+func (r stopReason) Error() string {
+	return string(r)
+}
+
+// stopReasonOf reports why the testers' context ended: a fixed run's own stop, or
+// POST /stop and shutdown for anything else
+func stopReasonOf(ctx context.Context) string {
+	var r stopReason
+	if errors.As(context.Cause(ctx), &r) {
+		return string(r)
+	}
+	return domain.StopReasonStopped
+}
+
+// runLimits ends a fixed run. With a sample target it stops each tester once it has
+// produced TargetSamples, and the run once every tester has; samples past a tester's
+// target are dropped so each tester reports exactly the target. Requests the stop cuts
+// short are dropped too, so a fixed run's uptime only counts real failures.
+type runLimits struct {
+	fixed   bool
+	target  int // samples per tester; 0 means no target
+	testCtx context.Context
+	stopRun context.CancelCauseFunc
+
+	mu        sync.Mutex
+	counts    map[string]int                // tester -> samples accepted
+	stops     map[string]context.CancelFunc // testers still short of the target
+	stoppedAt time.Time                     // when the testers' context ended
+}
+
+// newRunLimits watches testCtx, which stopRun cancels
+func newRunLimits(cfg domain.RunConfig, testCtx context.Context, stopRun context.CancelCauseFunc) *runLimits {
+	l := &runLimits{
+		fixed:   cfg.RunMode == domain.RunModeFixed,
+		testCtx: testCtx,
+		stopRun: stopRun,
+		counts:  make(map[string]int),
+		stops:   make(map[string]context.CancelFunc),
+	}
+	if l.fixed {
+		l.target = cfg.TargetSamples
+		context.AfterFunc(testCtx, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.markStopped()
+		})
+	}
+	return l
+}
+
+// bind returns the context tester runs under, cancelled once it reaches the target.
+// Every tester is bound before any of them starts, so the run cannot stop early.
+func (l *runLimits) bind(ctx context.Context, tester string) context.Context {
+	if l.target == 0 {
+		return ctx
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stops[tester] = cancel
+	return ctx
+}
+
+// accept counts one sample from tester and reports whether to keep it
+func (l *runLimits) accept(tester string) bool {
+	if l == nil || l.target == 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[tester] >= l.target {
+		return false
+	}
+	l.counts[tester]++
+	if l.counts[tester] == l.target {
+		if stop, ok := l.stops[tester]; ok {
+			stop()
+			delete(l.stops, tester)
+			if len(l.stops) == 0 {
+				l.stopRun(stopReason(domain.StopReasonSampleTarget))
+			}
+		}
+	}
+	return true
+}
+
+// acceptHTTP is accept for HTTP samples, which also drops a fixed run's requests that
+// failed because the run stopped while they were in flight. Burst requests are kept
+// without counting toward the tester's target.
+func (l *runLimits) acceptHTTP(tester string, sample domain.HTTPSample) bool {
+	if l != nil && l.fixed && sample.ErrorType != "" {
+		l.mu.Lock()
+		l.markStopped() // the AfterFunc may not have run yet
+		stoppedAt := l.stoppedAt
+		l.mu.Unlock()
+		finished := sample.MeasuredAt.Add(time.Duration(sample.TotalMS * float64(time.Millisecond)))
+		if !stoppedAt.IsZero() && !finished.Before(stoppedAt) {
+			return false
+		}
+	}
+	if sample.IsBurst {
+		return true
+	}
+	return l.accept(tester)
+}
+
+// markStopped records when the testers' context ended; callers hold mu
+func (l *runLimits) markStopped() {
+	if l.stoppedAt.IsZero() && l.testCtx.Err() != nil {
+		l.stoppedAt = time.Now()
+	}
+}
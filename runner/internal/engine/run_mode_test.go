@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+func TestRunLimitsAcceptHTTP(t *testing.T) {
+	sample := domain.HTTPSample{MeasuredAt: time.Now(), TotalMS: 10}
+	burst := sample
+	burst.IsBurst = true
+
+	tests := []struct {
+		name        string
+		samples     []domain.HTTPSample
+		wantKept    int
+		wantStopped bool
+	}{
+		{
+			name:        "the target stops the run",
+			samples:     []domain.HTTPSample{sample, sample, sample},
+			wantKept:    3,
+			wantStopped: true,
+		},
+		{
+			name:        "samples past the target are dropped",
+			samples:     []domain.HTTPSample{sample, sample, sample, sample},
+			wantKept:    3,
+			wantStopped: true,
+		},
+		{
+			name:     "burst samples are kept but do not count",
+			samples:  []domain.HTTPSample{sample, burst, burst, burst, burst, sample},
+			wantKept: 6,
+		},
+		{
+			name:        "the target counts only regular samples",
+			samples:     []domain.HTTPSample{burst, sample, burst, sample, burst, sample},
+			wantKept:    6,
+			wantStopped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCtx, stopRun := context.WithCancelCause(context.Background())
+			defer stopRun(nil)
+			l := newRunLimits(domain.RunConfig{RunMode: domain.RunModeFixed, TargetSamples: 3}, testCtx, stopRun)
+			l.bind(testCtx, "http")
+
+			kept := 0
+			for _, s := range tt.samples {
+				if l.acceptHTTP("http", s) {
+					kept++
+				}
+			}
+			if kept != tt.wantKept {
+				t.Errorf("kept %d samples, want %d", kept, tt.wantKept)
+			}
+			stopped := testCtx.Err() != nil
+			if stopped != tt.wantStopped {
+				t.Errorf("run stopped %v, want %v", stopped, tt.wantStopped)
+			}
+			if stopped && stopReasonOf(testCtx) != domain.StopReasonSampleTarget {
+				t.Errorf("stop reason %q, want %q", stopReasonOf(testCtx), domain.StopReasonSampleTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Run lifecycle phases, in order
+const (
+	PhaseConnectivity = "connectivity"
+	PhaseIPCheck      = "ip_check"
+	PhaseWarmup       = "warmup"
+	PhaseContinuous   = "continuous"
+	PhaseStopping     = "stopping"
+	PhaseDone         = "done"
+)
+
+// burstHistoryLen caps the bursts kept for introspection
+const burstHistoryLen = 20
+
+// timelineLen caps the timeline events kept per run
+const timelineLen = 100
+
+// incidentHistoryLen caps the incidents kept for introspection
+const incidentHistoryLen = 50
+
+// Timeline event types
+const (
+	TimelineConfigChange = "config_change"
+)
+
+// RunStatus is a snapshot of what one run is doing, for GET /runs
+type RunStatus struct {
+	RunID        string                  `json:"run_id"`
+	ProxyLabel   string                  `json:"proxy_label"`
+	Protocol     string                  `json:"protocol"`
+	Phase        string                  `json:"phase"`
+	Status       string                  `json:"status"` // "running", "completed" or "failed"
+	ErrorMessage string                  `json:"error_message,omitempty"`
+	StartedAt    time.Time               `json:"started_at"`
+	PhaseSince   time.Time               `json:"phase_since"`
+	FinishedAt   *time.Time              `json:"finished_at,omitempty"`
+	Testers      map[string]TesterCounts `json:"testers"`
+	ObservedIP   string                  `json:"observed_ip,omitempty"`
+	IPChanges    int                     `json:"ip_changes"`
+	LoadProfile  string                  `json:"load_profile,omitempty"` // ramp, step, spike or sine
+	LoadPct      float64                 `json:"load_pct"`               // current level, % of the configured rates
+	TargetRPM    map[string]float64      `json:"target_rpm"`             // tester -> request rate it is set to
+	LastSummary  *domain.RunSummary      `json:"last_summary,omitempty"`
+	Windows      []domain.RunSummary     `json:"windows"` // latest trailing-window summaries
+	Bursts       []BurstResult           `json:"bursts"`
+	Incidents    []domain.Incident       `json:"incidents"`
+	Goroutines   []GoroutineHealth       `json:"goroutines"`
+	Timeline     []TimelineEvent         `json:"timeline"`
+	// Reports a required sink failed to take, and the last such error
+	ReportErrors      int        `json:"report_errors"`
+	LastReportError   string     `json:"last_report_error,omitempty"`
+	LastReportErrorAt *time.Time `json:"last_report_error_at,omitempty"`
+}
+
+// TesterCounts is how many samples one tester has produced so far
+type TesterCounts struct {
+	Samples      int        `json:"samples"`
+	Errors       int        `json:"errors"`
+	Warmup       int        `json:"warmup,omitempty"`
+	LastSampleAt *time.Time `json:"last_sample_at,omitempty"`
+}
+
+// BurstResult is one concurrency burst
+type BurstResult struct {
+	StartedAt    time.Time `json:"started_at"`
+	Concurrency  int       `json:"concurrency"`
+	SuccessCount int64     `json:"success_count"`
+	FailCount    int64     `json:"fail_count"`
+	AvgMS        float64   `json:"avg_ms"`
+	DurationMS   int64     `json:"duration_ms"`
+}
+
+// TimelineEvent is a change made to the run while it was running
+type TimelineEvent struct {
+	At      time.Time      `json:"at"`
+	Type    string         `json:"type"`
+	Changes []ConfigChange `json:"changes,omitempty"`
+}
+
+// ConfigChange is one setting changed through PATCH /runs/{run_id}
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// GoroutineHealth is the state of one of the run's worker goroutines
+type GoroutineHealth struct {
+	Name      string     `json:"name"`
+	State     string     `json:"state"` // "running", "stopped" or "failed"
+	Error     string     `json:"error,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+}
+
+// runState is the orchestrator's published lifecycle state; every method is safe for
+// concurrent use by the run's goroutines and the HTTP handler
+type runState struct {
+	mu     sync.Mutex
+	status RunStatus
+}
+
+func newRunState(cfg domain.RunConfig) *runState {
+	now := time.Now()
+	protocol := cfg.Proxy.Protocol
+	if protocol == "" {
+		protocol = domain.ProtocolHTTP
+	}
+	st := &runState{status: RunStatus{
+		RunID:      cfg.RunID,
+		ProxyLabel: cfg.Proxy.Label,
+		Protocol:   protocol,
+		Phase:      PhaseConnectivity,
+		Status:     "running",
+		StartedAt:  now,
+		PhaseSince: now,
+		LoadPct:    100,
+		TargetRPM:  make(map[string]float64),
+		Testers:    make(map[string]TesterCounts),
+		Bursts:     []BurstResult{},
+		Incidents:  []domain.Incident{},
+		Goroutines: []GoroutineHealth{},
+		Windows:    []domain.RunSummary{},
+		Timeline:   []TimelineEvent{},
+	}}
+	if cfg.LoadProfile != nil {
+		st.status.LoadProfile = cfg.LoadProfile.Type
+	}
+	return st
+}
+
+func (s *runState) setPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Phase = phase
+	s.status.PhaseSince = time.Now()
+}
+
+// finish records the run's outcome and moves it to PhaseDone
+func (s *runState) finish(status, errorMessage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.status.Phase = PhaseDone
+	s.status.PhaseSince = now
+	s.status.Status = status
+	s.status.ErrorMessage = errorMessage
+	s.status.FinishedAt = &now
+}
+
+// countSample adds one sample from tester
+func (s *runState) countSample(tester string, warmup, failed bool, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.status.Testers[tester]
+	if warmup {
+		c.Warmup++
+	} else {
+		c.Samples++
+		if failed {
+			c.Errors++
+		}
+	}
+	c.LastSampleAt = &at
+	s.status.Testers[tester] = c
+}
+
+func (s *runState) setSummary(summary domain.RunSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastSummary = &summary
+}
+
+func (s *runState) setWindows(windows []domain.RunSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Windows = windows
+}
+
+// setLoad records the load level and the rate each tester was just set to
+func (s *runState) setLoad(pct float64, rpm map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LoadPct = pct
+	s.status.TargetRPM = rpm
+}
+
+func (s *runState) setIP(ip string, changes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.ObservedIP = ip
+	s.status.IPChanges = changes
+}
+
+func (s *runState) addBurst(b BurstResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Bursts = append(s.status.Bursts, b)
+	if len(s.status.Bursts) > burstHistoryLen {
+		s.status.Bursts = s.status.Bursts[len(s.status.Bursts)-burstHistoryLen:]
+	}
+}
+
+// setIncident records an incident as it opens, then replaces it when it ends
+func (s *runState) setIncident(inc domain.Incident) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.status.Incidents {
+		if s.status.Incidents[i].Seq == inc.Seq {
+			s.status.Incidents[i] = inc
+			return
+		}
+	}
+	s.status.Incidents = append(s.status.Incidents, inc)
+	if len(s.status.Incidents) > incidentHistoryLen {
+		s.status.Incidents = s.status.Incidents[len(s.status.Incidents)-incidentHistoryLen:]
+	}
+}
+
+// reportFailed counts a report a required sink did not take
+func (s *runState) reportFailed(err error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.ReportErrors++
+	s.status.LastReportError = err.Error()
+	s.status.LastReportErrorAt = &now
+}
+
+func (s *runState) addEvent(ev TimelineEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Timeline = append(s.status.Timeline, ev)
+	if len(s.status.Timeline) > timelineLen {
+		s.status.Timeline = s.status.Timeline[len(s.status.Timeline)-timelineLen:]
+	}
+}
+
+func (s *runState) phase() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status.Phase
+}
+
+// running reports whether the run has not finished yet
+func (s *runState) running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status.FinishedAt == nil
+}
+
+// track wraps a worker goroutine so its start, stop and error show in the snapshot
+func (s *runState) track(name string, fn func() error) func() error {
+	s.mu.Lock()
+	idx := len(s.status.Goroutines)
+	s.status.Goroutines = append(s.status.Goroutines, GoroutineHealth{
+		Name:      name,
+		State:     "running",
+		StartedAt: time.Now(),
+	})
+	s.mu.Unlock()
+
+	return func() error {
+		err := fn()
+		now := time.Now()
+		s.mu.Lock()
+		g := &s.status.Goroutines[idx]
+		g.StoppedAt = &now
+		g.State = "stopped"
+		if err != nil {
+			g.State = "failed"
+			g.Error = err.Error()
+		}
+		s.mu.Unlock()
+		return err
+	}
+}
+
+// snapshot copies the state so callers can encode it without holding the lock
+func (s *runState) snapshot() RunStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.status
+	out.Testers = make(map[string]TesterCounts, len(s.status.Testers))
+	for k, v := range s.status.Testers {
+		out.Testers[k] = v
+	}
+	out.TargetRPM = make(map[string]float64, len(s.status.TargetRPM))
+	for k, v := range s.status.TargetRPM {
+		out.TargetRPM[k] = v
+	}
+	out.Windows = append(make([]domain.RunSummary, 0, len(s.status.Windows)), s.status.Windows...)
+	out.Bursts = append(make([]BurstResult, 0, len(s.status.Bursts)), s.status.Bursts...)
+	out.Incidents = append(make([]domain.Incident, 0, len(s.status.Incidents)), s.status.Incidents...)
+	out.Goroutines = append(make([]GoroutineHealth, 0, len(s.status.Goroutines)), s.status.Goroutines...)
+	out.Timeline = append(make([]TimelineEvent, 0, len(s.status.Timeline)), s.status.Timeline...)
+	return out
+}
+
+// runRegistry tracks active runs, and finished ones for RunRetention
+type runRegistry struct {
+	mu   sync.Mutex
+	runs map[string]*Orchestrator
+}
+
+func (r *runRegistry) add(orch *Orchestrator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.runs == nil {
+		r.runs = make(map[string]*Orchestrator)
+	}
+	r.runs[orch.config.RunID] = orch
+}
+
+// forget drops orch after retention, unless the run ID was reused since
+func (r *runRegistry) forget(orch *Orchestrator, retention time.Duration) {
+	runID := orch.config.RunID
+	time.AfterFunc(retention, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.runs[runID] == orch {
+			delete(r.runs, runID)
+		}
+	})
+}
+
+func (r *runRegistry) get(runID string) (*Orchestrator, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	orch, ok := r.runs[runID]
+	return orch, ok
+}
+
+func (r *runRegistry) list() []RunStatus {
+	r.mu.Lock()
+	orchs := make([]*Orchestrator, 0, len(r.runs))
+	for _, orch := range r.runs {
+		orchs = append(orchs, orch)
+	}
+	r.mu.Unlock()
+
+	out := make([]RunStatus, 0, len(orchs))
+	for _, orch := range orchs {
+		out = append(out, orch.Status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
@@ -2,42 +2,106 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"sync"
 
+	"proxy-stability-test/runner/internal/alert"
 	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/metrics"
 	"proxy-stability-test/runner/internal/reporter"
+	"proxy-stability-test/runner/internal/stream"
+)
+
+// Errors returned by Reconfigure
+var (
+	ErrRunNotFound = errors.New("run not found")
+	ErrRunFinished = errors.New("run already finished")
 )
 
 // Scheduler manages parallel proxy test runs
 type Scheduler struct {
 	maxParallel int
+	reporter    *reporter.FanOut // the deployment's sinks, shared by every run
+	alerts      *alert.Manager   // nil when alerting is off
+	live        *stream.Hub      // live event subscribers
+	runs        runRegistry      // active runs, and finished ones for metrics.RunRetention
 	logger      *slog.Logger
 }
 
-// NewScheduler creates a new scheduler
-func NewScheduler(maxParallel int, logger *slog.Logger) *Scheduler {
+// NewScheduler creates a new scheduler that reports every run to rep, raises its
+// alerts through alerts and publishes its live events on live
+func NewScheduler(maxParallel int, rep *reporter.FanOut, alerts *alert.Manager, live *stream.Hub, logger *slog.Logger) *Scheduler {
 	return &Scheduler{
 		maxParallel: maxParallel,
+		reporter:    rep,
+		alerts:      alerts,
+		live:        live,
 		logger:      logger.With("module", "engine.scheduler"),
 	}
 }
 
-// RunSingle runs a single proxy test (Sprint 1)
-func (s *Scheduler) RunSingle(ctx context.Context, cfg domain.RunConfig, apiURL, dbURL string) {
+// StartRun marks runID as started on the sinks that need it: without the API nobody
+// else does, so sinks that write to the database do it here. A run a required sink
+// could not start must not go ahead.
+func (s *Scheduler) StartRun(runID string) error {
+	if err := s.reporter.StartRun(runID); err != nil {
+		s.logger.Error("Run start not recorded",
+			"run_id", runID,
+			"error_detail", err.Error(),
+		)
+		return fmt.Errorf("required reporter sink: %w", err)
+	}
+	return nil
+}
+
+// Runs lists the state of every active run, and of runs that finished recently
+func (s *Scheduler) Runs() []RunStatus {
+	return s.runs.list()
+}
+
+// Run returns one run's state
+func (s *Scheduler) Run(runID string) (RunStatus, bool) {
+	orch, ok := s.runs.get(runID)
+	if !ok {
+		return RunStatus{}, false
+	}
+	return orch.Status(), true
+}
+
+// Reconfigure applies patch to a running run and returns what changed
+func (s *Scheduler) Reconfigure(runID string, patch domain.RunConfigPatch) ([]ConfigChange, error) {
+	orch, ok := s.runs.get(runID)
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	if !orch.state.running() {
+		return nil, ErrRunFinished
+	}
+	return orch.Reconfigure(patch), nil
+}
+
+// RunSingle runs a single proxy test (Sprint 1) the caller has started with StartRun
+func (s *Scheduler) RunSingle(ctx context.Context, cfg domain.RunConfig) {
 	s.logger.Info("Scheduler start",
 		"proxy_count", 1,
 		"proxy_label", cfg.Proxy.Label,
 	)
 
-	rep := reporter.NewAPIReporter(apiURL, s.logger)
-
 	s.logger.Info("Proxy goroutine start",
 		"run_id", cfg.RunID,
 		"proxy_label", cfg.Proxy.Label,
 	)
 
-	orch := NewOrchestrator(cfg, rep, s.logger)
+	s.live.Open(cfg.RunID)
+	defer s.live.End(cfg.RunID)
+	orch := NewOrchestrator(cfg, s.reporter, s.alerts, s.live, s.logger)
+	s.runs.add(orch)
+	defer s.runs.forget(orch, metrics.RunRetention)
+	metrics.RegisterRun(cfg.RunID, cfg.Proxy.Label)
+	defer metrics.ForgetRun(cfg.RunID)
+	defer s.alerts.ForgetRun(cfg.RunID)
 	if err := orch.Run(ctx); err != nil {
 		s.logger.Error("Proxy goroutine error",
 			"run_id", cfg.RunID,
@@ -57,7 +121,7 @@ func (s *Scheduler) RunSingle(ctx context.Context, cfg domain.RunConfig, apiURL,
 }
 
 // RunAll runs multiple proxy tests in parallel (Sprint 3+)
-func (s *Scheduler) RunAll(ctx context.Context, runs []domain.RunConfig, apiURL, dbURL string) {
+func (s *Scheduler) RunAll(ctx context.Context, runs []domain.RunConfig) {
 	s.logger.Info("Scheduler start",
 		"proxy_count", len(runs),
 	)
@@ -76,6 +140,9 @@ func (s *Scheduler) RunAll(ctx context.Context, runs []domain.RunConfig, apiURL,
 
 		go func(r domain.RunConfig) {
 			defer wg.Done()
+			metrics.RegisterRun(r.RunID, r.Proxy.Label)
+			defer metrics.ForgetRun(r.RunID)
+			defer s.alerts.ForgetRun(r.RunID)
 			defer func() {
 				<-sem
 				if rec := recover(); rec != nil {
@@ -92,8 +159,14 @@ func (s *Scheduler) RunAll(ctx context.Context, runs []domain.RunConfig, apiURL,
 				"proxy_label", r.Proxy.Label,
 			)
 
-			rep := reporter.NewAPIReporter(apiURL, s.logger)
-			orch := NewOrchestrator(r, rep, s.logger)
+			if err := s.StartRun(r.RunID); err != nil {
+				return
+			}
+			s.live.Open(r.RunID)
+			defer s.live.End(r.RunID)
+			orch := NewOrchestrator(r, s.reporter, s.alerts, s.live, s.logger)
+			s.runs.add(orch)
+			defer s.runs.forget(orch, metrics.RunRetention)
 			if err := orch.Run(ctx); err != nil {
 				s.logger.Error("Proxy goroutine error",
 					"run_id", r.RunID,
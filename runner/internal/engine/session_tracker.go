@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/proxy"
+)
+
+// sessionTracker follows the exit IP across IP re-checks and tells rotation the proxy
+// promised apart from an IP that changed when it should have held. Callers hold ipMu.
+type sessionTracker struct {
+	mode      string
+	lastIP    string
+	sessionID string          // sticky session the current IP was first seen under
+	heldSince time.Time       // when the current IP started serving that session
+	lastSeen  time.Time       // last re-check that still saw it
+	sessions  int             // sticky sessions observed
+	lifetimes []time.Duration // how long each sticky session kept one IP
+	premature int             // sticky sessions that lost their IP before StickyDuration
+}
+
+func newSessionTracker(mode string) *sessionTracker {
+	if mode == "" {
+		mode = domain.RotationNone
+	}
+	return &sessionTracker{mode: mode}
+}
+
+// observe records ip seen under session at time at. changed reports a different IP than
+// the previous observation; expected reports that the change was promised by the
+// rotation mode (per-request pools, or a new sticky session).
+func (t *sessionTracker) observe(session proxy.Session, ip string, at time.Time) (changed, expected bool) {
+	changed = t.lastIP != "" && ip != t.lastIP
+	switch t.mode {
+	case domain.RotationPerRequest:
+		expected = true
+	case domain.RotationSticky:
+		switch {
+		case session.ID != t.sessionID:
+			// A new session may land anywhere in the pool
+			t.closeSession()
+			t.sessions++
+			t.sessionID = session.ID
+			t.heldSince = session.Started
+			expected = true
+		case changed:
+			// Same session, new IP: the provider dropped the session early
+			t.lifetimes = append(t.lifetimes, at.Sub(t.heldSince))
+			t.premature++
+			t.heldSince = at
+		}
+		t.lastSeen = at
+	}
+	t.lastIP = ip
+	return changed, expected
+}
+
+// closeSession records the span the current sticky session was seen holding its IP
+func (t *sessionTracker) closeSession() {
+	if t.sessionID != "" && t.lastSeen.After(t.heldSince) {
+		t.lifetimes = append(t.lifetimes, t.lastSeen.Sub(t.heldSince))
+	}
+}
+
+// apply writes the rotation metrics into summary; the open session counts as held so far
+func (t *sessionTracker) apply(summary *domain.RunSummary) {
+	summary.RotationMode = t.mode
+	if t.mode != domain.RotationSticky {
+		return
+	}
+	summary.SessionCount = t.sessions
+	summary.PrematureRotations = t.premature
+
+	lifetimes := t.lifetimes
+	if t.sessionID != "" && t.lastSeen.After(t.heldSince) {
+		lifetimes = append(lifetimes[:len(lifetimes):len(lifetimes)], t.lastSeen.Sub(t.heldSince))
+	}
+	if len(lifetimes) == 0 {
+		return
+	}
+	var total time.Duration
+	shortest := lifetimes[0]
+	for _, d := range lifetimes {
+		total += d
+		shortest = min(shortest, d)
+	}
+	summary.SessionLifetimeAvgSec = total.Seconds() / float64(len(lifetimes))
+	summary.SessionLifetimeMinSec = shortest.Seconds()
+}
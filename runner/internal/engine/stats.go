@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"math"
+	"math/bits"
+)
+
+// sketchAccuracy bounds the relative error of every percentile a summary reports: the
+// value returned is within 1% of the sample at the requested rank
+const sketchAccuracy = 0.01
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+)
+
+// cardinalityPrecision bounds the error of every distinct count a summary reports:
+// 2^12 one-byte registers (4 KiB) give a standard error of 1.04/√4096 ≈ 1.6% however
+// many values are added; small counts (hundreds) come out exact and up to ~10k stay
+// within about 1%
+const cardinalityPrecision = 12
+
+// cardinality counts distinct strings in fixed memory (HyperLogLog). Each value is hashed;
+// the top bits pick a register, which keeps the longest run of leading zeros seen in the
+// rest. Two estimators merge by taking the larger of each register.
+type cardinality struct {
+	registers []uint8 // nil until the first value
+}
+
+func (c *cardinality) add(v string) {
+	if c.registers == nil {
+		c.registers = make([]uint8, 1<<cardinalityPrecision)
+	}
+	x := hashString(v)
+	idx := x >> (64 - cardinalityPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<cardinalityPrecision|1<<(cardinalityPrecision-1))) + 1
+	if rank > c.registers[idx] {
+		c.registers[idx] = rank
+	}
+}
+
+func (c *cardinality) merge(o *cardinality) {
+	if o.registers == nil {
+		return
+	}
+	if c.registers == nil {
+		c.registers = make([]uint8, len(o.registers))
+	}
+	for i, r := range o.registers {
+		if r > c.registers[i] {
+			c.registers[i] = r
+		}
+	}
+}
+
+// estimate returns the number of distinct values added, switching to linear counting
+// while many registers are still empty, where the raw estimate is biased
+func (c *cardinality) estimate() int {
+	if c.registers == nil {
+		return 0
+	}
+	m := float64(len(c.registers))
+	var sum float64
+	zeros := 0
+	for _, r := range c.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(e))
+}
+
+// hashString is FNV-1a followed by MurmurHash3's finalizer, which spreads FNV's weak
+// high bits over the whole word. It is fixed so that estimates are reproducible.
+func hashString(s string) uint64 {
+	x := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		x ^= uint64(s[i])
+		x *= 1099511628211
+	}
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb3fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// quantileSketch is a log-bucketed histogram (DDSketch). Bucket i counts the values in
+// (γ^(i-1), γ^i] with γ = (1+α)/(1-α), and reports them as 2γ^i/(γ+1), which is within
+// α of each of them. Memory grows with the log of the value range rather than the
+// sample count (about 900 buckets from 10µs to 10 minutes), and two sketches merge by
+// adding their bucket counts.
+type quantileSketch struct {
+	bins   []uint64 // bins[k] counts bucket offset+k
+	offset int
+	zeros  uint64 // values <= 0, which have no log bucket
+	count  uint64
+}
+
+func (s *quantileSketch) add(v float64) {
+	s.count++
+	if v <= 0 {
+		s.zeros++
+		return
+	}
+	i := int(math.Ceil(math.Log(v) / sketchLogGamma))
+	s.grow(i)
+	s.bins[i-s.offset]++
+}
+
+// grow makes room for bucket i
+func (s *quantileSketch) grow(i int) {
+	switch {
+	case len(s.bins) == 0:
+		s.offset = i
+		s.bins = make([]uint64, 1)
+	case i < s.offset:
+		n := s.offset - i
+		s.bins = append(make([]uint64, n, n+len(s.bins)), s.bins...)
+		s.offset = i
+	case i-s.offset >= len(s.bins):
+		s.bins = append(s.bins, make([]uint64, i-s.offset-len(s.bins)+1)...)
+	}
+}
+
+func (s *quantileSketch) merge(o *quantileSketch) {
+	s.count += o.count
+	s.zeros += o.zeros
+	if len(o.bins) == 0 {
+		return
+	}
+	s.grow(o.offset)
+	s.grow(o.offset + len(o.bins) - 1)
+	for k, n := range o.bins {
+		s.bins[o.offset+k-s.offset] += n
+	}
+}
+
+// quantile returns the value at rank q*(count-1), q in [0, 1]
+func (s *quantileSketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	seen := s.zeros
+	i := s.offset
+	for k, n := range s.bins {
+		seen += n
+		i = s.offset + k
+		if seen > rank {
+			break
+		}
+	}
+	return 2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)
+}
+
+// runningStats keeps count, mean, variance (Welford) and extremes in constant memory
+type runningStats struct {
+	n    int
+	mean float64
+	m2   float64 // sum of squared deviations from mean
+	min  float64
+	max  float64
+}
+
+func (r *runningStats) add(v float64) {
+	r.n++
+	if r.n == 1 || v < r.min {
+		r.min = v
+	}
+	if r.n == 1 || v > r.max {
+		r.max = v
+	}
+	d := v - r.mean
+	r.mean += d / float64(r.n)
+	r.m2 += d * (v - r.mean)
+}
+
+// merge combines two runs of the same metric (Chan et al.'s pairwise update)
+func (r *runningStats) merge(o runningStats) {
+	if o.n == 0 {
+		return
+	}
+	if r.n == 0 {
+		*r = o
+		return
+	}
+	n := r.n + o.n
+	d := o.mean - r.mean
+	r.m2 += o.m2 + d*d*float64(r.n)*float64(o.n)/float64(n)
+	r.mean += d * float64(o.n) / float64(n)
+	r.min = math.Min(r.min, o.min)
+	r.max = math.Max(r.max, o.max)
+	r.n = n
+}
+
+// stddev is the population standard deviation
+func (r *runningStats) stddev() float64 {
+	if r.n <= 1 {
+		return 0
+	}
+	return math.Sqrt(r.m2 / float64(r.n))
+}
+
+// distribution tracks one metric's mean, spread, extremes and percentiles
+type distribution struct {
+	stats  runningStats
+	sketch quantileSketch
+}
+
+func (d *distribution) add(v float64) {
+	d.stats.add(v)
+	d.sketch.add(v)
+}
+
+func (d *distribution) merge(o *distribution) {
+	d.stats.merge(o.stats)
+	d.sketch.merge(&o.sketch)
+}
+
+func (d *distribution) count() int {
+	return d.stats.n
+}
+
+func (d *distribution) mean() float64 {
+	return d.stats.mean
+}
+
+func (d *distribution) stddev() float64 {
+	return d.stats.stddev()
+}
+
+func (d *distribution) max() float64 {
+	return d.stats.max
+}
+
+// percentile returns the p-th percentile (0-100), clamped to the exact min and max
+func (d *distribution) percentile(p float64) float64 {
+	if d.stats.n == 0 {
+		return 0
+	}
+	v := d.sketch.quantile(p / 100.0)
+	return math.Min(math.Max(v, d.stats.min), d.stats.max)
+}
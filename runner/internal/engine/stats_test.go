@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+var testPercentiles = []float64{0, 1, 10, 25, 50, 75, 90, 95, 99, 99.9, 100}
+
+func TestPercentileWithinSketchAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name string
+		gen  func() float64
+	}{
+		{"uniform 1-1000ms", func() float64 { return 1 + rng.Float64()*999 }},
+		{"lognormal latency", func() float64 { return math.Exp(4 + rng.NormFloat64()) }},
+		{"exponential", func() float64 { return rng.ExpFloat64() * 50 }},
+		{"10µs to 10min", func() float64 { return 0.01 * math.Pow(6e7, rng.Float64()) }},
+		{"constant", func() float64 { return 42 }},
+		{"with zeros", func() float64 {
+			if rng.Intn(10) == 0 {
+				return 0
+			}
+			return rng.Float64() * 200
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d distribution
+			values := make([]float64, 5000)
+			for i := range values {
+				values[i] = tt.gen()
+				d.add(values[i])
+			}
+			sort.Float64s(values)
+
+			for _, p := range testPercentiles {
+				exact := values[int(p/100*float64(len(values)-1))]
+				got := d.percentile(p)
+				if exact == 0 {
+					if got != 0 {
+						t.Errorf("p%v: got %v, want 0", p, got)
+					}
+					continue
+				}
+				if relErr := math.Abs(got-exact) / exact; relErr > sketchAccuracy+1e-12 {
+					t.Errorf("p%v: got %v, exact %v, relative error %.4f > %v", p, got, exact, relErr, sketchAccuracy)
+				}
+			}
+		})
+	}
+}
+
+func TestPercentileEmpty(t *testing.T) {
+	var d distribution
+	if got := d.percentile(95); got != 0 {
+		t.Errorf("empty distribution p95: got %v, want 0", got)
+	}
+}
+
+func TestMergeMatchesSinglePass(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	values := make([]float64, 3000)
+	for i := range values {
+		values[i] = math.Exp(3 + 1.5*rng.NormFloat64())
+	}
+
+	// Uneven chunks, including empty ones on either side of a merge
+	bounds := []int{0, 0, 1, 17, 500, 500, 2048, 3000}
+	var merged distribution
+	for i := 1; i < len(bounds); i++ {
+		var part distribution
+		for _, v := range values[bounds[i-1]:bounds[i]] {
+			part.add(v)
+		}
+		merged.merge(&part)
+	}
+
+	var single distribution
+	var sum float64
+	for _, v := range values {
+		single.add(v)
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	stddev := math.Sqrt(sq / float64(len(values)))
+
+	if merged.count() != len(values) {
+		t.Fatalf("count: got %d, want %d", merged.count(), len(values))
+	}
+	closeTo := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+	closeTo("mean", merged.mean(), mean)
+	closeTo("stddev", merged.stddev(), stddev)
+	closeTo("single-pass mean", single.mean(), mean)
+	closeTo("single-pass stddev", single.stddev(), stddev)
+	if merged.stats.min != single.stats.min || merged.max() != single.max() {
+		t.Errorf("extremes: got [%v, %v], want [%v, %v]", merged.stats.min, merged.max(), single.stats.min, single.max())
+	}
+	// Bucket counts add up, so merging loses nothing
+	for _, p := range testPercentiles {
+		if got, want := merged.percentile(p), single.percentile(p); got != want {
+			t.Errorf("p%v: merged %v, single pass %v", p, got, want)
+		}
+	}
+}
+
+func TestCardinalityEstimate(t *testing.T) {
+	// 3 standard errors of 1.04/√m
+	tolerance := 3 * 1.04 / math.Sqrt(1<<cardinalityPrecision)
+	tests := []struct {
+		name     string
+		distinct int
+		repeats  int
+		maxErr   float64 // relative
+	}{
+		{"empty", 0, 1, 0},
+		{"one ip", 1, 50, 0},
+		{"small pool", 20, 10, 0},
+		{"sticky pool", 500, 4, 0.01},
+		{"rotating pool", 10000, 2, tolerance},
+		{"per-request rotation", 200000, 1, tolerance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c cardinality
+			for r := 0; r < tt.repeats; r++ {
+				for i := 0; i < tt.distinct; i++ {
+					c.add(fmt.Sprintf("10.%d.%d.%d", i>>16, i>>8&0xff, i&0xff))
+				}
+			}
+			got := c.estimate()
+			if relErr := math.Abs(float64(got-tt.distinct)) / math.Max(1, float64(tt.distinct)); relErr > tt.maxErr {
+				t.Errorf("got %d, want %d, relative error %.4f > %.4f", got, tt.distinct, relErr, tt.maxErr)
+			}
+			if len(c.registers) > 1<<cardinalityPrecision {
+				t.Errorf("registers grew to %d", len(c.registers))
+			}
+		})
+	}
+}
+
+func TestCardinalityMergeMatchesSinglePass(t *testing.T) {
+	var single, merged cardinality
+	parts := make([]cardinality, 5)
+	for i := 0; i < 30000; i++ {
+		ip := fmt.Sprintf("2001:db8::%x", i%12000)
+		single.add(ip)
+		parts[i%len(parts)].add(ip)
+	}
+	merged.merge(&cardinality{}) // empty merges are no-ops
+	for i := range parts {
+		merged.merge(&parts[i])
+	}
+	if got, want := merged.estimate(), single.estimate(); got != want {
+		t.Errorf("merged %d, single pass %d", got, want)
+	}
+}
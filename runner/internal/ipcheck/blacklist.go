@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"net"
 	"strings"
+
+	"proxy-stability-test/runner/internal/domain"
 )
 
 // DNSBLServers is the list of DNSBL servers to check
@@ -70,14 +72,49 @@ func CheckBlacklist(logger *slog.Logger, ip string) (queried, listed int, source
 	return queried, listed, sources, nil
 }
 
-// reverseIP reverses the octets of an IPv4 address
-// "1.2.3.4" -> "4.3.2.1"
+// reverseIP builds the DNSBL query label for an address.
+// IPv4 reverses the octets ("1.2.3.4" -> "4.3.2.1"); IPv6 reverses every nibble of the
+// expanded address, as in ip6.arpa ("2001:db8::1" -> "1.0.0.0. ... .8.b.d.0.1.0.0.2").
+// IPv4-mapped IPv6 addresses ("::ffff:1.2.3.4") are treated as IPv4.
 func reverseIP(ip string) string {
-	parts := strings.Split(ip, ".")
-	if len(parts) != 4 {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
 		return ""
 	}
-	return fmt.Sprintf("%s.%s.%s.%s", parts[3], parts[2], parts[1], parts[0])
+	if v4 := parsed.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+
+	const hexDigits = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for i := len(parsed) - 1; i >= 0; i-- {
+		b := parsed[i]
+		nibbles = append(nibbles, string(hexDigits[b&0x0f]), string(hexDigits[b>>4]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// Family returns "ipv4" or "ipv6" for an address, or "" when it does not parse.
+// IPv4-mapped IPv6 addresses, as reported by dual-stack listeners, count as IPv4.
+func Family(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ""
+	case parsed.To4() != nil:
+		return domain.IPFamilyIPv4
+	default:
+		return domain.IPFamilyIPv6
+	}
+}
+
+// NormalizeIP unmaps IPv4-mapped IPv6 addresses so the same egress compares equal
+// whichever listener observed it; anything else is returned unchanged
+func NormalizeIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+		return parsed.To4().String()
+	}
+	return ip
 }
 
 // isDNSNotFound checks if the error is a DNS "not found" error
@@ -0,0 +1,25 @@
+package ipcheck
+
+import "testing"
+
+func TestReverseIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{"ipv4", "192.0.2.10", "10.2.0.192"},
+		{"full ipv6", "2606:4700:4700:0000:0000:0000:0000:1111", "1.1.1.1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.7.4.0.0.7.4.6.0.6.2"},
+		{"compressed ipv6", "2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"},
+		{"uppercase ipv6", "2001:DB8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"},
+		{"ipv4-mapped ipv6 reverses as ipv4", "::ffff:198.51.100.7", "7.100.51.198"},
+		{"invalid", "not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reverseIP(tt.ip); got != tt.want {
+				t.Errorf("reverseIP(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// Package metrics keeps the runner's counters, gauges and histograms and renders them
+// in the Prometheus text exposition format for GET /metrics
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metric families in registration order
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family interface {
+	write(w *bufio.Writer)
+	deleteLabel(name, value string)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteText renders every family in the text exposition format (version 0.0.4)
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// DeleteLabel drops every series whose label name has value, e.g. a finished run's run_id
+func (r *Registry) DeleteLabel(name, value string) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		f.deleteLabel(name, value)
+	}
+}
+
+// vec is the labelled series map shared by counters, gauges and histograms
+type vec[S any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	series map[string]*labelled[S]
+}
+
+type labelled[S any] struct {
+	values []string
+	s      S
+}
+
+func (v *vec[S]) init(name, help, kind string, labels []string) {
+	v.name, v.help, v.kind, v.labels = name, help, kind, labels
+	v.series = make(map[string]*labelled[S])
+}
+
+// get returns the series for values, creating it with init; callers hold mu
+func (v *vec[S]) get(values []string, init func() S) *S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	l, ok := v.series[key]
+	if !ok {
+		l = &labelled[S]{values: append([]string(nil), values...), s: init()}
+		v.series[key] = l
+	}
+	return &l.s
+}
+
+func (v *vec[S]) deleteLabel(name, value string) {
+	idx := -1
+	for i, l := range v.labels {
+		if l == name {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, l := range v.series {
+		if l.values[idx] == value {
+			delete(v.series, key)
+		}
+	}
+}
+
+// sorted returns series in label order so scrapes are stable; callers hold mu
+func (v *vec[S]) sorted() []*labelled[S] {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]*labelled[S], len(keys))
+	for i, k := range keys {
+		out[i] = v.series[k]
+	}
+	return out
+}
+
+func (v *vec[S]) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// CounterVec is a monotonically increasing value per label set
+type CounterVec struct {
+	vec[float64]
+}
+
+// NewCounterVec registers a counter family
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{}
+	c.init(name, help, "counter", labels)
+	r.register(c)
+	return c
+}
+
+// Add increases the counter for values by delta; negative deltas are ignored
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(values, zero) += delta
+}
+
+// Inc increases the counter for values by one
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, l := range c.sorted() {
+		writeSample(w, c.name, c.labels, l.values, "", "", l.s)
+	}
+}
+
+// GaugeVec is a value per label set that can go up and down
+type GaugeVec struct {
+	vec[float64]
+}
+
+// NewGaugeVec registers a gauge family
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{}
+	g.init(name, help, "gauge", labels)
+	r.register(g)
+	return g
+}
+
+// Set stores v for values
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.get(values, zero) = v
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(w)
+	for _, l := range g.sorted() {
+		writeSample(w, g.name, g.labels, l.values, "", "", l.s)
+	}
+}
+
+// GaugeFunc is an unlabelled gauge read at scrape time
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value comes from fn on every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, escapeHelp(g.help), g.name)
+	writeSample(w, g.name, nil, nil, "", "", g.fn())
+}
+
+func (g *GaugeFunc) deleteLabel(string, string) {}
+
+// GaugeVecFunc is a labelled gauge family collected at scrape time
+type GaugeVecFunc struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	collect func(set func(v float64, values ...string))
+}
+
+// NewGaugeVecFunc registers a gauge family whose series collect reports on every scrape
+func (r *Registry) NewGaugeVecFunc(name, help string, collect func(set func(v float64, values ...string)), labels ...string) *GaugeVecFunc {
+	g := &GaugeVecFunc{name: name, help: help, kind: "gauge", labels: labels, collect: collect}
+	r.register(g)
+	return g
+}
+
+// CounterVecFunc is a labelled counter family collected at scrape time, for totals
+// another component already keeps
+type CounterVecFunc struct {
+	GaugeVecFunc
+}
+
+// NewCounterVecFunc registers a counter family whose series collect reports on every scrape
+func (r *Registry) NewCounterVecFunc(name, help string, collect func(set func(v float64, values ...string)), labels ...string) *CounterVecFunc {
+	c := &CounterVecFunc{GaugeVecFunc{name: name, help: help, kind: "counter", labels: labels, collect: collect}}
+	r.register(c)
+	return c
+}
+
+func (g *GaugeVecFunc) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", g.name, escapeHelp(g.help), g.name, g.kind)
+	g.collect(func(v float64, values ...string) {
+		if len(values) != len(g.labels) {
+			panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", g.name, len(g.labels), len(values)))
+		}
+		writeSample(w, g.name, g.labels, values, "", "", v)
+	})
+}
+
+func (g *GaugeVecFunc) deleteLabel(string, string) {}
+
+// HistogramVec counts observations into cumulative buckets per label set
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds (ascending)
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{buckets: buckets}
+	h.init(name, help, "histogram", labels)
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the histogram for values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(values, func() histogram { return histogram{counts: make([]uint64, len(h.buckets))} })
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, l := range h.sorted() {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += l.s.counts[i]
+			writeSample(w, h.name+"_bucket", h.labels, l.values, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, l.values, "le", "+Inf", float64(l.s.count))
+		writeSample(w, h.name+"_sum", h.labels, l.values, "", "", l.s.sum)
+		writeSample(w, h.name+"_count", h.labels, l.values, "", "", float64(l.s.count))
+	}
+}
+
+func zero() float64 { return 0 }
+
+// writeSample writes one line; extraName/extraValue carry the histogram "le" label
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l, escapeLabel(values[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *Registry)
+		want     string
+	}{
+		{
+			name: "counter with escaped label values",
+			register: func(r *Registry) {
+				c := r.NewCounterVec("requests_total", "Requests by \\path\nand status", "path", "status")
+				c.Inc(`/a"b`, "200")
+				c.Add(2, `C:\tmp`+"\n", "500")
+				c.Add(-1, `/a"b`, "200") // ignored
+			},
+			want: `# HELP requests_total Requests by \\path\nand status
+# TYPE requests_total counter
+requests_total{path="/a\"b",status="200"} 1
+requests_total{path="C:\\tmp\n",status="500"} 2
+`,
+		},
+		{
+			name: "gauge keeps the last value and special floats",
+			register: func(r *Registry) {
+				g := r.NewGaugeVec("score", "Score", "component")
+				g.Set(0.5, "uptime")
+				g.Set(0.75, "uptime")
+				g.Set(math.Inf(1), "latency")
+				g.Set(math.NaN(), "jitter")
+			},
+			want: `# HELP score Score
+# TYPE score gauge
+score{component="jitter"} NaN
+score{component="latency"} +Inf
+score{component="uptime"} 0.75
+`,
+		},
+		{
+			name: "unlabelled gauge func",
+			register: func(r *Registry) {
+				r.NewGaugeFunc("active_runs", "Runs", func() float64 { return 3 })
+			},
+			want: `# HELP active_runs Runs
+# TYPE active_runs gauge
+active_runs 3
+`,
+		},
+		{
+			name: "gauge and counter vec funcs",
+			register: func(r *Registry) {
+				r.NewGaugeVecFunc("spool_entries", "Entries", func(set func(float64, ...string)) {
+					set(4, "api")
+					set(0, "db")
+				}, "sink")
+				r.NewCounterVecFunc("spool_dropped_total", "Dropped", func(set func(float64, ...string)) {
+					set(12, "api")
+				}, "sink")
+			},
+			want: `# HELP spool_entries Entries
+# TYPE spool_entries gauge
+spool_entries{sink="api"} 4
+spool_entries{sink="db"} 0
+# HELP spool_dropped_total Dropped
+# TYPE spool_dropped_total counter
+spool_dropped_total{sink="api"} 12
+`,
+		},
+		{
+			name: "histogram buckets are cumulative and inclusive",
+			register: func(r *Registry) {
+				h := r.NewHistogramVec("latency_seconds", "Latency", []float64{0.1, 1}, "protocol")
+				for _, v := range []float64{0.0625, 0.5, 1, 5} {
+					h.Observe(v, "http")
+				}
+			},
+			want: `# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{protocol="http",le="0.1"} 1
+latency_seconds_bucket{protocol="http",le="1"} 3
+latency_seconds_bucket{protocol="http",le="+Inf"} 4
+latency_seconds_sum{protocol="http"} 6.5625
+latency_seconds_count{protocol="http"} 4
+`,
+		},
+		{
+			name: "unlabelled histogram",
+			register: func(r *Registry) {
+				r.NewHistogramVec("wait_seconds", "Wait", []float64{1}).Observe(2)
+			},
+			want: `# HELP wait_seconds Wait
+# TYPE wait_seconds histogram
+wait_seconds_bucket{le="1"} 0
+wait_seconds_bucket{le="+Inf"} 1
+wait_seconds_sum 2
+wait_seconds_count 1
+`,
+		},
+		{
+			name: "family without series writes only its header",
+			register: func(r *Registry) {
+				r.NewCounterVec("errors_total", "Errors", "error_type")
+			},
+			want: `# HELP errors_total Errors
+# TYPE errors_total counter
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.register(r)
+			var out strings.Builder
+			if err := r.WriteText(&out); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeleteLabel(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Requests", "run_id", "protocol")
+	h := r.NewHistogramVec("ttfb_seconds", "TTFB", []float64{1}, "run_id")
+	g := r.NewGaugeVec("target_rpm", "RPM", "reporter") // no run_id label: untouched
+	for _, run := range []string{"r1", "r2"} {
+		c.Inc(run, "http")
+		c.Inc(run, "https")
+		h.Observe(0.5, run)
+	}
+	g.Set(60, "r1")
+
+	r.DeleteLabel("run_id", "r1")
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP requests_total Requests
+# TYPE requests_total counter
+requests_total{run_id="r2",protocol="http"} 1
+requests_total{run_id="r2",protocol="https"} 1
+# HELP ttfb_seconds TTFB
+# TYPE ttfb_seconds histogram
+ttfb_seconds_bucket{run_id="r2",le="1"} 1
+ttfb_seconds_bucket{run_id="r2",le="+Inf"} 1
+ttfb_seconds_sum{run_id="r2"} 0.5
+ttfb_seconds_count{run_id="r2"} 1
+# HELP target_rpm RPM
+# TYPE target_rpm gauge
+target_rpm{reporter="r1"} 60
+`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A deleted series starts over when it is written again
+	c.Inc("r1", "http")
+	out.Reset()
+	r.WriteText(&out)
+	if !strings.Contains(out.String(), `requests_total{run_id="r1",protocol="http"} 1`+"\n") {
+		t.Errorf("re-created series missing or not reset:\n%s", out.String())
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a missing label value")
+		}
+	}()
+	NewRegistry().NewCounterVec("requests_total", "Requests", "run_id", "protocol").Inc("r1")
+}
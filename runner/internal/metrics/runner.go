@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Default is the registry GET /metrics serves
+var Default = NewRegistry()
+
+// RunRetention is how long a finished run's series stay scrapeable before they are dropped
+const RunRetention = 5 * time.Minute
+
+// Latency buckets in seconds, from LAN-local hops to slow residential exits
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	httpTTFB = Default.NewHistogramVec("runner_http_ttfb_seconds",
+		"Time to first byte of HTTP(S) requests through the proxy",
+		latencyBuckets, "run_id", "proxy_label", "protocol")
+	httpTotal = Default.NewHistogramVec("runner_http_total_seconds",
+		"Total duration of successful HTTP(S) requests through the proxy",
+		latencyBuckets, "run_id", "proxy_label", "protocol")
+	tcpConnect = Default.NewHistogramVec("runner_tcp_connect_seconds",
+		"TCP connect time to the proxy",
+		latencyBuckets, "run_id", "proxy_label", "protocol")
+	tlsHandshake = Default.NewHistogramVec("runner_tls_handshake_seconds",
+		"TLS handshake time with the target through the proxy",
+		latencyBuckets, "run_id", "proxy_label", "protocol")
+	requests = Default.NewCounterVec("runner_requests_total",
+		"Samples taken, by protocol",
+		"run_id", "proxy_label", "protocol")
+	sampleErrors = Default.NewCounterVec("runner_errors_total",
+		"Failed samples by protocol and error_type",
+		"run_id", "proxy_label", "protocol", "error_type")
+	wsDrops = Default.NewCounterVec("runner_ws_drops_total",
+		"WebSocket messages sent without an echo",
+		"run_id", "proxy_label")
+	wsDisconnects = Default.NewCounterVec("runner_ws_disconnects_total",
+		"WebSocket connections that ended early, by reason",
+		"run_id", "proxy_label", "reason")
+	scores = Default.NewGaugeVec("runner_score",
+		"Latest rolling score components (0-1)",
+		"run_id", "proxy_label", "component")
+	windowScores = Default.NewGaugeVec("runner_window_score",
+		"Latest total score over a trailing window (0-1)",
+		"run_id", "proxy_label", "window")
+	targetRPM = Default.NewGaugeVec("runner_target_rpm",
+		"Request rate each tester is set to, moved by the run's load profile",
+		"run_id", "proxy_label", "protocol")
+	uptimeRatio = Default.NewGaugeVec("runner_uptime_ratio",
+		"Latest rolling share of successful samples",
+		"run_id", "proxy_label")
+	reporterRetries = Default.NewCounterVec("runner_reporter_retries_total",
+		"Report attempts retried after a failure",
+		"reporter")
+	reporterFailures = Default.NewCounterVec("runner_reporter_failures_total",
+		"Reports that failed for good: unavailable after retries, or rejected",
+		"reporter", "reason")
+	alerts = Default.NewCounterVec("runner_alerts_total",
+		"Alert events by type and outcome: fired, resolved, suppressed (cooldown) or dropped (queue full)",
+		"event", "outcome")
+	alertDeliveries = Default.NewCounterVec("runner_alert_deliveries_total",
+		"Webhook deliveries by channel and outcome (ok or failed)",
+		"channel", "outcome")
+	streamDropped = Default.NewCounterVec("runner_stream_dropped_events_total",
+		"Live stream events a slow subscriber missed")
+)
+
+// ObserveHTTPSample records one HTTP(S) sample; warmup samples are left out as in summaries
+func ObserveHTTPSample(runID, label string, s domain.HTTPSample) {
+	if s.IsWarmup {
+		return
+	}
+	protocol := httpProtocol(s)
+	requests.Inc(runID, label, protocol)
+	if s.TCPConnectMS > 0 {
+		tcpConnect.Observe(s.TCPConnectMS/1000, runID, label, protocol)
+	}
+	if s.TLSHandshakeMS > 0 {
+		tlsHandshake.Observe(s.TLSHandshakeMS/1000, runID, label, protocol)
+	}
+	if s.ErrorType != "" {
+		sampleErrors.Inc(runID, label, protocol, s.ErrorType)
+		return
+	}
+	if s.TTFBMS > 0 {
+		httpTTFB.Observe(s.TTFBMS/1000, runID, label, protocol)
+	}
+	httpTotal.Observe(s.TotalMS/1000, runID, label, protocol)
+}
+
+// httpProtocol labels a sample http, https, or http3 when it went over HTTP/3 (MASQUE)
+func httpProtocol(s domain.HTTPSample) string {
+	switch {
+	case s.NegotiatedProtocol == "h3":
+		return "http3"
+	case s.IsHTTPS:
+		return "https"
+	default:
+		return "http"
+	}
+}
+
+// ObserveWSSample records one WebSocket connection sample
+func ObserveWSSample(runID, label string, s domain.WSSample) {
+	if s.IsWarmup {
+		return
+	}
+	protocol := "ws"
+	if s.IsWSS {
+		protocol = "wss"
+	}
+	requests.Inc(runID, label, protocol)
+	if s.TCPConnectMS > 0 {
+		tcpConnect.Observe(s.TCPConnectMS/1000, runID, label, protocol)
+	}
+	if s.TLSHandshakeMS > 0 {
+		tlsHandshake.Observe(s.TLSHandshakeMS/1000, runID, label, protocol)
+	}
+	if s.ErrorType != "" {
+		sampleErrors.Inc(runID, label, protocol, s.ErrorType)
+	}
+	if s.DropCount > 0 {
+		wsDrops.Add(float64(s.DropCount), runID, label)
+	}
+	if s.DisconnectReason != "" {
+		wsDisconnects.Inc(runID, label, s.DisconnectReason)
+	}
+}
+
+// ObserveUDPSample records one UDP session sample
+func ObserveUDPSample(runID, label string, s domain.UDPSample) {
+	if s.IsWarmup {
+		return
+	}
+	requests.Inc(runID, label, "udp")
+	if s.ErrorType != "" {
+		sampleErrors.Inc(runID, label, "udp", s.ErrorType)
+	}
+}
+
+// SetScores publishes a computed summary's score components
+func SetScores(runID, label string, summary domain.RunSummary) {
+	for component, v := range map[string]float64{
+		"total":    summary.ScoreTotal,
+		"uptime":   summary.ScoreUptime,
+		"latency":  summary.ScoreLatency,
+		"jitter":   summary.ScoreJitter,
+		"ws":       summary.ScoreWS,
+		"udp":      summary.ScoreUDP,
+		"security": summary.ScoreSecurity,
+	} {
+		scores.Set(v, runID, label, component)
+	}
+	uptimeRatio.Set(summary.UptimeRatio, runID, label)
+}
+
+// SetWindowScore publishes the total score of a trailing-window summary
+func SetWindowScore(runID, label string, summary domain.RunSummary) {
+	windowScores.Set(summary.ScoreTotal, runID, label, summary.Window)
+}
+
+// SetTargetRPM publishes the request rate a tester is set to
+func SetTargetRPM(runID, label, protocol string, rpm float64) {
+	targetRPM.Set(rpm, runID, label, protocol)
+}
+
+// ReporterRetry counts one retried report attempt
+func ReporterRetry(reporter string) {
+	reporterRetries.Inc(reporter)
+}
+
+// ReporterFailure counts one report that failed for reason ("unavailable" or "rejected")
+func ReporterFailure(reporter, reason string) {
+	reporterFailures.Inc(reporter, reason)
+}
+
+// Alert counts one alert event by outcome
+func Alert(event, outcome string) {
+	alerts.Inc(event, outcome)
+}
+
+// AlertDelivery counts one webhook delivery by outcome ("ok" or "failed")
+func AlertDelivery(channel, outcome string) {
+	alertDeliveries.Inc(channel, outcome)
+}
+
+// StreamDropped counts one live event dropped for a subscriber that fell behind
+func StreamDropped() {
+	streamDropped.Inc()
+}
+
+// runLabels maps each run to the proxy label its series carry
+var runLabels sync.Map // run_id → proxy_label
+
+// RegisterRun records the proxy label for runID's series, for callers that only have the run ID
+func RegisterRun(runID, label string) {
+	runLabels.Store(runID, label)
+}
+
+// RunLabel returns the proxy label registered for runID, or "" if there is none
+func RunLabel(runID string) string {
+	label, _ := runLabels.Load(runID)
+	s, _ := label.(string)
+	return s
+}
+
+// ForgetRun drops a finished run's series after RunRetention, leaving time for a final scrape
+func ForgetRun(runID string) {
+	time.AfterFunc(RunRetention, func() {
+		Default.DeleteLabel("run_id", runID)
+		runLabels.Delete(runID)
+	})
+}
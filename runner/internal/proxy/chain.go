@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// ChainHopError is returned when a chained dial fails at a specific hop.
+// Hop indexes Hops(proxy); the hop that failed to open its onward tunnel is blamed.
+type ChainHopError struct {
+	Hop   int
+	Label string
+	Err   error
+}
+
+func (e *ChainHopError) Error() string {
+	return fmt.Sprintf("chain hop %d (%s): %s", e.Hop, e.Label, e.Err.Error())
+}
+
+func (e *ChainHopError) Unwrap() error {
+	return e.Err
+}
+
+// IsChained reports whether the proxy is reached through upstream hops
+func IsChained(proxy domain.ProxyConfig) bool {
+	return len(proxy.Chain) > 0
+}
+
+// Hops returns every hop to traverse in order: the upstream chain, then the proxy itself
+func Hops(proxy domain.ProxyConfig) []domain.ProxyHop {
+	hops := make([]domain.ProxyHop, 0, len(proxy.Chain)+1)
+	hops = append(hops, proxy.Chain...)
+	return append(hops, domain.ProxyHop{
+		Host:     proxy.Host,
+		Port:     proxy.Port,
+		Protocol: proxy.Protocol,
+		AuthUser: proxy.AuthUser,
+		AuthPass: proxy.AuthPass,
+		Label:    proxy.Label,
+	})
+}
+
+// hopProxyConfig lets the single-proxy handshakes (CONNECT, SOCKS, proxy TLS) run against a hop
+func hopProxyConfig(hop domain.ProxyHop) domain.ProxyConfig {
+	return domain.ProxyConfig{
+		Host:     hop.Host,
+		Port:     hop.Port,
+		Protocol: hop.Protocol,
+		AuthUser: hop.AuthUser,
+		AuthPass: hop.AuthPass,
+		Label:    hop.Label,
+	}
+}
+
+// DialChain connects to the last hop (the proxy itself) through every upstream hop.
+// The returned connection is ready for the final CONNECT/SOCKS request to the target.
+// Timings are returned even on failure, up to and including the failing hop; the TLS
+// state belongs to the last hop when it is an https proxy.
+func DialChain(ctx context.Context, proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) (net.Conn, []domain.HopTiming, *tls.ConnectionState, error) {
+	return dialChain(ctx, &net.Dialer{Timeout: timeout}, proxy, timeout, logger)
+}
+
+func dialChain(ctx context.Context, dialer *net.Dialer, proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) (net.Conn, []domain.HopTiming, *tls.ConnectionState, error) {
+	hops := Hops(proxy)
+	timings := make([]domain.HopTiming, 0, len(hops))
+
+	// Hop 0: plain TCP connect
+	first := domain.HopTiming{Hop: 0, Label: hops[0].Label, Protocol: hops[0].Protocol}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(hops[0].Host, hops[0].Port))
+	first.TCPConnectMS = durationMS(time.Since(start))
+	if err != nil {
+		first.ErrorType = classifyHTTPError(err)
+		return nil, append(timings, first), nil, err
+	}
+	timings = append(timings, first)
+
+	var state *tls.ConnectionState
+	for i, hop := range hops {
+		if i > 0 {
+			// Ask the previous hop to open a tunnel to this one
+			prev := hops[i-1]
+			conn.SetDeadline(time.Now().Add(timeout))
+			start := time.Now()
+			auth, err := openTunnel(conn, hop.Host, hop.Port, hopProxyConfig(prev), logger)
+			conn.SetDeadline(time.Time{})
+			timings[i-1].TunnelMS = durationMS(time.Since(start))
+			timings[i-1].AuthScheme = auth.Scheme
+			if err != nil {
+				conn.Close()
+				timings[i-1].ErrorType = classifyHTTPError(err)
+				logger.Debug("Chain hop tunnel fail",
+					"hop", i-1,
+					"next_hop", i,
+					"error_type", timings[i-1].ErrorType,
+				)
+				return nil, timings, nil, &ChainHopError{Hop: i - 1, Label: prev.Label, Err: err}
+			}
+			timings = append(timings, domain.HopTiming{Hop: i, Label: hop.Label, Protocol: hop.Protocol})
+		}
+
+		if hop.Protocol != domain.ProtocolHTTPS {
+			state = nil
+			continue
+		}
+
+		// TLS to the hop itself, nested inside any outer hop's tunnel
+		tlsConn, hopState, tlsDuration, err := ProxyTLSHandshake(ctx, conn, hopProxyConfig(hop), timeout)
+		timings[i].TLSHandshakeMS = durationMS(tlsDuration)
+		if err != nil {
+			conn.Close()
+			timings[i].ErrorType = classifyHTTPError(err)
+			if i == 0 {
+				return nil, timings, nil, err
+			}
+			return nil, timings, nil, &ChainHopError{Hop: i, Label: hop.Label, Err: err}
+		}
+		conn = tlsConn
+		state = hopState
+	}
+
+	if len(hops) > 1 {
+		logger.Debug("Chain dial success",
+			"hop_count", len(hops),
+		)
+	}
+	return conn, timings, state, nil
+}
@@ -1,72 +1,114 @@
 package proxy
 
 import (
-	"bufio"
 	"context"
-	"encoding/base64"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"proxy-stability-test/runner/internal/domain"
 )
 
-// DialThroughProxy creates a TCP connection to the proxy server
+// DialThroughProxy creates a TCP connection to the proxy server.
+// For https proxies the TLS handshake with the proxy is included; chained
+// proxies are reached hop by hop, and the returned duration covers every hop.
 func DialThroughProxy(ctx context.Context, proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) (net.Conn, time.Duration, error) {
-	addr := fmt.Sprintf("%s:%d", proxy.Host, proxy.Port)
-
 	logger.Debug("TCP connect start",
 		"proxy_host", proxy.Host,
 		"proxy_port", proxy.Port,
+		"hop_count", len(proxy.Chain)+1,
 	)
 
 	start := time.Now()
-	dialer := net.Dialer{Timeout: timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	conn, timings, state, err := DialChain(ctx, proxy, timeout, logger)
 	connectMS := time.Since(start)
 
 	if err != nil {
-		logger.Error("TCP connect fail",
-			"proxy_label", proxy.Label,
-			"error_type", "connection_refused",
-			"error_detail", err.Error(),
-			"connect_ms", connectMS.Milliseconds(),
-		)
-		return nil, connectMS, fmt.Errorf("tcp_connect_failed: %w", err)
+		var hopErr *ChainHopError
+		var tlsErr *ProxyTLSError
+		switch {
+		case errors.As(err, &hopErr):
+			logger.Error("Proxy chain fail",
+				"proxy_label", proxy.Label,
+				"hop", hopErr.Hop,
+				"hop_label", hopErr.Label,
+				"error_type", timings[hopErr.Hop].ErrorType,
+				"error_detail", err.Error(),
+			)
+			return nil, connectMS, err
+		case errors.As(err, &tlsErr):
+			logger.Error("Proxy TLS handshake fail",
+				"proxy_label", proxy.Label,
+				"error_detail", err.Error(),
+				"proxy_tls_handshake_ms", timings[0].TLSHandshakeMS,
+			)
+			return nil, connectMS, err
+		default:
+			logger.Error("TCP connect fail",
+				"proxy_label", proxy.Label,
+				"error_type", "connection_refused",
+				"error_detail", err.Error(),
+				"connect_ms", connectMS.Milliseconds(),
+			)
+			return nil, connectMS, fmt.Errorf("tcp_connect_failed: %w", err)
+		}
 	}
 
 	logger.Info("TCP connect success",
 		"proxy_label", proxy.Label,
 		"connect_ms", connectMS.Milliseconds(),
 	)
+	if state != nil {
+		logger.Info("Proxy TLS handshake success",
+			"proxy_label", proxy.Label,
+			"proxy_tls_version", TLSVersionString(state.Version),
+			"proxy_tls_handshake_ms", timings[len(timings)-1].TLSHandshakeMS,
+		)
+	}
+	for _, hop := range timings[:len(timings)-1] {
+		logger.Info("Proxy chain hop reached",
+			"proxy_label", proxy.Label,
+			"hop", hop.Hop,
+			"hop_label", hop.Label,
+			"hop_protocol", hop.Protocol,
+			"tcp_connect_ms", hop.TCPConnectMS,
+			"tls_handshake_ms", hop.TLSHandshakeMS,
+			"tunnel_ms", hop.TunnelMS,
+		)
+	}
+
 	return conn, connectMS, nil
 }
 
-// ConnectTunnel sends a CONNECT request through the proxy for HTTPS/WSS tunneling
+// ConnectTunnel opens a tunnel to the target through the proxy for HTTPS/WSS tunneling.
+// HTTP proxies get a CONNECT request, SOCKS proxies the matching SOCKS CONNECT.
 func ConnectTunnel(conn net.Conn, targetHost string, targetPort int, proxy domain.ProxyConfig, logger *slog.Logger) error {
-	target := fmt.Sprintf("%s:%d", targetHost, targetPort)
-	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
-
-	if proxy.AuthUser != "" {
-		auth := base64.StdEncoding.EncodeToString([]byte(proxy.AuthUser + ":" + proxy.AuthPass))
-		connectReq += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", auth)
-	}
-
-	connectReq += "\r\n"
+	_, err := openTunnel(conn, targetHost, targetPort, proxy, logger)
+	return err
+}
 
-	_, err := conn.Write([]byte(connectReq))
-	if err != nil {
-		return fmt.Errorf("connect_tunnel_failed: write: %w", err)
+// openTunnel is ConnectTunnel that also reports how a CONNECT authenticated to the proxy
+func openTunnel(conn net.Conn, targetHost string, targetPort int, proxy domain.ProxyConfig, logger *slog.Logger) (AuthResult, error) {
+	switch proxy.Protocol {
+	case domain.ProtocolSOCKS5:
+		return AuthResult{}, SOCKS5Connect(conn, targetHost, targetPort, proxy, logger)
+	case domain.ProtocolSOCKS4:
+		return AuthResult{}, SOCKS4Connect(conn, targetHost, targetPort, false, proxy, logger)
+	case domain.ProtocolSOCKS4A:
+		return AuthResult{}, SOCKS4Connect(conn, targetHost, targetPort, true, proxy, logger)
 	}
 
-	reader := bufio.NewReader(conn)
-	resp, err := http.ReadResponse(reader, nil)
+	target := hostPort(targetHost, targetPort)
+	resp, auth, err := httpConnect(conn, target, proxy)
 	if err != nil {
-		return fmt.Errorf("connect_tunnel_failed: read: %w", err)
+		return auth, fmt.Errorf("connect_tunnel_failed: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		errType := classifyConnectError(resp.StatusCode)
@@ -74,14 +116,57 @@ func ConnectTunnel(conn net.Conn, targetHost string, targetPort int, proxy domai
 			"target", target,
 			"status_code", resp.StatusCode,
 			"error_type", errType,
+			"auth_scheme", auth.Scheme,
 		)
-		return fmt.Errorf("%s: status %d", errType, resp.StatusCode)
+		return auth, &ConnectError{ErrorType: errType, StatusCode: resp.StatusCode}
 	}
 
 	logger.Debug("CONNECT tunnel success",
 		"target", target,
+		"auth_scheme", auth.Scheme,
+		"auth_round_trips", auth.RoundTrips,
+		"auth_ms", durationMS(auth.Extra),
 	)
-	return nil
+	return auth, nil
+}
+
+// ConnectError is returned when an HTTP proxy answers CONNECT with a non-200 status
+type ConnectError struct {
+	ErrorType  string
+	StatusCode int
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("%s: status %d", e.ErrorType, e.StatusCode)
+}
+
+// proxyErrorType extracts the error type from typed proxy-leg errors (SOCKS, CONNECT, proxy TLS, proxy auth, MASQUE, IP family)
+func proxyErrorType(err error) (string, bool) {
+	var socksErr *SOCKSError
+	if errors.As(err, &socksErr) {
+		return socksErr.ErrorType, true
+	}
+	var connErr *ConnectError
+	if errors.As(err, &connErr) {
+		return connErr.ErrorType, true
+	}
+	var tlsErr *ProxyTLSError
+	if errors.As(err, &tlsErr) {
+		return tlsErr.ErrorType, true
+	}
+	var masqueErr *MASQUEError
+	if errors.As(err, &masqueErr) {
+		return masqueErr.ErrorType, true
+	}
+	var authErr *ProxyAuthError
+	if errors.As(err, &authErr) {
+		return authErr.ErrorType, true
+	}
+	var familyErr *AddressFamilyError
+	if errors.As(err, &familyErr) {
+		return "address_family_unavailable", true
+	}
+	return "", false
 }
 
 func classifyConnectError(statusCode int) string {
@@ -96,3 +181,217 @@ func classifyConnectError(statusCode int) string {
 		return "connect_tunnel_failed"
 	}
 }
+
+// IsSOCKS reports whether the proxy speaks SOCKS (4, 4a or 5) instead of HTTP
+func IsSOCKS(proxy domain.ProxyConfig) bool {
+	switch proxy.Protocol {
+	case domain.ProtocolSOCKS4, domain.ProtocolSOCKS4A, domain.ProtocolSOCKS5:
+		return true
+	default:
+		return false
+	}
+}
+
+// ProxyURL builds the proxy URL used by net/http for plain-HTTP requests to HTTP proxies.
+// The scheme is always http: TLS to https proxies is layered in by the dial function.
+// Credentials are left out; WithForwardProxy sends Proxy-Authorization so it can answer
+// Digest and NTLM challenges.
+func ProxyURL(proxy domain.ProxyConfig) *url.URL {
+	return &url.URL{
+		Scheme: "http",
+		Host:   hostPort(proxy.Host, proxy.Port),
+	}
+}
+
+// NewTransport creates an http.Transport that routes every request through the proxy.
+// Plain-HTTP requests to HTTP(S) proxies are forwarded through the standard Proxy hook
+// (wrap the transport in WithForwardProxy to authenticate them); everything else, including
+// SOCKS, is tunneled by DialContext so CONNECT can answer 407 challenges.
+func NewTransport(proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) *http.Transport {
+	tunnel := tunnelDialContext(proxy, timeout, logger)
+	transport := &http.Transport{
+		DialContext: tunnel,
+	}
+	if IsSOCKS(proxy) {
+		return transport
+	}
+
+	proxyURL := ProxyURL(proxy)
+	forward := proxyDialContext(proxy, timeout, logger)
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if req.URL.Scheme == "http" {
+			return proxyURL, nil
+		}
+		return nil, nil
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == proxyURL.Host {
+			return forward(ctx, network, addr)
+		}
+		return tunnel(ctx, network, addr)
+	}
+	return transport
+}
+
+// proxyDialContext returns a dial function for the connection to an HTTP(S) proxy.
+// For https proxies the connection is wrapped in TLS before it is returned; for
+// chained proxies addr (the last hop) is reached through the upstream hops.
+func proxyDialContext(proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if proxy.Protocol != domain.ProtocolHTTPS && !IsChained(proxy) {
+		return dialer.DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, timings, state, err := dialChain(ctx, dialer, proxy, timeout, logger)
+		if tr := dialTraceFrom(ctx); tr != nil {
+			tr.record(proxy, timings, state)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// tunnelDialContext returns a dial function that reaches addr through a SOCKS handshake
+// or CONNECT tunnel, pinned to the run's IP family. Its duration and any proxy auth are
+// recorded on the context's dialTrace.
+func tunnelDialContext(proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+		}
+
+		host, err = pinFamily(ctx, host, proxy.IPFamily)
+		if err != nil {
+			return nil, err
+		}
+
+		tr := dialTraceFrom(ctx)
+		conn, timings, state, err := dialChain(ctx, dialer, proxy, timeout, logger)
+		if tr != nil {
+			tr.record(proxy, timings, state)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		conn.SetDeadline(start.Add(timeout))
+		auth, err := openTunnel(conn, host, port, proxy, logger)
+		conn.SetDeadline(time.Time{})
+		if tr != nil {
+			tr.tunnel = time.Since(start)
+			tr.socks = IsSOCKS(proxy)
+			tr.auth = auth
+			tr.recordTunnel(err)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// dialTrace receives proxy-leg timings from the dial functions above, which
+// run inside net/http and gorilla/websocket where samples are not reachable
+type dialTrace struct {
+	tunnel            time.Duration // SOCKS handshake or CONNECT to the target
+	socks             bool
+	auth              AuthResult
+	proxyTLSHandshake time.Duration
+	proxyTLSState     *tls.ConnectionState
+	hops              []domain.HopTiming // chained proxies only
+}
+
+type dialTraceKey struct{}
+
+// withDialTrace attaches a dialTrace to ctx
+func withDialTrace(ctx context.Context) (context.Context, *dialTrace) {
+	tr := &dialTrace{}
+	return context.WithValue(ctx, dialTraceKey{}, tr), tr
+}
+
+func dialTraceFrom(ctx context.Context) *dialTrace {
+	tr, _ := ctx.Value(dialTraceKey{}).(*dialTrace)
+	return tr
+}
+
+// record stores the result of dialChain. Only the last hop's TLS counts as the proxy leg.
+func (tr *dialTrace) record(proxy domain.ProxyConfig, timings []domain.HopTiming, state *tls.ConnectionState) {
+	if len(timings) == 0 {
+		return
+	}
+	last := timings[len(timings)-1]
+	if last.Hop == len(proxy.Chain) {
+		tr.proxyTLSHandshake = time.Duration(last.TLSHandshakeMS * float64(time.Millisecond))
+		tr.proxyTLSState = state
+	}
+	if IsChained(proxy) {
+		tr.hops = timings
+	}
+}
+
+// recordTunnel attributes the final tunnel to the target to the last hop
+func (tr *dialTrace) recordTunnel(err error) {
+	if len(tr.hops) == 0 {
+		return
+	}
+	last := &tr.hops[len(tr.hops)-1]
+	last.TunnelMS = durationMS(tr.tunnel)
+	last.AuthScheme = tr.auth.Scheme
+	if err != nil {
+		last.ErrorType = classifyHTTPError(err)
+	}
+}
+
+// applyHTTP copies the recorded proxy-leg timings onto an HTTP sample
+func (tr *dialTrace) applyHTTP(sample *domain.HTTPSample) {
+	if tr.socks {
+		sample.SOCKSHandshakeMS = durationMS(tr.tunnel)
+	}
+	sample.ProxyAuthScheme = tr.auth.Scheme
+	sample.ProxyAuthRoundTrips = tr.auth.RoundTrips
+	sample.ProxyAuthMS = durationMS(tr.auth.Extra)
+	sample.ProxyTLSHandshakeMS = durationMS(tr.proxyTLSHandshake)
+	if tr.proxyTLSState != nil {
+		sample.ProxyTLSVersion = TLSVersionString(tr.proxyTLSState.Version)
+		sample.ProxyTLSCipher = tls.CipherSuiteName(tr.proxyTLSState.CipherSuite)
+	}
+	sample.HopTimings = tr.hops
+}
+
+// applyWS copies the recorded proxy-leg timings onto a WS sample
+func (tr *dialTrace) applyWS(sample *domain.WSSample) {
+	if tr.socks {
+		sample.SOCKSHandshakeMS = durationMS(tr.tunnel)
+	}
+	sample.ProxyAuthScheme = tr.auth.Scheme
+	sample.ProxyAuthRoundTrips = tr.auth.RoundTrips
+	sample.ProxyAuthMS = durationMS(tr.auth.Extra)
+	sample.ProxyTLSHandshakeMS = durationMS(tr.proxyTLSHandshake)
+	if tr.proxyTLSState != nil {
+		sample.ProxyTLSVersion = TLSVersionString(tr.proxyTLSState.Version)
+		sample.ProxyTLSCipher = tls.CipherSuiteName(tr.proxyTLSState.CipherSuite)
+	}
+	sample.HopTimings = tr.hops
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000.0
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/ipcheck"
+)
+
+// ObservedIPHeader is set by the targets on every response to the client address
+// they saw on the socket, i.e. the proxy's egress address
+const ObservedIPHeader = "X-Observed-Ip"
+
+// AddressFamilyError is returned when a target has no address in the run's IP family
+type AddressFamilyError struct {
+	Family string
+	Host   string
+	Err    error
+}
+
+func (e *AddressFamilyError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("no %s address for %s: %s", e.Family, e.Host, e.Err.Error())
+	}
+	return fmt.Sprintf("no %s address for %s", e.Family, e.Host)
+}
+
+func (e *AddressFamilyError) Unwrap() error {
+	return e.Err
+}
+
+// hostPort joins host and port, bracketing IPv6 literals
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// pinFamily resolves a target host to an address literal of the run's IP family, so the
+// proxy has no choice of egress family. With auto the host is returned unchanged.
+func pinFamily(ctx context.Context, host, family string) (string, error) {
+	if family == "" || family == domain.IPFamilyAuto {
+		return host, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ipcheck.Family(host) != family {
+			return "", &AddressFamilyError{Family: family, Host: host}
+		}
+		return host, nil
+	}
+
+	network := "ip4"
+	if family == domain.IPFamilyIPv6 {
+		network = "ip6"
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil || len(ips) == 0 {
+		return "", &AddressFamilyError{Family: family, Host: host, Err: err}
+	}
+	return ips[0].String(), nil
+}
+
+// observedIP returns the address a target reported in ObservedIPHeader and its family
+func observedIP(h http.Header) (string, string) {
+	ip := ipcheck.NormalizeIP(h.Get(ObservedIPHeader))
+	return ip, ipcheck.Family(ip)
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// h2ExtraStreams is how many GET /echo streams run alongside the primary request
+// on every h2 connection to measure multiplexing through the tunnel
+const h2ExtraStreams = 3
+
+// alpnProtocols are offered to the target; h2 is preferred when the target supports it
+var alpnProtocols = []string{http2.NextProtoTLS, "http/1.1"}
+
+type h2StreamResult struct {
+	ms  float64
+	err error
+}
+
+// doH2Request sends the request as an h2 stream over the tunneled TLS connection,
+// with h2ExtraStreams concurrent streams multiplexed on the same connection
+func (t *HTTPSTester) doH2Request(ctx context.Context, tlsConn *tls.Conn, method, path string, body []byte, seq int, requestType string, reqStart time.Time, sample *domain.HTTPSample) {
+	tr := &http2.Transport{}
+	cc, err := tr.NewClientConn(tlsConn)
+	if err != nil {
+		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+		sample.ErrorType = "h2_setup_failed"
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("HTTPS request fail",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"error_type", sample.ErrorType,
+			"stage", "h2_setup",
+			"seq", seq,
+		)
+		return
+	}
+	defer cc.Close()
+
+	reqCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	// Extra streams start first so they overlap with the primary request
+	results := make(chan h2StreamResult, h2ExtraStreams)
+	for i := 0; i < h2ExtraStreams; i++ {
+		go func(stream int) {
+			start := time.Now()
+			req, err := t.newH2Request(reqCtx, "GET", "/echo", nil, seq, stream)
+			if err == nil {
+				var resp *http.Response
+				resp, err = cc.RoundTrip(req)
+				if err == nil {
+					_, err = io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+			results <- h2StreamResult{ms: durationMS(time.Since(start)), err: err}
+		}(i + 1)
+	}
+
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+		sample.BytesSent = int64(len(body))
+	}
+
+	primaryStart := time.Now()
+	primaryErr := func() error {
+		req, err := t.newH2Request(reqCtx, method, path, bodyReader, seq, 0)
+		if err != nil {
+			return err
+		}
+		resp, err := cc.RoundTrip(req)
+		sample.TTFBMS = float64(time.Since(primaryStart).Microseconds()) / 1000.0
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		sample.StatusCode = resp.StatusCode
+		sample.ObservedIP, sample.ObservedIPFamily = observedIP(resp.Header)
+		n, err := io.Copy(io.Discard, resp.Body)
+		sample.BytesReceived = n
+		return err
+	}()
+	primaryMS := durationMS(time.Since(primaryStart))
+
+	// Wait for every extra stream so none outlives the connection
+	streamMS := []float64{primaryMS}
+	if isH2StreamReset(primaryErr) {
+		sample.H2StreamResets++
+	}
+	for i := 0; i < h2ExtraStreams; i++ {
+		res := <-results
+		if res.err != nil {
+			if isH2StreamReset(res.err) {
+				sample.H2StreamResets++
+			}
+			continue
+		}
+		streamMS = append(streamMS, res.ms)
+	}
+
+	sample.H2Streams = h2ExtraStreams + 1
+	sum := 0.0
+	for _, ms := range streamMS {
+		sum += ms
+		if ms > sample.H2StreamMaxMS {
+			sample.H2StreamMaxMS = ms
+		}
+	}
+	sample.H2StreamAvgMS = sum / float64(len(streamMS))
+	sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+
+	if primaryErr != nil {
+		sample.ErrorType = classifyH2Error(primaryErr)
+		sample.ErrorMessage = primaryErr.Error()
+		t.logger.Debug("HTTPS request fail",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"error_type", sample.ErrorType,
+			"stage", "h2_response",
+			"h2_stream_resets", sample.H2StreamResets,
+			"seq", seq,
+		)
+		return
+	}
+
+	t.logger.Debug("HTTPS total timing",
+		"phase", "continuous",
+		"request_type", requestType,
+		"method", method,
+		"negotiated_protocol", sample.NegotiatedProtocol,
+		"tcp_connect_ms", sample.TCPConnectMS,
+		"tls_handshake_ms", sample.TLSHandshakeMS,
+		"ttfb_ms", sample.TTFBMS,
+		"total_ms", sample.TotalMS,
+		"h2_stream_avg_ms", sample.H2StreamAvgMS,
+		"h2_stream_resets", sample.H2StreamResets,
+		"status_code", sample.StatusCode,
+		"seq", seq,
+	)
+
+	if sample.StatusCode >= 400 {
+		t.logger.Warn("HTTPS non-200 status",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"status_code", sample.StatusCode,
+			"seq", seq,
+		)
+	}
+}
+
+func (t *HTTPSTester) newH2Request(ctx context.Context, method, path string, body io.Reader, seq, stream int) (*http.Request, error) {
+	url := "https://" + hostPort(t.targetHost, t.targetPort) + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ProxyTester/1.0")
+	req.Header.Set("X-Run-Id", t.runID)
+	req.Header.Set("X-Seq", strconv.Itoa(seq))
+	req.Header.Set("X-Stream", strconv.Itoa(stream))
+	injectTrace(ctx, req.Header)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// isH2StreamReset reports whether the peer (or a middlebox) reset the stream
+func isH2StreamReset(err error) bool {
+	if err == nil {
+		return false
+	}
+	var streamErr http2.StreamError
+	return errors.As(err, &streamErr) || strings.Contains(err.Error(), "RST_STREAM")
+}
+
+func classifyH2Error(err error) string {
+	var goAway http2.GoAwayError
+	var connErr http2.ConnectionError
+	switch {
+	case isH2StreamReset(err):
+		return "h2_stream_reset"
+	case errors.As(err, &goAway):
+		return "h2_goaway"
+	case errors.As(err, &connErr):
+		return "h2_protocol_error"
+	case errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "timeout"):
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,346 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// HTTP3Tester performs HTTP/3 testing through a MASQUE CONNECT-UDP tunnel
+type HTTP3Tester struct {
+	proxy      domain.ProxyConfig
+	runID      string
+	rpm        int
+	timeout    time.Duration
+	limiter    *rate.Limiter
+	baseURL    string
+	targetHost string
+	targetPort int
+	samples    chan<- domain.HTTPSample
+	logger     *slog.Logger
+	seq        int
+}
+
+// NewHTTP3Tester creates a new HTTP/3 tester
+func NewHTTP3Tester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS int, baseURL string, samples chan<- domain.HTTPSample, logger *slog.Logger) *HTTP3Tester {
+	timeout := time.Duration(timeoutMS) * time.Millisecond
+
+	ratePerSec := float64(rpm) / 60.0
+	limiter := rate.NewLimiter(rate.Limit(ratePerSec), 1)
+
+	// Parse target host:port from URL (e.g., https://h3target:3444)
+	targetHost, targetPort, err := H3TargetAddr(baseURL)
+	if err != nil {
+		targetHost, targetPort = "h3target", 3444
+	}
+
+	testerLogger := logger.With(
+		"module", "proxy.http3_tester",
+		"goroutine", "http3",
+		"run_id", runID,
+		"proxy_label", proxy.Label,
+	)
+
+	testerLogger.Info("HTTP3 transport created",
+		"phase", "continuous",
+		"http3_rpm", rpm,
+		"proxy_protocol", proxy.Protocol,
+		"proxy_host", proxy.Host,
+		"proxy_port", proxy.Port,
+		"target_host", targetHost,
+		"target_port", targetPort,
+	)
+
+	return &HTTP3Tester{
+		proxy:      proxy,
+		runID:      runID,
+		rpm:        rpm,
+		timeout:    timeout,
+		limiter:    limiter,
+		baseURL:    baseURL,
+		targetHost: targetHost,
+		targetPort: targetPort,
+		samples:    samples,
+		logger:     testerLogger,
+	}
+}
+
+// SetRPM changes the request rate of a running tester; the next request waits at the new rate
+func (t *HTTP3Tester) SetRPM(rpm int) {
+	t.limiter.SetLimit(rate.Limit(float64(rpm) / 60.0))
+	t.logger.Info("HTTP/3 rate changed",
+		"phase", "continuous",
+		"http3_rpm", rpm,
+	)
+}
+
+// SetTargetRPM moves the request rate without logging, for load profiles that change it
+// every tick; rpm may be fractional
+func (t *HTTP3Tester) SetTargetRPM(rpm float64) {
+	t.limiter.SetLimit(rate.Limit(rpm / 60.0))
+}
+
+// TargetRPM returns the request rate the tester is currently set to, to 0.01 rpm
+func (t *HTTP3Tester) TargetRPM() float64 {
+	return math.Round(float64(t.limiter.Limit())*60.0*100) / 100
+}
+
+// Run starts the HTTP/3 test loop
+func (t *HTTP3Tester) Run(ctx context.Context) error {
+	t.logger.Info("HTTP3 goroutine started",
+		"phase", "continuous",
+		"http3_rpm", t.rpm,
+	)
+
+	methodIdx := 0
+	batchCount := 0
+	lastIPCheck := time.Now()
+
+	for {
+		if err := t.limiter.Wait(ctx); err != nil {
+			t.logger.Info("Cancel signal received",
+				"phase", "stopping",
+				"pending_requests", 0,
+			)
+			t.logger.Info("HTTP3 goroutine stopped",
+				"phase", "stopping",
+				"total_samples", t.seq,
+			)
+			return nil
+		}
+
+		t.seq++
+		mt := domain.MethodRotation[methodIdx]
+		methodIdx = (methodIdx + 1) % len(domain.MethodRotation)
+
+		var body []byte
+		if mt.Body != nil {
+			body = mt.Body(t.seq)
+		}
+
+		requestType := getRequestType(mt.Path)
+		sample := t.doRequest(ctx, mt.Method, mt.Path, body, t.seq, requestType)
+		select {
+		case t.samples <- sample:
+		default:
+			t.logger.Warn("Sample channel near capacity",
+				"phase", "continuous",
+			)
+			t.samples <- sample
+		}
+
+		// Every 10th batch: bandwidth + slow test
+		if methodIdx == 0 {
+			batchCount++
+			t.logger.Debug("HTTP3 method batch complete",
+				"phase", "continuous",
+				"batch_number", batchCount,
+				"total_samples", t.seq,
+			)
+
+			if batchCount%10 == 0 {
+				if err := t.limiter.Wait(ctx); err != nil {
+					return nil
+				}
+				t.seq++
+				largeSample := t.doRequest(ctx, "GET", "/large?size=1048576", nil, t.seq, "bandwidth")
+				t.samples <- largeSample
+
+				if err := t.limiter.Wait(ctx); err != nil {
+					return nil
+				}
+				t.seq++
+				slowSample := t.doRequest(ctx, "GET", "/slow?delay=2000", nil, t.seq, "timeout_test")
+				t.samples <- slowSample
+			}
+		}
+
+		// IP check every 30 seconds
+		if time.Since(lastIPCheck) >= 30*time.Second {
+			if err := t.limiter.Wait(ctx); err != nil {
+				return nil
+			}
+			t.seq++
+			ipSample := t.doRequest(ctx, "GET", "/ip", nil, t.seq, "ip_check")
+			t.samples <- ipSample
+			lastIPCheck = time.Now()
+		}
+	}
+}
+
+// DoSingleRequest performs a single HTTP/3 request (used for warmup)
+func (t *HTTP3Tester) DoSingleRequest(ctx context.Context, method, path string, body []byte, seq int) domain.HTTPSample {
+	return t.doRequest(ctx, method, path, body, seq, getRequestType(path))
+}
+
+func (t *HTTP3Tester) doRequest(ctx context.Context, method, path string, body []byte, seq int, requestType string) domain.HTTPSample {
+	sample := domain.HTTPSample{
+		Seq:        seq,
+		TargetURL:  "https://" + hostPort(t.targetHost, t.targetPort) + path,
+		Method:     method,
+		IsHTTPS:    true,
+		TargetRPM:  t.TargetRPM(),
+		MeasuredAt: time.Now(),
+	}
+
+	reqStart := time.Now()
+
+	t.logger.Debug("HTTP3 request start",
+		"phase", "continuous",
+		"request_type", requestType,
+		"method", method,
+		"seq", seq,
+	)
+
+	// Phase 1: QUIC to the proxy, CONNECT-UDP, then QUIC to the target inside the tunnel
+	sess, handshake, err := DialMASQUESession(ctx, t.proxy, t.targetHost, t.targetPort, t.timeout, t.logger)
+	sample.ProxyTLSHandshakeMS = durationMS(sess.Timing.ProxyHandshake)
+	sample.ConnectUDPMS = durationMS(sess.Timing.ConnectUDP)
+	sample.TLSHandshakeMS = durationMS(handshake)
+	if sess.Timing.ProxyTLS != nil {
+		sample.ProxyTLSVersion = TLSVersionString(sess.Timing.ProxyTLS.Version)
+		sample.ProxyTLSCipher = tls.CipherSuiteName(sess.Timing.ProxyTLS.CipherSuite)
+	}
+	if err != nil {
+		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+		sample.ErrorMessage = err.Error()
+		stage := "quic_handshake"
+		var masqueErr *MASQUEError
+		var connErr *ConnectError
+		switch {
+		case sess.Timing.ProxyTLS == nil:
+			stage = "proxy_quic"
+		case errors.As(err, &masqueErr) || errors.As(err, &connErr):
+			stage = "connect_udp"
+		}
+		if stage == "quic_handshake" {
+			sample.ErrorType = classifyQUICError(err, "quic_handshake_failed")
+		} else {
+			sample.ErrorType = classifyHTTPError(err)
+		}
+		t.logger.Debug("HTTP3 request fail",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"error_type", sample.ErrorType,
+			"stage", stage,
+			"proxy_tls_handshake_ms", sample.ProxyTLSHandshakeMS,
+			"connect_udp_ms", sample.ConnectUDPMS,
+			"seq", seq,
+		)
+		return sample
+	}
+	defer sess.Close()
+
+	state := sess.Conn.ConnectionState().TLS
+	sample.TLSVersion = TLSVersionString(state.Version)
+	sample.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+	sample.NegotiatedProtocol = state.NegotiatedProtocol
+
+	t.logger.Debug("QUIC handshake success",
+		"phase", "continuous",
+		"tls_version", sample.TLSVersion,
+		"tls_cipher", sample.TLSCipher,
+		"tls_handshake_ms", sample.TLSHandshakeMS,
+		"negotiated_protocol", sample.NegotiatedProtocol,
+		"seq", seq,
+	)
+
+	// Phase 2: HTTP/3 request
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+		sample.BytesSent = int64(len(body))
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, method, sample.TargetURL, bodyReader)
+	if err != nil {
+		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+		sample.ErrorType = "request_build_error"
+		sample.ErrorMessage = err.Error()
+		return sample
+	}
+	req.Header.Set("User-Agent", "ProxyTester/1.0")
+	req.Header.Set("X-Run-Id", t.runID)
+	req.Header.Set("X-Seq", strconv.Itoa(seq))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	ttfbStart := time.Now()
+	resp, err := sess.Client.RoundTrip(req)
+	sample.TTFBMS = float64(time.Since(ttfbStart).Microseconds()) / 1000.0
+	if err != nil {
+		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+		sample.ErrorType = classifyQUICError(err, "unknown")
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("HTTP3 request fail",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"error_type", sample.ErrorType,
+			"stage", "h3_response",
+			"seq", seq,
+		)
+		return sample
+	}
+	defer resp.Body.Close()
+
+	sample.StatusCode = resp.StatusCode
+	sample.ObservedIP, sample.ObservedIPFamily = observedIP(resp.Header)
+	n, err := io.Copy(io.Discard, resp.Body)
+	sample.BytesReceived = n
+	sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+	if err != nil {
+		sample.ErrorType = classifyQUICError(err, "unknown")
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("HTTP3 request fail",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"error_type", sample.ErrorType,
+			"stage", "h3_body",
+			"seq", seq,
+		)
+		return sample
+	}
+
+	t.logger.Debug("HTTP3 total timing",
+		"phase", "continuous",
+		"request_type", requestType,
+		"method", method,
+		"proxy_tls_handshake_ms", sample.ProxyTLSHandshakeMS,
+		"connect_udp_ms", sample.ConnectUDPMS,
+		"tls_handshake_ms", sample.TLSHandshakeMS,
+		"ttfb_ms", sample.TTFBMS,
+		"total_ms", sample.TotalMS,
+		"status_code", sample.StatusCode,
+		"seq", seq,
+	)
+
+	if sample.StatusCode >= 400 {
+		t.logger.Warn("HTTP3 non-200 status",
+			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
+			"status_code", sample.StatusCode,
+			"seq", seq,
+		)
+	}
+
+	return sample
+}
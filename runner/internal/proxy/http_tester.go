@@ -4,17 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
-	"fmt"
 	"io"
 	"log/slog"
-	"net"
+	"math"
 	"net/http"
 	"net/http/httptrace"
-	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/time/rate"
 
 	"proxy-stability-test/runner/internal/domain"
@@ -38,44 +37,31 @@ type HTTPTester struct {
 func NewHTTPTester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS int, baseURL string, samples chan<- domain.HTTPSample, logger *slog.Logger) *HTTPTester {
 	timeout := time.Duration(timeoutMS) * time.Millisecond
 
-	proxyURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s:%d", proxy.Host, proxy.Port),
-	}
-	if proxy.AuthUser != "" {
-		proxyURL.User = url.UserPassword(proxy.AuthUser, proxy.AuthPass)
-	}
+	testerLogger := logger.With(
+		"module", "proxy.http_tester",
+		"goroutine", "http",
+		"run_id", runID,
+		"proxy_label", proxy.Label,
+	)
 
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxyURL),
-		DialContext: (&net.Dialer{
-			Timeout:   timeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 100,
-		IdleConnTimeout:     90 * time.Second,
-	}
+	transport := NewTransport(proxy, timeout, testerLogger)
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 100
+	transport.IdleConnTimeout = 90 * time.Second
 
 	client := &http.Client{
-		Transport: transport,
+		Transport: WithForwardProxy(transport, proxy),
 		Timeout:   timeout,
 	}
 
 	ratePerSec := float64(rpm) / 60.0
 	limiter := rate.NewLimiter(rate.Limit(ratePerSec), 1)
 
-	testerLogger := logger.With(
-		"module", "proxy.http_tester",
-		"goroutine", "http",
-		"run_id", runID,
-		"proxy_label", proxy.Label,
-	)
-
 	testerLogger.Info("HTTP transport created",
 		"phase", "continuous",
 		"http_rpm", rpm,
+		"proxy_protocol", proxy.Protocol,
 		"proxy_host", proxy.Host,
 		"proxy_port", proxy.Port,
 	)
@@ -93,6 +79,26 @@ func NewHTTPTester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS in
 	}
 }
 
+// SetRPM changes the request rate of a running tester; the next request waits at the new rate
+func (t *HTTPTester) SetRPM(rpm int) {
+	t.limiter.SetLimit(rate.Limit(float64(rpm) / 60.0))
+	t.logger.Info("HTTP rate changed",
+		"phase", "continuous",
+		"http_rpm", rpm,
+	)
+}
+
+// SetTargetRPM moves the request rate without logging, for load profiles that change it
+// every tick; rpm may be fractional
+func (t *HTTPTester) SetTargetRPM(rpm float64) {
+	t.limiter.SetLimit(rate.Limit(rpm / 60.0))
+}
+
+// TargetRPM returns the request rate the tester is currently set to, to 0.01 rpm
+func (t *HTTPTester) TargetRPM() float64 {
+	return math.Round(float64(t.limiter.Limit())*60.0*100) / 100
+}
+
 // Run starts the HTTP test loop until context is cancelled
 func (t *HTTPTester) Run(ctx context.Context) error {
 	t.logger.Info("HTTP goroutine started",
@@ -198,10 +204,18 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 		TargetURL:  targetURL,
 		Method:     method,
 		IsHTTPS:    false,
+		TargetRPM:  t.TargetRPM(),
 		MeasuredAt: time.Now(),
 	}
 
-	var connectStart, connectDone, gotFirstByte time.Time
+	ctx, span := startProbe(ctx, "http.request", t.proxy, t.runID, seq,
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", targetURL),
+		attribute.String("request_type", requestType),
+	)
+	defer func() { endHTTPProbe(span, &sample) }()
+
+	var connectStart, connectDone, wroteRequest, gotFirstByte time.Time
 
 	trace := &httptrace.ClientTrace{
 		ConnectStart: func(_, _ string) { connectStart = time.Now() },
@@ -210,6 +224,7 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 				connectDone = time.Now()
 			}
 		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
 		GotFirstResponseByte: func() { gotFirstByte = time.Now() },
 	}
 
@@ -221,6 +236,7 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 		sample.BytesSent = int64(len(body))
 	}
 
+	ctx, proxyTrace := withDialTrace(ctx)
 	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, targetURL, bodyReader)
 	if err != nil {
 		sample.ErrorType = "unknown"
@@ -235,6 +251,27 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	injectTrace(ctx, req.Header)
+
+	// tracePhases records the phases reached, marking the last one with errType. A reused
+	// keep-alive connection has no connect phase, so its request starts at reqStart.
+	tracePhases := func(errType string) {
+		requestStart := reqStart
+		if !connectStart.IsZero() {
+			if connectDone.IsZero() {
+				tracePhase(ctx, "tcp_connect", connectStart, time.Time{}, errType)
+				return
+			}
+			tracePhase(ctx, "tcp_connect", connectStart, connectDone, "")
+			requestStart = connectDone
+		}
+		if wroteRequest.IsZero() {
+			tracePhase(ctx, "request", requestStart, time.Time{}, errType)
+			return
+		}
+		tracePhase(ctx, "request", requestStart, wroteRequest, "")
+		tracePhase(ctx, "response", wroteRequest, time.Time{}, errType)
+	}
 
 	resp, err := t.client.Do(req)
 	sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
@@ -242,6 +279,7 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 	if !connectStart.IsZero() && !connectDone.IsZero() {
 		sample.TCPConnectMS = float64(connectDone.Sub(connectStart).Microseconds()) / 1000.0
 	}
+	proxyTrace.applyHTTP(&sample)
 	if !gotFirstByte.IsZero() {
 		sample.TTFBMS = float64(gotFirstByte.Sub(reqStart).Microseconds()) / 1000.0
 	}
@@ -249,6 +287,7 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 	if err != nil {
 		sample.ErrorType = classifyHTTPError(err)
 		sample.ErrorMessage = err.Error()
+		tracePhases(sample.ErrorType)
 
 		t.logger.Debug("HTTP request fail",
 			"phase", "continuous",
@@ -264,10 +303,12 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 	defer resp.Body.Close()
 
 	sample.StatusCode = resp.StatusCode
+	sample.ObservedIP, sample.ObservedIPFamily = observedIP(resp.Header)
 
 	// Read body to measure bytes received
 	bodyBytes, _ := io.ReadAll(resp.Body)
 	sample.BytesReceived = int64(len(bodyBytes))
+	tracePhases("")
 
 	if resp.StatusCode >= 400 {
 		t.logger.Warn("HTTP non-200 status",
@@ -295,6 +336,10 @@ func (t *HTTPTester) doRequest(ctx context.Context, method, targetURL string, bo
 }
 
 func classifyHTTPError(err error) string {
+	if errType, ok := proxyErrorType(err); ok {
+		return errType
+	}
+
 	errStr := err.Error()
 	switch {
 	case strings.Contains(errStr, "context deadline exceeded") || strings.Contains(errStr, "timeout"):
@@ -6,15 +6,19 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/http2"
 	"golang.org/x/time/rate"
 
 	"proxy-stability-test/runner/internal/domain"
@@ -47,15 +51,15 @@ func NewHTTPSTester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS i
 	targetPort := 3443
 	if strings.Contains(baseURL, "://") {
 		parts := strings.SplitN(baseURL, "://", 2)
-		hostPort := strings.Split(parts[1], "/")[0]
-		if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		authority := strings.Split(parts[1], "/")[0]
+		if h, p, err := net.SplitHostPort(authority); err == nil {
 			targetHost = h
 			if pn, err := strconv.Atoi(p); err == nil {
 				targetPort = pn
 			}
 		} else {
 			// No port in URL — use default port based on scheme
-			targetHost = hostPort
+			targetHost = strings.Trim(authority, "[]")
 			if strings.HasPrefix(baseURL, "https://") {
 				targetPort = 443
 			} else {
@@ -74,6 +78,7 @@ func NewHTTPSTester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS i
 	testerLogger.Info("HTTPS transport created",
 		"phase", "continuous",
 		"https_rpm", rpm,
+		"proxy_protocol", proxy.Protocol,
 		"proxy_host", proxy.Host,
 		"proxy_port", proxy.Port,
 		"target_host", targetHost,
@@ -94,6 +99,26 @@ func NewHTTPSTester(proxy domain.ProxyConfig, runID string, rpm int, timeoutMS i
 	}
 }
 
+// SetRPM changes the request rate of a running tester; the next request waits at the new rate
+func (t *HTTPSTester) SetRPM(rpm int) {
+	t.limiter.SetLimit(rate.Limit(float64(rpm) / 60.0))
+	t.logger.Info("HTTPS rate changed",
+		"phase", "continuous",
+		"https_rpm", rpm,
+	)
+}
+
+// SetTargetRPM moves the request rate without logging, for load profiles that change it
+// every tick; rpm may be fractional
+func (t *HTTPSTester) SetTargetRPM(rpm float64) {
+	t.limiter.SetLimit(rate.Limit(rpm / 60.0))
+}
+
+// TargetRPM returns the request rate the tester is currently set to, to 0.01 rpm
+func (t *HTTPSTester) TargetRPM() float64 {
+	return math.Round(float64(t.limiter.Limit())*60.0*100) / 100
+}
+
 // Run starts the HTTPS test loop
 func (t *HTTPSTester) Run(ctx context.Context) error {
 	t.logger.Info("HTTPS goroutine started",
@@ -180,12 +205,20 @@ func (t *HTTPSTester) Run(ctx context.Context) error {
 func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body []byte, seq int, requestType string) domain.HTTPSample {
 	sample := domain.HTTPSample{
 		Seq:        seq,
-		TargetURL:  fmt.Sprintf("https://%s:%d%s", t.targetHost, t.targetPort, path),
+		TargetURL:  "https://" + hostPort(t.targetHost, t.targetPort) + path,
 		Method:     method,
 		IsHTTPS:    true,
+		TargetRPM:  t.TargetRPM(),
 		MeasuredAt: time.Now(),
 	}
 
+	ctx, span := startProbe(ctx, "https.request", t.proxy, t.runID, seq,
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", sample.TargetURL),
+		attribute.String("request_type", requestType),
+	)
+	defer func() { endHTTPProbe(span, &sample) }()
+
 	reqStart := time.Now()
 
 	// Phase 1: TCP connect to proxy
@@ -196,12 +229,10 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 		"seq", seq,
 	)
 
-	proxyAddr := fmt.Sprintf("%s:%d", t.proxy.Host, t.proxy.Port)
-	dialer := net.Dialer{Timeout: t.timeout}
-	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	// The proxy is handed an address literal when the run pins an IP family
+	tunnelHost, err := pinFamily(ctx, t.targetHost, t.proxy.IPFamily)
 	if err != nil {
-		sample.TCPConnectMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
-		sample.TotalMS = sample.TCPConnectMS
+		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
 		sample.ErrorType = classifyHTTPError(err)
 		sample.ErrorMessage = err.Error()
 		t.logger.Debug("HTTPS request fail",
@@ -209,71 +240,125 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 			"request_type", requestType,
 			"method", method,
 			"error_type", sample.ErrorType,
-			"stage", "tcp_connect",
+			"stage", "ip_family",
 			"seq", seq,
 		)
 		return sample
 	}
-	defer conn.Close()
-
-	sample.TCPConnectMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
 
-	// Phase 1b: CONNECT tunnel
-	connectReq := fmt.Sprintf("CONNECT %s:%d HTTP/1.1\r\nHost: %s:%d\r\n",
-		t.targetHost, t.targetPort, t.targetHost, t.targetPort)
-	if t.proxy.AuthUser != "" {
-		auth := basicAuth(t.proxy.AuthUser, t.proxy.AuthPass)
-		connectReq += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", auth)
+	// Phase 1a: reach the proxy through any chain hops, with TLS to https hops
+	dialStart := time.Now()
+	conn, hops, proxyState, err := DialChain(ctx, t.proxy, t.timeout, t.logger)
+	dialDone := time.Now()
+	sample.TCPConnectMS = hops[0].TCPConnectMS
+	last := hops[len(hops)-1]
+	if last.Hop == len(t.proxy.Chain) {
+		sample.ProxyTLSHandshakeMS = last.TLSHandshakeMS
+	}
+	if IsChained(t.proxy) {
+		sample.HopTimings = hops
 	}
-	connectReq += "\r\n"
-
-	conn.SetDeadline(time.Now().Add(t.timeout))
-	_, err = conn.Write([]byte(connectReq))
 	if err != nil {
 		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
-		sample.ErrorType = "connect_tunnel_failed"
+		sample.ErrorType = classifyHTTPError(err)
 		sample.ErrorMessage = err.Error()
-		t.logger.Debug("CONNECT tunnel fail",
+		stage := "tcp_connect"
+		var hopErr *ChainHopError
+		var tlsErr *ProxyTLSError
+		switch {
+		case errors.As(err, &hopErr):
+			stage = "proxy_chain"
+		case errors.As(err, &tlsErr):
+			stage = "proxy_tls"
+		}
+		tracePhase(ctx, "tcp_connect", dialStart, dialDone, sample.ErrorType)
+		t.logger.Debug("HTTPS request fail",
 			"phase", "continuous",
+			"request_type", requestType,
+			"method", method,
 			"error_type", sample.ErrorType,
+			"stage", stage,
+			"proxy_tls_handshake_ms", sample.ProxyTLSHandshakeMS,
 			"seq", seq,
 		)
 		return sample
 	}
+	defer conn.Close()
+	tracePhase(ctx, "tcp_connect", dialStart, dialDone, "")
 
-	reader := bufio.NewReader(conn)
-	resp, err := http.ReadResponse(reader, nil)
-	if err != nil {
-		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
-		sample.ErrorType = "connect_tunnel_failed"
-		sample.ErrorMessage = err.Error()
-		return sample
-	}
-	resp.Body.Close()
+	if proxyState != nil {
+		sample.ProxyTLSVersion = TLSVersionString(proxyState.Version)
+		sample.ProxyTLSCipher = tls.CipherSuiteName(proxyState.CipherSuite)
 
-	if resp.StatusCode != 200 {
-		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
-		sample.ErrorType = classifyConnectError(resp.StatusCode)
-		sample.ErrorMessage = fmt.Sprintf("CONNECT responded %d", resp.StatusCode)
-		t.logger.Debug("CONNECT tunnel fail",
+		t.logger.Debug("Proxy TLS handshake success",
 			"phase", "continuous",
-			"error_type", sample.ErrorType,
-			"status_code", resp.StatusCode,
+			"proxy_tls_version", sample.ProxyTLSVersion,
+			"proxy_tls_cipher", sample.ProxyTLSCipher,
+			"proxy_tls_handshake_ms", sample.ProxyTLSHandshakeMS,
 			"seq", seq,
 		)
-		return sample
 	}
 
-	t.logger.Debug("CONNECT tunnel success",
-		"phase", "continuous",
-		"seq", seq,
-	)
+	conn.SetDeadline(time.Now().Add(t.timeout))
+
+	// Phase 1b: SOCKS handshake or CONNECT tunnel
+	if IsSOCKS(t.proxy) {
+		socksStart := time.Now()
+		err = ConnectTunnel(conn, tunnelHost, t.targetPort, t.proxy, t.logger)
+		sample.SOCKSHandshakeMS = float64(time.Since(socksStart).Microseconds()) / 1000.0
+		socksErr := ""
+		if err != nil {
+			socksErr = classifyHTTPError(err)
+		}
+		tracePhase(ctx, "socks_handshake", socksStart, time.Now(), socksErr)
+		if IsChained(t.proxy) {
+			lastHop := &sample.HopTimings[len(sample.HopTimings)-1]
+			lastHop.TunnelMS = sample.SOCKSHandshakeMS
+			if err != nil {
+				lastHop.ErrorType = classifyHTTPError(err)
+			}
+		}
+		if err != nil {
+			sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+			sample.ErrorType = classifyHTTPError(err)
+			sample.ErrorMessage = err.Error()
+			t.logger.Debug("SOCKS handshake fail",
+				"phase", "continuous",
+				"proxy_protocol", t.proxy.Protocol,
+				"error_type", sample.ErrorType,
+				"socks_handshake_ms", sample.SOCKSHandshakeMS,
+				"seq", seq,
+			)
+			return sample
+		}
+
+		t.logger.Debug("SOCKS handshake success",
+			"phase", "continuous",
+			"socks_handshake_ms", sample.SOCKSHandshakeMS,
+			"seq", seq,
+		)
+	} else {
+		tunnelStart := time.Now()
+		ok := t.connectTunnel(conn, hostPort(tunnelHost, t.targetPort), &sample, seq)
+		tracePhase(ctx, "connect_tunnel", tunnelStart, time.Now(), sample.ErrorType)
+		if IsChained(t.proxy) {
+			lastHop := &sample.HopTimings[len(sample.HopTimings)-1]
+			lastHop.TunnelMS = durationMS(time.Since(tunnelStart))
+			lastHop.AuthScheme = sample.ProxyAuthScheme
+			lastHop.ErrorType = sample.ErrorType
+		}
+		if !ok {
+			sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+			return sample
+		}
+	}
 
 	// Phase 2: TLS handshake
 	tlsStart := time.Now()
 	tlsConn := tls.Client(conn, &tls.Config{
 		ServerName:         t.targetHost,
 		InsecureSkipVerify: true,
+		NextProtos:         alpnProtocols,
 	})
 
 	err = tlsConn.HandshakeContext(ctx)
@@ -283,6 +368,7 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
 		sample.ErrorType = classifyTLSError(err)
 		sample.ErrorMessage = err.Error()
+		tracePhase(ctx, "tls_handshake", tlsStart, time.Now(), sample.ErrorType)
 		t.logger.Debug("TLS handshake fail",
 			"phase", "continuous",
 			"error_type", sample.ErrorType,
@@ -292,18 +378,33 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 		return sample
 	}
 
+	tracePhase(ctx, "tls_handshake", tlsStart, time.Now(), "")
+
 	state := tlsConn.ConnectionState()
 	sample.TLSVersion = TLSVersionString(state.Version)
 	sample.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+	sample.NegotiatedProtocol = state.NegotiatedProtocol
+	if sample.NegotiatedProtocol == "" {
+		sample.NegotiatedProtocol = "http/1.1" // target ignored ALPN
+	}
 
 	t.logger.Debug("TLS handshake success",
 		"phase", "continuous",
 		"tls_version", sample.TLSVersion,
 		"tls_cipher", sample.TLSCipher,
 		"tls_handshake_ms", sample.TLSHandshakeMS,
+		"negotiated_protocol", sample.NegotiatedProtocol,
 		"seq", seq,
 	)
 
+	// Phase 3 (h2): multiplexed streams over the tunnel
+	if sample.NegotiatedProtocol == http2.NextProtoTLS {
+		h2Start := time.Now()
+		t.doH2Request(ctx, tlsConn, method, path, body, seq, requestType, reqStart, &sample)
+		tracePhase(ctx, "h2_streams", h2Start, time.Now(), sample.ErrorType)
+		return sample
+	}
+
 	// Phase 3: HTTPS request through tunnel
 	var bodyReader io.Reader
 	if body != nil {
@@ -315,6 +416,11 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 	reqPath := path
 	httpReq := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s:%d\r\nUser-Agent: ProxyTester/1.0\r\nX-Run-Id: %s\r\nX-Seq: %d\r\nConnection: close\r\n",
 		method, reqPath, t.targetHost, t.targetPort, t.runID, seq)
+	traceHeader := http.Header{}
+	injectTrace(ctx, traceHeader)
+	for name := range traceHeader {
+		httpReq += fmt.Sprintf("%s: %s\r\n", name, traceHeader.Get(name))
+	}
 
 	if body != nil {
 		httpReq += fmt.Sprintf("Content-Type: application/json\r\nContent-Length: %d\r\n", len(body))
@@ -322,17 +428,20 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 	httpReq += "\r\n"
 
 	tlsConn.SetDeadline(time.Now().Add(t.timeout))
+	writeStart := time.Now()
 	_, err = tlsConn.Write([]byte(httpReq))
 	if err != nil {
 		sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
 		sample.ErrorType = "unknown"
 		sample.ErrorMessage = err.Error()
+		tracePhase(ctx, "request", writeStart, time.Now(), sample.ErrorType)
 		return sample
 	}
 
 	if bodyReader != nil {
 		io.Copy(tlsConn, bodyReader)
 	}
+	tracePhase(ctx, "request", writeStart, time.Now(), "")
 
 	ttfbStart := time.Now()
 	tlsReader := bufio.NewReader(tlsConn)
@@ -342,6 +451,7 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 		sample.TTFBMS = float64(time.Since(ttfbStart).Microseconds()) / 1000.0
 		sample.ErrorType = "unknown"
 		sample.ErrorMessage = err.Error()
+		tracePhase(ctx, "response", ttfbStart, time.Now(), sample.ErrorType)
 		t.logger.Debug("HTTPS request fail",
 			"phase", "continuous",
 			"request_type", requestType,
@@ -356,10 +466,12 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 
 	sample.TTFBMS = float64(time.Since(ttfbStart).Microseconds()) / 1000.0
 	sample.StatusCode = httpResp.StatusCode
+	sample.ObservedIP, sample.ObservedIPFamily = observedIP(httpResp.Header)
 
 	respBody, _ := io.ReadAll(httpResp.Body)
 	sample.BytesReceived = int64(len(respBody))
 	sample.TotalMS = float64(time.Since(reqStart).Microseconds()) / 1000.0
+	tracePhase(ctx, "response", ttfbStart, time.Now(), "")
 
 	t.logger.Debug("HTTPS total timing",
 		"phase", "continuous",
@@ -386,6 +498,47 @@ func (t *HTTPSTester) doRequest(ctx context.Context, method, path string, body [
 	return sample
 }
 
+// connectTunnel issues an HTTP CONNECT on conn, answering any auth challenge; on failure
+// it records the error on sample and returns false
+func (t *HTTPSTester) connectTunnel(conn net.Conn, target string, sample *domain.HTTPSample, seq int) bool {
+	resp, auth, err := httpConnect(conn, target, t.proxy)
+	sample.ProxyAuthScheme = auth.Scheme
+	sample.ProxyAuthRoundTrips = auth.RoundTrips
+	sample.ProxyAuthMS = durationMS(auth.Extra)
+	if err != nil {
+		sample.ErrorType = "connect_tunnel_failed"
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("CONNECT tunnel fail",
+			"phase", "continuous",
+			"error_type", sample.ErrorType,
+			"seq", seq,
+		)
+		return false
+	}
+
+	if resp.StatusCode != 200 {
+		sample.ErrorType = classifyConnectError(resp.StatusCode)
+		sample.ErrorMessage = fmt.Sprintf("CONNECT responded %d", resp.StatusCode)
+		t.logger.Debug("CONNECT tunnel fail",
+			"phase", "continuous",
+			"error_type", sample.ErrorType,
+			"status_code", resp.StatusCode,
+			"proxy_auth_scheme", sample.ProxyAuthScheme,
+			"seq", seq,
+		)
+		return false
+	}
+
+	t.logger.Debug("CONNECT tunnel success",
+		"phase", "continuous",
+		"proxy_auth_scheme", sample.ProxyAuthScheme,
+		"proxy_auth_round_trips", sample.ProxyAuthRoundTrips,
+		"proxy_auth_ms", sample.ProxyAuthMS,
+		"seq", seq,
+	)
+	return true
+}
+
 func classifyTLSError(err error) string {
 	errStr := err.Error()
 	switch {
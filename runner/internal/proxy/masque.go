@@ -0,0 +1,460 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// MASQUEUDPPathPrefix is the default CONNECT-UDP URI template path (RFC 9298 §3):
+// /.well-known/masque/udp/{target_host}/{target_port}/
+const MASQUEUDPPathPrefix = "/.well-known/masque/udp/"
+
+// Outer QUIC packets must carry a full inner QUIC packet (at least 1200 bytes)
+// plus the DATAGRAM frame, quarter stream ID and context ID overhead
+const (
+	masqueOuterPacketSize = 1350
+	masqueInnerPacketSize = 1200
+)
+
+// masqueTunnelCount gives every tunnel a distinct local address; quic-go keys
+// its packet conns by LocalAddr and refuses duplicates
+var masqueTunnelCount atomic.Uint64
+
+// MASQUEError is a failure on the proxy leg of a MASQUE tunnel (QUIC handshake or HTTP/3 setup)
+type MASQUEError struct {
+	ErrorType string
+	Err       error
+}
+
+func (e *MASQUEError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorType, e.Err.Error())
+}
+
+func (e *MASQUEError) Unwrap() error {
+	return e.Err
+}
+
+// IsMASQUE reports whether the proxy is an HTTP/3 MASQUE (CONNECT-UDP) proxy
+func IsMASQUE(proxy domain.ProxyConfig) bool {
+	return proxy.Protocol == domain.ProtocolMASQUE
+}
+
+// MASQUETiming breaks down how long a CONNECT-UDP tunnel took to open
+type MASQUETiming struct {
+	ProxyHandshake time.Duration        // QUIC + TLS 1.3 to the proxy
+	ConnectUDP     time.Duration        // SETTINGS exchange + extended CONNECT until 2xx
+	ProxyTLS       *tls.ConnectionState // proxy leg, set once the QUIC handshake succeeds
+}
+
+// MASQUETunnel is a CONNECT-UDP tunnel to one target UDP address through a MASQUE proxy.
+// It implements net.PacketConn so a QUIC connection to the target can run inside it;
+// every datagram is sent as an HTTP datagram with context ID 0.
+type MASQUETunnel struct {
+	proxyConn quic.Connection
+	str       http3.RequestStream
+	local     net.Addr
+	remote    net.Addr
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu           sync.Mutex
+	readDeadline time.Time
+	readCancel   context.CancelFunc
+}
+
+// masqueAddr is a UDP address as seen through the tunnel; the proxy resolves the target host
+type masqueAddr string
+
+func (a masqueAddr) Network() string { return "udp" }
+func (a masqueAddr) String() string  { return string(a) }
+
+// OpenMASQUETunnel dials the proxy over QUIC and opens a CONNECT-UDP tunnel to targetHost:targetPort.
+// Timing is returned even on failure, up to and including the failing step.
+func OpenMASQUETunnel(ctx context.Context, proxy domain.ProxyConfig, targetHost string, targetPort int, timeout time.Duration, logger *slog.Logger) (*MASQUETunnel, MASQUETiming, error) {
+	var timing MASQUETiming
+
+	dialCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Step 1: QUIC handshake to the proxy
+	proxyAddr := hostPort(proxy.Host, proxy.Port)
+	start := time.Now()
+	proxyConn, err := quic.DialAddr(dialCtx, proxyAddr, &tls.Config{
+		ServerName:         proxy.Host,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http3.NextProtoH3},
+	}, &quic.Config{
+		EnableDatagrams:      true,
+		InitialPacketSize:    masqueOuterPacketSize,
+		HandshakeIdleTimeout: timeout,
+	})
+	timing.ProxyHandshake = time.Since(start)
+	if err != nil {
+		return nil, timing, &MASQUEError{ErrorType: classifyQUICError(err, "proxy_quic_handshake_failed"), Err: err}
+	}
+	proxyState := proxyConn.ConnectionState().TLS
+	timing.ProxyTLS = &proxyState
+
+	logger.Debug("MASQUE proxy handshake success",
+		"proxy_addr", proxyAddr,
+		"proxy_quic_handshake_ms", durationMS(timing.ProxyHandshake),
+	)
+
+	// Step 2: wait for SETTINGS, then extended CONNECT with :protocol=connect-udp
+	start = time.Now()
+	udpHost, err := pinFamily(dialCtx, targetHost, proxy.IPFamily)
+	if err != nil {
+		proxyConn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")
+		return nil, timing, &MASQUEError{ErrorType: "address_family_unavailable", Err: err}
+	}
+	str, err := connectUDP(dialCtx, proxyConn, proxy, udpHost, targetPort)
+	timing.ConnectUDP = time.Since(start)
+	if err != nil {
+		proxyConn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")
+		return nil, timing, err
+	}
+
+	logger.Debug("MASQUE CONNECT-UDP success",
+		"target_host", targetHost,
+		"target_port", targetPort,
+		"connect_udp_ms", durationMS(timing.ConnectUDP),
+	)
+
+	tunnelCtx, tunnelCancel := context.WithCancel(context.Background())
+	return &MASQUETunnel{
+		proxyConn: proxyConn,
+		str:       str,
+		local:     masqueAddr(fmt.Sprintf("%s#%d", proxyConn.LocalAddr(), masqueTunnelCount.Add(1))),
+		remote:    masqueAddr(hostPort(targetHost, targetPort)),
+		ctx:       tunnelCtx,
+		cancel:    tunnelCancel,
+	}, timing, nil
+}
+
+// H3TargetAddr splits an HTTP/3 target URL into host and UDP port (443 when absent)
+func H3TargetAddr(rawURL string) (string, int, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", 0, err
+	}
+	if u.Hostname() == "" {
+		return "", 0, fmt.Errorf("http3 target url %q has no host", rawURL)
+	}
+	port := 443
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return "", 0, err
+		}
+	}
+	return u.Hostname(), port, nil
+}
+
+// CheckMASQUE opens and closes one CONNECT-UDP tunnel to the HTTP/3 target (connectivity check).
+// Returns the QUIC handshake plus CONNECT-UDP duration.
+func CheckMASQUE(ctx context.Context, proxy domain.ProxyConfig, targetURL string, timeout time.Duration, logger *slog.Logger) (time.Duration, error) {
+	host, port, err := H3TargetAddr(targetURL)
+	if err != nil {
+		return 0, err
+	}
+	tunnel, timing, err := OpenMASQUETunnel(ctx, proxy, host, port, timeout, logger)
+	if err != nil {
+		return timing.ProxyHandshake + timing.ConnectUDP, err
+	}
+	tunnel.Close()
+	return timing.ProxyHandshake + timing.ConnectUDP, nil
+}
+
+func connectUDP(ctx context.Context, proxyConn quic.Connection, proxy domain.ProxyConfig, targetHost string, targetPort int) (http3.RequestStream, error) {
+	cc := (&http3.Transport{EnableDatagrams: true}).NewClientConn(proxyConn)
+	select {
+	case <-cc.ReceivedSettings():
+	case <-ctx.Done():
+		return nil, &MASQUEError{ErrorType: "timeout", Err: ctx.Err()}
+	}
+	settings := cc.Settings()
+	if !settings.EnableExtendedConnect || !settings.EnableDatagrams {
+		return nil, &MASQUEError{
+			ErrorType: "masque_unsupported",
+			Err:       fmt.Errorf("proxy settings: extended_connect=%t datagrams=%t", settings.EnableExtendedConnect, settings.EnableDatagrams),
+		}
+	}
+
+	str, err := cc.OpenRequestStream(ctx)
+	if err != nil {
+		return nil, &MASQUEError{ErrorType: classifyQUICError(err, "connect_tunnel_failed"), Err: err}
+	}
+
+	// IPv6 literals keep their colons percent-encoded inside the path segment
+	authority := hostPort(proxy.Host, proxy.Port)
+	escapedHost := strings.ReplaceAll(url.PathEscape(targetHost), ":", "%3A")
+	u, err := url.Parse(fmt.Sprintf("https://%s%s%s/%d/", authority, MASQUEUDPPathPrefix, escapedHost, targetPort))
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeRequestCanceled))
+		str.Close()
+		return nil, err
+	}
+	req := &http.Request{
+		Method: http.MethodConnect,
+		Proto:  "connect-udp",
+		Host:   authority,
+		URL:    u,
+		Header: http.Header{http3.CapsuleProtocolHeader: []string{"?1"}},
+	}
+	if proxy.AuthUser != "" {
+		req.Header.Set("Proxy-Authorization", "Basic "+basicAuth(sessionUser(proxy), proxy.AuthPass))
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		str.SetReadDeadline(deadline)
+	}
+	if err := str.SendRequestHeader(req); err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeRequestCanceled))
+		str.Close()
+		return nil, &MASQUEError{ErrorType: classifyQUICError(err, "connect_tunnel_failed"), Err: err}
+	}
+	resp, err := str.ReadResponse()
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeRequestCanceled))
+		str.Close()
+		return nil, &MASQUEError{ErrorType: classifyQUICError(err, "connect_tunnel_failed"), Err: err}
+	}
+	str.SetReadDeadline(time.Time{})
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		str.CancelRead(quic.StreamErrorCode(http3.ErrCodeNoError))
+		str.Close()
+		return nil, &ConnectError{ErrorType: classifyConnectError(resp.StatusCode), StatusCode: resp.StatusCode}
+	}
+	return str, nil
+}
+
+// ReadFrom returns the next context ID 0 datagram from the target
+func (t *MASQUETunnel) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		t.mu.Lock()
+		deadline := t.readDeadline
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			t.mu.Unlock()
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		ctx, cancel := context.WithCancel(t.ctx)
+		if !deadline.IsZero() {
+			ctx, cancel = context.WithDeadline(t.ctx, deadline)
+		}
+		t.readCancel = cancel
+		t.mu.Unlock()
+
+		data, err := t.str.ReceiveDatagram(ctx)
+		cancel()
+		if err != nil {
+			if t.ctx.Err() != nil {
+				return 0, nil, net.ErrClosed
+			}
+			if ctx.Err() != nil {
+				continue // deadline reached or moved; re-evaluated at the top
+			}
+			return 0, nil, err
+		}
+
+		contextID, n, err := quicvarint.Parse(data)
+		if err != nil || contextID != 0 {
+			continue // unknown contexts are dropped (RFC 9298 §4)
+		}
+		return copy(b, data[n:]), t.remote, nil
+	}
+}
+
+// WriteTo sends b to the target as a context ID 0 datagram; addr is ignored
+func (t *MASQUETunnel) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if t.ctx.Err() != nil {
+		return 0, net.ErrClosed
+	}
+	data := make([]byte, 0, len(b)+1)
+	data = append(data, 0) // context ID 0
+	data = append(data, b...)
+	if err := t.str.SendDatagram(data); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close tears down the CONNECT-UDP stream and the QUIC connection to the proxy
+func (t *MASQUETunnel) Close() error {
+	t.cancel()
+	t.str.CancelRead(quic.StreamErrorCode(http3.ErrCodeNoError))
+	t.str.Close()
+	return t.proxyConn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")
+}
+
+func (t *MASQUETunnel) LocalAddr() net.Addr { return t.local }
+
+// RemoteAddr is the target address the tunnel was opened to
+func (t *MASQUETunnel) RemoteAddr() net.Addr { return t.remote }
+
+func (t *MASQUETunnel) SetDeadline(d time.Time) error {
+	return t.SetReadDeadline(d)
+}
+
+// SetReadDeadline also wakes a blocked ReadFrom so quic-go can stop its read loop on close
+func (t *MASQUETunnel) SetReadDeadline(d time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.readDeadline = d
+	if t.readCancel != nil {
+		t.readCancel()
+	}
+	return nil
+}
+
+// SetWriteDeadline is a no-op: datagram sends never block
+func (t *MASQUETunnel) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// DialQUIC runs a QUIC handshake to the target inside the tunnel. The returned
+// transport must be closed after the connection, before the tunnel itself.
+func (t *MASQUETunnel) DialQUIC(ctx context.Context, tlsConf *tls.Config, timeout time.Duration) (quic.Connection, *quic.Transport, error) {
+	tr := &quic.Transport{Conn: t}
+	conn, err := tr.Dial(ctx, t.remote, tlsConf, &quic.Config{
+		InitialPacketSize:       masqueInnerPacketSize,
+		DisablePathMTUDiscovery: true,
+		HandshakeIdleTimeout:    timeout,
+	})
+	if err != nil {
+		tr.Close()
+		return nil, nil, err
+	}
+	return conn, tr, nil
+}
+
+// MASQUESession is an HTTP/3 connection to the target running inside a CONNECT-UDP tunnel
+type MASQUESession struct {
+	Tunnel    *MASQUETunnel
+	Timing    MASQUETiming
+	Conn      quic.Connection
+	Client    *http3.ClientConn
+	transport *quic.Transport
+}
+
+// DialMASQUESession opens a tunnel to targetHost:targetPort and completes the inner
+// QUIC handshake; the returned duration is that inner handshake.
+func DialMASQUESession(ctx context.Context, proxy domain.ProxyConfig, targetHost string, targetPort int, timeout time.Duration, logger *slog.Logger) (*MASQUESession, time.Duration, error) {
+	tunnel, timing, err := OpenMASQUETunnel(ctx, proxy, targetHost, targetPort, timeout, logger)
+	if err != nil {
+		return &MASQUESession{Timing: timing}, 0, err
+	}
+
+	hsCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	conn, tr, err := tunnel.DialQUIC(hsCtx, &tls.Config{
+		ServerName:         targetHost,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{http3.NextProtoH3},
+	}, timeout)
+	handshake := time.Since(start)
+	if err != nil {
+		tunnel.Close()
+		return &MASQUESession{Timing: timing}, handshake, err
+	}
+
+	return &MASQUESession{
+		Tunnel:    tunnel,
+		Timing:    timing,
+		Conn:      conn,
+		Client:    (&http3.Transport{}).NewClientConn(conn),
+		transport: tr,
+	}, handshake, nil
+}
+
+// Close shuts down the inner connection, then the tunnel
+func (s *MASQUESession) Close() error {
+	s.Conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")
+	s.transport.Close()
+	return s.Tunnel.Close()
+}
+
+// masqueRoundTripper sends each request over a fresh MASQUE session (IP checks, bursts)
+type masqueRoundTripper struct {
+	proxy   domain.ProxyConfig
+	timeout time.Duration
+	logger  *slog.Logger
+}
+
+// NewMASQUETransport returns an http.RoundTripper for https:// URLs served over HTTP/3,
+// reached through the MASQUE proxy. Each request uses its own tunnel.
+func NewMASQUETransport(proxy domain.ProxyConfig, timeout time.Duration, logger *slog.Logger) http.RoundTripper {
+	return &masqueRoundTripper{proxy: proxy, timeout: timeout, logger: logger}
+}
+
+func (rt *masqueRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, port, err := H3TargetAddr(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	sess, _, err := DialMASQUESession(req.Context(), rt.proxy, host, port, rt.timeout, rt.logger)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sess.Client.RoundTrip(req)
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+	resp.Body = &sessionBody{ReadCloser: resp.Body, sess: sess}
+	return resp, nil
+}
+
+// sessionBody closes the MASQUE session along with the response body
+type sessionBody struct {
+	io.ReadCloser
+	sess *MASQUESession
+	once sync.Once
+}
+
+func (b *sessionBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.sess.Close() })
+	return err
+}
+
+// classifyQUICError maps QUIC and HTTP/3 errors to error types; fallback covers handshake/setup failures
+func classifyQUICError(err error, fallback string) string {
+	var idleErr *quic.IdleTimeoutError
+	var hsTimeoutErr *quic.HandshakeTimeoutError
+	var appErr *quic.ApplicationError
+	var streamErr *quic.StreamError
+	switch {
+	case errors.As(err, &idleErr) || errors.As(err, &hsTimeoutErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &streamErr):
+		return "h3_stream_reset"
+	case errors.As(err, &appErr):
+		return "h3_connection_closed"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection_refused"
+	default:
+		return fallback
+	}
+}
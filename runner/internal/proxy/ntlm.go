@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM (MS-NLMP) client messages for proxy authentication. Only NTLMv2 responses are
+// produced; the session key, signing and sealing are not needed to get through a proxy.
+
+const (
+	ntlmNegotiateUnicode          = 0x00000001
+	ntlmNegotiateOEM              = 0x00000002
+	ntlmRequestTarget             = 0x00000004
+	ntlmNegotiateNTLM             = 0x00000200
+	ntlmNegotiateAlwaysSign       = 0x00008000
+	ntlmNegotiateExtendedSecurity = 0x00080000
+	ntlmNegotiateTargetInfo       = 0x00800000
+	ntlmNegotiate128              = 0x20000000
+	ntlmNegotiate56               = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmNegotiateOEM | ntlmRequestTarget |
+		ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSecurity |
+		ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+
+	ntlmAvTimestamp = 7 // MsvAvTimestamp in the challenge's target info
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiateMessage builds the type 1 message that opens the handshake
+func ntlmNegotiateMessage() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	// Empty domain and workstation fields point just past the header
+	binary.LittleEndian.PutUint32(msg[20:], 32)
+	binary.LittleEndian.PutUint32(msg[28:], 32)
+	return msg
+}
+
+// ntlmChallenge is the part of the proxy's type 2 message the response depends on
+type ntlmChallenge struct {
+	serverChallenge []byte
+	targetInfo      []byte
+}
+
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) || binary.LittleEndian.Uint32(msg[8:]) != 2 {
+		return nil, errors.New("ntlm: malformed challenge message")
+	}
+	c := &ntlmChallenge{serverChallenge: msg[24:32]}
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, errors.New("ntlm: target info out of range")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+// ntlmAuthenticateMessage answers challenge with a type 3 message carrying NTLMv2
+// responses. The domain may be given in the user name as DOMAIN\user.
+func ntlmAuthenticateMessage(challenge *ntlmChallenge, user, pass string) ([]byte, error) {
+	domain := ""
+	if d, u, ok := strings.Cut(user, `\`); ok {
+		domain, user = d, u
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+	timestamp, fromServer := ntlmTimestamp(challenge.targetInfo)
+	ntResponse, lmResponse := ntlmV2Responses(user, pass, domain, challenge.serverChallenge, clientChallenge, timestamp, challenge.targetInfo)
+	if fromServer {
+		// MS-NLMP 3.1.5.1.2: with a server timestamp the LMv2 response is zeroed
+		lmResponse = make([]byte, 24)
+	}
+
+	// Header (64 bytes), then the payload fields in order
+	fields := [][]byte{lmResponse, ntResponse, utf16LE(domain), utf16LE(user), nil, nil}
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	offset := len(msg)
+	for i, field := range fields {
+		at := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[at:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[at+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[at+4:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], ntlmNegotiateFlags&^ntlmNegotiateOEM)
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg, nil
+}
+
+// ntlmV2Responses computes the NTLMv2 and LMv2 responses (MS-NLMP 3.3.2)
+func ntlmV2Responses(user, pass, domain string, serverChallenge, clientChallenge, timestamp, targetInfo []byte) (nt, lm []byte) {
+	ntHash := md4.New()
+	ntHash.Write(utf16LE(pass))
+	responseKey := hmacMD5(ntHash.Sum(nil), utf16LE(strings.ToUpper(user)+domain))
+
+	blob := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	proof := hmacMD5(responseKey, append(append([]byte{}, serverChallenge...), blob...))
+	nt = append(proof, blob...)
+	lm = append(hmacMD5(responseKey, append(append([]byte{}, serverChallenge...), clientChallenge...)), clientChallenge...)
+	return nt, lm
+}
+
+// ntlmTimestamp returns the server's MsvAvTimestamp when present, otherwise the
+// current time, as a little-endian FILETIME
+func ntlmTimestamp(targetInfo []byte) ([]byte, bool) {
+	for info := targetInfo; len(info) >= 4; {
+		id := binary.LittleEndian.Uint16(info)
+		length := int(binary.LittleEndian.Uint16(info[2:]))
+		if len(info) < 4+length || id == 0 {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return info[4:12], true
+		}
+		info = info[4+length:]
+	}
+
+	// FILETIME counts 100ns intervals since 1601-01-01
+	filetime := uint64(time.Now().UnixNano()/100) + 116444736000000000
+	ts := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ts, filetime)
+	return ts, false
+}
+
+func hmacMD5(key, data []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func utf16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
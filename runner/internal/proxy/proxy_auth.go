@@ -0,0 +1,520 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Proxy-Authorization schemes the runner can answer. When a 407 offers several, Digest
+// wins over NTLM (one round trip, no connection affinity) and NTLM over Basic.
+const (
+	AuthSchemeBasic  = "basic"
+	AuthSchemeDigest = "digest"
+	AuthSchemeNTLM   = "ntlm"
+)
+
+// maxAuthAttempts bounds the 407 loop: a rejected preemptive Basic followed by the
+// NTLM negotiate/authenticate pair is the longest legitimate exchange
+const maxAuthAttempts = 4
+
+var authSchemeRank = map[string]int{
+	AuthSchemeDigest: 0,
+	AuthSchemeNTLM:   1,
+	AuthSchemeBasic:  2,
+}
+
+// AuthResult describes how a request got past the proxy's authentication
+type AuthResult struct {
+	Scheme     string        // scheme of the last Proxy-Authorization sent; empty without credentials
+	RoundTrips int           // extra requests caused by 407 challenges
+	Extra      time.Duration // time spent on those extra requests
+}
+
+// proxyAuth holds the credentials and negotiated state for one proxy. It is shared by
+// every request to that proxy, so once Digest is negotiated later requests reuse the
+// nonce and skip the challenge round trip until the proxy marks it stale.
+type proxyAuth struct {
+	user string
+	pass string
+
+	mu     sync.Mutex
+	scheme string         // scheme the proxy last challenged with; "" until the first 407
+	digest *authChallenge // last Digest challenge
+	nc     uint32         // nonce count for digest
+}
+
+var proxyAuths sync.Map // host:port|user|pass → *proxyAuth
+
+// proxyAuthFor returns the shared negotiation state for proxy, or nil without credentials.
+// Each sticky session username gets its own state.
+func proxyAuthFor(proxy domain.ProxyConfig) *proxyAuth {
+	if proxy.AuthUser == "" {
+		return nil
+	}
+	user := sessionUser(proxy)
+	key := fmt.Sprintf("%s:%d|%s|%s", proxy.Host, proxy.Port, user, proxy.AuthPass)
+	auth, _ := proxyAuths.LoadOrStore(key, &proxyAuth{user: user, pass: proxy.AuthPass})
+	return auth.(*proxyAuth)
+}
+
+// ProxyAuthError is returned when the proxy demands an auth scheme the request's path
+// cannot answer
+type ProxyAuthError struct {
+	ErrorType string
+	Scheme    string
+}
+
+func (e *ProxyAuthError) Error() string {
+	return fmt.Sprintf("%s: %s needs every leg on one connection", e.ErrorType, e.Scheme)
+}
+
+// authExchange is one request's walk through the challenge/response loop
+type authExchange struct {
+	auth   *proxyAuth
+	method string
+	uri    string
+	pinned bool            // every attempt goes over the same connection
+	noNTLM bool            // the proxy offered NTLM but the exchange is not pinned
+	scheme string          // scheme of the header sent on the current attempt
+	cached bool            // the Digest header reused a remembered nonce
+	ntlm   bool            // an NTLM negotiate message is awaiting its challenge
+	tried  map[string]bool // schemes already answered from a fresh challenge
+}
+
+// first returns the Proxy-Authorization for the first attempt: the remembered scheme,
+// or preemptive Basic while the proxy has not challenged yet. ok is false when the
+// remembered scheme is NTLM and the exchange is not pinned to one connection.
+func (x *authExchange) first() (authz string, ok bool) {
+	a := x.auth
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.scheme == AuthSchemeDigest && a.digest != nil:
+		a.nc++
+		x.scheme, x.cached = AuthSchemeDigest, true
+		return digestAuthorization(a.digest, a.user, a.pass, x.method, x.uri, a.nc, newCnonce()), true
+	case a.scheme == AuthSchemeNTLM && !x.pinned:
+		x.scheme, x.noNTLM = AuthSchemeNTLM, true
+		return "", false
+	case a.scheme == AuthSchemeNTLM:
+		x.scheme, x.ntlm = AuthSchemeNTLM, true
+		x.tried[AuthSchemeNTLM] = true
+		return "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()), true
+	default:
+		x.scheme = AuthSchemeBasic
+		x.tried[AuthSchemeBasic] = true
+		return "Basic " + basicAuth(a.user, a.pass), true
+	}
+}
+
+// next answers a 407. ok is false when the proxy offers nothing left to try, which
+// means the credentials were refused.
+func (x *authExchange) next(resp *http.Response) (authz string, ok bool) {
+	challenges := parseChallenges(resp.Header.Values("Proxy-Authenticate"))
+	a := x.auth
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// An NTLM negotiate is answered on the same connection with the server challenge
+	if x.ntlm {
+		x.ntlm = false
+		for _, c := range challenges {
+			if c.scheme != AuthSchemeNTLM || c.token == "" {
+				continue
+			}
+			raw, err := base64.StdEncoding.DecodeString(c.token)
+			if err != nil {
+				return "", false
+			}
+			challenge, err := parseNTLMChallenge(raw)
+			if err != nil {
+				return "", false
+			}
+			msg, err := ntlmAuthenticateMessage(challenge, a.user, a.pass)
+			if err != nil {
+				return "", false
+			}
+			return "NTLM " + base64.StdEncoding.EncodeToString(msg), true
+		}
+		return "", false
+	}
+
+	for _, c := range challenges {
+		switch c.scheme {
+		case AuthSchemeDigest:
+			// A rejected Digest built from a fresh nonce means wrong credentials
+			stale := strings.EqualFold(c.params["stale"], "true")
+			if x.tried[AuthSchemeDigest] && !stale || !digestSupported(c) {
+				continue
+			}
+			a.scheme, a.digest, a.nc = AuthSchemeDigest, c, 1
+			x.scheme, x.cached = AuthSchemeDigest, false
+			x.tried[AuthSchemeDigest] = true
+			return digestAuthorization(c, a.user, a.pass, x.method, x.uri, a.nc, newCnonce()), true
+		case AuthSchemeNTLM:
+			if x.tried[AuthSchemeNTLM] {
+				continue
+			}
+			if !x.pinned {
+				// The authenticate message must follow the negotiate on its connection
+				x.noNTLM = true
+				continue
+			}
+			a.scheme = AuthSchemeNTLM
+			x.scheme, x.ntlm = AuthSchemeNTLM, true
+			x.tried[AuthSchemeNTLM] = true
+			return "NTLM " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()), true
+		case AuthSchemeBasic:
+			if x.tried[AuthSchemeBasic] {
+				continue
+			}
+			a.scheme = AuthSchemeBasic
+			x.scheme = AuthSchemeBasic
+			x.tried[AuthSchemeBasic] = true
+			return "Basic " + basicAuth(a.user, a.pass), true
+		}
+	}
+	return "", false
+}
+
+// negotiateProxyAuth sends a request through send, answering 407 challenges until the
+// proxy accepts, runs out of schemes to offer, or maxAuthAttempts is reached; the last
+// response is returned either way. send receives the Proxy-Authorization for the attempt
+// ("" without credentials) and reports whether another attempt can follow. pinned says
+// every attempt goes over the same connection; without it a proxy that only offers NTLM
+// gets a *ProxyAuthError instead of a handshake split across pooled connections.
+func negotiateProxyAuth(auth *proxyAuth, method, uri string, pinned bool, send func(authz string) (*http.Response, bool, error)) (*http.Response, AuthResult, error) {
+	var res AuthResult
+	if auth == nil {
+		resp, _, err := send("")
+		return resp, res, err
+	}
+
+	x := &authExchange{auth: auth, method: method, uri: uri, pinned: pinned, tried: make(map[string]bool)}
+	authz, ok := x.first()
+	if !ok {
+		res.Scheme = x.scheme
+		return nil, res, &ProxyAuthError{ErrorType: "proxy_auth_unsupported", Scheme: AuthSchemeNTLM}
+	}
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, retry, err := send(authz)
+		if attempt > 0 {
+			res.RoundTrips++
+			res.Extra += time.Since(start)
+		}
+		res.Scheme = x.scheme
+		if err != nil {
+			return nil, res, err
+		}
+		if resp.StatusCode != http.StatusProxyAuthRequired || !retry || attempt+1 >= maxAuthAttempts {
+			return resp, res, nil
+		}
+
+		next, ok := x.next(resp)
+		if !ok && x.noNTLM {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			res.Scheme = AuthSchemeNTLM
+			return nil, res, &ProxyAuthError{ErrorType: "proxy_auth_unsupported", Scheme: AuthSchemeNTLM}
+		}
+		if !ok {
+			return resp, res, nil
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		authz = next
+	}
+}
+
+// httpConnect sends CONNECT for target over conn, answering 407 challenges on the same
+// connection. The returned response's body is already closed.
+func httpConnect(conn net.Conn, target string, proxy domain.ProxyConfig) (*http.Response, AuthResult, error) {
+	reader := bufio.NewReader(conn)
+	resp, res, err := negotiateProxyAuth(proxyAuthFor(proxy), http.MethodConnect, target, true, func(authz string) (*http.Response, bool, error) {
+		connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+		if authz != "" {
+			connectReq += fmt.Sprintf("Proxy-Authorization: %s\r\nProxy-Connection: Keep-Alive\r\n", authz)
+		}
+		connectReq += "\r\n"
+
+		if _, err := conn.Write([]byte(connectReq)); err != nil {
+			return nil, false, fmt.Errorf("write: %w", err)
+		}
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			return nil, false, fmt.Errorf("read: %w", err)
+		}
+		return resp, !resp.Close, nil
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return resp, res, err
+}
+
+// forwardTransport handles plain-HTTP requests forwarded by an HTTP(S) proxy: it pins the
+// target to the run's IP family and answers 407 challenges. Requests to https targets are
+// tunneled, and do both in the dial.
+type forwardTransport struct {
+	base  http.RoundTripper
+	proxy domain.ProxyConfig
+}
+
+// WithForwardProxy wraps a NewTransport transport so forwarded requests authenticate to
+// the proxy and honour the run's IP family. SOCKS proxies, which tunnel everything, and
+// proxies with neither credentials nor a family preference get rt back unchanged.
+func WithForwardProxy(rt http.RoundTripper, proxy domain.ProxyConfig) http.RoundTripper {
+	pinned := proxy.IPFamily != "" && proxy.IPFamily != domain.IPFamilyAuto
+	if IsSOCKS(proxy) || (proxy.AuthUser == "" && !pinned) {
+		return rt
+	}
+	return &forwardTransport{base: rt, proxy: proxy}
+}
+
+func (t *forwardTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" {
+		return t.base.RoundTrip(req)
+	}
+
+	// Name the target by address so the proxy cannot pick the other family;
+	// the Host header keeps the original name
+	host, err := pinFamily(req.Context(), req.URL.Hostname(), t.proxy.IPFamily)
+	if err != nil {
+		return nil, err
+	}
+	if host != req.URL.Hostname() {
+		pinned := req.Clone(req.Context())
+		pinned.Host = req.Host
+		if pinned.Host == "" {
+			pinned.Host = req.URL.Host
+		}
+		pinned.URL.Host = host
+		if port := req.URL.Port(); port != "" {
+			pinned.URL.Host = net.JoinHostPort(host, port)
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			pinned.URL.Host = "[" + host + "]"
+		}
+		req = pinned
+	}
+
+	// Retries need a fresh copy of the body; requests without GetBody get one attempt.
+	// Attempts go through the pool and may land on different connections, so NTLM is
+	// refused rather than split across them.
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	attempt := 0
+	resp, res, err := negotiateProxyAuth(proxyAuthFor(t.proxy), req.Method, req.URL.String(), false, func(authz string) (*http.Response, bool, error) {
+		r := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, false, err
+			}
+			r.Body = body
+		}
+		attempt++
+		if authz != "" {
+			r.Header.Set("Proxy-Authorization", authz)
+		}
+
+		resp, err := t.base.RoundTrip(r)
+		if err != nil {
+			return nil, false, err
+		}
+		return resp, replayable, nil
+	})
+	if tr := dialTraceFrom(req.Context()); tr != nil {
+		tr.auth = res
+	}
+	return resp, err
+}
+
+// authChallenge is one challenge from a Proxy-Authenticate header
+type authChallenge struct {
+	scheme string            // lower-cased
+	token  string            // token68 form (NTLM messages)
+	params map[string]string // auth-param form, lower-cased names
+}
+
+// parseChallenges splits Proxy-Authenticate values into challenges, ordered by
+// authSchemeRank. A single value may carry several comma-separated challenges.
+func parseChallenges(values []string) []*authChallenge {
+	var challenges []*authChallenge
+	var cur *authChallenge
+	for _, v := range values {
+		cur = nil
+		for _, part := range splitQuoted(v) {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			i := strings.IndexAny(part, " =")
+			if i > 0 && part[i] == '=' && cur != nil && !isToken68Padding(part[i:]) {
+				cur.params[strings.ToLower(part[:i])] = unquoteParam(part[i+1:])
+				continue
+			}
+
+			// A new challenge: scheme, then either a token68 or its first auth-param
+			cur = &authChallenge{scheme: strings.ToLower(part), params: make(map[string]string)}
+			challenges = append(challenges, cur)
+			if i <= 0 || part[i] != ' ' {
+				continue
+			}
+			cur.scheme = strings.ToLower(part[:i])
+			rest := strings.TrimSpace(part[i:])
+			if name, value, found := strings.Cut(rest, "="); found && !isToken68Padding("="+value) {
+				cur.params[strings.ToLower(strings.TrimSpace(name))] = unquoteParam(value)
+			} else {
+				cur.token = rest
+			}
+		}
+	}
+
+	sort.SliceStable(challenges, func(i, j int) bool {
+		ri, ok := authSchemeRank[challenges[i].scheme]
+		if !ok {
+			ri = len(authSchemeRank)
+		}
+		rj, ok := authSchemeRank[challenges[j].scheme]
+		if !ok {
+			rj = len(authSchemeRank)
+		}
+		return ri < rj
+	})
+	return challenges
+}
+
+// isToken68Padding reports whether s (starting at an '=') is only base64 padding
+func isToken68Padding(s string) bool {
+	return strings.Trim(s, "=") == ""
+}
+
+// splitQuoted splits s on commas outside quoted strings
+func splitQuoted(s string) []string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unquoteParam(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func quoteParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// digestSupported reports whether the challenge uses an algorithm and qop this client
+// implements (RFC 7616 MD5/SHA-256, optionally -sess, with qop=auth or legacy no-qop)
+func digestSupported(c *authChallenge) bool {
+	if c.params["nonce"] == "" {
+		return false
+	}
+	switch strings.ToLower(c.params["algorithm"]) {
+	case "", "md5", "md5-sess", "sha-256", "sha-256-sess":
+	default:
+		return false
+	}
+	qop, ok := c.params["qop"]
+	return !ok || digestQopAuth(qop)
+}
+
+func digestQopAuth(qop string) bool {
+	for _, q := range strings.Split(qop, ",") {
+		if strings.EqualFold(strings.TrimSpace(q), "auth") {
+			return true
+		}
+	}
+	return false
+}
+
+// newCnonce returns a random client nonce for a Digest response
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// digestAuthorization builds the RFC 7616 response to challenge for one request
+func digestAuthorization(c *authChallenge, user, pass, method, uri string, nc uint32, cnonce string) string {
+	algorithm := c.params["algorithm"]
+	var newHash func() hash.Hash = md5.New
+	if strings.HasPrefix(strings.ToLower(algorithm), "sha-256") {
+		newHash = sha256.New
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	realm, nonce := c.params["realm"], c.params["nonce"]
+
+	ha1 := h(user + ":" + realm + ":" + pass)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Digest username=%s, realm=%s, nonce=%s, uri=%s",
+		quoteParam(user), quoteParam(realm), quoteParam(nonce), quoteParam(uri))
+	if qop, ok := c.params["qop"]; ok && digestQopAuth(qop) {
+		ncValue := fmt.Sprintf("%08x", nc)
+		response := h(ha1 + ":" + nonce + ":" + ncValue + ":" + cnonce + ":auth:" + ha2)
+		fmt.Fprintf(&b, ", qop=auth, nc=%s, cnonce=%s, response=%s", ncValue, quoteParam(cnonce), quoteParam(response))
+	} else {
+		fmt.Fprintf(&b, ", response=%s", quoteParam(h(ha1+":"+nonce+":"+ha2)))
+	}
+	if algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", algorithm)
+	}
+	if opaque, ok := c.params["opaque"]; ok {
+		fmt.Fprintf(&b, ", opaque=%s", quoteParam(opaque))
+	}
+	return b.String()
+}
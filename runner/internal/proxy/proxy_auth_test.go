@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChallenges(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []authChallenge
+	}{
+		{
+			name:   "basic",
+			values: []string{`Basic realm="proxy"`},
+			want:   []authChallenge{{scheme: "basic", params: map[string]string{"realm": "proxy"}}},
+		},
+		{
+			name: "rfc 7616 digest pair, sha-256 listed first",
+			values: []string{
+				`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+				`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			},
+			want: []authChallenge{
+				{scheme: "digest", params: map[string]string{
+					"realm": "http-auth@example.org", "qop": "auth, auth-int", "algorithm": "SHA-256",
+					"nonce": "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "opaque": "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+				}},
+				{scheme: "digest", params: map[string]string{
+					"realm": "http-auth@example.org", "qop": "auth, auth-int", "algorithm": "MD5",
+					"nonce": "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "opaque": "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+				}},
+			},
+		},
+		{
+			name:   "several challenges in one value are ranked digest, ntlm, basic",
+			values: []string{`Basic realm="p", NTLM, Digest realm="p", nonce="n\"x", Negotiate`},
+			want: []authChallenge{
+				{scheme: "digest", params: map[string]string{"realm": "p", "nonce": `n"x`}},
+				{scheme: "ntlm", params: map[string]string{}},
+				{scheme: "basic", params: map[string]string{"realm": "p"}},
+				{scheme: "negotiate", params: map[string]string{}},
+			},
+		},
+		{
+			name:   "ntlm token68 keeps its padding",
+			values: []string{"NTLM TlRMTVNTUAACAAAADAAMADAAAAA=="},
+			want:   []authChallenge{{scheme: "ntlm", token: "TlRMTVNTUAACAAAADAAMADAAAAA==", params: map[string]string{}}},
+		},
+		{
+			name:   "scheme names and param names are lower-cased",
+			values: []string{`DIGEST Realm="R", NONCE=abc, Stale=TRUE`},
+			want:   []authChallenge{{scheme: "digest", params: map[string]string{"realm": "R", "nonce": "abc", "stale": "TRUE"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseChallenges(tt.values)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d challenges, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !reflect.DeepEqual(*got[i], tt.want[i]) {
+					t.Errorf("challenge %d: got %+v, want %+v", i, *got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// RFC 7616 section 3.9.1
+const (
+	rfcUser   = "Mufasa"
+	rfcPass   = "Circle of Life"
+	rfcURI    = "/dir/index.html"
+	rfcCnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	rfcNonce  = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	rfcOpaque = "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			c := parseChallenges([]string{
+				`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=` + tt.algorithm +
+					`, nonce="` + rfcNonce + `", opaque="` + rfcOpaque + `"`,
+			})[0]
+			if !digestSupported(c) {
+				t.Fatal("challenge not supported")
+			}
+			got := digestAuthorization(c, rfcUser, rfcPass, http.MethodGet, rfcURI, 1, rfcCnonce)
+			want := `Digest username="Mufasa", realm="http-auth@example.org", nonce="` + rfcNonce +
+				`", uri="/dir/index.html", qop=auth, nc=00000001, cnonce="` + rfcCnonce +
+				`", response="` + tt.response + `", algorithm=` + tt.algorithm + `, opaque="` + rfcOpaque + `"`
+			if got != want {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDigestAuthorizationWithoutQop(t *testing.T) {
+	// RFC 2069 compatibility: response = H(HA1:nonce:HA2), no nc or cnonce
+	c := &authChallenge{scheme: "digest", params: map[string]string{"realm": "testrealm@host.com", "nonce": "dcd98b7102dd2f0e8b11d0f600bfb0c093"}}
+	got := digestAuthorization(c, "Mufasa", "CircleOfLife", http.MethodGet, "/dir/index.html", 1, "unused")
+	want := `Digest username="Mufasa", realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", response="1949323746fe6a43ef61f9606e7febea"`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestNegotiateProxyAuthRefusesUnpinnedNTLM(t *testing.T) {
+	tests := []struct {
+		name   string
+		pinned bool
+		offer  string
+		want   string // scheme of the second attempt, or "" for a ProxyAuthError
+	}{
+		{"unpinned ntlm only", false, "NTLM", ""},
+		{"unpinned ntlm falls back to basic", false, `NTLM, Basic realm="p"`, ""},
+		{"unpinned digest", false, `Digest realm="p", nonce="n"`, AuthSchemeDigest},
+		{"pinned ntlm", true, "NTLM", AuthSchemeNTLM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &proxyAuth{user: "u", pass: "p"}
+			var sent []string
+			_, res, err := negotiateProxyAuth(auth, http.MethodGet, "http://target/", tt.pinned, func(authz string) (*http.Response, bool, error) {
+				sent = append(sent, authz)
+				resp := &http.Response{StatusCode: http.StatusProxyAuthRequired, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}
+				if len(sent) == 1 {
+					resp.Header.Set("Proxy-Authenticate", tt.offer)
+				} else {
+					resp.StatusCode = http.StatusOK
+				}
+				return resp, true, nil
+			})
+
+			var authErr *ProxyAuthError
+			if tt.want == "" {
+				if !errors.As(err, &authErr) || authErr.ErrorType != "proxy_auth_unsupported" {
+					t.Fatalf("got error %v, want proxy_auth_unsupported", err)
+				}
+				if len(sent) != 1 {
+					t.Errorf("sent %d requests, want 1", len(sent))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Scheme != tt.want || res.RoundTrips != 1 {
+				t.Errorf("got scheme %q after %d round trips, want %q after 1", res.Scheme, res.RoundTrips, tt.want)
+			}
+		})
+	}
+}
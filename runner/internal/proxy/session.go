@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Residential providers pin an exit IP to a session ID carried in the username
+// (user-session-abc123); without one they rotate per request. In sticky mode every
+// dial presents the current session username, and a fresh session starts once the
+// previous one has been used for StickyMinutes.
+
+const (
+	DefaultStickyMinutes = 10
+	defaultSessionFormat = "{user}-session-{session}"
+)
+
+// Session is the sticky session a proxy username currently carries
+type Session struct {
+	ID      string
+	Started time.Time
+}
+
+type proxySession struct {
+	mu      sync.Mutex
+	current Session
+	runs    int // runs holding the session, guarded by sessionsMu
+}
+
+// Sticky sessions are shared by every tester dialing the same proxy and credentials,
+// and dropped once the last run using them ends
+var (
+	sessionsMu    sync.Mutex
+	proxySessions = make(map[string]*proxySession)
+)
+
+// IsSticky reports whether dials to proxy carry a generated session username
+func IsSticky(proxy domain.ProxyConfig) bool {
+	return proxy.Rotation.Mode == domain.RotationSticky && proxy.AuthUser != ""
+}
+
+// StickyDuration is how long one session is kept before a new one is generated
+func StickyDuration(proxy domain.ProxyConfig) time.Duration {
+	minutes := proxy.Rotation.StickyMinutes
+	if minutes <= 0 {
+		minutes = DefaultStickyMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// CurrentSession returns the proxy's live sticky session, starting a new one when the
+// previous one has run for StickyDuration. It is zero outside sticky mode.
+func CurrentSession(proxy domain.ProxyConfig) Session {
+	if !IsSticky(proxy) {
+		return Session{}
+	}
+	sessionsMu.Lock()
+	s := loadSession(proxy)
+	sessionsMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current.ID == "" || time.Since(s.current.Started) >= StickyDuration(proxy) {
+		s.current = Session{ID: newSessionID(), Started: time.Now()}
+	}
+	return s.current
+}
+
+// RetainSession marks a run as using proxy's sticky session until ReleaseSession
+func RetainSession(proxy domain.ProxyConfig) {
+	if !IsSticky(proxy) {
+		return
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	loadSession(proxy).runs++
+}
+
+// ReleaseSession ends a run's use of proxy's sticky session and forgets the session
+// once no run holds it
+func ReleaseSession(proxy domain.ProxyConfig) {
+	if !IsSticky(proxy) {
+		return
+	}
+	key := sessionKey(proxy)
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := proxySessions[key]
+	if !ok {
+		return
+	}
+	if s.runs--; s.runs <= 0 {
+		delete(proxySessions, key)
+	}
+}
+
+// loadSession returns proxy's session entry, creating it; callers hold sessionsMu
+func loadSession(proxy domain.ProxyConfig) *proxySession {
+	key := sessionKey(proxy)
+	s, ok := proxySessions[key]
+	if !ok {
+		s = &proxySession{}
+		proxySessions[key] = s
+	}
+	return s
+}
+
+// sessionKey identifies a proxy and its credentials without keeping the password
+func sessionKey(proxy domain.ProxyConfig) string {
+	pass := sha256.Sum256([]byte(proxy.AuthPass))
+	return fmt.Sprintf("%s:%d|%s|%x", proxy.Host, proxy.Port, proxy.AuthUser, pass[:8])
+}
+
+// sessionUser is the username to present to proxy: AuthUser, or in sticky mode the
+// session username built from Rotation.SessionFormat
+func sessionUser(proxy domain.ProxyConfig) string {
+	if !IsSticky(proxy) {
+		return proxy.AuthUser
+	}
+	format := proxy.Rotation.SessionFormat
+	if format == "" {
+		format = defaultSessionFormat
+	}
+	minutes := int(StickyDuration(proxy) / time.Minute)
+	return strings.NewReplacer(
+		"{user}", proxy.AuthUser,
+		"{session}", CurrentSession(proxy).ID,
+		"{minutes}", strconv.Itoa(minutes),
+	).Replace(format)
+}
+
+// newSessionID returns 10 lowercase hex characters; providers expect short alphanumeric IDs
+func newSessionID() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+func TestSessionReleasedWithLastRun(t *testing.T) {
+	cfg := domain.ProxyConfig{
+		Host:     "gw.example",
+		Port:     7777,
+		AuthUser: "user",
+		AuthPass: "secret-pass",
+		Rotation: domain.RotationConfig{Mode: domain.RotationSticky},
+	}
+	key := sessionKey(cfg)
+	if strings.Contains(key, cfg.AuthPass) {
+		t.Fatalf("session key %q holds the password", key)
+	}
+
+	RetainSession(cfg)
+	RetainSession(cfg)
+	first := CurrentSession(cfg)
+
+	ReleaseSession(cfg)
+	if got := CurrentSession(cfg); got != first {
+		t.Errorf("session changed while a run still holds it: %+v, want %+v", got, first)
+	}
+
+	ReleaseSession(cfg)
+	sessionsMu.Lock()
+	_, ok := proxySessions[key]
+	sessionsMu.Unlock()
+	if ok {
+		t.Error("session kept after the last run released it")
+	}
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// SOCKS4 protocol constants
+const (
+	socks4Version       = 0x04
+	socks4CmdConnect    = 0x01
+	socks4ReplyVersion  = 0x00
+	socks4Granted       = 0x5A
+	socks4Rejected      = 0x5B
+	socks4IdentdFailed  = 0x5C
+	socks4IdentdUserErr = 0x5D
+)
+
+// SOCKS4Connect sends a SOCKS4 (or SOCKS4a when remoteDNS is set) CONNECT
+// request on an already established connection and waits for the grant.
+// SOCKS4 has no password; AuthUser is sent as the USERID field.
+func SOCKS4Connect(conn net.Conn, targetHost string, targetPort int, remoteDNS bool, proxy domain.ProxyConfig, logger *slog.Logger) error {
+	target := net.JoinHostPort(targetHost, fmt.Sprintf("%d", targetPort))
+
+	req := []byte{socks4Version, socks4CmdConnect}
+	req = binary.BigEndian.AppendUint16(req, uint16(targetPort))
+
+	var hostname string
+	ip := net.ParseIP(targetHost)
+	switch {
+	case ip != nil && ip.To4() != nil:
+		req = append(req, ip.To4()...)
+	case ip != nil:
+		return &SOCKSError{ErrorType: "socks4_address_type_not_supported", Msg: "SOCKS4 cannot reach IPv6 targets"}
+	case remoteDNS:
+		// SOCKS4a: 0.0.0.x signals that the hostname follows the USERID
+		req = append(req, 0, 0, 0, 1)
+		hostname = targetHost
+	default:
+		// SOCKS4: the client has to resolve the target itself
+		addrs, err := net.LookupIP(targetHost)
+		if err != nil {
+			return &SOCKSError{ErrorType: "dns_resolution_failed", Msg: err.Error()}
+		}
+		var ip4 net.IP
+		for _, a := range addrs {
+			if ip4 = a.To4(); ip4 != nil {
+				break
+			}
+		}
+		if ip4 == nil {
+			return &SOCKSError{ErrorType: "socks4_address_type_not_supported", Msg: fmt.Sprintf("no IPv4 address for %s", targetHost)}
+		}
+		req = append(req, ip4...)
+	}
+
+	req = append(req, sessionUser(proxy)...)
+	req = append(req, 0x00)
+	if hostname != "" {
+		req = append(req, hostname...)
+		req = append(req, 0x00)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		return &SOCKSError{ErrorType: "socks4_handshake_failed", Msg: "write connect: " + err.Error()}
+	}
+
+	// Reply: VN CD DSTPORT DSTIP
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return &SOCKSError{ErrorType: "socks4_handshake_failed", Msg: "read reply: " + err.Error()}
+	}
+	if reply[0] != socks4ReplyVersion {
+		return &SOCKSError{ErrorType: "socks4_handshake_failed", Msg: fmt.Sprintf("unexpected reply version %d", reply[0])}
+	}
+	if reply[1] != socks4Granted {
+		errType, msg := classifySOCKS4Reply(reply[1])
+		logger.Error("SOCKS4 connect fail",
+			"target", target,
+			"reply_code", reply[1],
+			"error_type", errType,
+		)
+		return &SOCKSError{ErrorType: errType, Code: reply[1], Msg: msg}
+	}
+
+	logger.Debug("SOCKS4 connect success",
+		"target", target,
+		"remote_dns", remoteDNS,
+	)
+	return nil
+}
+
+// classifySOCKS4Reply maps a SOCKS4 CD field to an error type and message
+func classifySOCKS4Reply(code byte) (string, string) {
+	switch code {
+	case socks4Rejected:
+		return "socks4_rejected", "request rejected or failed"
+	case socks4IdentdFailed:
+		return "socks4_identd_unreachable", "client identd not reachable"
+	case socks4IdentdUserErr:
+		return "socks4_identd_mismatch", "identd could not confirm the user ID"
+	default:
+		return "socks4_rejected", fmt.Sprintf("unknown reply code 0x%02x", code)
+	}
+}
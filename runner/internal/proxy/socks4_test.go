@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"testing"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+func TestSOCKS4Connect(t *testing.T) {
+	granted := []byte{0x00, 0x5a, 0, 0, 0, 0, 0, 0}
+	ipv4Req := cat([]byte{0x04, 0x01, 0x1f, 0x90, 10, 1, 2, 3}, []byte("alice"), []byte{0x00})
+	socks4aReq := cat([]byte{0x04, 0x01, 0x01, 0xbb, 0, 0, 0, 1}, []byte("alice"), []byte{0x00}, []byte("target.example"), []byte{0x00})
+
+	tests := []struct {
+		name      string
+		host      string
+		port      int
+		remoteDNS bool
+		exchanges []exchange
+		wantErr   string
+	}{
+		{
+			name:      "ipv4 granted",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: granted}},
+		},
+		{
+			name:      "socks4a sends 0.0.0.1 and the hostname after the userid",
+			host:      "target.example",
+			port:      443,
+			remoteDNS: true,
+			exchanges: []exchange{{want: socks4aReq, reply: granted}},
+		},
+		{
+			name:      "rejected",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: []byte{0x00, 0x5b, 0, 0, 0, 0, 0, 0}}},
+			wantErr:   "socks4_rejected",
+		},
+		{
+			name:      "identd unreachable",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: []byte{0x00, 0x5c, 0, 0, 0, 0, 0, 0}}},
+			wantErr:   "socks4_identd_unreachable",
+		},
+		{
+			name:      "identd mismatch",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: []byte{0x00, 0x5d, 0, 0, 0, 0, 0, 0}}},
+			wantErr:   "socks4_identd_mismatch",
+		},
+		{
+			name:      "unknown reply code",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: []byte{0x00, 0x77, 0, 0, 0, 0, 0, 0}}},
+			wantErr:   "socks4_rejected",
+		},
+		{
+			name:      "bad reply version",
+			host:      "10.1.2.3",
+			port:      8080,
+			exchanges: []exchange{{want: ipv4Req, reply: []byte{0x04, 0x5a, 0, 0, 0, 0, 0, 0}}},
+			wantErr:   "socks4_handshake_failed",
+		},
+		{
+			name:    "ipv6 target is refused before anything is sent",
+			host:    "2001:db8::1",
+			port:    443,
+			wantErr: "socks4_address_type_not_supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, done := fakeProxy(t, tt.exchanges)
+			proxy := domain.ProxyConfig{AuthUser: "alice"}
+			err := SOCKS4Connect(conn, tt.host, tt.port, tt.remoteDNS, proxy, discardLogger)
+			if got := errorType(err); got != tt.wantErr || (tt.wantErr == "" && err != nil) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClassifySOCKS4Reply(t *testing.T) {
+	if _, msg := classifySOCKS4Reply(0x77); msg != "unknown reply code 0x77" {
+		t.Errorf("unknown code message: got %q", msg)
+	}
+}
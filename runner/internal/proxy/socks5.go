@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// SOCKS5 protocol constants (RFC 1928 / RFC 1929)
+const (
+	socks5Version      = 0x05
+	socks5AuthVersion  = 0x01
+	socks5MethodNoAuth = 0x00
+	socks5MethodUser   = 0x02
+	socks5MethodNone   = 0xFF
+	socks5CmdConnect   = 0x01
+	socks5CmdUDPAssoc  = 0x03
+	socks5AtypIPv4     = 0x01
+	socks5AtypDomain   = 0x03
+	socks5AtypIPv6     = 0x04
+	socks5ReplySuccess = 0x00
+)
+
+// SOCKSError is returned when a SOCKS proxy rejects the handshake or request.
+// ErrorType is the sample error_type reported for the failure.
+type SOCKSError struct {
+	ErrorType string
+	Code      byte
+	Msg       string
+}
+
+func (e *SOCKSError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorType, e.Msg)
+}
+
+// SOCKS5Connect performs the SOCKS5 greeting, optional username/password
+// sub-negotiation and CONNECT request on an already established connection
+func SOCKS5Connect(conn net.Conn, targetHost string, targetPort int, proxy domain.ProxyConfig, logger *slog.Logger) error {
+	target := net.JoinHostPort(targetHost, fmt.Sprintf("%d", targetPort))
+
+	if err := socks5Negotiate(conn, proxy, logger); err != nil {
+		return err
+	}
+	if _, _, err := socks5Request(conn, socks5CmdConnect, targetHost, targetPort, logger); err != nil {
+		return err
+	}
+
+	logger.Debug("SOCKS5 connect success",
+		"target", target,
+	)
+	return nil
+}
+
+// SOCKS5UDPAssociate negotiates a UDP relay on the control connection (RFC 1928 §7).
+// The relay stays valid only while conn is kept open.
+func SOCKS5UDPAssociate(conn net.Conn, proxy domain.ProxyConfig, logger *slog.Logger) (*net.UDPAddr, error) {
+	if err := socks5Negotiate(conn, proxy, logger); err != nil {
+		return nil, err
+	}
+
+	// The client does not know its outgoing UDP address yet, so it sends 0.0.0.0:0
+	bndHost, bndPort, err := socks5Request(conn, socks5CmdUDPAssoc, "0.0.0.0", 0, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Many proxies answer with an unspecified address meaning "same host as the control connection"
+	relayIP := net.ParseIP(bndHost)
+	if relayIP == nil || relayIP.IsUnspecified() {
+		relayIP = nil
+		if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			relayIP = tcpAddr.IP
+		}
+	}
+	if relayIP == nil {
+		ips, err := net.LookupIP(bndHost)
+		if err != nil || len(ips) == 0 {
+			return nil, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: fmt.Sprintf("cannot resolve UDP relay %q", bndHost)}
+		}
+		relayIP = ips[0]
+	}
+
+	relay := &net.UDPAddr{IP: relayIP, Port: bndPort}
+	logger.Debug("SOCKS5 UDP associate success",
+		"relay_addr", relay.String(),
+	)
+	return relay, nil
+}
+
+// socks5Negotiate runs the greeting and, if selected, username/password auth
+func socks5Negotiate(conn net.Conn, proxy domain.ProxyConfig, logger *slog.Logger) error {
+	// Greeting: offer username/password only when credentials are configured
+	methods := []byte{socks5MethodNoAuth}
+	if proxy.AuthUser != "" {
+		methods = append(methods, socks5MethodUser)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "write greeting: " + err.Error()}
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "read method selection: " + err.Error()}
+	}
+	if reply[0] != socks5Version {
+		return &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: fmt.Sprintf("unexpected version %d", reply[0])}
+	}
+
+	switch reply[1] {
+	case socks5MethodNoAuth:
+	case socks5MethodUser:
+		if err := socks5UserPassAuth(conn, proxy); err != nil {
+			logger.Error("SOCKS5 auth fail",
+				"error_type", err.ErrorType,
+				"error_detail", err.Msg,
+			)
+			return err
+		}
+	case socks5MethodNone:
+		return &SOCKSError{ErrorType: "socks5_no_acceptable_method", Code: reply[1], Msg: "proxy accepted none of the offered auth methods"}
+	default:
+		return &SOCKSError{ErrorType: "socks5_no_acceptable_method", Code: reply[1], Msg: fmt.Sprintf("proxy selected unsupported method 0x%02x", reply[1])}
+	}
+	return nil
+}
+
+// socks5Request sends a command request and returns the bound address from the reply
+func socks5Request(conn net.Conn, cmd byte, host string, port int, logger *slog.Logger) (string, int, error) {
+	req, err := socks5AppendAddr([]byte{socks5Version, cmd, 0x00}, host, port)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return "", 0, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "write request: " + err.Error()}
+	}
+
+	// Reply: VER REP RSV ATYP BND.ADDR BND.PORT
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", 0, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "read reply: " + err.Error()}
+	}
+	if header[0] != socks5Version {
+		return "", 0, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: fmt.Sprintf("unexpected reply version %d", header[0])}
+	}
+	if header[1] != socks5ReplySuccess {
+		errType, msg := classifySOCKS5Reply(header[1])
+		logger.Error("SOCKS5 request fail",
+			"target", net.JoinHostPort(host, fmt.Sprintf("%d", port)),
+			"command", cmd,
+			"reply_code", header[1],
+			"error_type", errType,
+		)
+		return "", 0, &SOCKSError{ErrorType: errType, Code: header[1], Msg: msg}
+	}
+
+	bndHost, bndPort, err := socks5ReadAddr(conn)
+	if err != nil {
+		return "", 0, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "read bound address: " + err.Error()}
+	}
+	return bndHost, bndPort, nil
+}
+
+// socks5AppendAddr appends ATYP, DST.ADDR and DST.PORT for host:port to buf.
+// Domain names are sent as-is so the proxy resolves them.
+func socks5AppendAddr(buf []byte, host string, port int) ([]byte, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			buf = append(buf, socks5AtypIPv4)
+			buf = append(buf, ip4...)
+		} else {
+			buf = append(buf, socks5AtypIPv6)
+			buf = append(buf, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "target host name too long"}
+		}
+		buf = append(buf, socks5AtypDomain, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	return binary.BigEndian.AppendUint16(buf, uint16(port)), nil
+}
+
+// socks5ReadAddr reads ATYP, ADDR and PORT from r
+func socks5ReadAddr(r io.Reader) (string, int, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", 0, err
+	}
+
+	var addrLen int
+	switch atyp[0] {
+	case socks5AtypIPv4:
+		addrLen = net.IPv4len
+	case socks5AtypIPv6:
+		addrLen = net.IPv6len
+	case socks5AtypDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(r, l); err != nil {
+			return "", 0, err
+		}
+		addrLen = int(l[0])
+	default:
+		return "", 0, fmt.Errorf("unknown address type %d", atyp[0])
+	}
+
+	buf := make([]byte, addrLen+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", 0, err
+	}
+	port := int(binary.BigEndian.Uint16(buf[addrLen:]))
+	if atyp[0] == socks5AtypDomain {
+		return string(buf[:addrLen]), port, nil
+	}
+	return net.IP(buf[:addrLen]).String(), port, nil
+}
+
+// socks5UserPassAuth runs the RFC 1929 username/password sub-negotiation
+func socks5UserPassAuth(conn net.Conn, proxy domain.ProxyConfig) *SOCKSError {
+	user := sessionUser(proxy)
+	if len(user) > 255 || len(proxy.AuthPass) > 255 {
+		return &SOCKSError{ErrorType: "proxy_auth_failed", Msg: "username or password too long"}
+	}
+
+	req := []byte{socks5AuthVersion, byte(len(user))}
+	req = append(req, user...)
+	req = append(req, byte(len(proxy.AuthPass)))
+	req = append(req, proxy.AuthPass...)
+	if _, err := conn.Write(req); err != nil {
+		return &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "write auth: " + err.Error()}
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return &SOCKSError{ErrorType: "socks5_handshake_failed", Msg: "read auth reply: " + err.Error()}
+	}
+	if reply[1] != 0x00 {
+		return &SOCKSError{ErrorType: "proxy_auth_failed", Code: reply[1], Msg: fmt.Sprintf("username/password rejected (status %d)", reply[1])}
+	}
+	return nil
+}
+
+// classifySOCKS5Reply maps a SOCKS5 REP field to an error type and message
+func classifySOCKS5Reply(code byte) (string, string) {
+	switch code {
+	case 0x01:
+		return "socks5_general_failure", "general SOCKS server failure"
+	case 0x02:
+		return "socks5_not_allowed", "connection not allowed by ruleset"
+	case 0x03:
+		return "socks5_network_unreachable", "network unreachable"
+	case 0x04:
+		return "socks5_host_unreachable", "host unreachable"
+	case 0x05:
+		return "socks5_connection_refused", "connection refused"
+	case 0x06:
+		return "socks5_ttl_expired", "TTL expired"
+	case 0x07:
+		return "socks5_command_not_supported", "command not supported"
+	case 0x08:
+		return "socks5_address_type_not_supported", "address type not supported"
+	default:
+		return "socks5_general_failure", fmt.Sprintf("unknown reply code 0x%02x", code)
+	}
+}
@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// exchange is one request the fake proxy expects byte for byte, and the reply it sends
+type exchange struct {
+	want  []byte
+	reply []byte
+}
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeProxy plays exchanges on the server end of a net.Pipe and returns the client end.
+// Mismatches are reported on the returned channel once the client is done.
+func fakeProxy(t *testing.T, exchanges []exchange) (net.Conn, <-chan error) {
+	t.Helper()
+	client, server := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	client.SetDeadline(deadline)
+	server.SetDeadline(deadline)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		defer server.Close()
+		for i, ex := range exchanges {
+			got := make([]byte, len(ex.want))
+			if _, err := io.ReadFull(server, got); err != nil {
+				done <- err
+				return
+			}
+			if !bytes.Equal(got, ex.want) {
+				done <- fmt.Errorf("request %d: got % x, want % x", i, got, ex.want)
+				return
+			}
+			if _, err := server.Write(ex.reply); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	return client, done
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// errorType returns the SOCKSError type of err, or "" if it is not one
+func errorType(err error) string {
+	var socksErr *SOCKSError
+	if errors.As(err, &socksErr) {
+		return socksErr.ErrorType
+	}
+	return ""
+}
+
+func TestSOCKS5AppendAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		port int
+		want []byte
+	}{
+		{"ipv4", "192.0.2.1", 80, []byte{0x01, 192, 0, 2, 1, 0x00, 0x50}},
+		{"ipv6", "2001:db8::1", 443, cat([]byte{0x04, 0x20, 0x01, 0x0d, 0xb8}, make([]byte, 11), []byte{0x01, 0x01, 0xbb})},
+		{"ipv4-mapped ipv6 goes as ipv4", "::ffff:10.0.0.1", 1080, []byte{0x01, 10, 0, 0, 1, 0x04, 0x38}},
+		{"domain", "example.com", 8080, cat([]byte{0x03, 11}, []byte("example.com"), []byte{0x1f, 0x90})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := socks5AppendAddr([]byte{0xaa}, tt.host, tt.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := cat([]byte{0xaa}, tt.want); !bytes.Equal(got, want) {
+				t.Errorf("got % x, want % x", got, want)
+			}
+		})
+	}
+
+	if _, err := socks5AppendAddr(nil, string(bytes.Repeat([]byte("a"), 256)), 80); errorType(err) != "socks5_handshake_failed" {
+		t.Errorf("256-byte host: got %v, want socks5_handshake_failed", err)
+	}
+}
+
+func TestSOCKS5ReadAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		wire     []byte
+		wantHost string
+		wantPort int
+	}{
+		{"ipv4", []byte{0x01, 203, 0, 113, 7, 0x1f, 0x90}, "203.0.113.7", 8080},
+		{"ipv6", cat([]byte{0x04, 0x20, 0x01, 0x0d, 0xb8}, make([]byte, 10), []byte{0x00, 0x02, 0x00, 0x35}), "2001:db8::2", 53},
+		{"domain", cat([]byte{0x03, 9}, []byte("relay.lan"), []byte{0x27, 0x10}), "relay.lan", 10000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				server.Write(tt.wire)
+				server.Close()
+			}()
+			host, port, err := socks5ReadAddr(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("got %s:%d, want %s:%d", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+
+	if _, _, err := socks5ReadAddr(bytes.NewReader([]byte{0x05, 0, 0})); err == nil {
+		t.Error("unknown address type: got nil error")
+	}
+	if _, _, err := socks5ReadAddr(bytes.NewReader([]byte{0x01, 10, 0})); err == nil {
+		t.Error("truncated address: got nil error")
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	boundOK := []byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0x00, 0x00}
+	connectReq := cat([]byte{0x05, 0x01, 0x00, 0x03, 6}, []byte("target"), []byte{0x0b, 0xb9})
+
+	tests := []struct {
+		name      string
+		proxy     domain.ProxyConfig
+		exchanges []exchange
+		wantErr   string
+	}{
+		{
+			name:  "no auth",
+			proxy: domain.ProxyConfig{},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x01, 0x00}, reply: []byte{0x05, 0x00}},
+				{want: connectReq, reply: boundOK},
+			},
+		},
+		{
+			name:  "username and password",
+			proxy: domain.ProxyConfig{AuthUser: "bob", AuthPass: "pw"},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x02, 0x00, 0x02}, reply: []byte{0x05, 0x02}},
+				{want: cat([]byte{0x01, 3}, []byte("bob"), []byte{2}, []byte("pw")), reply: []byte{0x01, 0x00}},
+				{want: connectReq, reply: boundOK},
+			},
+		},
+		{
+			name:  "credentials rejected",
+			proxy: domain.ProxyConfig{AuthUser: "bob", AuthPass: "pw"},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x02, 0x00, 0x02}, reply: []byte{0x05, 0x02}},
+				{want: cat([]byte{0x01, 3}, []byte("bob"), []byte{2}, []byte("pw")), reply: []byte{0x01, 0x01}},
+			},
+			wantErr: "proxy_auth_failed",
+		},
+		{
+			name:  "no acceptable method",
+			proxy: domain.ProxyConfig{},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x01, 0x00}, reply: []byte{0x05, 0xff}},
+			},
+			wantErr: "socks5_no_acceptable_method",
+		},
+		{
+			name:  "connection refused",
+			proxy: domain.ProxyConfig{},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x01, 0x00}, reply: []byte{0x05, 0x00}},
+				{want: connectReq, reply: []byte{0x05, 0x05, 0x00}},
+			},
+			wantErr: "socks5_connection_refused",
+		},
+		{
+			name:  "reply with wrong version",
+			proxy: domain.ProxyConfig{},
+			exchanges: []exchange{
+				{want: []byte{0x05, 0x01, 0x00}, reply: []byte{0x05, 0x00}},
+				{want: connectReq, reply: []byte{0x04, 0x00, 0x00}},
+			},
+			wantErr: "socks5_handshake_failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, done := fakeProxy(t, tt.exchanges)
+			err := SOCKS5Connect(conn, "target", 3001, tt.proxy, discardLogger)
+			if got := errorType(err); got != tt.wantErr || (tt.wantErr == "" && err != nil) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
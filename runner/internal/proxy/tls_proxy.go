@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// ProxyTLSError is returned when the TLS handshake with an https proxy fails.
+// It is kept apart from target-leg TLS errors so both legs can be told apart.
+type ProxyTLSError struct {
+	ErrorType string
+	Err       error
+}
+
+func (e *ProxyTLSError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorType, e.Err.Error())
+}
+
+func (e *ProxyTLSError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyTLSHandshake wraps a freshly dialed proxy connection in TLS (protocol=https).
+// Returns the TLS connection, its state on success, and the handshake duration.
+func ProxyTLSHandshake(ctx context.Context, conn net.Conn, proxy domain.ProxyConfig, timeout time.Duration) (*tls.Conn, *tls.ConnectionState, time.Duration, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         proxy.Host,
+		InsecureSkipVerify: true,
+	})
+
+	start := time.Now()
+	hsCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := tlsConn.HandshakeContext(hsCtx)
+	duration := time.Since(start)
+
+	if err != nil {
+		return nil, nil, duration, &ProxyTLSError{
+			ErrorType: "proxy_" + classifyTLSError(err),
+			Err:       err,
+		}
+	}
+
+	state := tlsConn.ConnectionState()
+	return tlsConn, &state, duration, nil
+}
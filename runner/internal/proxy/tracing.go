@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Each probe is one trace: a root span per request or WS connection, with a child span
+// per phase. Phases are recorded after the fact from the timestamps the testers already
+// take, so tracing adds no work to the measured path. Without a configured exporter the
+// global provider is a no-op and no trace headers are sent.
+
+var tracer = otel.Tracer("proxy-stability-test/runner/internal/proxy")
+
+// startProbe starts the root span for one probe
+func startProbe(ctx context.Context, name string, proxy domain.ProxyConfig, runID string, seq int, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("run_id", runID),
+		attribute.String("proxy.label", proxy.Label),
+		attribute.String("proxy.protocol", proxy.Protocol),
+		attribute.String("proxy.address", hostPort(proxy.Host, proxy.Port)),
+		attribute.Int("seq", seq),
+	)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// tracePhase records a finished phase as a child of the span in ctx. Phases that never
+// started are skipped; errType marks the phase that failed.
+func tracePhase(ctx context.Context, name string, start, end time.Time, errType string) {
+	if start.IsZero() || !trace.SpanFromContext(ctx).IsRecording() {
+		return
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	_, span := tracer.Start(ctx, name, trace.WithTimestamp(start))
+	if errType != "" {
+		span.SetStatus(codes.Error, errType)
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// endHTTPProbe records the sample outcome on the root span and ends it
+func endHTTPProbe(span trace.Span, sample *domain.HTTPSample) {
+	if sample.StatusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", sample.StatusCode))
+	}
+	if sample.NegotiatedProtocol != "" {
+		span.SetAttributes(attribute.String("network.protocol.name", sample.NegotiatedProtocol))
+	}
+	if sample.ObservedIP != "" {
+		span.SetAttributes(attribute.String("proxy.observed_ip", sample.ObservedIP))
+	}
+	span.SetAttributes(
+		attribute.Float64("ttfb_ms", sample.TTFBMS),
+		attribute.Float64("total_ms", sample.TotalMS),
+	)
+	if sample.ErrorType != "" {
+		span.SetAttributes(attribute.String("error.type", sample.ErrorType))
+		span.SetStatus(codes.Error, sample.ErrorMessage)
+	}
+	span.End()
+}
+
+// endWSProbe records the connection outcome on the root span and ends it
+func endWSProbe(span trace.Span, sample *domain.WSSample) {
+	span.SetAttributes(
+		attribute.Bool("ws.connected", sample.Connected),
+		attribute.Int("ws.messages_sent", sample.MessagesSent),
+		attribute.Int("ws.messages_received", sample.MessagesReceived),
+		attribute.Int("ws.drops", sample.DropCount),
+		attribute.String("ws.disconnect_reason", sample.DisconnectReason),
+	)
+	if sample.ErrorType != "" {
+		span.SetAttributes(attribute.String("error.type", sample.ErrorType))
+		span.SetStatus(codes.Error, sample.ErrorMessage)
+	}
+	span.End()
+}
+
+// injectTrace adds the trace context headers (traceparent, tracestate) for the target
+func injectTrace(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,360 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// udpPacketsPerSession is how many datagrams one UDP ASSOCIATE session sends
+const udpPacketsPerSession = 30
+
+// udpMagic prefixes every probe payload so stray datagrams are ignored
+var udpMagic = []byte("PSTU")
+
+// UDPTester measures UDP latency and loss through a SOCKS5 UDP ASSOCIATE relay
+type UDPTester struct {
+	proxy         domain.ProxyConfig
+	runID         string
+	packetsPerMin int
+	timeout       time.Duration
+	targetAddr    string // udp echo host:port
+	targetHost    string
+	targetPort    int
+	samples       chan<- domain.UDPSample
+	logger        *slog.Logger
+	seq           int
+}
+
+// NewUDPTester creates a new UDP tester
+func NewUDPTester(proxy domain.ProxyConfig, runID string, packetsPerMin int, timeoutMS int,
+	targetAddr string, samples chan<- domain.UDPSample, logger *slog.Logger) *UDPTester {
+
+	timeout := time.Duration(timeoutMS) * time.Millisecond
+
+	if packetsPerMin <= 0 {
+		packetsPerMin = 600
+	}
+
+	targetHost, targetPort := targetAddr, 0
+	if h, p, err := net.SplitHostPort(targetAddr); err == nil {
+		targetHost = h
+		targetPort, _ = strconv.Atoi(p)
+	}
+
+	testerLogger := logger.With(
+		"module", "proxy.udp_tester",
+		"goroutine", "udp",
+		"run_id", runID,
+		"proxy_label", proxy.Label,
+	)
+
+	testerLogger.Info("UDP transport created",
+		"phase", "continuous",
+		"udp_packets_per_min", packetsPerMin,
+		"proxy_protocol", proxy.Protocol,
+		"udp_target", targetAddr,
+	)
+
+	return &UDPTester{
+		proxy:         proxy,
+		runID:         runID,
+		packetsPerMin: packetsPerMin,
+		timeout:       timeout,
+		targetAddr:    targetAddr,
+		targetHost:    targetHost,
+		targetPort:    targetPort,
+		samples:       samples,
+		logger:        testerLogger,
+	}
+}
+
+// Run starts the UDP test loop, one ASSOCIATE session after another
+func (t *UDPTester) Run(ctx context.Context) error {
+	t.logger.Info("UDP goroutine started",
+		"phase", "continuous",
+		"udp_packets_per_min", t.packetsPerMin,
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.logger.Info("UDP goroutine stopped",
+				"phase", "stopping",
+				"total_sessions", t.seq,
+			)
+			return nil
+		default:
+		}
+
+		t.seq++
+		sample := t.doSession(ctx, t.seq)
+
+		select {
+		case t.samples <- sample:
+		case <-ctx.Done():
+			return nil
+		}
+
+		// Brief pause between sessions
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func (t *UDPTester) doSession(ctx context.Context, seq int) domain.UDPSample {
+	sample := domain.UDPSample{
+		Seq:        seq,
+		TargetAddr: t.targetAddr,
+		MeasuredAt: time.Now(),
+	}
+
+	t.logger.Debug("UDP session start",
+		"phase", "continuous",
+		"seq", seq,
+	)
+
+	// Phase 1: TCP control connection to the proxy
+	connStart := time.Now()
+	dialer := net.Dialer{Timeout: t.timeout}
+	ctrl, err := dialer.DialContext(ctx, "tcp", hostPort(t.proxy.Host, t.proxy.Port))
+	sample.TCPConnectMS = durationMS(time.Since(connStart))
+	if err != nil {
+		sample.ErrorType = classifyHTTPError(err)
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("UDP session fail",
+			"phase", "continuous",
+			"stage", "tcp_connect",
+			"error_type", sample.ErrorType,
+			"seq", seq,
+		)
+		return sample
+	}
+	defer ctrl.Close()
+
+	// Phase 2: SOCKS5 UDP ASSOCIATE
+	hsStart := time.Now()
+	ctrl.SetDeadline(hsStart.Add(t.timeout))
+	relay, err := SOCKS5UDPAssociate(ctrl, t.proxy, t.logger)
+	ctrl.SetDeadline(time.Time{})
+	sample.SOCKSHandshakeMS = durationMS(time.Since(hsStart))
+	if err != nil {
+		sample.ErrorType = classifyHTTPError(err)
+		sample.ErrorMessage = err.Error()
+		t.logger.Debug("UDP session fail",
+			"phase", "continuous",
+			"stage", "udp_associate",
+			"error_type", sample.ErrorType,
+			"seq", seq,
+		)
+		return sample
+	}
+
+	udpConn, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		sample.ErrorType = "udp_socket_error"
+		sample.ErrorMessage = err.Error()
+		return sample
+	}
+	defer udpConn.Close()
+	sample.Associated = true
+
+	targetHost, err := pinFamily(ctx, t.targetHost, t.proxy.IPFamily)
+	if err != nil {
+		sample.ErrorType = classifyHTTPError(err)
+		sample.ErrorMessage = err.Error()
+		return sample
+	}
+	header, err := socks5AppendAddr([]byte{0x00, 0x00, 0x00}, targetHost, t.targetPort)
+	if err != nil {
+		sample.ErrorType = "udp_socket_error"
+		sample.ErrorMessage = err.Error()
+		return sample
+	}
+
+	// Phase 3: reader collects echoes until the socket is closed
+	stats := newUDPStats(udpPacketsPerSession)
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		buf := make([]byte, 2048)
+		for {
+			n, err := udpConn.Read(buf)
+			if err != nil {
+				return
+			}
+			recvAt := time.Now()
+			pktSeq, sentAt, ok := parseUDPEcho(buf[:n], seq)
+			if !ok {
+				continue
+			}
+			stats.record(pktSeq, recvAt.Sub(sentAt))
+		}
+	}()
+
+	// Phase 4: send sequenced datagrams at the configured rate
+	interval := time.Duration(float64(time.Minute) / float64(t.packetsPerMin))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	payload := make([]byte, 0, len(header)+20)
+sendLoop:
+	for i := 0; i < udpPacketsPerSession; i++ {
+		payload = append(payload[:0], header...)
+		payload = append(payload, udpMagic...)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(seq))
+		payload = binary.BigEndian.AppendUint32(payload, uint32(i))
+		payload = binary.BigEndian.AppendUint64(payload, uint64(time.Now().UnixNano()))
+
+		if _, err := udpConn.Write(payload); err != nil {
+			sample.ErrorType = "udp_write_error"
+			sample.ErrorMessage = err.Error()
+			break
+		}
+		sample.PacketsSent++
+
+		if i == udpPacketsPerSession-1 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break sendLoop
+		case <-ticker.C:
+		}
+	}
+
+	// Give in-flight echoes up to the request timeout to arrive
+	grace := t.timeout
+	if grace > 3*time.Second {
+		grace = 3 * time.Second
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(grace):
+	}
+	udpConn.Close()
+	<-readerDone
+
+	stats.fill(&sample)
+	if sample.PacketsSent > 0 && sample.PacketsReceived == 0 && sample.ErrorType == "" {
+		sample.ErrorType = "udp_no_response"
+		sample.ErrorMessage = "no datagrams echoed back through the relay"
+	}
+
+	t.logger.Info("UDP session complete",
+		"phase", "continuous",
+		"seq", seq,
+		"packets_sent", sample.PacketsSent,
+		"packets_received", sample.PacketsReceived,
+		"lost", sample.LostCount,
+		"reordered", sample.ReorderedCount,
+		"duplicates", sample.DuplicateCount,
+		"rtt_avg_ms", math.Round(sample.RTTAvgMS*100)/100,
+		"jitter_ms", math.Round(sample.JitterMS*100)/100,
+	)
+
+	return sample
+}
+
+// parseUDPEcho strips the SOCKS5 UDP header and decodes a probe payload from this session
+func parseUDPEcho(b []byte, sessionSeq int) (int, time.Time, bool) {
+	if len(b) < 4 || b[2] != 0x00 {
+		return 0, time.Time{}, false // fragmented datagrams are not supported
+	}
+	r := bytes.NewReader(b[3:])
+	if _, _, err := socks5ReadAddr(r); err != nil {
+		return 0, time.Time{}, false
+	}
+	data := b[len(b)-r.Len():]
+	if len(data) < 20 || !bytes.Equal(data[:4], udpMagic) {
+		return 0, time.Time{}, false
+	}
+	if int(binary.BigEndian.Uint32(data[4:8])) != sessionSeq {
+		return 0, time.Time{}, false
+	}
+	pktSeq := int(binary.BigEndian.Uint32(data[8:12]))
+	sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(data[12:20])))
+	return pktSeq, sentAt, true
+}
+
+// udpStats tracks echoes for one session; written by the reader goroutine
+type udpStats struct {
+	mu         sync.Mutex
+	seen       map[int]bool
+	highestSeq int
+	reordered  int
+	duplicates int
+	rtts       []float64 // in arrival order
+}
+
+func newUDPStats(expected int) *udpStats {
+	return &udpStats{
+		seen:       make(map[int]bool, expected),
+		highestSeq: -1,
+	}
+}
+
+func (s *udpStats) record(pktSeq int, rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen[pktSeq] {
+		s.duplicates++
+		return
+	}
+	s.seen[pktSeq] = true
+
+	if pktSeq < s.highestSeq {
+		s.reordered++
+	} else {
+		s.highestSeq = pktSeq
+	}
+	s.rtts = append(s.rtts, durationMS(rtt))
+}
+
+func (s *udpStats) fill(sample *domain.UDPSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sample.PacketsReceived = len(s.seen)
+	sample.LostCount = sample.PacketsSent - sample.PacketsReceived
+	if sample.LostCount < 0 {
+		sample.LostCount = 0
+	}
+	sample.ReorderedCount = s.reordered
+	sample.DuplicateCount = s.duplicates
+
+	if len(s.rtts) == 0 {
+		return
+	}
+
+	sum := 0.0
+	sample.RTTMinMS = s.rtts[0]
+	for i, rtt := range s.rtts {
+		sum += rtt
+		if rtt < sample.RTTMinMS {
+			sample.RTTMinMS = rtt
+		}
+		if rtt > sample.RTTMaxMS {
+			sample.RTTMaxMS = rtt
+		}
+		if i > 0 {
+			sample.JitterMS += math.Abs(rtt - s.rtts[i-1])
+		}
+	}
+	sample.RTTAvgMS = sum / float64(len(s.rtts))
+	if len(s.rtts) > 1 {
+		sample.JitterMS /= float64(len(s.rtts) - 1)
+	}
+}
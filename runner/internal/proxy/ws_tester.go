@@ -8,29 +8,31 @@ import (
 	"math"
 	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"proxy-stability-test/runner/internal/domain"
 )
 
 // WSTester performs WebSocket testing through a proxy
 type WSTester struct {
-	proxy        domain.ProxyConfig
-	runID        string
-	messagesPerMin int
-	timeout      time.Duration
-	wsURL        string   // ws://target:3001/ws-echo
-	wssURL       string   // wss://target:3443/ws-echo
-	samples      chan<- domain.WSSample
-	logger       *slog.Logger
-	seq          int
-	mu           sync.Mutex
+	proxy          domain.ProxyConfig
+	runID          string
+	messagesPerMin atomic.Int64 // read at each message tick, so changes apply to open connections
+	timeout        time.Duration
+	wsURL          string // ws://target:3001/ws-echo
+	wssURL         string // wss://target:3443/ws-echo
+	samples        chan<- domain.WSSample
+	logger         *slog.Logger
+	seq            int
+	mu             sync.Mutex
 }
 
 // NewWSTester creates a new WebSocket tester
@@ -56,27 +58,42 @@ func NewWSTester(proxy domain.ProxyConfig, runID string, messagesPerMin int, tim
 	testerLogger.Info("WS transport created",
 		"phase", "continuous",
 		"ws_messages_per_min", messagesPerMin,
+		"proxy_protocol", proxy.Protocol,
 		"ws_url", wsURL,
 		"wss_url", wssURL,
 	)
 
-	return &WSTester{
-		proxy:          proxy,
-		runID:          runID,
-		messagesPerMin: messagesPerMin,
-		timeout:        timeout,
-		wsURL:          wsURL,
-		wssURL:         wssURL,
-		samples:        samples,
-		logger:         testerLogger,
+	t := &WSTester{
+		proxy:   proxy,
+		runID:   runID,
+		timeout: timeout,
+		wsURL:   wsURL,
+		wssURL:  wssURL,
+		samples: samples,
+		logger:  testerLogger,
 	}
+	t.messagesPerMin.Store(int64(messagesPerMin))
+	return t
+}
+
+// SetMessagesPerMin changes the message rate, including on the connection currently held
+func (t *WSTester) SetMessagesPerMin(messagesPerMin int) {
+	t.messagesPerMin.Store(int64(messagesPerMin))
+	t.logger.Info("WS rate changed",
+		"phase", "continuous",
+		"ws_messages_per_min", messagesPerMin,
+	)
+}
+
+func messageInterval(messagesPerMin int64) time.Duration {
+	return time.Duration(float64(time.Minute) / float64(messagesPerMin))
 }
 
 // Run starts the WS test loop, alternating ws/wss connections
 func (t *WSTester) Run(ctx context.Context) error {
 	t.logger.Info("WS goroutine started",
 		"phase", "continuous",
-		"ws_messages_per_min", t.messagesPerMin,
+		"ws_messages_per_min", t.messagesPerMin.Load(),
 	)
 
 	connNum := 0
@@ -133,6 +150,12 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 		protocol = "wss"
 	}
 
+	ctx, span := startProbe(ctx, "ws.connection", t.proxy, t.runID, seq,
+		attribute.String("url.full", targetURL),
+		attribute.Int("ws.connection_num", connNum),
+	)
+	defer func() { endWSProbe(span, &sample) }()
+
 	t.logger.Debug("WS connection start",
 		"phase", "continuous",
 		"protocol", protocol,
@@ -142,21 +165,10 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 
 	connStart := time.Now()
 
-	// Build proxy URL
-	proxyURL := &url.URL{
-		Scheme: "http",
-		Host:   fmt.Sprintf("%s:%d", t.proxy.Host, t.proxy.Port),
-	}
-	if t.proxy.AuthUser != "" {
-		proxyURL.User = url.UserPassword(t.proxy.AuthUser, t.proxy.AuthPass)
-	}
-
+	// The tunnel is opened by the dial function rather than the dialer's Proxy hook,
+	// which can only send Basic credentials
 	dialer := websocket.Dialer{
-		Proxy: http.ProxyURL(proxyURL),
-		NetDialContext: (&net.Dialer{
-			Timeout:   t.timeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		NetDialContext:   tunnelDialContext(t.proxy, t.timeout, t.logger),
 		HandshakeTimeout: t.timeout,
 		TLSClientConfig:  &tls.Config{InsecureSkipVerify: true},
 	}
@@ -165,10 +177,18 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 	header.Set("User-Agent", "ProxyTester/1.0")
 	header.Set("X-Run-Id", t.runID)
 	header.Set("X-Seq", strconv.Itoa(seq))
+	injectTrace(ctx, header)
 
+	dialCtx, proxyTrace := withDialTrace(ctx)
 	dialStart := time.Now()
-	conn, resp, err := dialer.DialContext(ctx, targetURL, header)
+	conn, resp, err := dialer.DialContext(dialCtx, targetURL, header)
 	dialDuration := time.Since(dialStart)
+	proxyTrace.applyWS(&sample)
+	dialErr := ""
+	if err != nil {
+		dialErr = classifyWSError(err)
+	}
+	tracePhase(ctx, "ws_handshake", dialStart, dialStart.Add(dialDuration), dialErr)
 
 	// Estimate TCP + handshake from total dial time
 	sample.TCPConnectMS = float64(dialDuration.Microseconds()) / 1000.0 / 2
@@ -200,6 +220,7 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 	defer conn.Close()
 
 	sample.Connected = true
+	_, sample.ObservedIPFamily = observedIP(resp.Header)
 
 	t.logger.Debug("WS connected",
 		"phase", "continuous",
@@ -209,8 +230,8 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 	)
 
 	// Message loop: send messages at configured rate (1/sec for 60/min)
-	messageInterval := time.Duration(float64(time.Minute) / float64(t.messagesPerMin))
-	messageTicker := time.NewTicker(messageInterval)
+	messagesPerMin := t.messagesPerMin.Load()
+	messageTicker := time.NewTicker(messageInterval(messagesPerMin))
 	defer messageTicker.Stop()
 
 	// Ping/pong monitoring
@@ -253,6 +274,7 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 		}
 	}()
 
+	messagesStart := time.Now()
 	msgNum := 0
 	for msgNum < maxMessages {
 		select {
@@ -284,6 +306,10 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 				}
 			}
 		case <-messageTicker.C:
+			if rate := t.messagesPerMin.Load(); rate != messagesPerMin {
+				messagesPerMin = rate
+				messageTicker.Reset(messageInterval(rate))
+			}
 			msgNum++
 			payload := fmt.Sprintf(`{"seq":%d,"msg":%d,"ts":%d}`, seq, msgNum, time.Now().UnixMilli())
 
@@ -302,6 +328,7 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 				if result.err != nil {
 					if isTimeoutErr(result.err) {
 						sample.DropCount++
+						span.AddEvent("message_dropped", trace.WithAttributes(attribute.Int("ws.msg", msgNum)))
 					} else {
 						sample.DisconnectReason = "read_error"
 						goto done
@@ -314,6 +341,7 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 				}
 			case <-time.After(5 * time.Second):
 				sample.DropCount++
+				span.AddEvent("message_dropped", trace.WithAttributes(attribute.Int("ws.msg", msgNum)))
 			case <-ctx.Done():
 				sample.DisconnectReason = "context_cancelled"
 				goto done
@@ -325,6 +353,7 @@ func (t *WSTester) doConnection(ctx context.Context, targetURL string, isWSS boo
 done:
 	close(doneCh)
 	sample.ConnectionHeldMS = float64(time.Since(connStart).Microseconds()) / 1000.0
+	tracePhase(ctx, "ws_messages", messagesStart, time.Now(), sample.ErrorType)
 
 	if sample.MessagesReceived > 0 {
 		sample.MessageRTTMS = totalRTT / float64(sample.MessagesReceived)
@@ -362,6 +391,10 @@ func isTimeoutErr(err error) bool {
 }
 
 func classifyWSError(err error) string {
+	if errType, ok := proxyErrorType(err); ok {
+		return errType
+	}
+
 	errStr := err.Error()
 	switch {
 	case strings.Contains(errStr, "context deadline exceeded") || strings.Contains(errStr, "timeout"):
@@ -3,23 +3,37 @@ package reporter
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/metrics"
 )
 
 // Reporter interface for reporting test results
 type Reporter interface {
 	ReportHTTPSamples(runID string, samples []domain.HTTPSample) error
 	ReportWSSamples(runID string, samples []domain.WSSample) error
+	ReportUDPSamples(runID string, samples []domain.UDPSample) error
 	ReportIPCheck(runID string, result domain.IPCheckResult) error
 	ReportSummary(runID string, summary domain.RunSummary) error
+	ReportIncident(runID string, incident domain.Incident) error
 	UpdateStatus(runID string, status string, errorMessage string) error
 }
 
+// RejectedError is returned when the destination refuses a report outright (a 4xx from
+// the API, a constraint violation in the database). Retrying or spooling it cannot help.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "report rejected: " + e.Reason
+}
+
 // APIReporter sends results to the Controller API
 type APIReporter struct {
 	apiURL    string
@@ -127,6 +141,44 @@ func (r *APIReporter) ReportWSSamples(runID string, samples []domain.WSSample) e
 	return nil
 }
 
+// ReportUDPSamples sends UDP samples to the API in batches
+func (r *APIReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	for i := 0; i < len(samples); i += r.batchSize {
+		end := i + r.batchSize
+		if end > len(samples) {
+			end = len(samples)
+		}
+		batch := samples[i:end]
+
+		url := fmt.Sprintf("%s/runs/%s/udp-samples/batch", r.apiURL, runID)
+		payload := map[string]interface{}{
+			"samples": batch,
+		}
+
+		r.logger.Debug("UDP batch POST start",
+			"phase", "continuous",
+			"run_id", runID,
+			"batch_size", len(batch),
+		)
+
+		err := r.postWithRetry(url, payload)
+		if err != nil {
+			r.logger.Error("UDP batch POST fail",
+				"phase", "continuous",
+				"run_id", runID,
+				"error_detail", err.Error(),
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
 // ReportIPCheck sends an IP check result to the API
 func (r *APIReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
 	url := fmt.Sprintf("%s/runs/%s/ip-checks", r.apiURL, runID)
@@ -154,6 +206,21 @@ func (r *APIReporter) ReportSummary(runID string, summary domain.RunSummary) err
 	return r.postWithRetry(url, summary)
 }
 
+// ReportIncident sends an incident to the API when it opens and again when it ends
+func (r *APIReporter) ReportIncident(runID string, incident domain.Incident) error {
+	url := fmt.Sprintf("%s/runs/%s/incidents", r.apiURL, runID)
+	err := r.postWithRetry(url, incident)
+	if err != nil {
+		r.logger.Error("Incident POST fail",
+			"phase", "continuous",
+			"run_id", runID,
+			"incident_seq", incident.Seq,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
+}
+
 // UpdateStatus updates the run status via the API
 func (r *APIReporter) UpdateStatus(runID string, status string, errorMessage string) error {
 	url := fmt.Sprintf("%s/runs/%s/status", r.apiURL, runID)
@@ -178,6 +245,7 @@ func (r *APIReporter) UpdateStatus(runID string, status string, errorMessage str
 			"status", status,
 			"error_detail", err.Error(),
 		)
+		countFailure("api", err)
 		return err
 	}
 	defer resp.Body.Close()
@@ -188,11 +256,33 @@ func (r *APIReporter) UpdateStatus(runID string, status string, errorMessage str
 			"status", status,
 			"http_status", resp.StatusCode,
 		)
+		err := statusError(resp.StatusCode)
+		countFailure("api", err)
+		return err
 	}
 
 	return nil
 }
 
+// statusError maps an HTTP error status to an error; client errors other than timeouts
+// and rate limits are rejections
+func statusError(code int) error {
+	if code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+		return &RejectedError{Reason: fmt.Sprintf("HTTP %d", code)}
+	}
+	return fmt.Errorf("HTTP %d", code)
+}
+
+// countFailure records a report that failed for good on /metrics
+func countFailure(reporter string, err error) {
+	reason := "unavailable"
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		reason = "rejected"
+	}
+	metrics.ReporterFailure(reporter, reason)
+}
+
 func (r *APIReporter) postWithRetry(url string, payload interface{}) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -209,6 +299,7 @@ func (r *APIReporter) postWithRetry(url string, payload interface{}) error {
 				"attempt", attempt+1,
 				"backoff_ms", backoff.Milliseconds(),
 			)
+			metrics.ReporterRetry("api")
 			time.Sleep(backoff)
 		}
 
@@ -223,7 +314,17 @@ func (r *APIReporter) postWithRetry(url string, payload interface{}) error {
 			return nil
 		}
 
-		lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+		lastErr = statusError(resp.StatusCode)
+		var rejected *RejectedError
+		if errors.As(lastErr, &rejected) {
+			r.logger.Error("Report rejected",
+				"phase", "continuous",
+				"url", url,
+				"http_status", resp.StatusCode,
+			)
+			countFailure("api", lastErr)
+			return lastErr
+		}
 	}
 
 	r.logger.Error("All retries exhausted",
@@ -233,5 +334,6 @@ func (r *APIReporter) postWithRetry(url string, payload interface{}) error {
 		"last_error", lastErr.Error(),
 	)
 
+	countFailure("api", lastErr)
 	return lastErr
 }
@@ -1,68 +1,592 @@
 package reporter
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"proxy-stability-test/runner/internal/domain"
 )
 
-// DBReporter inserts results directly into PostgreSQL (alternative mode)
+// DBReporter inserts results directly into PostgreSQL (database/schema.sql), for
+// deployments where the runner must keep reporting without the API service.
+// It writes the same rows the API's ingestion routes would.
 type DBReporter struct {
-	dbURL  string
-	logger *slog.Logger
+	pool    *pgxpool.Pool
+	timeout time.Duration
+	logger  *slog.Logger
 }
 
-// NewDBReporter creates a new DB reporter
-func NewDBReporter(dbURL string, logger *slog.Logger) *DBReporter {
-	return &DBReporter{
-		dbURL:  dbURL,
-		logger: logger.With("module", "reporter.db_reporter"),
+// validTransitions mirrors the API's PATCH /runs/:id/status rules
+var validTransitions = map[string][]string{
+	"pending":   {"running", "cancelled"},
+	"running":   {"stopping", "completed", "failed"},
+	"stopping":  {"completed", "failed", "cancelled"},
+	"completed": {},
+	"failed":    {},
+	"cancelled": {},
+}
+
+// NewDBReporter connects to dbURL; the pool is shared by every run in the process
+func NewDBReporter(ctx context.Context, dbURL string, logger *slog.Logger) (*DBReporter, error) {
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("connect database: %w", err)
 	}
+	return &DBReporter{
+		pool:    pool,
+		timeout: 30 * time.Second,
+		logger:  logger.With("module", "reporter.db_reporter"),
+	}, nil
+}
+
+// Close releases the connection pool
+func (r *DBReporter) Close() {
+	r.pool.Close()
 }
 
 // ReportHTTPSamples inserts HTTP samples directly into the database
 func (r *DBReporter) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
-	// Sprint 1: placeholder - direct DB insert not yet implemented
-	// Will use pgx batch insert in future sprints
-	r.logger.Debug("DB insert skipped (using API reporter)",
+	if len(samples) == 0 {
+		return nil
+	}
+	rows := make([][]any, len(samples))
+	for i, s := range samples {
+		rows[i] = []any{
+			runID, s.Seq, s.IsWarmup, s.TargetURL, withDefault(s.Method, "GET"),
+			s.IsHTTPS, nullIfZero(s.StatusCode), nullIfZero(s.ErrorType), nullIfZero(s.ErrorMessage),
+			s.TCPConnectMS, nullIfZero(s.SOCKSHandshakeMS), nullIfZero(s.TLSHandshakeMS), s.TTFBMS, s.TotalMS,
+			nullIfZero(s.TLSVersion), nullIfZero(s.TLSCipher),
+			nullIfZero(s.ProxyTLSHandshakeMS), nullIfZero(s.ProxyTLSVersion), nullIfZero(s.ProxyTLSCipher),
+			nullIfZero(s.ProxyAuthScheme), s.ProxyAuthRoundTrips, nullIfZero(s.ProxyAuthMS), nullIfZero(s.ObservedIPFamily),
+			nullIfZero(s.NegotiatedProtocol), nullIfZero(s.H2Streams), nullIfZero(s.H2StreamAvgMS), nullIfZero(s.H2StreamMaxMS), s.H2StreamResets,
+			s.BytesSent, s.BytesReceived, nullIfZero(s.TargetRPM),
+			nullIfZero(hopTimingsJSON(s.HopTimings)), measuredAt(s.MeasuredAt),
+		}
+	}
+	columns := []string{
+		"run_id", "seq", "is_warmup", "target_url", "method",
+		"is_https", "status_code", "error_type", "error_message",
+		"tcp_connect_ms", "socks_handshake_ms", "tls_handshake_ms", "ttfb_ms", "total_ms",
+		"tls_version", "tls_cipher",
+		"proxy_tls_handshake_ms", "proxy_tls_version", "proxy_tls_cipher",
+		"proxy_auth_scheme", "proxy_auth_round_trips", "proxy_auth_ms", "observed_ip_family",
+		"negotiated_protocol", "h2_streams", "h2_stream_avg_ms", "h2_stream_max_ms", "h2_stream_resets",
+		"bytes_sent", "bytes_received", "target_rpm",
+		"hop_timings", "measured_at",
+	}
+	return r.copySamples(runID, "http_sample", "", columns, rows)
+}
+
+// ReportWSSamples inserts WS samples directly into the database
+func (r *DBReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	rows := make([][]any, len(samples))
+	for i, s := range samples {
+		rows[i] = []any{
+			runID, s.Seq, s.IsWarmup, s.TargetURL,
+			s.Connected, nullIfZero(s.ErrorType), nullIfZero(s.ErrorMessage),
+			s.TCPConnectMS, nullIfZero(s.SOCKSHandshakeMS), nullIfZero(s.TLSHandshakeMS), s.HandshakeMS,
+			nullIfZero(s.ProxyTLSHandshakeMS), nullIfZero(s.ProxyTLSVersion), nullIfZero(s.ProxyTLSCipher),
+			nullIfZero(s.ProxyAuthScheme), s.ProxyAuthRoundTrips, nullIfZero(s.ProxyAuthMS), nullIfZero(s.ObservedIPFamily),
+			s.MessageRTTMS, s.ConnectionHeldMS, nullIfZero(s.DisconnectReason),
+			s.MessagesSent, s.MessagesReceived, s.DropCount,
+			nullIfZero(hopTimingsJSON(s.HopTimings)), measuredAt(s.MeasuredAt),
+		}
+	}
+	columns := []string{
+		"run_id", "seq", "is_warmup", "target_url",
+		"connected", "error_type", "error_message",
+		"tcp_connect_ms", "socks_handshake_ms", "tls_handshake_ms", "handshake_ms",
+		"proxy_tls_handshake_ms", "proxy_tls_version", "proxy_tls_cipher",
+		"proxy_auth_scheme", "proxy_auth_round_trips", "proxy_auth_ms", "observed_ip_family",
+		"message_rtt_ms", "connection_held_ms", "disconnect_reason",
+		"messages_sent", "messages_received", "drop_count",
+		"hop_timings", "measured_at",
+	}
+	return r.copySamples(runID, "ws_sample", "total_ws_samples", columns, rows)
+}
+
+// ReportUDPSamples inserts UDP samples directly into the database
+func (r *DBReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	rows := make([][]any, len(samples))
+	for i, s := range samples {
+		rows[i] = []any{
+			runID, s.Seq, s.IsWarmup, s.TargetAddr,
+			s.Associated, nullIfZero(s.ErrorType), nullIfZero(s.ErrorMessage),
+			s.TCPConnectMS, s.SOCKSHandshakeMS,
+			s.PacketsSent, s.PacketsReceived, s.LostCount, s.ReorderedCount, s.DuplicateCount,
+			s.RTTAvgMS, s.RTTMinMS, s.RTTMaxMS, s.JitterMS,
+			measuredAt(s.MeasuredAt),
+		}
+	}
+	columns := []string{
+		"run_id", "seq", "is_warmup", "target_addr",
+		"associated", "error_type", "error_message",
+		"tcp_connect_ms", "socks_handshake_ms",
+		"packets_sent", "packets_received", "lost_count", "reordered_count", "duplicate_count",
+		"rtt_avg_ms", "rtt_min_ms", "rtt_max_ms", "jitter_ms",
+		"measured_at",
+	}
+	return r.copySamples(runID, "udp_sample", "total_udp_samples", columns, rows)
+}
+
+// copySamples bulk-loads one batch with COPY and bumps the run's counter column, if any,
+// in the same transaction
+func (r *DBReporter) copySamples(runID, table, counter string, columns []string, rows [][]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows)); err != nil {
+			return err
+		}
+		if counter == "" {
+			return nil
+		}
+		_, err := tx.Exec(ctx,
+			fmt.Sprintf("UPDATE test_run SET %s = %s + $2 WHERE id = $1", counter, counter),
+			runID, len(rows),
+		)
+		return err
+	})
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("Batch insert fail",
+			"phase", "continuous",
+			"run_id", runID,
+			"table", table,
+			"batch_size", len(rows),
+			"error_detail", err.Error(),
+		)
+		return err
+	}
+
+	r.logger.Debug("Batch insert success",
 		"phase", "continuous",
 		"run_id", runID,
-		"sample_count", len(samples),
+		"table", table,
+		"batch_size", len(rows),
 	)
 	return nil
 }
 
-// ReportSummary inserts a run summary directly into the database
+// ReportIPCheck inserts an IP check result directly into the database
+func (r *DBReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	sources, _ := json.Marshal(result.BlacklistSources)
+	if result.BlacklistSources == nil {
+		sources = []byte("[]")
+	}
+
+	// proxy_id comes from the run, as the API does; an unknown run fails the NOT NULL
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO ip_check_result (
+			run_id, proxy_id, observed_ip, expected_country, actual_country, actual_region, actual_city,
+			geo_match, blacklist_checked, blacklists_queried, blacklists_listed, blacklist_sources,
+			is_clean, ip_stable, ip_changes
+		) VALUES (
+			$1, (SELECT proxy_id FROM test_run WHERE id = $1),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+		)`,
+		runID, result.ObservedIP,
+		nullIfZero(result.ExpectedCountry), nullIfZero(result.ActualCountry),
+		nullIfZero(result.ActualRegion), nullIfZero(result.ActualCity),
+		result.GeoMatch, result.BlacklistChecked,
+		result.BlacklistQueried, result.BlacklistListed, string(sources),
+		result.IsClean, result.IPStable, result.IPChanges,
+	)
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("IP check insert fail",
+			"phase", "ip_check",
+			"run_id", runID,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
+}
+
+// ReportSummary upserts the run summary directly into the database; trailing-window
+// summaries go to run_summary_window
 func (r *DBReporter) ReportSummary(runID string, summary domain.RunSummary) error {
-	r.logger.Debug("DB summary insert skipped (using API reporter)",
-		"phase", "continuous",
-		"run_id", runID,
+	if summary.Window != "" {
+		return r.reportWindowSummary(runID, summary)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	s := summary
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO run_summary (
+			run_id, proxy_id, http_sample_count, https_sample_count, ws_sample_count,
+			http_success_count, http_error_count, uptime_ratio,
+			ttfb_avg_ms, ttfb_p50_ms, ttfb_p95_ms, ttfb_p99_ms, ttfb_max_ms,
+			total_avg_ms, total_p50_ms, total_p95_ms, total_p99_ms,
+			jitter_ms, tls_p50_ms, tls_p95_ms, tls_p99_ms,
+			tcp_connect_p50_ms, tcp_connect_p95_ms, tcp_connect_p99_ms,
+			ws_success_count, ws_error_count, ws_rtt_avg_ms, ws_rtt_p95_ms, ws_drop_rate, ws_avg_hold_ms,
+			total_bytes_sent, total_bytes_received, avg_throughput_bps,
+			ip_clean, ip_geo_match, ip_stable,
+			score_uptime, score_latency, score_jitter, score_ws, score_security, score_total,
+			ip_clean_score, majority_tls_version, tls_version_score,
+			udp_sample_count, udp_loss_rate, udp_rtt_p95_ms, udp_jitter_ms, score_udp,
+			h1_sample_count, h1_error_count, h1_ttfb_p50_ms, h1_ttfb_p95_ms,
+			h2_sample_count, h2_error_count, h2_ttfb_p50_ms, h2_ttfb_p95_ms,
+			h2_stream_avg_ms, h2_stream_p95_ms, h2_stream_reset_count, h2_stream_reset_rate,
+			stop_reason,
+			rotation_mode, ip_pool_size, ip_reuse_rate,
+			session_count, session_lifetime_avg_sec, session_lifetime_min_sec, premature_rotations,
+			computed_at
+		) VALUES (
+			$1, (SELECT proxy_id FROM test_run WHERE id = $1),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			$17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32,
+			$33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44,
+			$45, $46, $47, $48, $49,
+			$50, $51, $52, $53, $54, $55, $56, $57, $58, $59, $60, $61,
+			$62,
+			$63, $64, $65, $66, $67, $68, $69, now()
+		)
+		ON CONFLICT (run_id) DO UPDATE SET
+			http_sample_count = EXCLUDED.http_sample_count,
+			https_sample_count = EXCLUDED.https_sample_count,
+			ws_sample_count = EXCLUDED.ws_sample_count,
+			http_success_count = EXCLUDED.http_success_count,
+			http_error_count = EXCLUDED.http_error_count,
+			uptime_ratio = EXCLUDED.uptime_ratio,
+			ttfb_avg_ms = EXCLUDED.ttfb_avg_ms,
+			ttfb_p50_ms = EXCLUDED.ttfb_p50_ms,
+			ttfb_p95_ms = EXCLUDED.ttfb_p95_ms,
+			ttfb_p99_ms = EXCLUDED.ttfb_p99_ms,
+			ttfb_max_ms = EXCLUDED.ttfb_max_ms,
+			total_avg_ms = EXCLUDED.total_avg_ms,
+			total_p50_ms = EXCLUDED.total_p50_ms,
+			total_p95_ms = EXCLUDED.total_p95_ms,
+			total_p99_ms = EXCLUDED.total_p99_ms,
+			jitter_ms = EXCLUDED.jitter_ms,
+			tls_p50_ms = EXCLUDED.tls_p50_ms,
+			tls_p95_ms = EXCLUDED.tls_p95_ms,
+			tls_p99_ms = EXCLUDED.tls_p99_ms,
+			tcp_connect_p50_ms = EXCLUDED.tcp_connect_p50_ms,
+			tcp_connect_p95_ms = EXCLUDED.tcp_connect_p95_ms,
+			tcp_connect_p99_ms = EXCLUDED.tcp_connect_p99_ms,
+			ws_success_count = EXCLUDED.ws_success_count,
+			ws_error_count = EXCLUDED.ws_error_count,
+			ws_rtt_avg_ms = EXCLUDED.ws_rtt_avg_ms,
+			ws_rtt_p95_ms = EXCLUDED.ws_rtt_p95_ms,
+			ws_drop_rate = EXCLUDED.ws_drop_rate,
+			ws_avg_hold_ms = EXCLUDED.ws_avg_hold_ms,
+			total_bytes_sent = EXCLUDED.total_bytes_sent,
+			total_bytes_received = EXCLUDED.total_bytes_received,
+			avg_throughput_bps = EXCLUDED.avg_throughput_bps,
+			ip_clean = EXCLUDED.ip_clean,
+			ip_geo_match = EXCLUDED.ip_geo_match,
+			ip_stable = EXCLUDED.ip_stable,
+			score_uptime = EXCLUDED.score_uptime,
+			score_latency = EXCLUDED.score_latency,
+			score_jitter = EXCLUDED.score_jitter,
+			score_ws = EXCLUDED.score_ws,
+			score_security = EXCLUDED.score_security,
+			score_total = EXCLUDED.score_total,
+			ip_clean_score = EXCLUDED.ip_clean_score,
+			majority_tls_version = EXCLUDED.majority_tls_version,
+			tls_version_score = EXCLUDED.tls_version_score,
+			udp_sample_count = EXCLUDED.udp_sample_count,
+			udp_loss_rate = EXCLUDED.udp_loss_rate,
+			udp_rtt_p95_ms = EXCLUDED.udp_rtt_p95_ms,
+			udp_jitter_ms = EXCLUDED.udp_jitter_ms,
+			score_udp = EXCLUDED.score_udp,
+			h1_sample_count = EXCLUDED.h1_sample_count,
+			h1_error_count = EXCLUDED.h1_error_count,
+			h1_ttfb_p50_ms = EXCLUDED.h1_ttfb_p50_ms,
+			h1_ttfb_p95_ms = EXCLUDED.h1_ttfb_p95_ms,
+			h2_sample_count = EXCLUDED.h2_sample_count,
+			h2_error_count = EXCLUDED.h2_error_count,
+			h2_ttfb_p50_ms = EXCLUDED.h2_ttfb_p50_ms,
+			h2_ttfb_p95_ms = EXCLUDED.h2_ttfb_p95_ms,
+			h2_stream_avg_ms = EXCLUDED.h2_stream_avg_ms,
+			h2_stream_p95_ms = EXCLUDED.h2_stream_p95_ms,
+			h2_stream_reset_count = EXCLUDED.h2_stream_reset_count,
+			h2_stream_reset_rate = EXCLUDED.h2_stream_reset_rate,
+			stop_reason = COALESCE(EXCLUDED.stop_reason, run_summary.stop_reason),
+			rotation_mode = EXCLUDED.rotation_mode,
+			ip_pool_size = EXCLUDED.ip_pool_size,
+			ip_reuse_rate = EXCLUDED.ip_reuse_rate,
+			session_count = EXCLUDED.session_count,
+			session_lifetime_avg_sec = EXCLUDED.session_lifetime_avg_sec,
+			session_lifetime_min_sec = EXCLUDED.session_lifetime_min_sec,
+			premature_rotations = EXCLUDED.premature_rotations,
+			computed_at = now()`,
+		runID,
+		s.HTTPSampleCount, s.HTTPSSampleCount, s.WSSampleCount,
+		s.HTTPSuccessCount, s.HTTPErrorCount, s.UptimeRatio,
+		s.TTFBAvgMS, s.TTFBP50MS, s.TTFBP95MS, s.TTFBP99MS, s.TTFBMaxMS,
+		s.TotalAvgMS, s.TotalP50MS, s.TotalP95MS, s.TotalP99MS,
+		s.JitterMS, s.TLSP50MS, s.TLSP95MS, s.TLSP99MS,
+		s.TCPConnectP50MS, s.TCPConnectP95MS, s.TCPConnectP99MS,
+		s.WSSuccessCount, s.WSErrorCount, s.WSRTTAvgMS, s.WSRTTP95MS, s.WSDropRate, s.WSAvgHoldMS,
+		s.TotalBytesSent, s.TotalBytesReceived, s.AvgThroughputBPS,
+		s.IPClean, s.IPGeoMatch, s.IPStable,
+		s.ScoreUptime, s.ScoreLatency, s.ScoreJitter, s.ScoreWS, s.ScoreSecurity, s.ScoreTotal,
+		s.IPCleanScore, nullIfZero(s.MajorityTLSVersion), s.TLSVersionScore,
+		s.UDPSampleCount, s.UDPLossRate, s.UDPRTTP95MS, s.UDPJitterMS, s.ScoreUDP,
+		s.H1SampleCount, s.H1ErrorCount, s.H1TTFBP50MS, s.H1TTFBP95MS,
+		s.H2SampleCount, s.H2ErrorCount, s.H2TTFBP50MS, s.H2TTFBP95MS,
+		s.H2StreamAvgMS, s.H2StreamP95MS, s.H2StreamResetCount, s.H2StreamResetRate,
+		nullIfZero(s.StopReason),
+		nullIfZero(s.RotationMode), s.IPPoolSize, s.IPReuseRate,
+		s.SessionCount, s.SessionLifetimeAvgSec, s.SessionLifetimeMinSec, s.PrematureRotations,
 	)
-	return nil
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("Summary upsert fail",
+			"phase", "continuous",
+			"run_id", runID,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
 }
 
-// UpdateStatus updates run status directly in the database
-func (r *DBReporter) UpdateStatus(runID string, status string, errorMessage string) error {
-	r.logger.Debug("DB status update skipped (using API reporter)",
-		"run_id", runID,
-		"status", status,
+// reportWindowSummary upserts one trailing-window summary, keyed by run and window
+func (r *DBReporter) reportWindowSummary(runID string, summary domain.RunSummary) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	s := summary
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO run_summary_window (
+			run_id, proxy_id, window_label,
+			http_sample_count, https_sample_count, ws_sample_count, udp_sample_count,
+			http_success_count, http_error_count, uptime_ratio,
+			ttfb_p50_ms, ttfb_p95_ms, ttfb_p99_ms, total_p95_ms, jitter_ms,
+			ws_drop_rate, udp_loss_rate,
+			score_uptime, score_latency, score_jitter, score_ws, score_udp, score_security, score_total,
+			computed_at
+		) VALUES (
+			$1, (SELECT proxy_id FROM test_run WHERE id = $1), $2,
+			$3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+			$17, $18, $19, $20, $21, $22, $23, now()
+		)
+		ON CONFLICT (run_id, window_label) DO UPDATE SET
+			http_sample_count = EXCLUDED.http_sample_count,
+			https_sample_count = EXCLUDED.https_sample_count,
+			ws_sample_count = EXCLUDED.ws_sample_count,
+			udp_sample_count = EXCLUDED.udp_sample_count,
+			http_success_count = EXCLUDED.http_success_count,
+			http_error_count = EXCLUDED.http_error_count,
+			uptime_ratio = EXCLUDED.uptime_ratio,
+			ttfb_p50_ms = EXCLUDED.ttfb_p50_ms,
+			ttfb_p95_ms = EXCLUDED.ttfb_p95_ms,
+			ttfb_p99_ms = EXCLUDED.ttfb_p99_ms,
+			total_p95_ms = EXCLUDED.total_p95_ms,
+			jitter_ms = EXCLUDED.jitter_ms,
+			ws_drop_rate = EXCLUDED.ws_drop_rate,
+			udp_loss_rate = EXCLUDED.udp_loss_rate,
+			score_uptime = EXCLUDED.score_uptime,
+			score_latency = EXCLUDED.score_latency,
+			score_jitter = EXCLUDED.score_jitter,
+			score_ws = EXCLUDED.score_ws,
+			score_udp = EXCLUDED.score_udp,
+			score_security = EXCLUDED.score_security,
+			score_total = EXCLUDED.score_total,
+			computed_at = now()`,
+		runID, s.Window,
+		s.HTTPSampleCount, s.HTTPSSampleCount, s.WSSampleCount, s.UDPSampleCount,
+		s.HTTPSuccessCount, s.HTTPErrorCount, s.UptimeRatio,
+		s.TTFBP50MS, s.TTFBP95MS, s.TTFBP99MS, s.TotalP95MS, s.JitterMS,
+		s.WSDropRate, s.UDPLossRate,
+		s.ScoreUptime, s.ScoreLatency, s.ScoreJitter, s.ScoreWS, s.ScoreUDP, s.ScoreSecurity, s.ScoreTotal,
 	)
-	return nil
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("Window summary upsert fail",
+			"phase", "continuous",
+			"run_id", runID,
+			"window", s.Window,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
 }
 
-// ReportWSSamples inserts WS samples directly into the database
-func (r *DBReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
-	r.logger.Debug("DB WS insert skipped (using API reporter)",
-		"run_id", runID,
-		"sample_count", len(samples),
+// ReportIncident upserts an incident, keyed by run and seq, when it opens and when it ends
+func (r *DBReporter) ReportIncident(runID string, incident domain.Incident) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	counts, _ := json.Marshal(incident.ErrorCounts)
+	protocols, _ := json.Marshal(incident.Protocols)
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO incident (
+			run_id, proxy_id, seq, status, trigger, error_type, error_counts, protocols,
+			failed_samples, total_samples, started_at, ended_at, duration_ms
+		) VALUES (
+			$1, (SELECT proxy_id FROM test_run WHERE id = $1),
+			$2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		)
+		ON CONFLICT (run_id, seq) DO UPDATE SET
+			status = EXCLUDED.status,
+			error_type = EXCLUDED.error_type,
+			error_counts = EXCLUDED.error_counts,
+			protocols = EXCLUDED.protocols,
+			failed_samples = EXCLUDED.failed_samples,
+			total_samples = EXCLUDED.total_samples,
+			ended_at = EXCLUDED.ended_at,
+			duration_ms = EXCLUDED.duration_ms`,
+		runID, incident.Seq, incident.Status, incident.Trigger, incident.ErrorType,
+		string(counts), string(protocols),
+		incident.FailedSamples, incident.TotalSamples,
+		incident.StartedAt, incident.EndedAt, incident.DurationMS,
 	)
-	return nil
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("Incident upsert fail",
+			"phase", "continuous",
+			"run_id", runID,
+			"incident_seq", incident.Seq,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
 }
 
-// ReportIPCheck inserts an IP check result directly into the database
-func (r *DBReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
-	r.logger.Debug("DB IP check insert skipped (using API reporter)",
-		"run_id", runID,
+// StartRun moves a pending run to running, as the API does when it triggers the runner.
+// Runs the API already started are left alone.
+func (r *DBReporter) StartRun(runID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE test_run SET status = 'running', started_at = now() WHERE id = $1 AND status = 'pending'`,
+		runID,
 	)
+	if err != nil {
+		countFailure("db", err)
+		r.logger.Error("Status update fail",
+			"run_id", runID,
+			"status", "running",
+			"error_detail", err.Error(),
+		)
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		r.logger.Info("Run status changed",
+			"run_id", runID,
+			"old_status", "pending",
+			"new_status", "running",
+		)
+	}
 	return nil
 }
+
+// UpdateStatus updates run status directly in the database, enforcing the API's transitions
+func (r *DBReporter) UpdateStatus(runID string, status string, errorMessage string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		var oldStatus string
+		if err := tx.QueryRow(ctx, `SELECT status FROM test_run WHERE id = $1 FOR UPDATE`, runID).Scan(&oldStatus); err != nil {
+			if err == pgx.ErrNoRows {
+				return &RejectedError{Reason: fmt.Sprintf("run %s not found", runID)}
+			}
+			return err
+		}
+		if !isValidTransition(oldStatus, status) {
+			return &RejectedError{Reason: fmt.Sprintf("invalid status transition: %s → %s", oldStatus, status)}
+		}
+
+		query := `UPDATE test_run SET status = $2, error_message = COALESCE($3, error_message)`
+		if status == "completed" || status == "failed" || status == "cancelled" {
+			query += `, finished_at = now()`
+		}
+		if _, err := tx.Exec(ctx, query+` WHERE id = $1`, runID, status, nullIfZero(errorMessage)); err != nil {
+			return err
+		}
+
+		r.logger.Info("Run status changed",
+			"run_id", runID,
+			"old_status", oldStatus,
+			"new_status", status,
+		)
+		return nil
+	})
+	if err != nil {
+		err = dbError(err)
+		countFailure("db", err)
+		r.logger.Error("Status update fail",
+			"run_id", runID,
+			"status", status,
+			"error_detail", err.Error(),
+		)
+	}
+	return err
+}
+
+// dbError turns data and integrity violations (SQLSTATE classes 22 and 23) into
+// rejections; anything else may succeed on retry
+func dbError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")) {
+		return &RejectedError{Reason: pgErr.Code + " " + pgErr.Message}
+	}
+	return err
+}
+
+func isValidTransition(from, to string) bool {
+	for _, allowed := range validTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// nullIfZero maps the zero value to NULL, matching the API's `?? null` for omitted JSON fields
+func nullIfZero[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func withDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func measuredAt(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
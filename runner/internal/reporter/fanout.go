@@ -0,0 +1,336 @@
+package reporter
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// SinkPolicy is how a FanOut treats one destination
+type SinkPolicy struct {
+	// Required sinks fail the report when they fail, and a run they cannot start is
+	// refused; best-effort sink failures are logged and shown in /health only
+	Required bool
+	// Timeout bounds each request to the sink
+	Timeout time.Duration
+	// BatchSize caps samples per call to the sink; 0 passes batches through as assembled
+	BatchSize int
+}
+
+// Sink is one named destination of a FanOut
+type Sink struct {
+	Name     string
+	Reporter Reporter
+	Policy   SinkPolicy
+	// Spool, if set, holds reports this sink could not take until it recovers
+	Spool *Spool
+}
+
+// NewAPISink sends reports to the Controller API at apiURL
+func NewAPISink(apiURL string, policy SinkPolicy, logger *slog.Logger) Sink {
+	api := NewAPIReporter(apiURL, logger)
+	if policy.Timeout > 0 {
+		api.client.Timeout = policy.Timeout
+	}
+	if policy.BatchSize > 0 {
+		api.batchSize = policy.BatchSize
+	}
+	return Sink{Name: "api", Reporter: api, Policy: policy}
+}
+
+// NewDBSink writes reports straight to PostgreSQL through db
+func NewDBSink(db *DBReporter, policy SinkPolicy) Sink {
+	if policy.Timeout > 0 {
+		db.timeout = policy.Timeout
+	}
+	return Sink{Name: "db", Reporter: db, Policy: policy}
+}
+
+// NewFileSink writes reports to per-run NDJSON/Parquet files through file
+func NewFileSink(file *FileReporter, policy SinkPolicy) Sink {
+	return Sink{Name: "file", Reporter: file, Policy: policy}
+}
+
+// RunStarter is implemented by sinks that must mark a run as started themselves
+// because the API, which normally does, may not be in the loop
+type RunStarter interface {
+	StartRun(runID string) error
+}
+
+// SinkHealth is one sink's delivery record for /health
+type SinkHealth struct {
+	Name                string      `json:"name"`
+	Required            bool        `json:"required"`
+	Status              string      `json:"status"` // "ok", "degraded" (spooling) or "failing"
+	Delivered           int64       `json:"delivered"`
+	Failed              int64       `json:"failed"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	LastError           string      `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time  `json:"last_error_at,omitempty"`
+	LastSuccessAt       *time.Time  `json:"last_success_at,omitempty"`
+	Spool               *SpoolStats `json:"spool,omitempty"`
+}
+
+// FanOut is a Reporter that sends every report to several sinks concurrently. It is
+// built once per process and shared by all runs, so sink health spans runs.
+type FanOut struct {
+	sinks  []*fanOutSink
+	logger *slog.Logger
+}
+
+type fanOutSink struct {
+	Sink
+	base Reporter // the sink's own reporter, below spool and health tracking
+	out  Reporter // what the fan-out calls: spooled and tracked
+
+	mu     sync.Mutex
+	health SinkHealth
+}
+
+// NewFanOut wraps each sink with health tracking and, when it has a spool, spooling
+func NewFanOut(sinks []Sink, logger *slog.Logger) *FanOut {
+	f := &FanOut{logger: logger.With("module", "reporter.fanout")}
+	for _, sink := range sinks {
+		s := &fanOutSink{
+			Sink:   sink,
+			base:   sink.Reporter,
+			health: SinkHealth{Name: sink.Name, Required: sink.Policy.Required, Status: "ok"},
+		}
+		s.out = &trackedReporter{next: sink.Reporter, sink: s}
+		if sink.Spool != nil {
+			s.out = WithSpool(s.out, sink.Spool, logger)
+		}
+		f.sinks = append(f.sinks, s)
+	}
+	return f
+}
+
+// ReplayTarget is what a sink's spool should replay into: the sink itself, with health
+// tracking but without re-spooling
+func (f *FanOut) ReplayTarget(name string) Reporter {
+	for _, s := range f.sinks {
+		if s.Name == name {
+			return &trackedReporter{next: s.base, sink: s}
+		}
+	}
+	return nil
+}
+
+// Health reports every sink's delivery state
+func (f *FanOut) Health() []SinkHealth {
+	out := make([]SinkHealth, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		s.mu.Lock()
+		h := s.health
+		s.mu.Unlock()
+		if s.Spool != nil {
+			stats := s.Spool.Stats()
+			h.Spool = &stats
+			if h.Status == "ok" && stats.Entries > 0 {
+				h.Status = "degraded"
+			}
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+// Spools lists the sinks' spools by sink name
+func (f *FanOut) Spools() map[string]*Spool {
+	spools := make(map[string]*Spool)
+	for _, s := range f.sinks {
+		if s.Spool != nil {
+			spools[s.Name] = s.Spool
+		}
+	}
+	return spools
+}
+
+// StartRun marks runID as started on every sink that needs it
+func (f *FanOut) StartRun(runID string) error {
+	var errs []error
+	for _, s := range f.sinks {
+		if starter, ok := s.base.(RunStarter); ok {
+			if err := starter.StartRun(runID); err != nil && s.Policy.Required {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f *FanOut) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return f.each(runID, "http_samples", func(s *fanOutSink) error {
+		return inBatches(samples, s.Policy.BatchSize, func(batch []domain.HTTPSample) error {
+			return s.out.ReportHTTPSamples(runID, batch)
+		})
+	})
+}
+
+func (f *FanOut) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return f.each(runID, "ws_samples", func(s *fanOutSink) error {
+		return inBatches(samples, s.Policy.BatchSize, func(batch []domain.WSSample) error {
+			return s.out.ReportWSSamples(runID, batch)
+		})
+	})
+}
+
+func (f *FanOut) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return f.each(runID, "udp_samples", func(s *fanOutSink) error {
+		return inBatches(samples, s.Policy.BatchSize, func(batch []domain.UDPSample) error {
+			return s.out.ReportUDPSamples(runID, batch)
+		})
+	})
+}
+
+func (f *FanOut) ReportIPCheck(runID string, result domain.IPCheckResult) error {
+	return f.each(runID, "ip_check", func(s *fanOutSink) error {
+		return s.out.ReportIPCheck(runID, result)
+	})
+}
+
+func (f *FanOut) ReportSummary(runID string, summary domain.RunSummary) error {
+	return f.each(runID, "summary", func(s *fanOutSink) error {
+		return s.out.ReportSummary(runID, summary)
+	})
+}
+
+func (f *FanOut) ReportIncident(runID string, incident domain.Incident) error {
+	return f.each(runID, "incident", func(s *fanOutSink) error {
+		return s.out.ReportIncident(runID, incident)
+	})
+}
+
+func (f *FanOut) UpdateStatus(runID string, status string, errorMessage string) error {
+	return f.each(runID, "status", func(s *fanOutSink) error {
+		return s.out.UpdateStatus(runID, status, errorMessage)
+	})
+}
+
+// each calls every sink concurrently and waits for all of them. Only required sinks'
+// errors are returned; best-effort failures are logged.
+func (f *FanOut) each(runID, kind string, call func(s *fanOutSink) error) error {
+	if len(f.sinks) == 1 {
+		return f.result(runID, kind, f.sinks[0], call(f.sinks[0]))
+	}
+
+	errs := make([]error, len(f.sinks))
+	var wg sync.WaitGroup
+	for i, s := range f.sinks {
+		wg.Add(1)
+		go func(i int, s *fanOutSink) {
+			defer wg.Done()
+			errs[i] = f.result(runID, kind, s, call(s))
+		}(i, s)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (f *FanOut) result(runID, kind string, s *fanOutSink, err error) error {
+	if err == nil {
+		return nil
+	}
+	if !s.Policy.Required {
+		f.logger.Warn("Best-effort sink fail",
+			"run_id", runID,
+			"sink", s.Name,
+			"kind", kind,
+			"error_detail", err.Error(),
+		)
+		return nil
+	}
+	return fmt.Errorf("%s: %w", s.Name, err)
+}
+
+// inBatches calls send with consecutive slices of at most size items; size 0 sends all
+func inBatches[T any](items []T, size int, send func([]T) error) error {
+	if size <= 0 || len(items) <= size {
+		return send(items)
+	}
+	for i := 0; i < len(items); i += size {
+		if err := send(items[i:min(i+size, len(items))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackedReporter records each call's outcome on its sink's health
+type trackedReporter struct {
+	next Reporter
+	sink *fanOutSink
+}
+
+func (r *trackedReporter) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
+	return r.sink.record(r.next.ReportHTTPSamples(runID, samples))
+}
+
+func (r *trackedReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	return r.sink.record(r.next.ReportWSSamples(runID, samples))
+}
+
+func (r *trackedReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	return r.sink.record(r.next.ReportUDPSamples(runID, samples))
+}
+
+func (r *trackedReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
+	return r.sink.record(r.next.ReportIPCheck(runID, result))
+}
+
+func (r *trackedReporter) ReportSummary(runID string, summary domain.RunSummary) error {
+	return r.sink.record(r.next.ReportSummary(runID, summary))
+}
+
+func (r *trackedReporter) ReportIncident(runID string, incident domain.Incident) error {
+	return r.sink.record(r.next.ReportIncident(runID, incident))
+}
+
+func (r *trackedReporter) UpdateStatus(runID string, status string, errorMessage string) error {
+	return r.sink.record(r.next.UpdateStatus(runID, status, errorMessage))
+}
+
+// record updates the sink's health with one call's outcome and passes err through.
+// A rejection means the sink is up, so it does not count toward failing.
+func (s *fanOutSink) record(err error) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rejected *RejectedError
+	switch {
+	case err == nil:
+		s.health.Delivered++
+		s.health.ConsecutiveFailures = 0
+		s.health.LastSuccessAt = &now
+	case errors.As(err, &rejected):
+		s.health.Failed++
+		s.health.ConsecutiveFailures = 0
+		s.health.LastError = err.Error()
+		s.health.LastErrorAt = &now
+	default:
+		s.health.Failed++
+		s.health.ConsecutiveFailures++
+		s.health.LastError = err.Error()
+		s.health.LastErrorAt = &now
+	}
+
+	s.health.Status = "ok"
+	if s.health.ConsecutiveFailures > 0 {
+		s.health.Status = "failing"
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package reporter
+
+import (
+	"errors"
+	"testing"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// startingReporter is a fakeReporter that must start runs itself
+type startingReporter struct {
+	fakeReporter
+	startErr error
+}
+
+func (r *startingReporter) StartRun(string) error { return r.startErr }
+
+func TestFanOutRequiredSinkFailures(t *testing.T) {
+	tests := []struct {
+		name          string
+		required      bool
+		startErr      error
+		reportErr     error
+		wantStartErr  bool
+		wantReportErr bool
+	}{
+		{"healthy required sink", true, nil, nil, false, false},
+		{"required sink cannot start the run", true, errUnavailable, nil, true, false},
+		{"required sink fails a report", true, nil, errUnavailable, false, true},
+		{"best-effort sink cannot start the run", false, errUnavailable, nil, false, false},
+		{"best-effort sink fails a report", false, nil, errUnavailable, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &startingReporter{fakeReporter: fakeReporter{errs: []error{tt.reportErr}}, startErr: tt.startErr}
+			f := NewFanOut([]Sink{
+				{Name: "db", Reporter: sink, Policy: SinkPolicy{Required: tt.required}},
+				{Name: "other", Reporter: &fakeReporter{}},
+			}, discardLogger)
+
+			if err := f.StartRun("run-1"); (err != nil) != tt.wantStartErr {
+				t.Errorf("StartRun error %v, want error %v", err, tt.wantStartErr)
+			}
+			err := f.ReportIncident("run-1", domain.Incident{Seq: 1})
+			if (err != nil) != tt.wantReportErr {
+				t.Errorf("ReportIncident error %v, want error %v", err, tt.wantReportErr)
+			}
+			if tt.wantReportErr && !errors.Is(err, errUnavailable) {
+				t.Errorf("ReportIncident error %v does not wrap the sink's", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/xitongsys/parquet-go/writer"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Parquet rows are flat copies of the sample types. Hop timings, the only nested field,
+// are kept as a JSON string column; measured_at is a UTC millisecond timestamp.
+
+type httpSampleRow struct {
+	Seq                 int64   `parquet:"name=seq, type=INT64"`
+	IsWarmup            bool    `parquet:"name=is_warmup, type=BOOLEAN"`
+	TargetURL           string  `parquet:"name=target_url, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Method              string  `parquet:"name=method, type=BYTE_ARRAY, convertedtype=UTF8"`
+	IsHTTPS             bool    `parquet:"name=is_https, type=BOOLEAN"`
+	StatusCode          int32   `parquet:"name=status_code, type=INT32"`
+	ErrorType           string  `parquet:"name=error_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ErrorMessage        string  `parquet:"name=error_message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TCPConnectMS        float64 `parquet:"name=tcp_connect_ms, type=DOUBLE"`
+	SOCKSHandshakeMS    float64 `parquet:"name=socks_handshake_ms, type=DOUBLE"`
+	TLSHandshakeMS      float64 `parquet:"name=tls_handshake_ms, type=DOUBLE"`
+	ProxyTLSHandshakeMS float64 `parquet:"name=proxy_tls_handshake_ms, type=DOUBLE"`
+	ProxyTLSVersion     string  `parquet:"name=proxy_tls_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProxyTLSCipher      string  `parquet:"name=proxy_tls_cipher, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ConnectUDPMS        float64 `parquet:"name=connect_udp_ms, type=DOUBLE"`
+	ProxyAuthScheme     string  `parquet:"name=proxy_auth_scheme, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProxyAuthRoundTrips int32   `parquet:"name=proxy_auth_round_trips, type=INT32"`
+	ProxyAuthMS         float64 `parquet:"name=proxy_auth_ms, type=DOUBLE"`
+	ObservedIP          string  `parquet:"name=observed_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ObservedIPFamily    string  `parquet:"name=observed_ip_family, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TTFBMS              float64 `parquet:"name=ttfb_ms, type=DOUBLE"`
+	TotalMS             float64 `parquet:"name=total_ms, type=DOUBLE"`
+	TLSVersion          string  `parquet:"name=tls_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TLSCipher           string  `parquet:"name=tls_cipher, type=BYTE_ARRAY, convertedtype=UTF8"`
+	NegotiatedProtocol  string  `parquet:"name=negotiated_protocol, type=BYTE_ARRAY, convertedtype=UTF8"`
+	H2Streams           int32   `parquet:"name=h2_streams, type=INT32"`
+	H2StreamAvgMS       float64 `parquet:"name=h2_stream_avg_ms, type=DOUBLE"`
+	H2StreamMaxMS       float64 `parquet:"name=h2_stream_max_ms, type=DOUBLE"`
+	H2StreamResets      int32   `parquet:"name=h2_stream_resets, type=INT32"`
+	BytesSent           int64   `parquet:"name=bytes_sent, type=INT64"`
+	BytesReceived       int64   `parquet:"name=bytes_received, type=INT64"`
+	HopTimings          string  `parquet:"name=hop_timings, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TargetRPM           float64 `parquet:"name=target_rpm, type=DOUBLE"`
+	MeasuredAt          int64   `parquet:"name=measured_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+type wsSampleRow struct {
+	Seq                 int64   `parquet:"name=seq, type=INT64"`
+	IsWarmup            bool    `parquet:"name=is_warmup, type=BOOLEAN"`
+	TargetURL           string  `parquet:"name=target_url, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Connected           bool    `parquet:"name=connected, type=BOOLEAN"`
+	IsWSS               bool    `parquet:"name=is_wss, type=BOOLEAN"`
+	ErrorType           string  `parquet:"name=error_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ErrorMessage        string  `parquet:"name=error_message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TCPConnectMS        float64 `parquet:"name=tcp_connect_ms, type=DOUBLE"`
+	SOCKSHandshakeMS    float64 `parquet:"name=socks_handshake_ms, type=DOUBLE"`
+	TLSHandshakeMS      float64 `parquet:"name=tls_handshake_ms, type=DOUBLE"`
+	ProxyTLSHandshakeMS float64 `parquet:"name=proxy_tls_handshake_ms, type=DOUBLE"`
+	ProxyTLSVersion     string  `parquet:"name=proxy_tls_version, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProxyTLSCipher      string  `parquet:"name=proxy_tls_cipher, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProxyAuthScheme     string  `parquet:"name=proxy_auth_scheme, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ProxyAuthRoundTrips int32   `parquet:"name=proxy_auth_round_trips, type=INT32"`
+	ProxyAuthMS         float64 `parquet:"name=proxy_auth_ms, type=DOUBLE"`
+	ObservedIPFamily    string  `parquet:"name=observed_ip_family, type=BYTE_ARRAY, convertedtype=UTF8"`
+	HandshakeMS         float64 `parquet:"name=handshake_ms, type=DOUBLE"`
+	MessageRTTMS        float64 `parquet:"name=message_rtt_ms, type=DOUBLE"`
+	ConnectionHeldMS    float64 `parquet:"name=connection_held_ms, type=DOUBLE"`
+	DisconnectReason    string  `parquet:"name=disconnect_reason, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MessagesSent        int32   `parquet:"name=messages_sent, type=INT32"`
+	MessagesReceived    int32   `parquet:"name=messages_received, type=INT32"`
+	DropCount           int32   `parquet:"name=drop_count, type=INT32"`
+	HopTimings          string  `parquet:"name=hop_timings, type=BYTE_ARRAY, convertedtype=UTF8"`
+	MeasuredAt          int64   `parquet:"name=measured_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+type udpSampleRow struct {
+	Seq              int64   `parquet:"name=seq, type=INT64"`
+	IsWarmup         bool    `parquet:"name=is_warmup, type=BOOLEAN"`
+	TargetAddr       string  `parquet:"name=target_addr, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Associated       bool    `parquet:"name=associated, type=BOOLEAN"`
+	ErrorType        string  `parquet:"name=error_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ErrorMessage     string  `parquet:"name=error_message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TCPConnectMS     float64 `parquet:"name=tcp_connect_ms, type=DOUBLE"`
+	SOCKSHandshakeMS float64 `parquet:"name=socks_handshake_ms, type=DOUBLE"`
+	PacketsSent      int32   `parquet:"name=packets_sent, type=INT32"`
+	PacketsReceived  int32   `parquet:"name=packets_received, type=INT32"`
+	LostCount        int32   `parquet:"name=lost_count, type=INT32"`
+	ReorderedCount   int32   `parquet:"name=reordered_count, type=INT32"`
+	DuplicateCount   int32   `parquet:"name=duplicate_count, type=INT32"`
+	RTTAvgMS         float64 `parquet:"name=rtt_avg_ms, type=DOUBLE"`
+	RTTMinMS         float64 `parquet:"name=rtt_min_ms, type=DOUBLE"`
+	RTTMaxMS         float64 `parquet:"name=rtt_max_ms, type=DOUBLE"`
+	JitterMS         float64 `parquet:"name=jitter_ms, type=DOUBLE"`
+	MeasuredAt       int64   `parquet:"name=measured_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+// convertToParquet writes the NDJSON file src of kind to dst as Parquet and returns the
+// row count and file size. Kinds without a schema return -1 rows and write nothing.
+func convertToParquet(src, dst, kind string) (int, int64, error) {
+	var rows []any
+	var schema any
+	switch kind {
+	case fileHTTPSamples:
+		samples, err := readNDJSON[domain.HTTPSample](src)
+		if err != nil {
+			return 0, 0, err
+		}
+		schema = new(httpSampleRow)
+		for _, s := range samples {
+			rows = append(rows, httpRow(s))
+		}
+	case fileWSSamples:
+		samples, err := readNDJSON[domain.WSSample](src)
+		if err != nil {
+			return 0, 0, err
+		}
+		schema = new(wsSampleRow)
+		for _, s := range samples {
+			rows = append(rows, wsRow(s))
+		}
+	case fileUDPSamples:
+		samples, err := readNDJSON[domain.UDPSample](src)
+		if err != nil {
+			return 0, 0, err
+		}
+		schema = new(udpSampleRow)
+		for _, s := range samples {
+			rows = append(rows, udpRow(s))
+		}
+	default:
+		return -1, 0, nil
+	}
+
+	tmp := dst + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmp)
+
+	pw, err := writer.NewParquetWriterFromWriter(f, schema, 1)
+	if err != nil {
+		f.Close()
+		return 0, 0, fmt.Errorf("create parquet writer: %w", err)
+	}
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			f.Close()
+			return 0, 0, fmt.Errorf("write parquet row: %w", err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		f.Close()
+		return 0, 0, fmt.Errorf("finish parquet: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return 0, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return 0, 0, err
+	}
+	return len(rows), info.Size(), nil
+}
+
+func httpRow(s domain.HTTPSample) httpSampleRow {
+	return httpSampleRow{
+		Seq:                 int64(s.Seq),
+		IsWarmup:            s.IsWarmup,
+		TargetURL:           s.TargetURL,
+		Method:              s.Method,
+		IsHTTPS:             s.IsHTTPS,
+		StatusCode:          int32(s.StatusCode),
+		ErrorType:           s.ErrorType,
+		ErrorMessage:        s.ErrorMessage,
+		TCPConnectMS:        s.TCPConnectMS,
+		SOCKSHandshakeMS:    s.SOCKSHandshakeMS,
+		TLSHandshakeMS:      s.TLSHandshakeMS,
+		ProxyTLSHandshakeMS: s.ProxyTLSHandshakeMS,
+		ProxyTLSVersion:     s.ProxyTLSVersion,
+		ProxyTLSCipher:      s.ProxyTLSCipher,
+		ConnectUDPMS:        s.ConnectUDPMS,
+		ProxyAuthScheme:     s.ProxyAuthScheme,
+		ProxyAuthRoundTrips: int32(s.ProxyAuthRoundTrips),
+		ProxyAuthMS:         s.ProxyAuthMS,
+		ObservedIP:          s.ObservedIP,
+		ObservedIPFamily:    s.ObservedIPFamily,
+		TTFBMS:              s.TTFBMS,
+		TotalMS:             s.TotalMS,
+		TLSVersion:          s.TLSVersion,
+		TLSCipher:           s.TLSCipher,
+		NegotiatedProtocol:  s.NegotiatedProtocol,
+		H2Streams:           int32(s.H2Streams),
+		H2StreamAvgMS:       s.H2StreamAvgMS,
+		H2StreamMaxMS:       s.H2StreamMaxMS,
+		H2StreamResets:      int32(s.H2StreamResets),
+		BytesSent:           s.BytesSent,
+		BytesReceived:       s.BytesReceived,
+		HopTimings:          hopTimingsJSON(s.HopTimings),
+		TargetRPM:           s.TargetRPM,
+		MeasuredAt:          s.MeasuredAt.UnixMilli(),
+	}
+}
+
+func wsRow(s domain.WSSample) wsSampleRow {
+	return wsSampleRow{
+		Seq:                 int64(s.Seq),
+		IsWarmup:            s.IsWarmup,
+		TargetURL:           s.TargetURL,
+		Connected:           s.Connected,
+		IsWSS:               s.IsWSS,
+		ErrorType:           s.ErrorType,
+		ErrorMessage:        s.ErrorMessage,
+		TCPConnectMS:        s.TCPConnectMS,
+		SOCKSHandshakeMS:    s.SOCKSHandshakeMS,
+		TLSHandshakeMS:      s.TLSHandshakeMS,
+		ProxyTLSHandshakeMS: s.ProxyTLSHandshakeMS,
+		ProxyTLSVersion:     s.ProxyTLSVersion,
+		ProxyTLSCipher:      s.ProxyTLSCipher,
+		ProxyAuthScheme:     s.ProxyAuthScheme,
+		ProxyAuthRoundTrips: int32(s.ProxyAuthRoundTrips),
+		ProxyAuthMS:         s.ProxyAuthMS,
+		ObservedIPFamily:    s.ObservedIPFamily,
+		HandshakeMS:         s.HandshakeMS,
+		MessageRTTMS:        s.MessageRTTMS,
+		ConnectionHeldMS:    s.ConnectionHeldMS,
+		DisconnectReason:    s.DisconnectReason,
+		MessagesSent:        int32(s.MessagesSent),
+		MessagesReceived:    int32(s.MessagesReceived),
+		DropCount:           int32(s.DropCount),
+		HopTimings:          hopTimingsJSON(s.HopTimings),
+		MeasuredAt:          s.MeasuredAt.UnixMilli(),
+	}
+}
+
+func udpRow(s domain.UDPSample) udpSampleRow {
+	return udpSampleRow{
+		Seq:              int64(s.Seq),
+		IsWarmup:         s.IsWarmup,
+		TargetAddr:       s.TargetAddr,
+		Associated:       s.Associated,
+		ErrorType:        s.ErrorType,
+		ErrorMessage:     s.ErrorMessage,
+		TCPConnectMS:     s.TCPConnectMS,
+		SOCKSHandshakeMS: s.SOCKSHandshakeMS,
+		PacketsSent:      int32(s.PacketsSent),
+		PacketsReceived:  int32(s.PacketsReceived),
+		LostCount:        int32(s.LostCount),
+		ReorderedCount:   int32(s.ReorderedCount),
+		DuplicateCount:   int32(s.DuplicateCount),
+		RTTAvgMS:         s.RTTAvgMS,
+		RTTMinMS:         s.RTTMinMS,
+		RTTMaxMS:         s.RTTMaxMS,
+		JitterMS:         s.JitterMS,
+		MeasuredAt:       s.MeasuredAt.UnixMilli(),
+	}
+}
+
+// hopTimingsJSON encodes a chained dial's hops; unchained samples get an empty string
+func hopTimingsJSON(hops []domain.HopTiming) string {
+	if len(hops) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(hops)
+	return string(data)
+}
@@ -0,0 +1,393 @@
+package reporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// FileReporter writes each run's results under dir/<run_id>/ as NDJSON, one file series
+// per record kind, rotated by size, plus a manifest.json describing the run and its files.
+// With Parquet enabled every sealed sample file is also converted to a .parquet file
+// alongside it. The directory is self-contained, so a run can be archived, shipped and
+// loaded into a notebook without the API.
+type FileReporter struct {
+	dir          string
+	maxFileBytes int64
+	parquet      bool
+	logger       *slog.Logger
+
+	mu   sync.Mutex
+	runs map[string]*fileRun
+}
+
+// FileOptions tunes a FileReporter
+type FileOptions struct {
+	// MaxFileBytes starts a new file of the same kind once the current one reaches it;
+	// 0 means 64 MiB
+	MaxFileBytes int64
+	// Parquet also writes a .parquet copy of every sealed HTTP, WS and UDP sample file
+	Parquet bool
+}
+
+const (
+	fileDefaultMaxBytes = 64 << 20
+	fileManifestName    = "manifest.json"
+)
+
+// Result file kinds; each is a series of <kind>-NNNN.ndjson files
+const (
+	fileHTTPSamples = "http_samples"
+	fileWSSamples   = "ws_samples"
+	fileUDPSamples  = "udp_samples"
+	fileIPChecks    = "ip_checks"
+	fileSummaries   = "summaries"
+	fileIncidents   = "incidents"
+)
+
+// fileManifest is manifest.json: the run's status and every file written for it
+type fileManifest struct {
+	RunID        string         `json:"run_id"`
+	Status       string         `json:"status"`
+	ErrorMessage string         `json:"error_message,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	FinishedAt   *time.Time     `json:"finished_at,omitempty"`
+	Files        []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Format  string `json:"format"` // "ndjson" or "parquet"
+	Records int    `json:"records"`
+	Bytes   int64  `json:"bytes"`
+	Sealed  bool   `json:"sealed"` // no more records will be appended
+}
+
+// fileRun is one run's open files; mu serializes writes to the run directory
+type fileRun struct {
+	dir string
+
+	mu       sync.Mutex
+	manifest fileManifest
+	open     map[string]*fileSegment // by kind
+	next     map[string]int          // next file number by kind
+}
+
+type fileSegment struct {
+	f     *os.File
+	entry int // index into manifest.Files
+}
+
+// NewFileReporter writes run directories under dir, creating it if needed
+func NewFileReporter(dir string, opts FileOptions, logger *slog.Logger) (*FileReporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create results dir: %w", err)
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = fileDefaultMaxBytes
+	}
+	return &FileReporter{
+		dir:          dir,
+		maxFileBytes: opts.MaxFileBytes,
+		parquet:      opts.Parquet,
+		logger:       logger.With("module", "reporter.file_reporter"),
+		runs:         make(map[string]*fileRun),
+	}, nil
+}
+
+// StartRun creates the run directory and its manifest with status running
+func (r *FileReporter) StartRun(runID string) error {
+	run, err := r.run(runID)
+	if err != nil {
+		return err
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.manifest.Status == "" {
+		run.manifest.Status = "running"
+	}
+	return r.writeManifest(run)
+}
+
+func (r *FileReporter) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
+	return appendRecords(r, runID, fileHTTPSamples, samples)
+}
+
+func (r *FileReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	return appendRecords(r, runID, fileWSSamples, samples)
+}
+
+func (r *FileReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	return appendRecords(r, runID, fileUDPSamples, samples)
+}
+
+func (r *FileReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
+	return appendRecords(r, runID, fileIPChecks, []domain.IPCheckResult{result})
+}
+
+func (r *FileReporter) ReportSummary(runID string, summary domain.RunSummary) error {
+	return appendRecords(r, runID, fileSummaries, []domain.RunSummary{summary})
+}
+
+// ReportIncident appends the incident each time it opens or ends; the last record per
+// seq is its final state
+func (r *FileReporter) ReportIncident(runID string, incident domain.Incident) error {
+	return appendRecords(r, runID, fileIncidents, []domain.Incident{incident})
+}
+
+// UpdateStatus records the status in the manifest. A terminal status seals the run's
+// open files (writing their Parquet copies) and releases them.
+func (r *FileReporter) UpdateStatus(runID string, status string, errorMessage string) error {
+	run, err := r.run(runID)
+	if err != nil {
+		return err
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	run.manifest.Status = status
+	run.manifest.ErrorMessage = errorMessage
+	terminal := isTerminal(status)
+	if terminal {
+		now := time.Now().UTC()
+		run.manifest.FinishedAt = &now
+		for kind := range run.open {
+			r.seal(run, kind)
+		}
+	}
+	if err := r.writeManifest(run); err != nil {
+		return err
+	}
+
+	if terminal {
+		r.forget(runID, run)
+		r.logger.Info("Run files sealed",
+			"run_id", runID,
+			"status", status,
+			"dir", run.dir,
+			"files", len(run.manifest.Files),
+		)
+	}
+	return nil
+}
+
+// appendRecords writes records as NDJSON lines to the run's current file of kind,
+// rotating first if that file is full
+func appendRecords[T any](r *FileReporter, runID, kind string, records []T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return &RejectedError{Reason: fmt.Sprintf("encode %s: %s", kind, err)}
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	run, err := r.run(runID)
+	if err != nil {
+		return err
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	seg, err := r.segment(run, kind)
+	if err != nil {
+		return err
+	}
+	if _, err := seg.f.Write(buf); err != nil {
+		return fmt.Errorf("write %s: %w", kind, err)
+	}
+	if err := seg.f.Sync(); err != nil {
+		return fmt.Errorf("sync %s: %w", kind, err)
+	}
+
+	file := &run.manifest.Files[seg.entry]
+	file.Records += len(records)
+	file.Bytes += int64(len(buf))
+	// Late reports for a finished run (e.g. replayed from a spool) are sealed at once
+	finished := isTerminal(run.manifest.Status)
+	if file.Bytes >= r.maxFileBytes || finished {
+		r.seal(run, kind)
+	}
+	if err := r.writeManifest(run); err != nil {
+		return err
+	}
+	if finished {
+		r.forget(runID, run)
+	}
+	return nil
+}
+
+// run returns the state for runID, resuming from an existing manifest when a previous
+// process (or an earlier terminal status) left one behind
+func (r *FileReporter) run(runID string) (*fileRun, error) {
+	if runID == "" || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return nil, &RejectedError{Reason: fmt.Sprintf("run id %q is not usable as a directory name", runID)}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run, ok := r.runs[runID]; ok {
+		return run, nil
+	}
+
+	dir := filepath.Join(r.dir, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create run dir: %w", err)
+	}
+	now := time.Now().UTC()
+	run := &fileRun{
+		dir:      dir,
+		manifest: fileManifest{RunID: runID, CreatedAt: now, UpdatedAt: now, Files: []manifestFile{}},
+		open:     make(map[string]*fileSegment),
+		next:     make(map[string]int),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, fileManifestName))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &run.manifest); err != nil {
+			return nil, fmt.Errorf("read manifest: %w", err)
+		}
+		// Files left open by a previous process are never appended to again
+		for i := range run.manifest.Files {
+			file := &run.manifest.Files[i]
+			if file.Format == "ndjson" {
+				run.next[file.Kind]++
+			}
+			if !file.Sealed {
+				file.Sealed = true
+				r.writeParquet(run, *file)
+			}
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	r.runs[runID] = run
+	return run, nil
+}
+
+// segment returns the open file of kind, starting a new one if none is open
+func (r *FileReporter) segment(run *fileRun, kind string) (*fileSegment, error) {
+	if seg, ok := run.open[kind]; ok {
+		return seg, nil
+	}
+	run.next[kind]++
+	name := fmt.Sprintf("%s-%04d.ndjson", kind, run.next[kind])
+	f, err := os.OpenFile(filepath.Join(run.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+	run.manifest.Files = append(run.manifest.Files, manifestFile{Name: name, Kind: kind, Format: "ndjson"})
+	seg := &fileSegment{f: f, entry: len(run.manifest.Files) - 1}
+	run.open[kind] = seg
+	return seg, nil
+}
+
+// seal closes the open file of kind and writes its Parquet copy
+func (r *FileReporter) seal(run *fileRun, kind string) {
+	seg, ok := run.open[kind]
+	if !ok {
+		return
+	}
+	delete(run.open, kind)
+	if err := seg.f.Close(); err != nil {
+		r.logger.Warn("Result file close fail",
+			"run_id", run.manifest.RunID,
+			"file", run.manifest.Files[seg.entry].Name,
+			"error_detail", err.Error(),
+		)
+	}
+	run.manifest.Files[seg.entry].Sealed = true
+	r.writeParquet(run, run.manifest.Files[seg.entry])
+}
+
+// writeParquet converts a sealed NDJSON sample file and lists the result in the manifest.
+// Parquet is a convenience copy, so failures are logged and the NDJSON stays authoritative.
+func (r *FileReporter) writeParquet(run *fileRun, file manifestFile) {
+	if !r.parquet || file.Format != "ndjson" || file.Records == 0 {
+		return
+	}
+	name := strings.TrimSuffix(file.Name, ".ndjson") + ".parquet"
+	records, size, err := convertToParquet(filepath.Join(run.dir, file.Name), filepath.Join(run.dir, name), file.Kind)
+	if err != nil {
+		r.logger.Warn("Parquet write fail",
+			"run_id", run.manifest.RunID,
+			"file", file.Name,
+			"error_detail", err.Error(),
+		)
+		return
+	}
+	if records < 0 {
+		return // kind has no Parquet schema
+	}
+	run.manifest.Files = append(run.manifest.Files, manifestFile{
+		Name:    name,
+		Kind:    file.Kind,
+		Format:  "parquet",
+		Records: records,
+		Bytes:   size,
+		Sealed:  true,
+	})
+}
+
+// forget drops a finished run's state; a later report reloads it from the manifest
+func (r *FileReporter) forget(runID string, run *fileRun) {
+	r.mu.Lock()
+	if r.runs[runID] == run {
+		delete(r.runs, runID)
+	}
+	r.mu.Unlock()
+}
+
+func isTerminal(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+// writeManifest atomically replaces manifest.json with the run's current state
+func (r *FileReporter) writeManifest(run *fileRun) error {
+	run.manifest.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(run.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(run.dir, fileManifestName), append(data, '\n')); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// readNDJSON decodes every line of path into T, skipping a torn final line left by a crash
+func readNDJSON[T any](path string) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var rec T
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, scanner.Err()
+}
@@ -0,0 +1,56 @@
+package reporter
+
+import (
+	"proxy-stability-test/runner/internal/domain"
+	"proxy-stability-test/runner/internal/metrics"
+)
+
+// MetricsReporter publishes samples and summaries to the registry GET /metrics serves.
+// Series are labelled with the proxy label registered for the run (metrics.RegisterRun).
+type MetricsReporter struct{}
+
+// NewMetricsSink feeds the Prometheus metrics; it never fails, so it is not worth spooling
+func NewMetricsSink(policy SinkPolicy) Sink {
+	return Sink{Name: "metrics", Reporter: MetricsReporter{}, Policy: policy}
+}
+
+func (MetricsReporter) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
+	label := metrics.RunLabel(runID)
+	for _, s := range samples {
+		metrics.ObserveHTTPSample(runID, label, s)
+	}
+	return nil
+}
+
+func (MetricsReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	label := metrics.RunLabel(runID)
+	for _, s := range samples {
+		metrics.ObserveWSSample(runID, label, s)
+	}
+	return nil
+}
+
+func (MetricsReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	label := metrics.RunLabel(runID)
+	for _, s := range samples {
+		metrics.ObserveUDPSample(runID, label, s)
+	}
+	return nil
+}
+
+// ReportSummary publishes the rolling and final summaries' scores, or a trailing window's
+// total score
+func (MetricsReporter) ReportSummary(runID string, summary domain.RunSummary) error {
+	if summary.Window != "" {
+		metrics.SetWindowScore(runID, metrics.RunLabel(runID), summary)
+		return nil
+	}
+	metrics.SetScores(runID, metrics.RunLabel(runID), summary)
+	return nil
+}
+
+func (MetricsReporter) ReportIPCheck(string, domain.IPCheckResult) error { return nil }
+
+func (MetricsReporter) ReportIncident(string, domain.Incident) error { return nil }
+
+func (MetricsReporter) UpdateStatus(string, string, string) error { return nil }
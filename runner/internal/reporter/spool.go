@@ -0,0 +1,628 @@
+package reporter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+// Spool is a write-ahead queue for reports the destination could not take. Entries are
+// NDJSON lines in numbered segment files under one directory; the replayer delivers them
+// oldest first and removes each segment once drained, so a restarted runner resumes where
+// the previous process stopped. Past its limits the spool drops whole segments, oldest
+// first, and counts the entries lost.
+type Spool struct {
+	dir    string
+	limits SpoolLimits
+	logger *slog.Logger
+
+	drainMu    sync.Mutex // held while segments are replayed or dropped
+	mu         sync.Mutex
+	active     *os.File // segment appends go to; nil until the next append
+	activeSize int64
+	nextSeq    uint64
+	entries    int
+	bytes      int64
+	oldest     time.Time // spooled_at of the oldest pending entry
+	dropped    int64     // entries dropped over the limits since the spool opened
+}
+
+// SpoolLimits bounds the backlog on disk; zero leaves that dimension unbounded
+type SpoolLimits struct {
+	MaxBytes int64
+	MaxAge   time.Duration
+}
+
+const (
+	spoolSegmentExt      = ".ndjson"
+	spoolSegmentMaxBytes = 4 << 20
+	spoolPollInterval    = 2 * time.Second
+	spoolMaxBackoff      = time.Minute
+)
+
+// Spool entry kinds, one per Reporter method
+const (
+	spoolHTTPSamples = "http_samples"
+	spoolWSSamples   = "ws_samples"
+	spoolUDPSamples  = "udp_samples"
+	spoolIPCheck     = "ip_check"
+	spoolSummary     = "summary"
+	spoolIncident    = "incident"
+	spoolStatus      = "status"
+)
+
+type spoolEntry struct {
+	Kind      string          `json:"kind"`
+	RunID     string          `json:"run_id"`
+	SpooledAt time.Time       `json:"spooled_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type spoolStatusPayload struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// SpoolStats is the backlog waiting for the destination
+type SpoolStats struct {
+	Entries      int     `json:"entries"`
+	Segments     int     `json:"segments"`
+	Bytes        int64   `json:"bytes"`
+	OldestAgeSec float64 `json:"oldest_age_sec"`
+	Dropped      int64   `json:"dropped"` // entries dropped over the spool's limits
+}
+
+// OpenSpool opens (creating if needed) the spool in dir and counts what a previous
+// process left behind
+func OpenSpool(dir string, limits SpoolLimits, logger *slog.Logger) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &Spool{
+		dir:     dir,
+		limits:  limits,
+		logger:  logger.With("module", "reporter.spool"),
+		nextSeq: 1,
+	}
+
+	seqs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		n, size, err := countLines(s.path(seq))
+		if err != nil {
+			return nil, err
+		}
+		s.entries += n
+		s.bytes += size
+		s.nextSeq = seq + 1
+	}
+	s.refreshOldest()
+
+	s.logger.Info("Spool opened",
+		"phase", "startup",
+		"spool_dir", dir,
+		"entries", s.entries,
+		"segments", len(seqs),
+	)
+	return s, nil
+}
+
+// Depth is the number of entries waiting to be replayed
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries
+}
+
+// Stats reports spool depth and the age of the oldest entry
+func (s *Spool) Stats() SpoolStats {
+	seqs, _ := s.segments()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SpoolStats{Entries: s.entries, Segments: len(seqs), Bytes: s.bytes, Dropped: s.dropped}
+	if s.entries > 0 && !s.oldest.IsZero() {
+		stats.OldestAgeSec = time.Since(s.oldest).Seconds()
+	}
+	return stats
+}
+
+// Append writes one report to the newest segment and syncs it to disk, then drops the
+// oldest segments if that took the spool over its limits and no replay is running
+func (s *Spool) Append(kind, runID string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal spool payload: %w", err)
+	}
+	entry := spoolEntry{Kind: kind, RunID: runID, SpooledAt: time.Now().UTC(), Payload: raw}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal spool entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	if err := s.write(line, entry.SpooledAt); err != nil {
+		return err
+	}
+	if s.drainMu.TryLock() {
+		s.enforceLimits()
+		s.drainMu.Unlock()
+	}
+	return nil
+}
+
+func (s *Spool) write(line []byte, spooledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil || s.activeSize+int64(len(line)) > spoolSegmentMaxBytes {
+		s.closeActive()
+		f, err := os.OpenFile(s.path(s.nextSeq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("open spool segment: %w", err)
+		}
+		s.active = f
+		s.activeSize = 0
+		s.nextSeq++
+	}
+	if _, err := s.active.Write(line); err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+
+	s.activeSize += int64(len(line))
+	s.bytes += int64(len(line))
+	s.entries++
+	if s.entries == 1 {
+		s.oldest = spooledAt
+	}
+	return nil
+}
+
+// Replay delivers spooled entries to target, oldest first, until ctx is done. Failed
+// deliveries back off up to a minute; rejected entries are logged and dropped.
+func (s *Spool) Replay(ctx context.Context, target Reporter) {
+	wait := spoolPollInterval
+	for {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.closeActive()
+			s.mu.Unlock()
+			return
+		case <-time.After(wait):
+		}
+
+		if s.Depth() == 0 {
+			wait = spoolPollInterval
+			continue
+		}
+
+		start := s.Depth()
+		if err := s.drain(target); err != nil {
+			wait = min(wait*2, spoolMaxBackoff)
+			s.logger.Warn("Spool replay paused",
+				"phase", "continuous",
+				"entries", s.Depth(),
+				"retry_in_ms", wait.Milliseconds(),
+				"error_detail", err.Error(),
+			)
+			continue
+		}
+		wait = spoolPollInterval
+		s.logger.Info("Spool drained",
+			"phase", "continuous",
+			"replayed", start,
+		)
+	}
+}
+
+// drain applies the limits, seals the active segment so new appends start a fresh one,
+// then delivers every sealed segment in order
+func (s *Spool) drain(target Reporter) error {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+	s.enforceLimits()
+
+	s.mu.Lock()
+	s.closeActive()
+	seqs, err := s.segments()
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range seqs {
+		if err := s.drainSegment(seq, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drainSegment delivers one sealed segment. On failure the undelivered tail is written
+// back so a restart does not replay what the destination already has.
+func (s *Spool) drainSegment(seq uint64, target Reporter) error {
+	path := s.path(seq)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read spool segment: %w", err)
+	}
+
+	var delivered int
+	var deliveredBytes int64
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+
+		var entry spoolEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			// A torn write from a crash; nothing to deliver
+			s.logger.Error("Spool entry corrupt, dropping",
+				"segment", filepath.Base(path),
+				"error_detail", err.Error(),
+			)
+		} else if err := deliver(target, entry); err != nil {
+			var rejected *RejectedError
+			if !errors.As(err, &rejected) {
+				if delivered > 0 {
+					if werr := writeFileAtomic(path, data); werr != nil {
+						return fmt.Errorf("rewrite spool segment: %w", werr)
+					}
+				}
+				s.consumed(delivered, deliveredBytes)
+				return err
+			}
+			s.logger.Error("Spooled report rejected, dropping",
+				"run_id", entry.RunID,
+				"kind", entry.Kind,
+				"spooled_at", entry.SpooledAt,
+				"error_detail", err.Error(),
+			)
+		}
+
+		delivered++
+		deliveredBytes += int64(len(line))
+		data = data[len(line):]
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove spool segment: %w", err)
+	}
+	s.consumed(delivered, deliveredBytes)
+	return nil
+}
+
+// enforceLimits drops the oldest segment while the spool holds more than MaxBytes or its
+// oldest entry is older than MaxAge. A lone active segment is sealed first. Callers
+// hold drainMu.
+func (s *Spool) enforceLimits() {
+	for {
+		s.mu.Lock()
+		reason := s.overLimit()
+		if reason == "" {
+			s.mu.Unlock()
+			return
+		}
+		seqs, err := s.segments()
+		if err != nil || len(seqs) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		if len(seqs) == 1 {
+			s.closeActive()
+		}
+		path := s.path(seqs[0])
+		n, size, err := countLines(path)
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			s.logger.Error("Spool segment drop fail",
+				"segment", filepath.Base(path),
+				"error_detail", err.Error(),
+			)
+			return
+		}
+		s.entries = max(s.entries-n, 0)
+		s.bytes = max(s.bytes-size, 0)
+		s.dropped += int64(n)
+		s.refreshOldest()
+		s.mu.Unlock()
+
+		s.logger.Warn("Spool over limit, oldest segment dropped",
+			"segment", filepath.Base(path),
+			"reason", reason,
+			"dropped", n,
+		)
+	}
+}
+
+// overLimit names the limit the spool is over, or ""; callers hold mu
+func (s *Spool) overLimit() string {
+	switch {
+	case s.entries == 0:
+		return ""
+	case s.limits.MaxBytes > 0 && s.bytes > s.limits.MaxBytes:
+		return "max_bytes"
+	case s.limits.MaxAge > 0 && !s.oldest.IsZero() && time.Since(s.oldest) > s.limits.MaxAge:
+		return "max_age"
+	}
+	return ""
+}
+
+// consumed removes delivered entries from the counters
+func (s *Spool) consumed(entries int, size int64) {
+	if entries == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = max(s.entries-entries, 0)
+	s.bytes = max(s.bytes-size, 0)
+	s.refreshOldest()
+}
+
+// refreshOldest re-reads the first pending entry's timestamp; callers hold mu
+func (s *Spool) refreshOldest() {
+	s.oldest = time.Time{}
+	if s.entries == 0 {
+		return
+	}
+	seqs, err := s.segments()
+	if err != nil {
+		return
+	}
+	for _, seq := range seqs {
+		f, err := os.Open(s.path(seq))
+		if err != nil {
+			continue
+		}
+		line, _ := bufio.NewReader(f).ReadBytes('\n')
+		f.Close()
+		var entry spoolEntry
+		if json.Unmarshal(bytes.TrimSpace(line), &entry) == nil {
+			s.oldest = entry.SpooledAt
+			return
+		}
+	}
+}
+
+// closeActive seals the segment being appended to; callers hold mu
+func (s *Spool) closeActive() {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+}
+
+// segments lists segment sequence numbers in order
+func (s *Spool) segments() ([]uint64, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list spool dir: %w", err)
+	}
+	var seqs []uint64
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// deliver replays one entry through the matching Reporter method. Entries that no
+// longer decode are rejected rather than retried forever.
+func deliver(target Reporter, entry spoolEntry) error {
+	decode := func(v any) error {
+		if err := json.Unmarshal(entry.Payload, v); err != nil {
+			return &RejectedError{Reason: "undecodable spool payload: " + err.Error()}
+		}
+		return nil
+	}
+
+	switch entry.Kind {
+	case spoolHTTPSamples:
+		var samples []domain.HTTPSample
+		if err := decode(&samples); err != nil {
+			return err
+		}
+		return target.ReportHTTPSamples(entry.RunID, samples)
+	case spoolWSSamples:
+		var samples []domain.WSSample
+		if err := decode(&samples); err != nil {
+			return err
+		}
+		return target.ReportWSSamples(entry.RunID, samples)
+	case spoolUDPSamples:
+		var samples []domain.UDPSample
+		if err := decode(&samples); err != nil {
+			return err
+		}
+		return target.ReportUDPSamples(entry.RunID, samples)
+	case spoolIPCheck:
+		var result domain.IPCheckResult
+		if err := decode(&result); err != nil {
+			return err
+		}
+		return target.ReportIPCheck(entry.RunID, result)
+	case spoolSummary:
+		var summary domain.RunSummary
+		if err := decode(&summary); err != nil {
+			return err
+		}
+		return target.ReportSummary(entry.RunID, summary)
+	case spoolIncident:
+		var incident domain.Incident
+		if err := decode(&incident); err != nil {
+			return err
+		}
+		return target.ReportIncident(entry.RunID, incident)
+	case spoolStatus:
+		var status spoolStatusPayload
+		if err := decode(&status); err != nil {
+			return err
+		}
+		return target.UpdateStatus(entry.RunID, status.Status, status.ErrorMessage)
+	default:
+		return &RejectedError{Reason: "unknown spool entry kind " + entry.Kind}
+	}
+}
+
+func countLines(path string) (int, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read spool segment: %w", err)
+	}
+	n := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		n++ // torn final line, dropped on replay
+	}
+	return n, int64(len(data)), nil
+}
+
+// writeFileAtomic replaces path with data via a synced temp file and rename
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// spoolingReporter sends reports to next and spools whatever next cannot take. While a
+// backlog exists new reports queue behind it, so the replayer preserves their order.
+type spoolingReporter struct {
+	next   Reporter
+	spool  *Spool
+	logger *slog.Logger
+}
+
+// WithSpool wraps next so reports that fail to send are spooled instead of lost.
+// A spooled report counts as delivered; rejections are returned as-is.
+func WithSpool(next Reporter, spool *Spool, logger *slog.Logger) Reporter {
+	return &spoolingReporter{
+		next:   next,
+		spool:  spool,
+		logger: logger.With("module", "reporter.spool"),
+	}
+}
+
+func (r *spoolingReporter) ReportHTTPSamples(runID string, samples []domain.HTTPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return r.send(spoolHTTPSamples, runID, samples, func() error {
+		return r.next.ReportHTTPSamples(runID, samples)
+	})
+}
+
+func (r *spoolingReporter) ReportWSSamples(runID string, samples []domain.WSSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return r.send(spoolWSSamples, runID, samples, func() error {
+		return r.next.ReportWSSamples(runID, samples)
+	})
+}
+
+func (r *spoolingReporter) ReportUDPSamples(runID string, samples []domain.UDPSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	return r.send(spoolUDPSamples, runID, samples, func() error {
+		return r.next.ReportUDPSamples(runID, samples)
+	})
+}
+
+func (r *spoolingReporter) ReportIPCheck(runID string, result domain.IPCheckResult) error {
+	return r.send(spoolIPCheck, runID, result, func() error {
+		return r.next.ReportIPCheck(runID, result)
+	})
+}
+
+func (r *spoolingReporter) ReportSummary(runID string, summary domain.RunSummary) error {
+	return r.send(spoolSummary, runID, summary, func() error {
+		return r.next.ReportSummary(runID, summary)
+	})
+}
+
+func (r *spoolingReporter) ReportIncident(runID string, incident domain.Incident) error {
+	return r.send(spoolIncident, runID, incident, func() error {
+		return r.next.ReportIncident(runID, incident)
+	})
+}
+
+func (r *spoolingReporter) UpdateStatus(runID string, status string, errorMessage string) error {
+	payload := spoolStatusPayload{Status: status, ErrorMessage: errorMessage}
+	return r.send(spoolStatus, runID, payload, func() error {
+		return r.next.UpdateStatus(runID, status, errorMessage)
+	})
+}
+
+func (r *spoolingReporter) send(kind, runID string, payload any, call func() error) error {
+	if r.spool.Depth() == 0 {
+		err := call()
+		var rejected *RejectedError
+		if err == nil || errors.As(err, &rejected) {
+			return err
+		}
+		r.logger.Warn("Report spooled",
+			"run_id", runID,
+			"kind", kind,
+			"error_detail", err.Error(),
+		)
+	}
+
+	if err := r.spool.Append(kind, runID, payload); err != nil {
+		r.logger.Error("Spool append fail",
+			"run_id", runID,
+			"kind", kind,
+			"error_detail", err.Error(),
+		)
+		return err
+	}
+	return nil
+}
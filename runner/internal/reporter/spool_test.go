@@ -0,0 +1,392 @@
+package reporter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"proxy-stability-test/runner/internal/domain"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var errUnavailable = errors.New("connection refused")
+
+// fakeReporter records the incidents it takes by Seq. Call i returns errs[i] when that is
+// set, without recording the incident.
+type fakeReporter struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+	got   []int
+}
+
+func (f *fakeReporter) ReportIncident(runID string, incident domain.Incident) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.calls
+	f.calls++
+	if i < len(f.errs) && f.errs[i] != nil {
+		return f.errs[i]
+	}
+	f.got = append(f.got, incident.Seq)
+	return nil
+}
+
+func (f *fakeReporter) ReportHTTPSamples(string, []domain.HTTPSample) error { return nil }
+func (f *fakeReporter) ReportWSSamples(string, []domain.WSSample) error     { return nil }
+func (f *fakeReporter) ReportUDPSamples(string, []domain.UDPSample) error   { return nil }
+func (f *fakeReporter) ReportIPCheck(string, domain.IPCheckResult) error    { return nil }
+func (f *fakeReporter) ReportSummary(string, domain.RunSummary) error       { return nil }
+func (f *fakeReporter) UpdateStatus(string, string, string) error           { return nil }
+
+func openTestSpool(t *testing.T, dir string, limits SpoolLimits) *Spool {
+	t.Helper()
+	s, err := OpenSpool(dir, limits, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.closeActive()
+		s.mu.Unlock()
+	})
+	return s
+}
+
+func incidentEntry(t *testing.T, seq int, at time.Time) spoolEntry {
+	t.Helper()
+	payload, err := json.Marshal(domain.Incident{Seq: seq})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spoolEntry{Kind: spoolIncident, RunID: "run-1", SpooledAt: at.UTC().Truncate(time.Second), Payload: payload}
+}
+
+// writeSegment writes entries as segment seq of the spool in dir and returns its size
+func writeSegment(t *testing.T, dir string, seq uint64, entries ...spoolEntry) int64 {
+	t.Helper()
+	var data []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data))
+}
+
+func TestSpoolingReporterQueuesBehindBacklog(t *testing.T) {
+	tests := []struct {
+		name         string
+		errs         []error
+		wantDirect   []int
+		wantRejected int
+		wantDepth    int
+		wantReplayed []int
+	}{
+		{
+			name:       "delivered directly while nothing is spooled",
+			wantDirect: []int{1, 2, 3},
+		},
+		{
+			name:         "a failed send spools it and every report after it",
+			errs:         []error{errUnavailable},
+			wantDepth:    3,
+			wantReplayed: []int{1, 2, 3},
+		},
+		{
+			name:         "a failure mid-stream keeps the later reports behind it",
+			errs:         []error{nil, errUnavailable},
+			wantDirect:   []int{1},
+			wantDepth:    2,
+			wantReplayed: []int{2, 3},
+		},
+		{
+			name:         "a rejected send is returned, not spooled",
+			errs:         []error{&RejectedError{Reason: "bad payload"}},
+			wantDirect:   []int{2, 3},
+			wantRejected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spool := openTestSpool(t, t.TempDir(), SpoolLimits{})
+			next := &fakeReporter{errs: tt.errs}
+			rep := WithSpool(next, spool, discardLogger)
+
+			rejected := 0
+			for seq := 1; seq <= 3; seq++ {
+				err := rep.ReportIncident("run-1", domain.Incident{Seq: seq})
+				var rejectedErr *RejectedError
+				switch {
+				case errors.As(err, &rejectedErr):
+					rejected++
+				case err != nil:
+					t.Fatalf("incident %d: %v", seq, err)
+				}
+			}
+			if !reflect.DeepEqual(next.got, tt.wantDirect) {
+				t.Errorf("delivered directly %v, want %v", next.got, tt.wantDirect)
+			}
+			if rejected != tt.wantRejected {
+				t.Errorf("rejected %d, want %d", rejected, tt.wantRejected)
+			}
+			if got := spool.Depth(); got != tt.wantDepth {
+				t.Errorf("depth %d, want %d", got, tt.wantDepth)
+			}
+
+			replay := &fakeReporter{}
+			if err := spool.drain(replay); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(replay.got, tt.wantReplayed) {
+				t.Errorf("replayed %v, want %v", replay.got, tt.wantReplayed)
+			}
+			if got := spool.Depth(); got != 0 {
+				t.Errorf("depth after replay %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestSpoolDrainKeepsUndeliveredTail(t *testing.T) {
+	tests := []struct {
+		name       string
+		errs       []error
+		wantErr    bool
+		wantFirst  []int
+		wantDepth  int
+		wantSecond []int
+	}{
+		{
+			name:      "everything delivered",
+			wantFirst: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:       "failure mid-segment rewrites the tail",
+			errs:       []error{nil, nil, errUnavailable},
+			wantErr:    true,
+			wantFirst:  []int{1, 2},
+			wantDepth:  3,
+			wantSecond: []int{3, 4, 5},
+		},
+		{
+			name:       "failure on the first entry keeps the whole segment",
+			errs:       []error{errUnavailable},
+			wantErr:    true,
+			wantDepth:  5,
+			wantSecond: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:      "a rejected entry is dropped",
+			errs:      []error{nil, &RejectedError{Reason: "duplicate"}},
+			wantFirst: []int{1, 3, 4, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			spool := openTestSpool(t, dir, SpoolLimits{})
+			for seq := 1; seq <= 5; seq++ {
+				if err := spool.Append(spoolIncident, "run-1", domain.Incident{Seq: seq}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			first := &fakeReporter{errs: tt.errs}
+			if err := spool.drain(first); (err != nil) != tt.wantErr {
+				t.Fatalf("drain error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(first.got, tt.wantFirst) {
+				t.Errorf("first drain delivered %v, want %v", first.got, tt.wantFirst)
+			}
+			if got := spool.Depth(); got != tt.wantDepth {
+				t.Errorf("depth %d, want %d", got, tt.wantDepth)
+			}
+
+			// A restarted runner picks up exactly the tail
+			restarted := openTestSpool(t, dir, SpoolLimits{})
+			if got := restarted.Depth(); got != tt.wantDepth {
+				t.Errorf("depth after restart %d, want %d", got, tt.wantDepth)
+			}
+			if got, want := restarted.Stats().Bytes, spool.Stats().Bytes; got != want {
+				t.Errorf("bytes after restart %d, want %d", got, want)
+			}
+			second := &fakeReporter{}
+			if err := restarted.drain(second); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(second.got, tt.wantSecond) {
+				t.Errorf("second drain delivered %v, want %v", second.got, tt.wantSecond)
+			}
+			if stats := restarted.Stats(); stats.Entries != 0 || stats.Segments != 0 || stats.Bytes != 0 {
+				t.Errorf("stats after drain %+v, want empty", stats)
+			}
+		})
+	}
+}
+
+func TestOpenSpoolCountsBacklog(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name         string
+		segments     map[uint64][]spoolEntry
+		torn         bool // append a torn line to the last segment
+		wantEntries  int
+		wantAgeAbove float64
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "several segments",
+			segments: map[uint64][]spoolEntry{
+				3: {incidentEntry(t, 1, now.Add(-10*time.Minute)), incidentEntry(t, 2, now.Add(-5*time.Minute))},
+				7: {incidentEntry(t, 3, now)},
+			},
+			wantEntries:  3,
+			wantAgeAbove: 590,
+		},
+		{
+			name: "a torn final line counts until replay drops it",
+			segments: map[uint64][]spoolEntry{
+				1: {incidentEntry(t, 1, now.Add(-time.Minute))},
+			},
+			torn:         true,
+			wantEntries:  2,
+			wantAgeAbove: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var size int64
+			var last uint64
+			for seq, entries := range tt.segments {
+				size += writeSegment(t, dir, seq, entries...)
+				last = max(last, seq)
+			}
+			if tt.torn {
+				f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d%s", last, spoolSegmentExt)), os.O_WRONLY|os.O_APPEND, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				n, _ := f.WriteString(`{"kind":"incid`)
+				f.Close()
+				size += int64(n)
+			}
+			// Not segments: ignored
+			os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x\n"), 0o644)
+			os.WriteFile(filepath.Join(dir, "00000000000000000009.ndjson.tmp"), []byte("x\n"), 0o644)
+
+			spool := openTestSpool(t, dir, SpoolLimits{})
+			stats := spool.Stats()
+			if stats.Entries != tt.wantEntries || stats.Segments != len(tt.segments) || stats.Bytes != size {
+				t.Errorf("stats %+v, want %d entries, %d segments, %d bytes", stats, tt.wantEntries, len(tt.segments), size)
+			}
+			if tt.wantEntries == 0 && stats.OldestAgeSec != 0 {
+				t.Errorf("oldest age %v with nothing spooled", stats.OldestAgeSec)
+			}
+			if stats.OldestAgeSec < tt.wantAgeAbove || (tt.wantAgeAbove > 0 && stats.OldestAgeSec > tt.wantAgeAbove+120) {
+				t.Errorf("oldest age %v, want just over %v", stats.OldestAgeSec, tt.wantAgeAbove)
+			}
+
+			// New reports go after what the previous process left
+			if err := spool.Append(spoolIncident, "run-1", domain.Incident{Seq: 9}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(spool.path(last + 1)); err != nil {
+				t.Errorf("append after restart: %v", err)
+			}
+		})
+	}
+}
+
+func TestSpoolLimitsDropOldestSegments(t *testing.T) {
+	now := time.Now()
+	line, err := json.Marshal(incidentEntry(t, 1, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(line) + 1)
+
+	tests := []struct {
+		name          string
+		limits        SpoolLimits
+		wantDelivered []int
+		wantDropped   int64
+	}{
+		{
+			name:          "no limits",
+			wantDelivered: []int{1, 2, 3, 4},
+		},
+		{
+			name:          "max age drops segments that start too long ago",
+			limits:        SpoolLimits{MaxAge: 150 * time.Minute},
+			wantDelivered: []int{3, 4},
+			wantDropped:   2,
+		},
+		{
+			name:          "max bytes drops the oldest segment",
+			limits:        SpoolLimits{MaxBytes: 2 * lineSize},
+			wantDelivered: []int{3, 4},
+			wantDropped:   2,
+		},
+		{
+			name:          "max bytes keeps dropping until under the limit",
+			limits:        SpoolLimits{MaxBytes: lineSize},
+			wantDelivered: []int{4},
+			wantDropped:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSegment(t, dir, 1, incidentEntry(t, 1, now.Add(-3*time.Hour)), incidentEntry(t, 2, now.Add(-3*time.Hour)))
+			writeSegment(t, dir, 2, incidentEntry(t, 3, now.Add(-2*time.Hour)))
+			writeSegment(t, dir, 3, incidentEntry(t, 4, now))
+
+			spool := openTestSpool(t, dir, tt.limits)
+			target := &fakeReporter{}
+			if err := spool.drain(target); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(target.got, tt.wantDelivered) {
+				t.Errorf("delivered %v, want %v", target.got, tt.wantDelivered)
+			}
+			if got := spool.Stats().Dropped; got != tt.wantDropped {
+				t.Errorf("dropped %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestSpoolAppendEnforcesMaxBytes(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), SpoolLimits{MaxBytes: 1024})
+	for seq := 1; seq <= 20; seq++ {
+		if err := spool.Append(spoolIncident, "run-1", domain.Incident{Seq: seq}); err != nil {
+			t.Fatal(err)
+		}
+		if stats := spool.Stats(); stats.Bytes > 1024 {
+			t.Fatalf("after append %d the spool holds %d bytes, over its 1024 limit", seq, stats.Bytes)
+		}
+	}
+	stats := spool.Stats()
+	if stats.Dropped == 0 || int64(stats.Entries)+stats.Dropped != 20 {
+		t.Errorf("stats %+v: want drops, and entries plus drops to be 20", stats)
+	}
+}
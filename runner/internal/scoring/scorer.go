@@ -7,13 +7,15 @@ import (
 	"proxy-stability-test/runner/internal/domain"
 )
 
-// Weights for 5-component scoring
+// Weights for 5-component scoring, plus the optional UDP component.
+// Weights of skipped components are redistributed proportionally.
 const (
 	wUptime   = 0.25
 	wLatency  = 0.25
 	wJitter   = 0.15
 	wWS       = 0.15
 	wSecurity = 0.20
+	wUDP      = 0.15
 )
 
 // ComputeScore calculates the overall score for a run summary
@@ -49,6 +51,7 @@ func ComputeScore(summary *domain.RunSummary, cfg domain.ScoringConfig) {
 	// Determine which phases are active
 	hasWS := summary.WSSampleCount > 0
 	hasSecurity := summary.IPClean != nil
+	hasUDP := summary.UDPSampleCount > 0
 
 	// S_ws = 0.4*(1-wsErrorRate) + 0.3*(1-wsDropRate) + 0.3*wsHoldRatio
 	if hasWS {
@@ -87,39 +90,27 @@ func ComputeScore(summary *domain.RunSummary, cfg domain.ScoringConfig) {
 		summary.ScoreSecurity = 0.30*ipCleanVal + 0.25*geoMatch + 0.25*ipStable + 0.20*tlsScore
 	}
 
-	// Weight redistribution
-	switch {
-	case hasWS && hasSecurity:
-		// All 5 components
-		summary.ScoreTotal = wUptime*summary.ScoreUptime +
-			wLatency*summary.ScoreLatency +
-			wJitter*summary.ScoreJitter +
-			wWS*summary.ScoreWS +
-			wSecurity*summary.ScoreSecurity
-
-	case !hasWS && hasSecurity:
-		// WS skipped: redistribute to U, L, J, S
-		total := wUptime + wLatency + wJitter + wSecurity // 0.85
-		summary.ScoreTotal = (wUptime/total)*summary.ScoreUptime +
-			(wLatency/total)*summary.ScoreLatency +
-			(wJitter/total)*summary.ScoreJitter +
-			(wSecurity/total)*summary.ScoreSecurity
-
-	case hasWS && !hasSecurity:
-		// Security skipped: redistribute to U, L, J, WS
-		total := wUptime + wLatency + wJitter + wWS // 0.80
-		summary.ScoreTotal = (wUptime/total)*summary.ScoreUptime +
-			(wLatency/total)*summary.ScoreLatency +
-			(wJitter/total)*summary.ScoreJitter +
-			(wWS/total)*summary.ScoreWS
+	// S_udp = 0.4*(1-lossRate) + 0.25*rttScore + 0.25*jitterScore + 0.1*(1-reorderRate)
+	if hasUDP {
+		summary.ScoreUDP = udpScore(summary, cfg)
+	}
 
-	default:
-		// Both skipped (Sprint 1/2 compat): U, L, J only
-		total := wUptime + wLatency + wJitter // 0.65
-		summary.ScoreTotal = (wUptime/total)*summary.ScoreUptime +
-			(wLatency/total)*summary.ScoreLatency +
-			(wJitter/total)*summary.ScoreJitter
+	// Weight redistribution: only active components count, normalized by their total weight
+	weighted := wUptime*summary.ScoreUptime + wLatency*summary.ScoreLatency + wJitter*summary.ScoreJitter
+	total := wUptime + wLatency + wJitter
+	if hasWS {
+		weighted += wWS * summary.ScoreWS
+		total += wWS
+	}
+	if hasSecurity {
+		weighted += wSecurity * summary.ScoreSecurity
+		total += wSecurity
+	}
+	if hasUDP {
+		weighted += wUDP * summary.ScoreUDP
+		total += wUDP
 	}
+	summary.ScoreTotal = weighted / total
 
 	slog.Info("Score computed",
 		"module", "scoring.scorer",
@@ -130,13 +121,34 @@ func ComputeScore(summary *domain.RunSummary, cfg domain.ScoringConfig) {
 		"score_jitter", round(summary.ScoreJitter, 4),
 		"score_ws", round(summary.ScoreWS, 4),
 		"score_security", round(summary.ScoreSecurity, 4),
+		"score_udp", round(summary.ScoreUDP, 4),
 		"score_total", round(summary.ScoreTotal, 4),
 		"grade", ComputeGrade(summary.ScoreTotal),
 		"has_ws", hasWS,
 		"has_security", hasSecurity,
+		"has_udp", hasUDP,
 	)
 }
 
+// udpScore grades UDP ASSOCIATE sessions; loss dominates since games/VoIP degrade fastest on it
+func udpScore(summary *domain.RunSummary, cfg domain.ScoringConfig) float64 {
+	if summary.UDPSuccessCount == 0 {
+		// No session ever got a relay → UDP score is 0
+		return 0
+	}
+
+	rttScore := 1.0
+	if summary.UDPRTTP95MS > 0 {
+		rttScore = clamp(1.0-(summary.UDPRTTP95MS/cfg.LatencyThresholdMs), 0, 1)
+	}
+	jitterScore := 1.0
+	if summary.UDPJitterMS > 0 {
+		jitterScore = clamp(1.0-(summary.UDPJitterMS/cfg.JitterThresholdMs), 0, 1)
+	}
+
+	return 0.4*(1-summary.UDPLossRate) + 0.25*rttScore + 0.25*jitterScore + 0.1*(1-clamp(summary.UDPReorderRate, 0, 1))
+}
+
 // ipCleanGradient computes a gradient score based on blacklist ratio
 // Sprint 4: replaces binary (0 or 1) with 1 - (listed/queried)
 func ipCleanGradient(summary *domain.RunSummary) float64 {
@@ -3,41 +3,96 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"sync"
+	"time"
 
+	"proxy-stability-test/runner/internal/alert"
 	"proxy-stability-test/runner/internal/config"
 	"proxy-stability-test/runner/internal/domain"
 	"proxy-stability-test/runner/internal/engine"
+	"proxy-stability-test/runner/internal/metrics"
+	"proxy-stability-test/runner/internal/reporter"
+	"proxy-stability-test/runner/internal/stream"
 )
 
+// streamHeartbeat keeps idle live streams open through proxies that time out silent
+// connections
+const streamHeartbeat = 15 * time.Second
+
 // Handler manages HTTP endpoints for the Runner service
 type Handler struct {
-	logger     *slog.Logger
-	apiURL     string
-	dbURL      string
-	scheduler  *engine.Scheduler
-	mu         sync.Mutex
-	cancelFns  map[string]context.CancelFunc
+	logger    *slog.Logger
+	scheduler *engine.Scheduler
+	reporter  *reporter.FanOut
+	live      *stream.Hub
+	mu        sync.Mutex
+	cancelFns map[string]context.CancelFunc
 }
 
-// NewHandler creates a new Handler
-func NewHandler(logger *slog.Logger, apiURL, dbURL string) *Handler {
-	return &Handler{
+// NewHandler creates a new Handler; every run reports to rep's sinks and alerts through alerts
+func NewHandler(logger *slog.Logger, rep *reporter.FanOut, alerts *alert.Manager) *Handler {
+	live := stream.NewHub()
+	h := &Handler{
 		logger:    logger.With("module", "server.handler"),
-		apiURL:    apiURL,
-		dbURL:     dbURL,
-		scheduler: engine.NewScheduler(10, logger),
+		scheduler: engine.NewScheduler(10, rep, alerts, live, logger),
+		reporter:  rep,
+		live:      live,
 		cancelFns: make(map[string]context.CancelFunc),
 	}
+
+	metrics.Default.NewGaugeFunc("runner_active_runs", "Runs currently executing", func() float64 {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return float64(len(h.cancelFns))
+	})
+	metrics.Default.NewGaugeVecFunc("runner_reporter_sink_up", "1 while the sink's last delivery succeeded",
+		func(set func(float64, ...string)) {
+			for _, sink := range rep.Health() {
+				up := 0.0
+				if sink.ConsecutiveFailures == 0 {
+					up = 1
+				}
+				set(up, sink.Name)
+			}
+		}, "sink")
+	metrics.Default.NewGaugeVecFunc("runner_spool_entries", "Reports waiting in a sink's spool for replay",
+		func(set func(float64, ...string)) {
+			for name, spool := range rep.Spools() {
+				set(float64(spool.Depth()), name)
+			}
+		}, "sink")
+	metrics.Default.NewGaugeVecFunc("runner_spool_oldest_age_seconds", "Age of the oldest report in a sink's spool",
+		func(set func(float64, ...string)) {
+			for name, spool := range rep.Spools() {
+				set(spool.Stats().OldestAgeSec, name)
+			}
+		}, "sink")
+	metrics.Default.NewCounterVecFunc("runner_spool_dropped_total", "Reports a sink's spool dropped over its size or age limit",
+		func(set func(float64, ...string)) {
+			for name, spool := range rep.Spools() {
+				set(float64(spool.Stats().Dropped), name)
+			}
+		}, "sink")
+	metrics.Default.NewGaugeFunc("runner_stream_subscribers", "Open live stream connections", func() float64 {
+		return float64(live.Subscribers())
+	})
+	return h
 }
 
 // RegisterRoutes registers HTTP endpoints
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /health", h.handleHealth)
+	mux.HandleFunc("GET /metrics", h.handleMetrics)
 	mux.HandleFunc("POST /trigger", h.handleTrigger)
 	mux.HandleFunc("POST /stop", h.handleStop)
+	mux.HandleFunc("GET /runs", h.handleListRuns)
+	mux.HandleFunc("GET /runs/{run_id}", h.handleGetRun)
+	mux.HandleFunc("PATCH /runs/{run_id}", h.handlePatchRun)
+	mux.HandleFunc("GET /runs/{run_id}/stream", h.handleStream)
 }
 
 func (h *Handler) handleHealth(w http.ResponseWriter, _ *http.Request) {
@@ -45,11 +100,24 @@ func (h *Handler) handleHealth(w http.ResponseWriter, _ *http.Request) {
 	activeRuns := len(h.cancelFns)
 	h.mu.Unlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	health := map[string]interface{}{
 		"status":      "ok",
 		"active_runs": activeRuns,
-	})
+	}
+	health["sinks"] = h.reporter.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// handleMetrics serves runner metrics in the Prometheus text format
+func (h *Handler) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.Default.WriteText(w); err != nil {
+		h.logger.Warn("Metrics write fail",
+			"error_detail", err.Error(),
+		)
+	}
 }
 
 func (h *Handler) handleTrigger(w http.ResponseWriter, r *http.Request) {
@@ -67,6 +135,80 @@ func (h *Handler) handleTrigger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, tr := range payload.Runs {
+		if !config.IsSupportedProtocol(tr.Proxy.Protocol) {
+			h.logger.Error("Unsupported proxy protocol",
+				"run_id", tr.RunID,
+				"proxy_protocol", tr.Proxy.Protocol,
+			)
+			http.Error(w, `{"error":"unsupported proxy protocol"}`, http.StatusBadRequest)
+			return
+		}
+		if !config.IsSupportedIPFamily(tr.Config.IPFamily) {
+			h.logger.Error("Unsupported IP family",
+				"run_id", tr.RunID,
+				"ip_family", tr.Config.IPFamily,
+			)
+			http.Error(w, `{"error":"ip_family must be auto, ipv4 or ipv6"}`, http.StatusBadRequest)
+			return
+		}
+		if !config.IsSupportedRunMode(tr.Config) {
+			h.logger.Error("Invalid run mode",
+				"run_id", tr.RunID,
+				"run_mode", tr.Config.RunMode,
+				"duration_sec", tr.Config.DurationSec,
+				"target_samples", tr.Config.TargetSamples,
+			)
+			http.Error(w, `{"error":"run_mode must be continuous or fixed; fixed needs duration_sec or target_samples"}`, http.StatusBadRequest)
+			return
+		}
+		if !config.IsSupportedIncidentConfig(tr.Config.IncidentConfig) {
+			h.logger.Error("Invalid incident config",
+				"run_id", tr.RunID,
+			)
+			http.Error(w, `{"error":"incident_config values cannot be negative and error_rate_threshold must be at most 1"}`, http.StatusBadRequest)
+			return
+		}
+		if !config.IsSupportedLoadProfile(tr.Config.LoadProfile) {
+			h.logger.Error("Invalid load profile",
+				"run_id", tr.RunID,
+				"load_profile", tr.Config.LoadProfile.Type,
+			)
+			http.Error(w, `{"error":"load_profile type must be ramp, step, spike or sine, with no negative values and spikes shorter than period_sec"}`, http.StatusBadRequest)
+			return
+		}
+		if !config.IsSupportedRotation(tr.Proxy.Rotation, tr.Proxy.AuthUser) {
+			h.logger.Error("Invalid proxy rotation",
+				"run_id", tr.RunID,
+				"rotation_mode", tr.Proxy.Rotation.Mode,
+				"has_auth_user", tr.Proxy.AuthUser != "",
+			)
+			http.Error(w, `{"error":"rotation mode must be none, sticky or per_request; sticky needs auth_user"}`, http.StatusBadRequest)
+			return
+		}
+		if tr.Proxy.Protocol == domain.ProtocolMASQUE && (len(tr.Proxy.Chain) > 0 || tr.Target.HTTP3URL == "") {
+			// CONNECT-UDP runs over QUIC, which the TCP hops of a chain cannot carry
+			h.logger.Error("Invalid masque run",
+				"run_id", tr.RunID,
+				"chain_length", len(tr.Proxy.Chain),
+				"has_http3_target", tr.Target.HTTP3URL != "",
+			)
+			http.Error(w, `{"error":"masque proxy requires target http3_url and no chain"}`, http.StatusBadRequest)
+			return
+		}
+		for i, hop := range tr.Proxy.Chain {
+			if !config.IsSupportedProtocol(hop.Protocol) || hop.Protocol == domain.ProtocolMASQUE || hop.Host == "" || hop.Port <= 0 {
+				h.logger.Error("Invalid proxy chain hop",
+					"run_id", tr.RunID,
+					"hop", i,
+					"hop_protocol", hop.Protocol,
+				)
+				http.Error(w, `{"error":"invalid proxy chain hop"}`, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	h.logger.Info("Trigger received",
 		"run_count", len(payload.Runs),
 		"run_ids", runIDs(payload.Runs),
@@ -74,8 +216,13 @@ func (h *Handler) handleTrigger(w http.ResponseWriter, r *http.Request) {
 
 	// Build configs and register individual cancel functions for isolation
 	accepted := 0
+	rejected := []map[string]string{}
 	for _, tr := range payload.Runs {
 		cfg := config.FromTrigger(tr)
+		if err := h.scheduler.StartRun(cfg.RunID); err != nil {
+			rejected = append(rejected, map[string]string{"run_id": cfg.RunID, "error": err.Error()})
+			continue
+		}
 
 		ctx, cancel := context.WithCancel(context.Background())
 
@@ -93,14 +240,24 @@ func (h *Handler) handleTrigger(w http.ResponseWriter, r *http.Request) {
 				cancelFn()
 			}()
 
-			h.scheduler.RunSingle(ctx, c, h.apiURL, h.dbURL)
+			h.scheduler.RunSingle(ctx, c)
 		}(cfg, cancel)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if accepted == 0 {
+		// Every run was refused because a required reporter sink is down
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "required reporter sink unavailable",
+			"rejected": rejected,
+		})
+		return
+	}
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"accepted": accepted,
+		"rejected": rejected,
 	})
 }
 
@@ -137,6 +294,122 @@ func (h *Handler) handleStop(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleListRuns lists active runs, and runs that finished in the last few minutes
+func (h *Handler) handleListRuns(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"runs": h.scheduler.Runs(),
+	})
+}
+
+// handleGetRun returns one run's phase, sample counts, last summary, bursts and goroutines
+func (h *Handler) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	status, ok := h.scheduler.Run(r.PathValue("run_id"))
+	if !ok {
+		http.Error(w, `{"error":"run not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handlePatchRun changes a running run's rates, burst settings or scoring thresholds
+func (h *Handler) handlePatchRun(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("run_id")
+	var patch domain.RunConfigPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		h.logger.Error("Invalid run patch",
+			"run_id", runID,
+			"error_detail", err.Error(),
+		)
+		http.Error(w, `{"error":"invalid payload"}`, http.StatusBadRequest)
+		return
+	}
+	if err := config.ValidatePatch(patch); err != nil {
+		h.logger.Error("Invalid run patch",
+			"run_id", runID,
+			"error_detail", err.Error(),
+		)
+		body, _ := json.Marshal(map[string]string{"error": err.Error()})
+		http.Error(w, string(body), http.StatusBadRequest)
+		return
+	}
+
+	changes, err := h.scheduler.Reconfigure(runID, patch)
+	switch {
+	case errors.Is(err, engine.ErrRunNotFound):
+		http.Error(w, `{"error":"run not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, engine.ErrRunFinished):
+		http.Error(w, `{"error":"run already finished"}`, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"run_id":  runID,
+		"changes": changes,
+	})
+}
+
+// handleStream sends a running run's samples, summaries, IP changes and bursts as
+// Server-Sent Events as they happen. A subscriber that cannot keep up misses events and
+// gets a "lagged" event with the count; the stream ends with the run.
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	runID := r.PathValue("run_id")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"streaming unsupported"}`, http.StatusInternalServerError)
+		return
+	}
+	sub, ok := h.live.Subscribe(runID)
+	if !ok {
+		http.Error(w, `{"error":"run not found"}`, http.StatusNotFound)
+		return
+	}
+	defer h.live.Unsubscribe(runID, sub)
+
+	h.logger.Info("Stream subscriber connected",
+		"run_id", runID,
+		"remote_addr", r.RemoteAddr,
+	)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			h.logger.Info("Stream subscriber disconnected",
+				"run_id", runID,
+				"remote_addr", r.RemoteAddr,
+			)
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-sub.Events():
+			if !ok {
+				fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				fmt.Fprintf(w, "event: lagged\ndata: {\"dropped\":%d}\n\n", dropped)
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+		}
+		flusher.Flush()
+	}
+}
+
 func runIDs(runs []domain.TriggerRun) []string {
 	ids := make([]string, len(runs))
 	for i, r := range runs {
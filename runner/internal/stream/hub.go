@@ -0,0 +1,196 @@
+// Package stream fans a run's live events (samples, summaries, IP changes, bursts) out
+// to Server-Sent Events subscribers as they happen, ahead of batched reporting
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"proxy-stability-test/runner/internal/metrics"
+)
+
+// Event types, sent as the SSE event field
+const (
+	EventHTTPSample    = "http_sample"
+	EventWSSample      = "ws_sample"
+	EventUDPSample     = "udp_sample"
+	EventSummary       = "summary"
+	EventWindowSummary = "window_summary"
+	EventFinalSummary  = "final_summary"
+	EventIPChange      = "ip_change"
+	EventBurst         = "burst"
+	EventStatus        = "status"
+	EventConfigChange  = "config_change"
+	EventIncident      = "incident"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before
+// events are dropped for it
+const subscriberBuffer = 1024
+
+// Event is one published event; Data is its JSON payload
+type Event struct {
+	ID   uint64
+	Type string
+	Data []byte
+}
+
+// Hub holds one topic per running run. It is shared by all runs; a nil Hub ignores
+// everything, so callers need not check whether streaming is wired up.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]*topic
+}
+
+type topic struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[*Subscription]struct{}
+}
+
+// Subscription receives one run's events until the run ends or it is cancelled
+type Subscription struct {
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// NewHub returns an empty Hub
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]*topic)}
+}
+
+// Open starts accepting subscribers for runID
+func (h *Hub) Open(runID string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.topics[runID]; !ok {
+		h.topics[runID] = &topic{subs: make(map[*Subscription]struct{})}
+	}
+}
+
+// End closes every subscription to runID; their streams finish after the last event
+func (h *Hub) End(runID string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	t, ok := h.topics[runID]
+	delete(h.topics, runID)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for sub := range t.subs {
+		close(sub.events)
+	}
+	t.subs = nil
+}
+
+// Subscribe returns a subscription to runID, or false if the run is not open
+func (h *Hub) Subscribe(runID string) (*Subscription, bool) {
+	if h == nil {
+		return nil, false
+	}
+	h.mu.RLock()
+	t, ok := h.topics[runID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subs == nil {
+		return nil, false // ended between the lookup and now
+	}
+	sub := &Subscription{events: make(chan Event, subscriberBuffer)}
+	t.subs[sub] = struct{}{}
+	return sub, true
+}
+
+// Unsubscribe stops delivery to sub; safe to call after the run ended
+func (h *Hub) Unsubscribe(runID string, sub *Subscription) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	t, ok := h.topics[runID]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.subs[sub]; ok {
+		delete(t.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Subscribers counts open subscriptions across all runs
+func (h *Hub) Subscribers() int {
+	if h == nil {
+		return 0
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, t := range h.topics {
+		t.mu.Lock()
+		n += len(t.subs)
+		t.mu.Unlock()
+	}
+	return n
+}
+
+// Publish sends v as an event of eventType to runID's subscribers. It never blocks: a
+// subscriber whose buffer is full misses the event and is told how many it missed.
+func (h *Hub) Publish(runID, eventType string, v any) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	t, ok := h.topics[runID]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.subs) == 0 {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	t.nextID++
+	ev := Event{ID: t.nextID, Type: eventType, Data: data}
+	for sub := range t.subs {
+		select {
+		case sub.events <- ev:
+		default:
+			sub.dropped.Add(1)
+			metrics.StreamDropped()
+		}
+	}
+}
+
+// Events delivers the run's events; it is closed when the run ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// TakeDropped returns how many events were dropped since the last call
+func (s *Subscription) TakeDropped() int64 {
+	return s.dropped.Swap(0)
+}
@@ -0,0 +1,56 @@
+// Package tracing exports probe spans over OTLP/HTTP to a collector
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Setup installs a global tracer provider that batches spans to the OTLP/HTTP collector
+// named by OTEL_EXPORTER_OTLP_ENDPOINT (e.g. http://otel-collector:4318) and propagates
+// W3C trace context. The other standard OTEL_* variables (headers, sampler, service
+// name) apply as usual. Call the returned shutdown to flush pending spans.
+func Setup(ctx context.Context, logger *slog.Logger) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "proxy-stability-runner")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	// Export failures are logged rather than printed by the SDK's default handler
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("Trace export fail",
+			"module", "tracing",
+			"error_detail", err.Error(),
+		)
+	}))
+
+	return provider.Shutdown, nil
+}
@@ -10,6 +10,8 @@ import { largeRouter } from './routes/large';
 import { slowRouter } from './routes/slow';
 import { healthRouter } from './routes/health';
 import { setupWsEcho } from './ws/wsEcho';
+import { startUdpEcho } from './udp/udpEcho';
+import { observedIp, OBSERVED_IP_HEADER } from './observedIp';
 
 const logger = pino({ name: 'target', level: process.env.LOG_LEVEL || 'info' });
 
@@ -17,6 +19,12 @@ const app = express();
 app.use(express.json({ limit: '10mb' }));
 app.use(express.urlencoded({ extended: true }));
 
+// Every response carries the peer address so samples can record the egress IP family
+app.use((req, res, next) => {
+  res.set(OBSERVED_IP_HEADER, observedIp(req.socket.remoteAddress));
+  next();
+});
+
 // Mount routes
 app.use('/health', healthRouter);
 app.use('/echo', echoRouter);
@@ -77,11 +85,15 @@ try {
 const wsServer = new WebSocketServer({ server: httpServer, path: '/ws-echo' });
 setupWsEcho(wsServer, logger, 3001, 'http');
 
+// UDP echo (:3002) for SOCKS5 UDP ASSOCIATE tests
+const udpServer = startUdpEcho(logger, 3002);
+
 // Graceful shutdown
 const shutdown = () => {
   logger.info({ module: 'index' }, 'Shutting down...');
   httpServer.close();
   if (httpsServer) httpsServer.close();
+  udpServer.close();
   process.exit(0);
 };
 
@@ -0,0 +1,11 @@
+// Normalizes the socket peer address the target reports back to the runner.
+// Dual-stack listeners see IPv4 peers as IPv4-mapped IPv6 (::ffff:1.2.3.4); those are unmapped
+// so the runner can tell which family the proxy actually egressed on.
+export function observedIp(remoteAddress: string | undefined): string {
+  if (!remoteAddress) return 'unknown';
+  return remoteAddress.startsWith('::ffff:') && remoteAddress.includes('.')
+    ? remoteAddress.slice('::ffff:'.length)
+    : remoteAddress;
+}
+
+export const OBSERVED_IP_HEADER = 'X-Observed-IP';
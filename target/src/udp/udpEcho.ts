@@ -0,0 +1,50 @@
+import dgram from 'dgram';
+import type { Logger } from 'pino';
+
+// Echoes every datagram back to its sender unchanged.
+// The runner reaches this through a SOCKS5 UDP relay, so the sender is the relay.
+export function startUdpEcho(logger: Logger, port: number): dgram.Socket {
+  // Dual-stack so IPv6-pinned runs can reach it too
+  const socket = dgram.createSocket({ type: 'udp6', ipv6Only: false });
+  let datagrams = 0;
+
+  socket.on('message', (msg, rinfo) => {
+    datagrams++;
+    socket.send(msg, rinfo.port, rinfo.address, (err) => {
+      if (err) {
+        logger.warn({
+          module: 'udp.udpEcho',
+          client_ip: rinfo.address,
+          client_port: rinfo.port,
+          error: err.message,
+        }, 'UDP echo send fail');
+      }
+    });
+  });
+
+  socket.on('error', (err) => {
+    logger.error({
+      module: 'udp.udpEcho',
+      port,
+      error: err.message,
+    }, 'UDP echo socket error');
+  });
+
+  socket.on('close', () => {
+    logger.info({
+      module: 'udp.udpEcho',
+      port,
+      datagrams,
+    }, 'UDP echo stopped');
+  });
+
+  socket.bind(port, () => {
+    logger.info({
+      module: 'index',
+      protocol: 'udp',
+      port,
+    }, 'UDP echo server started');
+  });
+
+  return socket;
+}
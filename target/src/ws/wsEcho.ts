@@ -1,8 +1,13 @@
 import { WebSocketServer, WebSocket } from 'ws';
 import type { Logger } from 'pino';
 import { URL } from 'url';
+import { observedIp, OBSERVED_IP_HEADER } from '../observedIp';
 
 export function setupWsEcho(wss: WebSocketServer, logger: Logger, port: number, protocol: string) {
+  wss.on('headers', (headers, req) => {
+    headers.push(`${OBSERVED_IP_HEADER}: ${observedIp(req.socket.remoteAddress)}`);
+  });
+
   wss.on('connection', (ws: WebSocket, req) => {
     const clientIp = req.socket.remoteAddress || 'unknown';
     const startTime = Date.now();